@@ -16,11 +16,7 @@ package main
 
 import (
 	"context"
-
-	"os"
-	"os/signal"
 	"strings"
-	"syscall"
 
 	"github.com/koupleless/virtual-kubelet/commands/root"
 	"github.com/pkg/errors"
@@ -38,13 +34,8 @@ var (
 )
 
 func main() {
-	ctx, cancel := context.WithCancel(context.Background())
-	sig := make(chan os.Signal, 1)
-	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
-	go func() {
-		<-sig
-		cancel()
-	}()
+	// shutdown signals are handled by the root command
+	ctx := context.Background()
 
 	log.L = logruslogger.FromLogrus(logrus.NewEntry(logrus.StandardLogger()))
 	trace.T = opencensus.Adapter{}
@@ -56,7 +47,6 @@ func main() {
 	rootCmd := root.NewCommand(ctx, opts)
 	preRun := rootCmd.PreRunE
 
-	var logLevel string
 	rootCmd.PreRunE = func(cmd *cobra.Command, args []string) error {
 		if optsErr != nil {
 			return optsErr
@@ -67,19 +57,6 @@ func main() {
 		return nil
 	}
 
-	rootCmd.PersistentFlags().StringVar(&logLevel, "log-level", "info", `set the log level, e.g. "debug", "info", "warn", "error"`)
-
-	rootCmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
-		if logLevel != "" {
-			lvl, err := logrus.ParseLevel(logLevel)
-			if err != nil {
-				return errors.Wrap(err, "could not parse log level")
-			}
-			logrus.SetLevel(lvl)
-		}
-		return nil
-	}
-
 	if err := rootCmd.Execute(); err != nil && errors.Cause(err) != context.Canceled {
 		log.G(ctx).Fatal(err)
 	}
@@ -0,0 +1,62 @@
+package root
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+// loadConfigFile load options from the yaml file into c, values of flags changed on command line take precedence over the file.
+// Unknown keys in the file are rejected.
+func loadConfigFile(path string, flags *pflag.FlagSet, c *Opts) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading config file: %w", err)
+	}
+
+	fileOpts := *c
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	// an empty file decodes to io.EOF
+	if err = decoder.Decode(&fileOpts); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+	err = nil
+	if fileOpts.TraceConfig.Tags == nil {
+		fileOpts.TraceConfig.Tags = make(map[string]string)
+	}
+
+	// apply the changed flags again on the file values
+	fileFlags := pflag.NewFlagSet("config", pflag.ContinueOnError)
+	installFlags(fileFlags, &fileOpts)
+	flags.Visit(func(flag *pflag.Flag) {
+		if err != nil {
+			return
+		}
+		target := fileFlags.Lookup(flag.Name)
+		if target == nil {
+			return
+		}
+		switch value := flag.Value.(type) {
+		case mapVar:
+			for k, v := range value {
+				fileOpts.TraceConfig.Tags[k] = v
+			}
+		case pflag.SliceValue:
+			err = target.Value.(pflag.SliceValue).Replace(value.GetSlice())
+		default:
+			err = target.Value.Set(value.String())
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("applying flags over config file: %w", err)
+	}
+
+	*c = fileOpts
+	return nil
+}
@@ -0,0 +1,61 @@
+package root
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/pflag"
+	"gotest.tools/assert"
+)
+
+func writeConfigFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	assert.NilError(t, os.WriteFile(path, []byte(content), 0600))
+	return path
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	path := writeConfigFile(t, `
+mqttBroker: broker.example.com
+mqttPort: 1883
+mqttPassword: secret
+mqttDedupTTL: 30s
+traceExporters: [jaeger]
+leaderElection: true
+`)
+	c := Opts{TraceConfig: TracingExporterOptions{Tags: map[string]string{}}}
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	installFlags(flags, &c)
+	assert.NilError(t, flags.Parse([]string{"--config", path, "--mqtt-port", "8883", "--trace-exporter", "ocagent"}))
+
+	assert.NilError(t, loadConfigFile(c.ConfigPath, flags, &c))
+	assert.Equal(t, c.MqttBroker, "broker.example.com")
+	assert.Equal(t, c.MqttPassword, "secret")
+	assert.Equal(t, c.MqttDedupTTL, 30*time.Second)
+	assert.Assert(t, c.LeaderElection)
+	// flags override file values
+	assert.Equal(t, c.MqttPort, 8883)
+	assert.DeepEqual(t, c.TraceExporters, []string{"ocagent"})
+}
+
+func TestLoadConfigFile_UnknownKey(t *testing.T) {
+	path := writeConfigFile(t, "mqttBrokers: broker.example.com\n")
+	c := Opts{}
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	installFlags(flags, &c)
+
+	err := loadConfigFile(path, flags, &c)
+	assert.ErrorContains(t, err, "mqttBrokers")
+}
+
+func TestLoadConfigFile_Empty(t *testing.T) {
+	path := writeConfigFile(t, "")
+	c := Opts{MqttBroker: "default"}
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	installFlags(flags, &c)
+
+	assert.NilError(t, loadConfigFile(path, flags, &c))
+	assert.Equal(t, c.MqttBroker, "default")
+}
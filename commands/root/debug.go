@@ -0,0 +1,22 @@
+package root
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/koupleless/virtual-kubelet/java/controller"
+)
+
+// newDebugHandler serves /debug/nodes dumping the controller state of each managed node as json
+func newDebugHandler(dumpNodes func() []controller.NodeDebugInfo) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/nodes", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(dumpNodes()); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+	return mux
+}
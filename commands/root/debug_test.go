@@ -0,0 +1,38 @@
+package root
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/koupleless/virtual-kubelet/java/controller"
+	"gotest.tools/assert"
+)
+
+func TestNewDebugHandler(t *testing.T) {
+	handler := newDebugHandler(func() []controller.NodeDebugInfo {
+		return []controller.NodeDebugInfo{
+			{
+				NodeID: "test-device",
+				PendingCommands: []controller.PendingCommand{
+					{Command: "installBiz", BizIdentity: "biz1:0.0.1"},
+				},
+			},
+		}
+	})
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/debug/nodes", nil))
+	assert.Equal(t, recorder.Code, http.StatusOK)
+	assert.Equal(t, recorder.Header().Get("Content-Type"), "application/json")
+
+	var nodes []controller.NodeDebugInfo
+	assert.NilError(t, json.Unmarshal(recorder.Body.Bytes(), &nodes))
+	assert.Equal(t, len(nodes), 1)
+	assert.Equal(t, nodes[0].NodeID, "test-device")
+	assert.Equal(t, nodes[0].PendingCommands[0].BizIdentity, "biz1:0.0.1")
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/debug/other", nil))
+	assert.Equal(t, recorder.Code, http.StatusNotFound)
+}
@@ -58,7 +58,9 @@ func (mv mapVar) Type() string {
 }
 
 func installFlags(flags *pflag.FlagSet, c *Opts) {
-	flags.StringVar(&c.KubeConfigPath, "kubeconfig", c.KubeConfigPath, "kube config file to use for connecting to the Kubernetes API server")
+	flags.StringVar(&c.ConfigPath, "config", c.ConfigPath, "yaml file to load options from, flags override file values")
+	flags.StringVar(&c.KubeConfigPath, "kubeconfig", c.KubeConfigPath, "kube config file to use for connecting to the Kubernetes API server, the in-cluster config is used if empty")
+	flags.BoolVar(&c.KubeConfigInCluster, "kubeconfig-incluster", c.KubeConfigInCluster, "use the in-cluster service account config for connecting to the Kubernetes API server")
 	flags.StringVar(&c.OperatingSystem, "os", c.OperatingSystem, "Operating System (Linux/Windows)")
 
 	flags.IntVar(&c.PodSyncWorkers, "pod-sync-workers", c.PodSyncWorkers, `set the number of pod synchronization workers`)
@@ -67,13 +69,39 @@ func installFlags(flags *pflag.FlagSet, c *Opts) {
 	flags.StringVar(&c.TraceConfig.ServiceName, "trace-service-name", c.TraceConfig.ServiceName, "sets the name of the service used to register with the trace exporter")
 	flags.Var(mapVar(c.TraceConfig.Tags), "trace-tag", "add tags to include with traces in key=value form")
 	flags.StringVar(&c.TraceSampleRate, "trace-sample-rate", c.TraceSampleRate, "set probability of tracing samples")
-	flags.StringVar(&c.MqttBroker, "mqtt-broker", c.MqttBroker, "set mqtt broker")
+	flags.StringVar(&c.MqttBroker, "mqtt-broker", c.MqttBroker, "set mqtt broker, or a comma separated host[:port] list failed over in order")
 	flags.IntVar(&c.MqttPort, "mqtt-port", c.MqttPort, "set mqtt port")
 	flags.StringVar(&c.MqttUsername, "mqtt-username", c.MqttUsername, "set mqtt username")
-	flags.StringVar(&c.MqttPassword, "mqtt-password", c.MqttPassword, "set mqtt password")
+	flags.StringVar(&c.MqttPassword, "mqtt-password", c.MqttPassword, "set mqtt password, prefer --mqtt-password-file or env MQTT_PASSWORD to keep it out of process args")
+	flags.StringVar(&c.MqttPasswordFile, "mqtt-password-file", c.MqttPasswordFile, "set the file containing mqtt password")
 	flags.StringVar(&c.MqttCAPath, "mqtt-ca", c.MqttCAPath, "set mqtt ca path")
 	flags.StringVar(&c.MqttClientCrtPath, "mqtt-client-crt", c.MqttClientCrtPath, "set mqtt client crt path")
 	flags.StringVar(&c.MqttClientKeyPath, "mqtt-client-key", c.MqttClientKeyPath, "set mqtt client key path")
+	flags.StringVar(&c.MqttClientID, "client-id", c.MqttClientID, "set a stable mqtt client id, module-controller@@@<uuid> if empty")
+	flags.DurationVar(&c.MqttDedupTTL, "mqtt-dedup-ttl", c.MqttDedupTTL, "drop redelivered qos1 messages within the window, disabled if 0")
+	flags.DurationVar(&c.MqttConnectTimeout, "mqtt-connect-timeout", c.MqttConnectTimeout, "fail if not connected to mqtt broker within the timeout on startup")
+	flags.Uint8Var(&c.MqttQosHeartbeat, "mqtt-qos-heartbeat", c.MqttQosHeartbeat, "set the qos of base heartbeats and health commands")
+	flags.Uint8Var(&c.MqttQosCommand, "mqtt-qos-command", c.MqttQosCommand, "set the qos of biz commands and biz status, 1 if 0")
+	flags.Uint8Var(&c.MqttQosStatus, "mqtt-qos-status", c.MqttQosStatus, "set the qos of node online/offline status, 1 if 0")
+
+	flags.BoolVar(&c.LeaderElection, "leader-election", c.LeaderElection, "enable leader election, only the leader instance registers nodes")
+	flags.StringVar(&c.LeaseName, "lease-name", c.LeaseName, "set the lease name of leader election")
+	flags.StringVar(&c.LeaseNamespace, "lease-namespace", c.LeaseNamespace, "set the lease namespace of leader election")
+
+	flags.StringVar(&c.NodeNamePrefix, "node-name-prefix", c.NodeNamePrefix, "set the prefix of virtual node names, must be a RFC 1123 label")
+	flags.StringVar(&c.DefaultBizVersion, "default-biz-version", c.DefaultBizVersion, "set the version of biz containers without BIZ_VERSION env or image tag, e.g. 0.0.0-SNAPSHOT in dev clusters, empty to reject them")
+	flags.BoolVar(&c.DryRun, "dry-run", c.DryRun, "log the biz install and uninstall commands instead of publishing them")
+	flags.IntVar(&c.MaxConcurrentBizOps, "max-concurrent-biz-ops", c.MaxConcurrentBizOps, "set the max biz commands of a node waiting for confirmation at the same time, 4 if 0")
+	flags.BoolVar(&c.RejectBizDowngrade, "reject-biz-downgrade", c.RejectBizDowngrade, "reject pod updates replacing a biz with an older semantic version, keeping the installed one")
+	flags.DurationVar(&c.BizPollInterval, "biz-poll-interval", c.BizPollInterval, "poll the biz list of bases not pushing biz status in the interval, disabled if 0")
+	flags.StringVar(&c.LogLevel, "log-level", c.LogLevel, `set the log level, e.g. "debug", "info", "warn", "error"`)
+	flags.StringVar(&c.LogFormat, "log-format", c.LogFormat, `set the log format, "text" or "json"`)
+	flags.StringVar(&c.HealthAddr, "health-addr", c.HealthAddr, "set the address serving /healthz and /readyz, e.g. :8081, disabled if empty")
+	flags.StringVar(&c.DebugAddr, "debug-addr", c.DebugAddr, "set the address serving /debug/nodes dumping controller state, e.g. localhost:8082, disabled if empty")
+	flags.StringVar(&c.MetricsAddr, "metrics-addr", c.MetricsAddr, "set the address serving prometheus /metrics, e.g. :9090, disabled if empty")
+	flags.Int32Var(&c.KubeletPort, "kubelet-port", c.KubeletPort, "set the port of the https kubelet api serving kubectl logs of biz containers, e.g. 10250, disabled if 0")
+	flags.StringVar(&c.KubeletCertPath, "kubelet-cert", c.KubeletCertPath, "set the certificate path of the kubelet api")
+	flags.StringVar(&c.KubeletKeyPath, "kubelet-key", c.KubeletKeyPath, "set the key path of the kubelet api")
 
 	flags.DurationVar(&c.InformerResyncPeriod, "full-resync-period", c.InformerResyncPeriod, "how often to perform a full resync of pods between kubernetes and the provider")
 
@@ -0,0 +1,89 @@
+package root
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+)
+
+// newHealthHandler serves /healthz while the process is alive, and /readyz once mqtt connected and controller ready,
+// /readyz fails while kube degraded, e.g. the api server unreachable and the kube requests being retried
+func newHealthHandler(isConnected func() bool, isKubeDegraded func() bool, ready <-chan struct{}) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("ok"))
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, _ *http.Request) {
+		if !isConnected() {
+			http.Error(w, "mqtt not connected", http.StatusServiceUnavailable)
+			return
+		}
+		select {
+		case <-ready:
+		default:
+			http.Error(w, "controller not ready", http.StatusServiceUnavailable)
+			return
+		}
+		if isKubeDegraded() {
+			http.Error(w, "kube client degraded", http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("ok"))
+	})
+	return mux
+}
+
+// setupHTTPServer serve the handler on addr until ctx done, e.g. the health and debug endpoints
+func setupHTTPServer(ctx context.Context, addr string, handler http.Handler) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	serve(ctx, listener, addr, handler)
+	return nil
+}
+
+// setupHTTPSServer serve the handler over tls on addr until ctx done, e.g. the kubelet api requested by api server
+func setupHTTPSServer(ctx context.Context, addr, certPath, keyPath string, handler http.Handler) error {
+	if certPath == "" || keyPath == "" {
+		return errors.New("certificate and key paths are required")
+	}
+	cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		return err
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	serve(ctx, tls.NewListener(listener, &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}), addr, handler)
+	return nil
+}
+
+// serve the handler on listener until ctx done
+func serve(ctx context.Context, listener net.Listener, addr string, handler http.Handler) {
+	srv := &http.Server{Handler: handler, ReadHeaderTimeout: 30 * time.Second}
+	go func() {
+		e := srv.Serve(listener)
+		if errors.Is(e, http.ErrServerClosed) {
+			return
+		}
+		log.G(ctx).WithError(e).WithField("addr", addr).Error("HTTP server exited")
+	}()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+}
@@ -0,0 +1,47 @@
+package root
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestNewHealthHandler(t *testing.T) {
+	connected := false
+	degraded := false
+	ready := make(chan struct{})
+	handler := newHealthHandler(func() bool { return connected }, func() bool { return degraded }, ready)
+	statusCode := func(path string) int {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+		return recorder.Code
+	}
+
+	assert.Equal(t, statusCode("/healthz"), http.StatusOK)
+	assert.Equal(t, statusCode("/readyz"), http.StatusServiceUnavailable)
+
+	connected = true
+	assert.Equal(t, statusCode("/readyz"), http.StatusServiceUnavailable)
+
+	close(ready)
+	assert.Equal(t, statusCode("/readyz"), http.StatusOK)
+
+	degraded = true
+	assert.Equal(t, statusCode("/readyz"), http.StatusServiceUnavailable)
+	assert.Equal(t, statusCode("/healthz"), http.StatusOK)
+
+	degraded = false
+	assert.Equal(t, statusCode("/readyz"), http.StatusOK)
+
+	connected = false
+	assert.Equal(t, statusCode("/readyz"), http.StatusServiceUnavailable)
+}
+
+func TestSetupHTTPSServer_InvalidKeyPair(t *testing.T) {
+	ctx := context.Background()
+	assert.ErrorContains(t, setupHTTPSServer(ctx, "127.0.0.1:0", "", "", http.NotFoundHandler()), "required")
+	assert.Assert(t, setupHTTPSServer(ctx, "127.0.0.1:0", "not-exist.crt", "not-exist.key", http.NotFoundHandler()) != nil)
+}
@@ -0,0 +1,36 @@
+package root
+
+import (
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// LogFormatText writes human readable logs
+	LogFormatText = "text"
+
+	// LogFormatJSON writes one json object per log, fields such as clientID are structured keys
+	LogFormatJSON = "json"
+)
+
+// setupLogging configure the level and format of the logrus backend of log.G
+func setupLogging(logger *logrus.Logger, c Opts) error {
+	if c.LogLevel != "" {
+		level, err := logrus.ParseLevel(c.LogLevel)
+		if err != nil {
+			return fmt.Errorf("could not parse log level: %w", err)
+		}
+		logger.SetLevel(level)
+	}
+
+	switch c.LogFormat {
+	case "", LogFormatText:
+		logger.SetFormatter(&logrus.TextFormatter{})
+	case LogFormatJSON:
+		logger.SetFormatter(&logrus.JSONFormatter{})
+	default:
+		return fmt.Errorf("unsupported log format %q, must be %s or %s", c.LogFormat, LogFormatText, LogFormatJSON)
+	}
+	return nil
+}
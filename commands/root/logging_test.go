@@ -0,0 +1,31 @@
+package root
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"gotest.tools/assert"
+)
+
+func TestSetupLogging_JSON(t *testing.T) {
+	logger := logrus.New()
+	buffer := &bytes.Buffer{}
+	logger.SetOutput(buffer)
+	assert.NilError(t, setupLogging(logger, Opts{LogLevel: "debug", LogFormat: LogFormatJSON}))
+	assert.Equal(t, logger.GetLevel(), logrus.DebugLevel)
+
+	logger.WithFields(logrus.Fields{"clientID": "test-client", "operatingSystem": "linux"}).Debug("test")
+	var entry map[string]interface{}
+	assert.NilError(t, json.Unmarshal(buffer.Bytes(), &entry))
+	assert.Equal(t, entry["clientID"], "test-client")
+	assert.Equal(t, entry["operatingSystem"], "linux")
+	assert.Equal(t, entry["msg"], "test")
+}
+
+func TestSetupLogging_Invalid(t *testing.T) {
+	assert.Assert(t, setupLogging(logrus.New(), Opts{LogLevel: "verbose"}) != nil)
+	assert.Assert(t, setupLogging(logrus.New(), Opts{LogFormat: "xml"}) != nil)
+	assert.NilError(t, setupLogging(logrus.New(), Opts{LogFormat: LogFormatText}))
+}
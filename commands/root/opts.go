@@ -15,8 +15,10 @@
 package root
 
 import (
+	"errors"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -26,37 +28,106 @@ const (
 	DefaultOperatingSystem      = "linux"
 	DefaultInformerResyncPeriod = 1 * time.Minute
 	DefaultPodSyncWorkers       = 10
+
+	DefaultMqttConnectionWaitTimeout = 30 * time.Second
+	DefaultMqttConnectTimeout        = 30 * time.Second
+
+	DefaultLogLevel  = "info"
+	DefaultLogFormat = LogFormatText
 )
 
 // Opts stores all the options for configuring the root module-controller command.
 // It is used for setting flag values.
 //
 // You can set the default options by creating a new `Opts` struct and passing
-// it into `SetDefaultOpts`
+// it into `SetDefaultOpts`, or load them from the yaml file passed by --config,
+// whose keys are the field names in lower camel case, e.g. mqttBroker
 type Opts struct {
 	// Path to the kubeconfig to use to connect to the Kubernetes API server.
-	KubeConfigPath string
+	KubeConfigPath string `yaml:"kubeConfigPath"`
+	// use the in-cluster config of service account even if KubeConfigPath set
+	KubeConfigInCluster bool `yaml:"kubeConfigInCluster"`
 	// Operating system to run pods for
-	OperatingSystem string
+	OperatingSystem string `yaml:"operatingSystem"`
 
 	// Number of workers to use to handle pod notifications
-	PodSyncWorkers       int
-	InformerResyncPeriod time.Duration
+	PodSyncWorkers       int           `yaml:"podSyncWorkers"`
+	InformerResyncPeriod time.Duration `yaml:"informerResyncPeriod"`
 
-	TraceExporters  []string
-	TraceSampleRate string
-	TraceConfig     TracingExporterOptions
+	TraceExporters  []string               `yaml:"traceExporters"`
+	TraceSampleRate string                 `yaml:"traceSampleRate"`
+	TraceConfig     TracingExporterOptions `yaml:"traceConfig"`
 
 	// MQTT config
-	MqttBroker        string
-	MqttPort          int
-	MqttUsername      string
-	MqttPassword      string
-	MqttCAPath        string
-	MqttClientCrtPath string
-	MqttClientKeyPath string
-
-	Version string
+	MqttBroker   string `yaml:"mqttBroker"`
+	MqttPort     int    `yaml:"mqttPort"`
+	MqttUsername string `yaml:"mqttUsername"`
+	MqttPassword string `yaml:"mqttPassword"`
+	// file containing the mqtt password, keeps the secret out of process args
+	MqttPasswordFile  string `yaml:"mqttPasswordFile"`
+	MqttCAPath        string `yaml:"mqttCAPath"`
+	MqttClientCrtPath string `yaml:"mqttClientCrtPath"`
+	MqttClientKeyPath string `yaml:"mqttClientKeyPath"`
+	// pem encoded tls material, e.g. injected from a secret by env, preferred over the paths
+	MqttCAPem        string `yaml:"mqttCAPem"`
+	MqttClientCrtPem string `yaml:"mqttClientCrtPem"`
+	MqttClientKeyPem string `yaml:"mqttClientKeyPem"`
+	// client id used verbatim if set, otherwise module-controller@@@<uuid>
+	MqttClientID string `yaml:"mqttClientID"`
+	// window of dropping redelivered Qos1 messages, disabled if 0
+	MqttDedupTTL time.Duration `yaml:"mqttDedupTTL"`
+	// timeout of the initial connect to broker
+	MqttConnectTimeout time.Duration `yaml:"mqttConnectTimeout"`
+	// qos of heartbeats, biz commands and node status, the command and status ones default by the controller if 0
+	MqttQosHeartbeat uint8 `yaml:"mqttQosHeartbeat"`
+	MqttQosCommand   uint8 `yaml:"mqttQosCommand"`
+	MqttQosStatus    uint8 `yaml:"mqttQosStatus"`
+
+	// Leader election config, only the leader instance registers nodes
+	LeaderElection bool   `yaml:"leaderElection"`
+	LeaseName      string `yaml:"leaseName"`
+	LeaseNamespace string `yaml:"leaseNamespace"`
+
+	// prefix of virtual node names, avoiding collision between controllers of the same cluster
+	NodeNamePrefix string `yaml:"nodeNamePrefix"`
+
+	// version of biz containers without BIZ_VERSION env or image tag, empty to reject them as in production
+	DefaultBizVersion string `yaml:"defaultBizVersion"`
+
+	// log the biz commands instead of publishing them
+	DryRun bool `yaml:"dryRun"`
+
+	// max biz commands of a node waiting for confirmation at the same time, 4 if 0
+	MaxConcurrentBizOps int `yaml:"maxConcurrentBizOps"`
+
+	// reject pod updates replacing a biz with an older version
+	RejectBizDowngrade bool `yaml:"rejectBizDowngrade"`
+
+	// interval of polling the biz list of bases not pushing biz status, disabled if 0
+	BizPollInterval time.Duration `yaml:"bizPollInterval"`
+
+	// log level, e.g. debug, info, warn, error
+	LogLevel string `yaml:"logLevel"`
+	// log format, text or json
+	LogFormat string `yaml:"logFormat"`
+
+	// address of the /healthz and /readyz endpoint, disabled if empty
+	HealthAddr string `yaml:"healthAddr"`
+	// address of the /debug/nodes endpoint dumping controller state, disabled if empty
+	DebugAddr string `yaml:"debugAddr"`
+	// address of the prometheus /metrics endpoint, disabled if empty
+	MetricsAddr string `yaml:"metricsAddr"`
+
+	// port of the https kubelet api serving container logs of nodes, reported by nodes, disabled if 0
+	KubeletPort int32 `yaml:"kubeletPort"`
+	// certificate and key paths of the kubelet api
+	KubeletCertPath string `yaml:"kubeletCertPath"`
+	KubeletKeyPath  string `yaml:"kubeletKeyPath"`
+
+	Version string `yaml:"-"`
+
+	// ConfigPath is the yaml file to load options from, flags override file values
+	ConfigPath string `yaml:"-"`
 }
 
 // SetDefaultOpts sets default options for unset values on the passed in option struct.
@@ -78,6 +149,18 @@ func SetDefaultOpts(c *Opts) error {
 		c.TraceConfig.ServiceName = DefaultNodeName
 	}
 
+	if c.MqttConnectTimeout == 0 {
+		c.MqttConnectTimeout = DefaultMqttConnectTimeout
+	}
+
+	if c.LogLevel == "" {
+		c.LogLevel = DefaultLogLevel
+	}
+
+	if c.LogFormat == "" {
+		c.LogFormat = DefaultLogFormat
+	}
+
 	if c.KubeConfigPath == "" {
 		c.KubeConfigPath = os.Getenv("KUBE_CONFIG_PATH")
 	}
@@ -98,10 +181,6 @@ func SetDefaultOpts(c *Opts) error {
 		c.MqttUsername = os.Getenv("MQTT_USERNAME")
 	}
 
-	if c.MqttPassword == "" {
-		c.MqttPassword = os.Getenv("MQTT_PASSWORD")
-	}
-
 	if c.MqttCAPath == "" {
 		c.MqttCAPath = os.Getenv("MQTT_CA_PATH")
 	}
@@ -114,5 +193,66 @@ func SetDefaultOpts(c *Opts) error {
 		c.MqttClientKeyPath = os.Getenv("MQTT_CLIENT_KEY_PATH")
 	}
 
+	if c.MqttCAPem == "" {
+		c.MqttCAPem = os.Getenv("MQTT_CA_PEM")
+	}
+
+	if c.MqttClientCrtPem == "" {
+		c.MqttClientCrtPem = os.Getenv("MQTT_CLIENT_CRT_PEM")
+	}
+
+	if c.MqttClientKeyPem == "" {
+		c.MqttClientKeyPem = os.Getenv("MQTT_CLIENT_KEY_PEM")
+	}
+
 	return nil
 }
+
+// MqttPasswordEnv is the env of mqtt password, preferred over --mqtt-password to keep the secret out of process args
+const MqttPasswordEnv = "MQTT_PASSWORD"
+
+// ErrMultipleMqttPasswordSources is returned if more than one of --mqtt-password, --mqtt-password-file and MQTT_PASSWORD is set
+var ErrMultipleMqttPasswordSources = errors.New("only one of --mqtt-password, --mqtt-password-file and " + MqttPasswordEnv + " can be set")
+
+// resolveMqttPassword returns the mqtt password from the password file, env or the literal option, whichever is set
+func resolveMqttPassword(c Opts) (string, error) {
+	envPassword := os.Getenv(MqttPasswordEnv)
+	sources := 0
+	for _, source := range []string{c.MqttPassword, c.MqttPasswordFile, envPassword} {
+		if source != "" {
+			sources++
+		}
+	}
+	if sources > 1 {
+		return "", ErrMultipleMqttPasswordSources
+	}
+
+	switch {
+	case c.MqttPasswordFile != "":
+		content, err := os.ReadFile(c.MqttPasswordFile)
+		if err != nil {
+			return "", err
+		}
+		// mounted secret files usually end with a newline
+		return strings.TrimRight(string(content), "\r\n"), nil
+	case envPassword != "":
+		return envPassword, nil
+	default:
+		return c.MqttPassword, nil
+	}
+}
+
+// splitMqttBrokers returns the broker of --mqtt-broker, or the failover brokers if it is a comma separated list,
+// each "host" or "host:port"
+func splitMqttBrokers(brokers string) (string, []string) {
+	if !strings.Contains(brokers, ",") {
+		return brokers, nil
+	}
+	var failover []string
+	for _, broker := range strings.Split(brokers, ",") {
+		if broker = strings.TrimSpace(broker); broker != "" {
+			failover = append(failover, broker)
+		}
+	}
+	return "", failover
+}
@@ -0,0 +1,43 @@
+package root
+
+import (
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestResolveMqttPassword(t *testing.T) {
+	t.Setenv(MqttPasswordEnv, "")
+	password, err := resolveMqttPassword(Opts{MqttPassword: "literal"})
+	assert.NilError(t, err)
+	assert.Equal(t, password, "literal")
+
+	password, err = resolveMqttPassword(Opts{MqttPasswordFile: writeConfigFile(t, "from-file\n")})
+	assert.NilError(t, err)
+	assert.Equal(t, password, "from-file")
+
+	t.Setenv(MqttPasswordEnv, "from-env")
+	password, err = resolveMqttPassword(Opts{})
+	assert.NilError(t, err)
+	assert.Equal(t, password, "from-env")
+}
+
+func TestResolveMqttPassword_MultipleSources(t *testing.T) {
+	t.Setenv(MqttPasswordEnv, "from-env")
+	_, err := resolveMqttPassword(Opts{MqttPassword: "literal"})
+	assert.Equal(t, err, ErrMultipleMqttPasswordSources)
+
+	t.Setenv(MqttPasswordEnv, "")
+	_, err = resolveMqttPassword(Opts{MqttPassword: "literal", MqttPasswordFile: "/tmp/password"})
+	assert.Equal(t, err, ErrMultipleMqttPasswordSources)
+}
+
+func TestSplitMqttBrokers(t *testing.T) {
+	broker, failover := splitMqttBrokers("broker-a")
+	assert.Equal(t, broker, "broker-a")
+	assert.Assert(t, failover == nil)
+
+	broker, failover = splitMqttBrokers("broker-a:1883, broker-b:2883,,broker-c")
+	assert.Equal(t, broker, "")
+	assert.DeepEqual(t, failover, []string{"broker-a:1883", "broker-b:2883", "broker-c"})
+}
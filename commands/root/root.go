@@ -22,8 +22,11 @@ import (
 	"github.com/koupleless/virtual-kubelet/common/mqtt"
 	"github.com/koupleless/virtual-kubelet/java/controller"
 	"github.com/koupleless/virtual-kubelet/java/model"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/virtual-kubelet/virtual-kubelet/log"
+	"os"
 )
 
 // NewCommand creates a new top-level command.
@@ -36,6 +39,16 @@ func NewCommand(ctx context.Context, c Opts) *cobra.Command {
 backend implementation allowing users to create kubernetes nodes without running the kubelet.
 This allows users to schedule kubernetes workloads on nodes that aren't running Kubernetes.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, stop := withShutdownSignals(ctx, os.Exit)
+			defer stop()
+			if c.ConfigPath != "" {
+				if err := loadConfigFile(c.ConfigPath, cmd.Flags(), &c); err != nil {
+					return err
+				}
+			}
+			if err := setupLogging(logrus.StandardLogger(), c); err != nil {
+				return err
+			}
 			return runRootCommand(ctx, c)
 		},
 	}
@@ -52,26 +65,85 @@ func runRootCommand(ctx context.Context, c Opts) error {
 		return err
 	}
 
-	clientID := uuid.New().String()
+	clientID := c.MqttClientID
+	if clientID == "" {
+		clientID = fmt.Sprintf("module-controller@@@%s", uuid.New().String())
+	}
 
 	ctx = log.WithLogger(ctx, log.G(ctx).WithFields(log.Fields{
 		"operatingSystem": c.OperatingSystem,
 		"clientID":        clientID,
 	}))
 
+	mqttPassword, err := resolveMqttPassword(c)
+	if err != nil {
+		return err
+	}
+
+	broker, brokers := splitMqttBrokers(c.MqttBroker)
+	mqttConfig := &mqtt.ClientConfig{
+		Broker:        broker,
+		Brokers:       brokers,
+		Port:          c.MqttPort,
+		ClientID:      clientID,
+		Username:      c.MqttUsername,
+		Password:      mqttPassword,
+		CAPath:        c.MqttCAPath,
+		ClientCrtPath: c.MqttClientCrtPath,
+		ClientKeyPath: c.MqttClientKeyPath,
+		CAPem:         []byte(c.MqttCAPem),
+		ClientCrtPem:  []byte(c.MqttClientCrtPem),
+		ClientKeyPem:  []byte(c.MqttClientKeyPem),
+		CleanSession:  true,
+		DedupTTL:      c.MqttDedupTTL,
+
+		ConnectTimeout: c.MqttConnectTimeout,
+	}
+
+	var registry *prometheus.Registry
+	if c.MetricsAddr != "" {
+		registry = prometheus.NewRegistry()
+		recorder, err := mqtt.NewPrometheusMetricsRecorder(registry)
+		if err != nil {
+			return err
+		}
+		mqttConfig.MetricsRecorder = recorder
+	}
+
+	mqttClient, err := mqtt.NewMqttClient(mqttConfig)
+	if err != nil {
+		return controller.WrapMqttClientError(err)
+	}
+
+	// make sure the connection settled before controller starts publishing
+	waitCtx, waitCancel := context.WithTimeout(ctx, DefaultMqttConnectionWaitTimeout)
+	defer waitCancel()
+	if err = mqttClient.WaitForConnection(waitCtx); err != nil {
+		mqttClient.Disconnect(250)
+		return fmt.Errorf("%w: waiting for mqtt connection: %w", controller.ErrMqttConnect, err)
+	}
+
 	config := model.BuildBaseRegisterControllerConfig{
-		MqttConfig: &mqtt.ClientConfig{
-			Broker:        c.MqttBroker,
-			Port:          c.MqttPort,
-			ClientID:      fmt.Sprintf("module-controller@@@%s", clientID),
-			Username:      c.MqttUsername,
-			Password:      c.MqttPassword,
-			CAPath:        c.MqttCAPath,
-			ClientCrtPath: c.MqttClientCrtPath,
-			ClientKeyPath: c.MqttClientKeyPath,
-			CleanSession:  true,
-		},
+		MqttConfig:     mqttConfig,
+		MqttClient:     mqttClient,
 		KubeConfigPath: c.KubeConfigPath,
+		InCluster:      c.KubeConfigInCluster,
+		LeaderElection: c.LeaderElection,
+		LeaseName:      c.LeaseName,
+		LeaseNamespace: c.LeaseNamespace,
+		NodeNamePrefix: c.NodeNamePrefix,
+		DryRun:         c.DryRun,
+
+		DefaultBizVersion: c.DefaultBizVersion,
+
+		BizPollInterval:     c.BizPollInterval,
+		MaxConcurrentBizOps: c.MaxConcurrentBizOps,
+		RejectBizDowngrade:  c.RejectBizDowngrade,
+		KubeletPort:         c.KubeletPort,
+
+		QosHeartbeat: c.MqttQosHeartbeat,
+		QosCommand:   c.MqttQosCommand,
+		QosStatus:    c.MqttQosStatus,
 	}
 
 	registerController, err := controller.NewBaseRegisterController(&config)
@@ -83,10 +155,52 @@ func runRootCommand(ctx context.Context, c Opts) error {
 		return errors.New("register controller is nil")
 	}
 
+	if registry != nil {
+		recorder, err := controller.NewPrometheusMetricsRecorder(registry, registerController.NodeCount)
+		if err != nil {
+			mqttClient.Disconnect(250)
+			return err
+		}
+		registerController.SetMetricsRecorder(recorder)
+		if err = setupHTTPServer(ctx, c.MetricsAddr, newMetricsHandler(registry)); err != nil {
+			mqttClient.Disconnect(250)
+			return fmt.Errorf("starting metrics server: %w", err)
+		}
+	}
+
+	if c.HealthAddr != "" {
+		if err = setupHTTPServer(ctx, c.HealthAddr, newHealthHandler(mqttClient.IsConnected, registerController.KubeDegraded, registerController.Ready())); err != nil {
+			mqttClient.Disconnect(250)
+			return fmt.Errorf("starting health server: %w", err)
+		}
+	}
+
+	if c.DebugAddr != "" {
+		if err = setupHTTPServer(ctx, c.DebugAddr, newDebugHandler(registerController.DumpNodes)); err != nil {
+			mqttClient.Disconnect(250)
+			return fmt.Errorf("starting debug server: %w", err)
+		}
+	}
+
+	if c.KubeletPort > 0 {
+		if err = setupHTTPSServer(ctx, fmt.Sprintf(":%d", c.KubeletPort), c.KubeletCertPath, c.KubeletKeyPath, registerController.KubeletHandler()); err != nil {
+			mqttClient.Disconnect(250)
+			return fmt.Errorf("starting kubelet server: %w", err)
+		}
+	}
+
 	registerController.Run(ctx)
 
+	select {
+	case <-registerController.Ready():
+		log.G(ctx).Info("controller ready")
+	case <-registerController.Done():
+	}
+
 	select {
 	case <-ctx.Done():
+		// wait for the controller to drain
+		<-registerController.Done()
 	case <-registerController.Done():
 	}
 
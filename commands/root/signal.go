@@ -0,0 +1,47 @@
+package root
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+)
+
+var shutdownSignals = []os.Signal{syscall.SIGINT, syscall.SIGTERM}
+
+// withShutdownSignals returns a context canceled on the first SIGINT or SIGTERM so that the controller drains gracefully,
+// a second signal calls exit to force the process exit. The returned stop func releases the signal handler.
+func withShutdownSignals(ctx context.Context, exit func(code int)) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	stopped := make(chan struct{})
+	sig := make(chan os.Signal, 2)
+	signal.Notify(sig, shutdownSignals...)
+
+	go func() {
+		select {
+		case s := <-sig:
+			log.G(ctx).Infof("received %s, shutting down", s)
+			cancel()
+		case <-stopped:
+			return
+		}
+		select {
+		case s := <-sig:
+			log.G(ctx).Warnf("received %s again, force exit", s)
+			exit(1)
+		case <-stopped:
+		}
+	}()
+
+	var once sync.Once
+	return ctx, func() {
+		once.Do(func() {
+			signal.Stop(sig)
+			close(stopped)
+			cancel()
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package root
+
+import (
+	"context"
+	"syscall"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+)
+
+func TestWithShutdownSignals(t *testing.T) {
+	exited := make(chan int, 1)
+	ctx, stop := withShutdownSignals(context.Background(), func(code int) {
+		exited <- code
+	})
+	defer stop()
+
+	assert.NilError(t, syscall.Kill(syscall.Getpid(), syscall.SIGTERM))
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("context should be canceled on the first signal")
+	}
+
+	assert.NilError(t, syscall.Kill(syscall.Getpid(), syscall.SIGTERM))
+	select {
+	case code := <-exited:
+		assert.Equal(t, code, 1)
+	case <-time.After(5 * time.Second):
+		t.Fatal("second signal should force exit")
+	}
+}
+
+func TestWithShutdownSignals_Stop(t *testing.T) {
+	ctx, stop := withShutdownSignals(context.Background(), func(code int) {
+		t.Fatal("should not exit after stopped")
+	})
+	stop()
+	stop()
+	assert.Assert(t, ctx.Err() != nil)
+}
@@ -21,8 +21,8 @@ import (
 
 // TracingExporterOptions is the options passed to the tracing exporter init function.
 type TracingExporterOptions struct { //nolint: golint
-	Tags        map[string]string
-	ServiceName string
+	Tags        map[string]string `yaml:"tags"`
+	ServiceName string            `yaml:"serviceName"`
 }
 
 var (
@@ -0,0 +1,73 @@
+package mqtt
+
+import (
+	"crypto/sha256"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// deduplicator remember the hash of topic and payload of Qos1 messages seen within ttl,
+// as Qos1 messages may be redelivered by broker
+type deduplicator struct {
+	sync.Mutex
+	ttl       time.Duration
+	seen      map[[sha256.Size]byte]time.Time
+	lastPrune time.Time
+	now       func() time.Time
+}
+
+func newDeduplicator(ttl time.Duration) *deduplicator {
+	return &deduplicator{
+		ttl:  ttl,
+		seen: map[[sha256.Size]byte]time.Time{},
+		now:  time.Now,
+	}
+}
+
+func messageKey(topic string, payload []byte) [sha256.Size]byte {
+	h := sha256.New()
+	h.Write([]byte(topic))
+	h.Write([]byte{0})
+	h.Write(payload)
+	var key [sha256.Size]byte
+	copy(key[:], h.Sum(nil))
+	return key
+}
+
+// seenBefore record the message and return true if it has been seen within ttl
+func (d *deduplicator) seenBefore(topic string, payload []byte) bool {
+	key := messageKey(topic, payload)
+	now := d.now()
+	d.Lock()
+	defer d.Unlock()
+	if now.Sub(d.lastPrune) > d.ttl {
+		// drop expired entries at most once per ttl
+		for k, seenAt := range d.seen {
+			if now.Sub(seenAt) > d.ttl {
+				delete(d.seen, k)
+			}
+		}
+		d.lastPrune = now
+	}
+	if seenAt, ok := d.seen[key]; ok && now.Sub(seenAt) <= d.ttl {
+		return true
+	}
+	d.seen[key] = now
+	return false
+}
+
+// dedupHandler wrap handler to drop Qos1 messages already seen within ttl, dropped messages are still acked
+func dedupHandler(d *deduplicator, handler mqtt.MessageHandler) mqtt.MessageHandler {
+	if d == nil || handler == nil {
+		return handler
+	}
+	return func(client mqtt.Client, msg mqtt.Message) {
+		if msg.Qos() == Qos1 && d.seenBefore(msg.Topic(), msg.Payload()) {
+			msg.Ack()
+			return
+		}
+		handler(client, msg)
+	}
+}
@@ -0,0 +1,62 @@
+package mqtt
+
+import (
+	"testing"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"gotest.tools/assert"
+)
+
+type qosMessage struct {
+	fakeMessage
+	qos     byte
+	payload []byte
+	acked   bool
+}
+
+func (m *qosMessage) Qos() byte {
+	return m.qos
+}
+
+func (m *qosMessage) Payload() []byte {
+	return m.payload
+}
+
+func (m *qosMessage) Ack() {
+	m.acked = true
+}
+
+func TestDeduplicator_SeenBefore(t *testing.T) {
+	now := time.Now()
+	d := newDeduplicator(time.Second)
+	d.now = func() time.Time { return now }
+	assert.Assert(t, !d.seenBefore("test/topic", []byte("msg")))
+	assert.Assert(t, d.seenBefore("test/topic", []byte("msg")))
+	assert.Assert(t, !d.seenBefore("test/other", []byte("msg")))
+	assert.Assert(t, !d.seenBefore("test/topic", []byte("other")))
+
+	now = now.Add(2 * time.Second)
+	assert.Assert(t, !d.seenBefore("test/topic", []byte("msg")))
+	assert.Equal(t, len(d.seen), 1)
+}
+
+func TestDedupHandler(t *testing.T) {
+	handled := 0
+	handler := dedupHandler(newDeduplicator(time.Minute), func(client mqtt.Client, msg mqtt.Message) {
+		handled++
+	})
+	first := &qosMessage{fakeMessage: fakeMessage{topic: "test/topic"}, qos: Qos1, payload: []byte("msg")}
+	duplicate := &qosMessage{fakeMessage: fakeMessage{topic: "test/topic"}, qos: Qos1, payload: []byte("msg")}
+	handler(nil, first)
+	handler(nil, duplicate)
+	assert.Equal(t, handled, 1)
+	assert.Assert(t, duplicate.acked)
+
+	// qos0 messages are never redelivered, so not deduplicated
+	handler(nil, &qosMessage{fakeMessage: fakeMessage{topic: "test/topic"}, qos: Qos0, payload: []byte("msg")})
+	handler(nil, &qosMessage{fakeMessage: fakeMessage{topic: "test/topic"}, qos: Qos0, payload: []byte("msg")})
+	assert.Equal(t, handled, 3)
+
+	assert.Assert(t, dedupHandler(nil, nil) == nil)
+}
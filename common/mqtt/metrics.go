@@ -0,0 +1,106 @@
+package mqtt
+
+import (
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// MetricsRecorder is invoked by Client on publish, receive and subscribe, for throughput and latency observation
+type MetricsRecorder interface {
+	// ObservePublish is called once a publish finished, err is nil if succeeded
+	ObservePublish(topic string, qos byte, duration time.Duration, err error)
+
+	// ObserveReceive is called when a message arrived
+	ObserveReceive(topic string)
+
+	// ObserveSubscribe is called once a subscription finished, err is nil if succeeded
+	ObserveSubscribe(topic string, qos byte, err error)
+}
+
+type noopMetricsRecorder struct{}
+
+func (noopMetricsRecorder) ObservePublish(string, byte, time.Duration, error) {}
+
+func (noopMetricsRecorder) ObserveReceive(string) {}
+
+func (noopMetricsRecorder) ObserveSubscribe(string, byte, error) {}
+
+// observeReceiveHandler wrap handler to record received messages before handling
+func observeReceiveHandler(recorder MetricsRecorder, handler mqtt.MessageHandler) mqtt.MessageHandler {
+	if recorder == nil || handler == nil {
+		return handler
+	}
+	return func(client mqtt.Client, msg mqtt.Message) {
+		recorder.ObserveReceive(msg.Topic())
+		handler(client, msg)
+	}
+}
+
+func resultLabel(err error) string {
+	if err != nil {
+		return "failed"
+	}
+	return "succeeded"
+}
+
+// PrometheusMetricsRecorder is a MetricsRecorder exposing prometheus counters and publish latency histogram
+type PrometheusMetricsRecorder struct {
+	published       *prometheus.CounterVec
+	publishDuration *prometheus.HistogramVec
+	received        *prometheus.CounterVec
+	subscribed      *prometheus.CounterVec
+}
+
+var _ MetricsRecorder = &PrometheusMetricsRecorder{}
+
+// NewPrometheusMetricsRecorder create the recorder and register its collectors to registerer
+func NewPrometheusMetricsRecorder(registerer prometheus.Registerer) (*PrometheusMetricsRecorder, error) {
+	recorder := &PrometheusMetricsRecorder{
+		published: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "mqtt",
+			Name:      "published_messages_total",
+			Help:      "Total number of mqtt messages published.",
+		}, []string{"topic", "qos", "result"}),
+		publishDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "mqtt",
+			Name:      "publish_duration_seconds",
+			Help:      "Latency of mqtt publish until acknowledged.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"topic"}),
+		received: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "mqtt",
+			Name:      "received_messages_total",
+			Help:      "Total number of mqtt messages received.",
+		}, []string{"topic"}),
+		subscribed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "mqtt",
+			Name:      "subscriptions_total",
+			Help:      "Total number of mqtt subscriptions.",
+		}, []string{"topic", "qos", "result"}),
+	}
+	for _, collector := range []prometheus.Collector{recorder.published, recorder.publishDuration, recorder.received, recorder.subscribed} {
+		if err := registerer.Register(collector); err != nil {
+			return nil, err
+		}
+	}
+	return recorder, nil
+}
+
+func (r *PrometheusMetricsRecorder) ObservePublish(topic string, qos byte, duration time.Duration, err error) {
+	r.published.WithLabelValues(topic, qosLabel(qos), resultLabel(err)).Inc()
+	r.publishDuration.WithLabelValues(topic).Observe(duration.Seconds())
+}
+
+func (r *PrometheusMetricsRecorder) ObserveReceive(topic string) {
+	r.received.WithLabelValues(topic).Inc()
+}
+
+func (r *PrometheusMetricsRecorder) ObserveSubscribe(topic string, qos byte, err error) {
+	r.subscribed.WithLabelValues(topic, qosLabel(qos), resultLabel(err)).Inc()
+}
+
+func qosLabel(qos byte) string {
+	return string(rune('0' + qos))
+}
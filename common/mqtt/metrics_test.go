@@ -0,0 +1,88 @@
+package mqtt
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"gotest.tools/assert"
+)
+
+type fakeMetricsRecorder struct {
+	published  []string
+	publishErr []error
+	received   []string
+	subscribed []string
+}
+
+func (r *fakeMetricsRecorder) ObservePublish(topic string, _ byte, _ time.Duration, err error) {
+	r.published = append(r.published, topic)
+	r.publishErr = append(r.publishErr, err)
+}
+
+func (r *fakeMetricsRecorder) ObserveReceive(topic string) {
+	r.received = append(r.received, topic)
+}
+
+func (r *fakeMetricsRecorder) ObserveSubscribe(topic string, _ byte, _ error) {
+	r.subscribed = append(r.subscribed, topic)
+}
+
+type fakeMessage struct {
+	mqtt.Message
+	topic string
+}
+
+func (m fakeMessage) Topic() string {
+	return m.topic
+}
+
+func TestClient_PubE_Metrics(t *testing.T) {
+	recorder := &fakeMetricsRecorder{}
+	client := &Client{client: mqtt.NewClient(mqtt.NewClientOptions()), metrics: recorder}
+	err := client.PubE("test/metrics", Qos1, "msg")
+	assert.Assert(t, err != nil)
+	assert.DeepEqual(t, recorder.published, []string{"test/metrics"})
+	assert.Equal(t, recorder.publishErr[0], err)
+}
+
+func TestClient_PubE_InvalidQosNotObserved(t *testing.T) {
+	recorder := &fakeMetricsRecorder{}
+	client := &Client{client: mqtt.NewClient(mqtt.NewClientOptions()), metrics: recorder}
+	err := client.PubE("test/metrics", 3, "msg")
+	assert.Assert(t, errors.Is(err, ErrInvalidQos))
+	assert.Equal(t, len(recorder.published), 0)
+}
+
+func TestObserveReceiveHandler(t *testing.T) {
+	recorder := &fakeMetricsRecorder{}
+	handled := false
+	handler := observeReceiveHandler(recorder, func(client mqtt.Client, msg mqtt.Message) {
+		handled = true
+	})
+	handler(nil, fakeMessage{topic: "test/receive"})
+	assert.Assert(t, handled)
+	assert.DeepEqual(t, recorder.received, []string{"test/receive"})
+	assert.Assert(t, observeReceiveHandler(recorder, nil) == nil)
+}
+
+func TestPrometheusMetricsRecorder(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	recorder, err := NewPrometheusMetricsRecorder(registry)
+	assert.NilError(t, err)
+	recorder.ObservePublish("test/pub", Qos1, time.Millisecond, nil)
+	recorder.ObservePublish("test/pub", Qos1, time.Millisecond, errors.New("failed"))
+	recorder.ObserveReceive("test/sub")
+	recorder.ObserveSubscribe("test/sub", Qos0, nil)
+	assert.Equal(t, testutil.ToFloat64(recorder.published.WithLabelValues("test/pub", "1", "succeeded")), float64(1))
+	assert.Equal(t, testutil.ToFloat64(recorder.published.WithLabelValues("test/pub", "1", "failed")), float64(1))
+	assert.Equal(t, testutil.ToFloat64(recorder.received.WithLabelValues("test/sub")), float64(1))
+	assert.Equal(t, testutil.ToFloat64(recorder.subscribed.WithLabelValues("test/sub", "0", "succeeded")), float64(1))
+	assert.Equal(t, testutil.CollectAndCount(recorder.publishDuration), 1)
+
+	_, err = NewPrometheusMetricsRecorder(registry)
+	assert.Assert(t, err != nil)
+}
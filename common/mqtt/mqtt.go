@@ -1,14 +1,25 @@
 package mqtt
 
 import (
+	"bytes"
 	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/json"
+	"errors"
 	"fmt"
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 	"github.com/virtual-kubelet/virtual-kubelet/log"
+	"math/rand"
+	"net"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 )
 
 const (
@@ -22,137 +33,1006 @@ const (
 	Qos2
 )
 
+// DefaultConnectTimeout is the default timeout of the initial connect to broker
+const DefaultConnectTimeout = 30 * time.Second
+
+// MaxClientIDLength is the max client id length in bytes of the MQTT utf-8 string encoding
+const MaxClientIDLength = 65535
+
+// ErrPublishTimeout is returned when publish operation not finished within timeout
+var ErrPublishTimeout = errors.New("mqtt publish timeout")
+
+// ErrConnectTimeout is returned when the client not connected to broker within ConnectTimeout
+var ErrConnectTimeout = errors.New("mqtt connect timeout")
+
+// ErrSubscriptionRejected is returned when broker rejected the subscription in SUBACK
+var ErrSubscriptionRejected = errors.New("mqtt subscription rejected")
+
+// ErrInvalidClientConfig is returned when client config validation failed
+var ErrInvalidClientConfig = errors.New("invalid mqtt client config")
+
+// ErrInvalidQos is returned when qos is not one of Qos0, Qos1 and Qos2
+var ErrInvalidQos = errors.New("invalid mqtt qos")
+
+// ErrPayloadTooLarge is returned when the payload to publish exceeds ClientConfig.MaxPayloadBytes
+var ErrPayloadTooLarge = errors.New("mqtt payload too large")
+
+// ErrAlreadySubscribed is returned by SubOnce when the topic is covered by an active subscription
+var ErrAlreadySubscribed = errors.New("mqtt topic already subscribed")
+
+// ErrClientDisconnected is returned when the client has been disconnected by Disconnect
+var ErrClientDisconnected = errors.New("mqtt client disconnected")
+
+// Marshaler encode a payload object into bytes before publishing
+type Marshaler interface {
+	Marshal(v interface{}) ([]byte, error)
+}
+
+// JSONMarshaler is the default Marshaler using encoding/json
+type JSONMarshaler struct{}
+
+func (JSONMarshaler) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Publisher publish messages to topics
+type Publisher interface {
+	Pub(topic string, qos byte, msg interface{}) bool
+	PubWithRetained(ctx context.Context, topic string, qos byte, retained bool, msg interface{}) error
+	ClearRetained(topic string) error
+}
+
+// Subscriber subscribe and unsubscribe topics
+type Subscriber interface {
+	Sub(topic string, qos byte, callBack mqtt.MessageHandler) bool
+	SubWithContext(ctx context.Context, topic string, qos byte, callBack mqtt.MessageHandler) error
+	SubMultiple(filters map[string]byte, callBack mqtt.MessageHandler) error
+	SubOnce(ctx context.Context, topic string, qos byte) ([]byte, error)
+	UnSub(topic string) bool
+	UnSubMultipleE(topics ...string) error
+}
+
+// PubSubClient is the mqtt client used by controller and nodes, implemented by Client,
+// so that a fake one can be injected in tests without a live broker
+type PubSubClient interface {
+	Publisher
+	Subscriber
+	Disconnect(quiesce uint)
+}
+
+var _ PubSubClient = &Client{}
+
 type Client struct {
-	client mqtt.Client
+	client          mqtt.Client
+	marshaler       Marshaler
+	disconnected    atomic.Bool
+	offlineQueue    *offlineQueue
+	connectionState chan bool
+	metrics         MetricsRecorder
+	dedup           *deduplicator
+	maxPayloadBytes int
+	onHandlerPanic  HandlerPanicHandler
+
+	// subscriptions are replayed once reconnected if resubscribe, i.e. clean session
+	subscriptions subscriptionRegistry
+	resubscribe   bool
+
+	// connected is closed while the client is connected, renewed once connection lost
+	connectedLock sync.Mutex
+	connected     chan struct{}
 }
 
 type ClientConfig struct {
-	Broker                string
-	Port                  int
+	// Broker is the host of the primary broker, connected on Port
+	Broker string
+
+	// Brokers are the brokers failed over to in order if Broker is down, each "host" or "host:port",
+	// Port is used if no port. Broker may be empty if Brokers set
+	Brokers []string
+
+	Port int
+
 	ClientID              string
 	Username              string
 	Password              string
 	CAPath                string
 	ClientCrtPath         string
 	ClientKeyPath         string
+	InsecureSkipVerify    bool
+	WillTopic             string
+	WillPayload           []byte
+	WillQos               byte
+	WillRetained          bool
 	CleanSession          bool
 	KeepAlive             time.Duration
+	MaxQueuedMessages     int
+	Marshaler             Marshaler
 	DefaultMessageHandler mqtt.MessageHandler
 	OnConnectHandler      mqtt.OnConnectHandler
 	ConnectionLostHandler mqtt.ConnectionLostHandler
+	MetricsRecorder       MetricsRecorder
+
+	// Router handles the messages delivered to no subscription callback, e.g. the ones of a persistent session
+	// redelivered before subscribed again, callers register their routes on it. ignored if DefaultMessageHandler set
+	Router *TopicRouter
+
+	// MaxReconnectInterval is the upper bound of the exponential reconnect backoff, paho default is 10 minutes.
+	// a random jitter of up to 20% is added so that a fleet of clients don't reconnect simultaneously
+	MaxReconnectInterval time.Duration
+
+	// ConnectRetryInterval enables retrying the initial connect with the interval plus up to 20% jitter,
+	// note that NewMqttClient would block until connected or ConnectTimeout elapsed once it is set
+	ConnectRetryInterval time.Duration
+
+	// ConnectTimeout bounds waiting for the initial connect in NewMqttClient, DefaultConnectTimeout if zero
+	ConnectTimeout time.Duration
+
+	// DedupTTL enables dropping Qos1 messages with the same topic and payload redelivered within the window,
+	// so that subscription callbacks are not invoked twice for one message
+	DedupTTL time.Duration
+
+	// MaxPayloadBytes rejects publishing payloads larger than it before sending to broker, unlimited if zero
+	MaxPayloadBytes int
+
+	// OnHandlerPanic is called once a subscription callback or the default message handler panicked, the panic is
+	// always recovered and logged with the topic and payload, so that a malformed message doesn't crash the process
+	OnHandlerPanic HandlerPanicHandler
+
+	// CAPem, ClientCrtPem and ClientKeyPem are the pem encoded tls material, e.g. injected from a secret by env,
+	// each takes precedence over the file of its path so that no filesystem mount is required
+	CAPem        []byte
+	ClientCrtPem []byte
+	ClientKeyPem []byte
+}
+
+// brokerAddrs returns the "host:port" of Broker and Brokers in failover order
+func (cfg *ClientConfig) brokerAddrs() ([]string, error) {
+	brokers := make([]string, 0, len(cfg.Brokers)+1)
+	if cfg.Broker != "" {
+		brokers = append(brokers, net.JoinHostPort(cfg.Broker, strconv.Itoa(cfg.Port)))
+	}
+	for _, broker := range cfg.Brokers {
+		host, port, err := net.SplitHostPort(broker)
+		if err != nil {
+			// no port, or an ipv6 host without port
+			host, port = strings.Trim(broker, "[]"), strconv.Itoa(cfg.Port)
+		}
+		if host == "" {
+			return nil, fmt.Errorf("%w: broker %q has no host", ErrInvalidClientConfig, broker)
+		}
+		if portNum, err := strconv.Atoi(port); err != nil || portNum < 1 || portNum > 65535 {
+			return nil, fmt.Errorf("%w: broker %q port out of range [1, 65535]", ErrInvalidClientConfig, broker)
+		}
+		brokers = append(brokers, net.JoinHostPort(host, port))
+	}
+	return brokers, nil
+}
+
+// tlsEnabled returns true if ca is configured by either pem or path
+func (cfg *ClientConfig) tlsEnabled() bool {
+	return len(cfg.CAPem) > 0 || cfg.CAPath != ""
+}
+
+// Validate check the required fields of client config, so that misconfiguration fails fast before dialing
+func (cfg *ClientConfig) Validate() error {
+	if cfg.Broker == "" && len(cfg.Brokers) == 0 {
+		return fmt.Errorf("%w: broker cannot be empty", ErrInvalidClientConfig)
+	}
+	if cfg.Port < 1 || cfg.Port > 65535 {
+		return fmt.Errorf("%w: port %d out of range [1, 65535]", ErrInvalidClientConfig, cfg.Port)
+	}
+	if _, err := cfg.brokerAddrs(); err != nil {
+		return err
+	}
+	if cfg.ClientID == "" {
+		return fmt.Errorf("%w: client id cannot be empty", ErrInvalidClientConfig)
+	}
+	if len(cfg.ClientID) > MaxClientIDLength {
+		return fmt.Errorf("%w: client id longer than %d bytes", ErrInvalidClientConfig, MaxClientIDLength)
+	}
+	if !utf8.ValidString(cfg.ClientID) {
+		return fmt.Errorf("%w: client id is not valid utf-8", ErrInvalidClientConfig)
+	}
+	hasClientCrt := len(cfg.ClientCrtPem) > 0 || cfg.ClientCrtPath != ""
+	hasClientKey := len(cfg.ClientKeyPem) > 0 || cfg.ClientKeyPath != ""
+	if hasClientCrt != hasClientKey {
+		return fmt.Errorf("%w: client crt and client key must be set together", ErrInvalidClientConfig)
+	}
+	if hasClientCrt && !cfg.tlsEnabled() {
+		return fmt.Errorf("%w: ca is required when client key pair is set", ErrInvalidClientConfig)
+	}
+	return nil
 }
 
-var defaultMessageHandler mqtt.MessageHandler = func(client mqtt.Client, msg mqtt.Message) {
-	log.G(context.Background()).Infof("Received message: %s from topic: %s\n", msg.Payload(), msg.Topic())
+// defaultMessageHandler drops messages not delivered to any subscription callback, set Router of ClientConfig to handle them
+var defaultMessageHandler mqtt.MessageHandler = NewTopicRouter(nil).HandleMessage
+
+// connectionLogger returns the logger attributing connection events to the broker and client id,
+// so that events of many clients in one process can be told apart
+func connectionLogger(broker, clientID string) log.Logger {
+	return log.G(context.Background()).WithFields(log.Fields{
+		"broker":   broker,
+		"clientID": clientID,
+	})
 }
 
-var defaultOnConnectHandler mqtt.OnConnectHandler = func(client mqtt.Client) {
-	log.G(context.Background()).Info("Connected")
+func newDefaultOnConnectHandler(broker, clientID string) mqtt.OnConnectHandler {
+	return func(_ mqtt.Client) {
+		connectionLogger(broker, clientID).Info("Connected")
+	}
+}
+
+func newDefaultConnectionLostHandler(broker, clientID string) mqtt.ConnectionLostHandler {
+	return func(_ mqtt.Client, err error) {
+		connectionLogger(broker, clientID).WithError(err).Warn("Connect lost")
+	}
 }
 
-var defaultConnectionLostHandler mqtt.ConnectionLostHandler = func(client mqtt.Client, err error) {
-	log.G(context.Background()).Warnf("Connect lost: %v\n", err)
+const (
+	// TLSFileCA is the ca certificate of broker
+	TLSFileCA = "ca"
+
+	// TLSFileClientCert is the client certificate for mutual tls
+	TLSFileClientCert = "client cert"
+
+	// TLSFileClientKey is the client private key for mutual tls
+	TLSFileClientKey = "client key"
+)
+
+// TLSConfigError records which tls file failed to load and the underlying cause
+type TLSConfigError struct {
+	// File is one of TLSFileCA, TLSFileClientCert and TLSFileClientKey
+	File string
+	// Path is empty if the material is loaded from pem
+	Path string
+	Err  error
+}
+
+func (e *TLSConfigError) Error() string {
+	if e.Path == "" {
+		return fmt.Sprintf("failed to load mqtt tls %s from pem: %v", e.File, e.Err)
+	}
+	return fmt.Sprintf("failed to load mqtt tls %s from %s: %v", e.File, e.Path, e.Err)
+}
+
+// loadTLSMaterial returns pem if set, otherwise reads the file of path
+func loadTLSMaterial(file string, pem []byte, path string) ([]byte, error) {
+	if len(pem) > 0 {
+		return pem, nil
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, &TLSConfigError{File: file, Path: path, Err: err}
+	}
+	return content, nil
+}
+
+// tlsMaterialPath returns the path the material is loaded from, empty if loaded from pem
+func tlsMaterialPath(pem []byte, path string) string {
+	if len(pem) > 0 {
+		return ""
+	}
+	return path
+}
+
+func (e *TLSConfigError) Unwrap() error {
+	return e.Err
 }
 
 // newTlsConfig create a tls config using client config
 func newTlsConfig(cfg *ClientConfig) (*tls.Config, error) {
-	config := tls.Config{
-		InsecureSkipVerify: true,
+	config := tls.Config{}
+	// the server name is inferred from the host dialed if there are failover brokers, each with its own name
+	if len(cfg.Brokers) == 0 {
+		config.ServerName = cfg.Broker
+	}
+	if cfg.InsecureSkipVerify {
+		// only skip server certificate verification when explicitly required
+		config.InsecureSkipVerify = true
 	}
 
 	certpool := x509.NewCertPool()
-	ca, err := os.ReadFile(cfg.CAPath)
+	ca, err := loadTLSMaterial(TLSFileCA, cfg.CAPem, cfg.CAPath)
 	if err != nil {
 		return nil, err
 	}
-	certpool.AppendCertsFromPEM(ca)
+	if !certpool.AppendCertsFromPEM(ca) {
+		return nil, &TLSConfigError{File: TLSFileCA, Path: tlsMaterialPath(cfg.CAPem, cfg.CAPath), Err: errors.New("no valid pem certificate found")}
+	}
 	config.RootCAs = certpool
-	if cfg.ClientCrtPath != "" {
+	if len(cfg.ClientCrtPem) > 0 || cfg.ClientCrtPath != "" {
 		// Import client certificate/key pair
-		clientKeyPair, err := tls.LoadX509KeyPair(cfg.ClientCrtPath, cfg.ClientKeyPath)
+		clientCrt, err := loadTLSMaterial(TLSFileClientCert, cfg.ClientCrtPem, cfg.ClientCrtPath)
+		if err != nil {
+			return nil, err
+		}
+		clientKey, err := loadTLSMaterial(TLSFileClientKey, cfg.ClientKeyPem, cfg.ClientKeyPath)
 		if err != nil {
 			return nil, err
 		}
+		clientKeyPair, err := tls.X509KeyPair(clientCrt, clientKey)
+		if err != nil {
+			return nil, &TLSConfigError{File: TLSFileClientCert, Path: tlsMaterialPath(cfg.ClientCrtPem, cfg.ClientCrtPath), Err: err}
+		}
 		config.Certificates = []tls.Certificate{clientKeyPair}
-		config.ClientAuth = tls.NoClientCert
+		// always present the client certificate for mutual tls, Certificates alone is skipped if the broker
+		// advertises acceptable CAs not matching the certificate issuer, e.g. an intermediate CA
+		config.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return &clientKeyPair, nil
+		}
 	}
 
 	return &config, nil
 }
 
-// NewMqttClient create a new client using client config
-func NewMqttClient(cfg *ClientConfig) (*Client, error) {
+// withJitter add a random jitter of up to 20% to the interval
+func withJitter(interval time.Duration) time.Duration {
+	return interval + time.Duration(rand.Int63n(int64(interval)/5+1))
+}
+
+// newClientOptions create paho client options using client config
+func newClientOptions(cfg *ClientConfig) (*mqtt.ClientOptions, error) {
 	opts := mqtt.NewClientOptions()
-	broker := ""
 	opts.SetClientID(cfg.ClientID)
-	if cfg.CAPath != "" {
+
+	if cfg.tlsEnabled() {
 		// tls configured
 		tlsConfig, err := newTlsConfig(cfg)
 		if err != nil {
 			return nil, err
 		}
 		opts.SetTLSConfig(tlsConfig)
-		broker = fmt.Sprintf("ssl://%s:%d", cfg.Broker, cfg.Port)
-	} else {
-		broker = fmt.Sprintf("tcp://%s:%d", cfg.Broker, cfg.Port)
+	}
+	// credentials are orthogonal to tls, secured brokers usually require both
+	if cfg.Username != "" {
 		opts.SetUsername(cfg.Username)
+	}
+	if cfg.Password != "" {
 		opts.SetPassword(cfg.Password)
 	}
 
-	opts.AddBroker(broker)
+	brokerAddrs, err := cfg.brokerAddrs()
+	if err != nil {
+		return nil, err
+	}
+	scheme := "tcp"
+	if cfg.tlsEnabled() {
+		scheme = "ssl"
+	}
+	// paho connects the brokers in order, and fails over to the next one once the connection lost
+	brokers := make([]string, 0, len(brokerAddrs))
+	for _, addr := range brokerAddrs {
+		brokers = append(brokers, fmt.Sprintf("%s://%s", scheme, addr))
+		opts.AddBroker(brokers[len(brokers)-1])
+	}
+	broker := strings.Join(brokers, ",")
 
+	if cfg.DefaultMessageHandler == nil && cfg.Router != nil {
+		cfg.DefaultMessageHandler = cfg.Router.HandleMessage
+	}
 	if cfg.DefaultMessageHandler == nil {
 		cfg.DefaultMessageHandler = defaultMessageHandler
 	}
 
 	if cfg.OnConnectHandler == nil {
-		cfg.OnConnectHandler = defaultOnConnectHandler
+		cfg.OnConnectHandler = newDefaultOnConnectHandler(broker, cfg.ClientID)
 	}
 
 	if cfg.ConnectionLostHandler == nil {
-		cfg.ConnectionLostHandler = defaultConnectionLostHandler
+		cfg.ConnectionLostHandler = newDefaultConnectionLostHandler(broker, cfg.ClientID)
 	}
 
 	if cfg.KeepAlive == 0 {
 		cfg.KeepAlive = time.Minute
 	}
 
-	opts.SetDefaultPublishHandler(cfg.DefaultMessageHandler)
+	opts.SetDefaultPublishHandler(observeReceiveHandler(cfg.MetricsRecorder, recoverHandler(cfg.OnHandlerPanic, cfg.DefaultMessageHandler)))
 	opts.SetAutoReconnect(true)
+	if cfg.MaxReconnectInterval > 0 {
+		opts.SetMaxReconnectInterval(withJitter(cfg.MaxReconnectInterval))
+	}
+	if cfg.ConnectRetryInterval > 0 {
+		opts.SetConnectRetry(true)
+		opts.SetConnectRetryInterval(withJitter(cfg.ConnectRetryInterval))
+	}
 	opts.SetKeepAlive(cfg.KeepAlive)
 	opts.SetCleanSession(cfg.CleanSession)
 	opts.SetOnConnectHandler(cfg.OnConnectHandler)
 	opts.SetConnectionLostHandler(cfg.ConnectionLostHandler)
-	client := mqtt.NewClient(opts)
-	if token := client.Connect(); token.Wait() && token.Error() != nil {
+
+	if cfg.WillTopic != "" {
+		// last will message would be published by broker once the client disconnected unexpectedly
+		opts.SetBinaryWill(cfg.WillTopic, cfg.WillPayload, cfg.WillQos, cfg.WillRetained)
+	}
+	return opts, nil
+}
+
+// NewMqttClient create a new client using client config
+func NewMqttClient(cfg *ClientConfig) (*Client, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	opts, err := newClientOptions(cfg)
+	if err != nil {
+		return nil, err
+	}
+	ret := &Client{
+		marshaler:       cfg.Marshaler,
+		connectionState: make(chan bool, 10),
+		metrics:         cfg.MetricsRecorder,
+		maxPayloadBytes: cfg.MaxPayloadBytes,
+		onHandlerPanic:  cfg.OnHandlerPanic,
+		resubscribe:     cfg.CleanSession,
+	}
+	if cfg.DedupTTL > 0 {
+		ret.dedup = newDeduplicator(cfg.DedupTTL)
+	}
+	if cfg.MaxQueuedMessages > 0 {
+		// buffer publishes while disconnected, flush them once connected again
+		ret.offlineQueue = newOfflineQueue(cfg.MaxQueuedMessages)
+	}
+	onConnectHandler := cfg.OnConnectHandler
+	opts.SetOnConnectHandler(func(client mqtt.Client) {
+		ret.onConnected()
+		onConnectHandler(client)
+	})
+	connectionLostHandler := cfg.ConnectionLostHandler
+	opts.SetConnectionLostHandler(func(client mqtt.Client, err error) {
+		ret.notifyConnectionState(false)
+		connectionLostHandler(client, err)
+	})
+	ret.client = mqtt.NewClient(opts)
+	connectTimeout := cfg.ConnectTimeout
+	if connectTimeout <= 0 {
+		connectTimeout = DefaultConnectTimeout
+	}
+	token := ret.client.Connect()
+	if !token.WaitTimeout(connectTimeout) {
+		// stop the connect retry in background
+		ret.client.Disconnect(0)
+		brokerAddrs, _ := cfg.brokerAddrs()
+		return nil, fmt.Errorf("%w: broker %s not connected within %s", ErrConnectTimeout, strings.Join(brokerAddrs, ","), connectTimeout)
+	}
+	if token.Error() != nil {
 		return nil, token.Error()
 	}
-	return &Client{
-		client: client,
-	}, nil
+	return ret, nil
+}
+
+// validateQos check qos is one of Qos0, Qos1 and Qos2
+func validateQos(qos byte) error {
+	if qos > Qos2 {
+		return fmt.Errorf("%w: %d", ErrInvalidQos, qos)
+	}
+	return nil
+}
+
+// checkOperation check the client is still usable and qos is valid before pub/sub
+func (c *Client) checkOperation(qos byte) error {
+	if c.disconnected.Load() {
+		return ErrClientDisconnected
+	}
+	return validateQos(qos)
+}
+
+// checkPayloadSize reject payload larger than max payload bytes, msg is a payload returned by encodePayload
+func (c *Client) checkPayloadSize(msg interface{}) error {
+	if c.maxPayloadBytes <= 0 {
+		return nil
+	}
+	size := 0
+	switch m := msg.(type) {
+	case []byte:
+		size = len(m)
+	case string:
+		size = len(m)
+	case bytes.Buffer:
+		size = m.Len()
+	case *bytes.Buffer:
+		size = m.Len()
+	}
+	if size > c.maxPayloadBytes {
+		return fmt.Errorf("%w: %d bytes exceeds limit %d", ErrPayloadTooLarge, size, c.maxPayloadBytes)
+	}
+	return nil
+}
+
+// encodePayload returns the raw payloads published by paho as is, i.e. string, []byte, bytes.Buffer and *bytes.Buffer,
+// and the others encoded with client marshaler
+func (c *Client) encodePayload(msg interface{}) (interface{}, error) {
+	switch msg.(type) {
+	case string, []byte, bytes.Buffer, *bytes.Buffer:
+		return msg, nil
+	}
+	return c.encode(msg)
+}
+
+// encode marshal v with client marshaler, json by default
+func (c *Client) encode(v interface{}) ([]byte, error) {
+	if c.marshaler == nil {
+		return JSONMarshaler{}.Marshal(v)
+	}
+	return c.marshaler.Marshal(v)
+}
+
+// publish send a message to broker, status messages are retained by default
+func (c *Client) publish(topic string, qos byte, retained bool, msg interface{}) mqtt.Token {
+	if c.offlineQueue != nil && !c.client.IsConnected() {
+		c.offlineQueue.push(offlineMessage{
+			topic:    topic,
+			qos:      qos,
+			retained: retained,
+			payload:  msg,
+		})
+		return newQueuedToken()
+	}
+	return c.client.Publish(topic, qos, retained, msg)
+}
+
+// flushOfflineQueue publish all messages buffered while disconnected
+func (c *Client) flushOfflineQueue() {
+	for _, msg := range c.offlineQueue.drain() {
+		c.client.Publish(msg.topic, msg.qos, msg.retained, msg.payload)
+	}
+}
+
+// notifyConnectionState send connection state transition without blocking paho callbacks, stale states are dropped if no one consumes
+func (c *Client) notifyConnectionState(connected bool) {
+	c.signalConnected(connected)
+	select {
+	case c.connectionState <- connected:
+		return
+	default:
+	}
+	select {
+	case <-c.connectionState:
+	default:
+	}
+	select {
+	case c.connectionState <- connected:
+	default:
+	}
+}
+
+// connectedChan returns the channel closed once the client connected
+func (c *Client) connectedChan() chan struct{} {
+	c.connectedLock.Lock()
+	defer c.connectedLock.Unlock()
+	if c.connected == nil {
+		c.connected = make(chan struct{})
+	}
+	return c.connected
+}
+
+func (c *Client) signalConnected(connected bool) {
+	ch := c.connectedChan()
+	c.connectedLock.Lock()
+	defer c.connectedLock.Unlock()
+	select {
+	case <-ch:
+		if !connected {
+			c.connected = make(chan struct{})
+		}
+	default:
+		if connected {
+			close(ch)
+		}
+	}
+}
+
+// WaitForConnection block until the client is connected to broker, return ctx.Err() if ctx done first
+func (c *Client) WaitForConnection(ctx context.Context) error {
+	if c.disconnected.Load() {
+		return ErrClientDisconnected
+	}
+	if c.IsConnected() {
+		return nil
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-c.connectedChan():
+		return nil
+	}
+}
+
+// IsConnected returns whether the client is connected to broker
+func (c *Client) IsConnected() bool {
+	return c.client.IsConnected()
+}
+
+// ConnectionState returns a channel emitting connection state transitions, true for connected and false for connection lost
+func (c *Client) ConnectionState() <-chan bool {
+	return c.connectionState
+}
+
+// QueueLen returns the count of messages buffered while disconnected
+func (c *Client) QueueLen() int {
+	if c.offlineQueue == nil {
+		return 0
+	}
+	return c.offlineQueue.len()
+}
+
+// wrapHandler wrap subscription callback with metrics, deduplication and panic recovery
+func (c *Client) wrapHandler(callBack mqtt.MessageHandler) mqtt.MessageHandler {
+	return observeReceiveHandler(c.metrics, dedupHandler(c.dedup, recoverHandler(c.onHandlerPanic, callBack)))
+}
+
+// metricsRecorder returns the configured MetricsRecorder, a noop one if not set
+func (c *Client) metricsRecorder() MetricsRecorder {
+	if c.metrics == nil {
+		return noopMetricsRecorder{}
+	}
+	return c.metrics
+}
+
+// observePublish record the publish started at start and pass through err
+func (c *Client) observePublish(topic string, qos byte, start time.Time, err error) error {
+	c.metricsRecorder().ObservePublish(topic, qos, time.Since(start), err)
+	return err
+}
+
+// PubWithTimeoutE publish a message to target topic with timeout config, return ErrPublishTimeout if timeout or the underlying error if send failed
+func (c *Client) PubWithTimeoutE(topic string, qos byte, msg interface{}, timeout time.Duration) error {
+	if err := c.checkOperation(qos); err != nil {
+		return err
+	}
+	msg, err := c.encodePayload(msg)
+	if err != nil {
+		return err
+	}
+	if err := c.checkPayloadSize(msg); err != nil {
+		return err
+	}
+	start := time.Now()
+	token := c.publish(topic, qos, true, msg)
+	if !token.WaitTimeout(timeout) {
+		return c.observePublish(topic, qos, start, ErrPublishTimeout)
+	}
+	return c.observePublish(topic, qos, start, token.Error())
+}
+
+// PubE publish a message to target topic, waiting for publish operation finish, return the underlying error if send failed
+func (c *Client) PubE(topic string, qos byte, msg interface{}) error {
+	if err := c.checkOperation(qos); err != nil {
+		return err
+	}
+	msg, err := c.encodePayload(msg)
+	if err != nil {
+		return err
+	}
+	if err := c.checkPayloadSize(msg); err != nil {
+		return err
+	}
+	start := time.Now()
+	token := c.publish(topic, qos, true, msg)
+	token.Wait()
+	return c.observePublish(topic, qos, start, token.Error())
+}
+
+// PubWithContext publish a retained message to target topic, waiting for publish operation finish or ctx done, return ctx.Err() if ctx done first
+func (c *Client) PubWithContext(ctx context.Context, topic string, qos byte, msg interface{}) error {
+	return c.PubWithRetained(ctx, topic, qos, true, msg)
+}
+
+// PubJSON marshal v with client marshaler, json by default, and publish the bytes to target topic
+func (c *Client) PubJSON(topic string, qos byte, v interface{}) error {
+	payload, err := c.encode(v)
+	if err != nil {
+		return err
+	}
+	return c.PubE(topic, qos, payload)
+}
+
+// PubWithRetained publish a message to target topic with retained flag, waiting for publish operation finish or ctx done.
+// retained message would be replayed to new subscribers by broker, so ephemeral commands should not be retained.
+func (c *Client) PubWithRetained(ctx context.Context, topic string, qos byte, retained bool, msg interface{}) error {
+	if err := c.checkOperation(qos); err != nil {
+		return err
+	}
+	msg, err := c.encodePayload(msg)
+	if err != nil {
+		return err
+	}
+	if err := c.checkPayloadSize(msg); err != nil {
+		return err
+	}
+	start := time.Now()
+	token := c.publish(topic, qos, retained, msg)
+	select {
+	case <-ctx.Done():
+		return c.observePublish(topic, qos, start, ctx.Err())
+	case <-token.Done():
+		return c.observePublish(topic, qos, start, token.Error())
+	}
+}
+
+// ClearRetained publish a zero-length retained message to target topic, so that broker removes the message retained on it
+func (c *Client) ClearRetained(topic string) error {
+	return c.PubWithRetained(context.Background(), topic, Qos1, true, []byte{})
+}
+
+// PubAsync publish a non-retained message to target topic without waiting, onComplete is invoked from a goroutine with
+// the publish result once the token completed, i.e. acknowledged by broker for Qos1 and Qos2, onComplete may be nil
+func (c *Client) PubAsync(topic string, qos byte, msg interface{}, onComplete func(error)) {
+	complete := func(err error) {
+		if onComplete != nil {
+			onComplete(err)
+		}
+	}
+	if err := c.checkOperation(qos); err != nil {
+		go complete(err)
+		return
+	}
+	msg, err := c.encodePayload(msg)
+	if err != nil {
+		go complete(err)
+		return
+	}
+	if err := c.checkPayloadSize(msg); err != nil {
+		go complete(err)
+		return
+	}
+	start := time.Now()
+	token := c.publish(topic, qos, false, msg)
+	go func() {
+		<-token.Done()
+		complete(c.observePublish(topic, qos, start, token.Error()))
+	}()
 }
 
 // PubWithTimeout publish a message to target topic with timeout config, return false if send failed or timeout
 func (c *Client) PubWithTimeout(topic string, qos byte, msg interface{}, timeout time.Duration) bool {
-	return c.client.Publish(topic, qos, true, msg).WaitTimeout(timeout)
+	err := c.PubWithTimeoutE(topic, qos, msg, timeout)
+	if errors.Is(err, ErrInvalidQos) || errors.Is(err, ErrPayloadTooLarge) {
+		log.G(context.Background()).WithError(err).Warnf("failed to publish to topic %s", topic)
+	}
+	return err == nil
 }
 
 // Pub publish a message to target topic, waiting for publish operation finish, return false if send failed
 func (c *Client) Pub(topic string, qos byte, msg interface{}) bool {
-	return c.client.Publish(topic, qos, true, msg).Wait()
+	err := c.PubE(topic, qos, msg)
+	if errors.Is(err, ErrInvalidQos) || errors.Is(err, ErrPayloadTooLarge) {
+		log.G(context.Background()).WithError(err).Warnf("failed to publish to topic %s", topic)
+	}
+	return err == nil
 }
 
 // SubWithTimeout subscribe a topic with callback, return false if subscription's creation fail or creation timeout
 func (c *Client) SubWithTimeout(topic string, qos byte, timeout time.Duration, callBack mqtt.MessageHandler) bool {
-	return c.client.Subscribe(topic, qos, callBack).WaitTimeout(timeout)
+	if err := c.checkOperation(qos); err != nil {
+		log.G(context.Background()).WithError(err).Warnf("failed to subscribe topic %s", topic)
+		return false
+	}
+	handler := c.wrapHandler(callBack)
+	token := c.client.Subscribe(topic, qos, handler)
+	if !token.WaitTimeout(timeout) {
+		c.metricsRecorder().ObserveSubscribe(topic, qos, context.DeadlineExceeded)
+		return false
+	}
+	c.metricsRecorder().ObserveSubscribe(topic, qos, token.Error())
+	if token.Error() == nil {
+		c.subscriptions.add(topic, qos, handler)
+	}
+	return true
+}
+
+// SubWithContext subscribe a topic with callback bound to ctx, waiting for subscription's creation or ctx done,
+// the topic is unsubscribed once ctx done, e.g. a per node context cancelled once the node removed.
+// note that subscribing the same topic elsewhere shares the subscription, which is unsubscribed as well
+func (c *Client) SubWithContext(ctx context.Context, topic string, qos byte, callBack mqtt.MessageHandler) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := c.checkOperation(qos); err != nil {
+		return err
+	}
+	handler := c.wrapHandler(callBack)
+	token := c.client.Subscribe(topic, qos, handler)
+	select {
+	case <-ctx.Done():
+		c.metricsRecorder().ObserveSubscribe(topic, qos, ctx.Err())
+		// the subscription may still be created by broker
+		go c.UnSub(topic)
+		return ctx.Err()
+	case <-token.Done():
+	}
+	c.metricsRecorder().ObserveSubscribe(topic, qos, token.Error())
+	if err := token.Error(); err != nil {
+		return err
+	}
+	c.subscriptions.add(topic, qos, handler)
+	go func() {
+		<-ctx.Done()
+		c.UnSub(topic)
+	}()
+	return nil
 }
 
 // Sub subscribe a topic with callback, return false if subscription's creation fail
 func (c *Client) Sub(topic string, qos byte, callBack mqtt.MessageHandler) bool {
-	return c.client.Subscribe(topic, qos, callBack).Wait()
+	if err := c.checkOperation(qos); err != nil {
+		log.G(context.Background()).WithError(err).Warnf("failed to subscribe topic %s", topic)
+		return false
+	}
+	handler := c.wrapHandler(callBack)
+	token := c.client.Subscribe(topic, qos, handler)
+	ret := token.Wait()
+	c.metricsRecorder().ObserveSubscribe(topic, qos, token.Error())
+	if token.Error() == nil {
+		c.subscriptions.add(topic, qos, handler)
+	}
+	return ret
+}
+
+// SubWithGrantedQos subscribe a topic with callback and return the qos granted by broker in SUBACK,
+// which may be lower than requested due to broker policy, a warning is logged in that case
+func (c *Client) SubWithGrantedQos(topic string, qos byte, callBack mqtt.MessageHandler) (byte, error) {
+	if err := c.checkOperation(qos); err != nil {
+		return 0, err
+	}
+	handler := c.wrapHandler(callBack)
+	token := c.client.Subscribe(topic, qos, handler)
+	token.Wait()
+	err := token.Error()
+	granted := qos
+	if err == nil {
+		if subscribeToken, ok := token.(*mqtt.SubscribeToken); ok {
+			granted, err = resolveGrantedQos(topic, qos, subscribeToken.Result())
+		}
+	}
+	c.metricsRecorder().ObserveSubscribe(topic, qos, err)
+	if err != nil {
+		return 0, err
+	}
+	if granted < qos {
+		log.G(context.Background()).Warnf("broker granted qos %d lower than requested %d for topic %s", granted, qos, topic)
+	}
+	c.subscriptions.add(topic, qos, handler)
+	return granted, nil
+}
+
+// resolveGrantedQos returns the granted qos of topic in SUBACK result, ErrSubscriptionRejected if broker rejected it
+func resolveGrantedQos(topic string, requested byte, result map[string]byte) (byte, error) {
+	granted, has := result[topic]
+	if !has || granted == 0x80 {
+		return 0, fmt.Errorf("%w: topic %s with qos %d", ErrSubscriptionRejected, topic, requested)
+	}
+	return granted, nil
+}
+
+// SubMultiple subscribe multiple topic filters with callback in a single control packet,
+// return error describing the filters which broker rejected or granted a lower qos than requested
+func (c *Client) SubMultiple(filters map[string]byte, callBack mqtt.MessageHandler) error {
+	for filter, qos := range filters {
+		if err := c.checkOperation(qos); err != nil {
+			return fmt.Errorf("failed to subscribe %s: %w", filter, err)
+		}
+	}
+	handler := c.wrapHandler(callBack)
+	token := c.client.SubscribeMultiple(filters, handler)
+	token.Wait()
+	err := token.Error()
+	var granted map[string]byte
+	if err == nil {
+		if subscribeToken, ok := token.(*mqtt.SubscribeToken); ok {
+			granted = subscribeToken.Result()
+			err = checkGrantedQos(filters, granted)
+		}
+	}
+	for filter, qos := range filters {
+		c.metricsRecorder().ObserveSubscribe(filter, qos, err)
+		// filters granted a lower qos are still active on broker, only the rejected ones are not
+		grantedQos, has := granted[filter]
+		if token.Error() == nil && (granted == nil || has && grantedQos != 0x80) {
+			c.subscriptions.add(filter, qos, handler)
+		}
+	}
+	return err
+}
+
+// SubOnce subscribe a topic, wait for the first message or ctx done, then unsubscribe and return the payload of the message.
+// It is used to await exactly one reply of a command, the subscription should be made before the command published.
+// ErrAlreadySubscribed is returned if an active subscription matches topic, as unsubscribing would tear it down,
+// such replies should be awaited through the handler of that subscription instead
+func (c *Client) SubOnce(ctx context.Context, topic string, qos byte) ([]byte, error) {
+	if err := c.checkOperation(qos); err != nil {
+		return nil, err
+	}
+	if filter, has := c.subscriptions.matching(topic); has {
+		return nil, fmt.Errorf("%w: %s by %s", ErrAlreadySubscribed, topic, filter)
+	}
+	received := make(chan []byte, 1)
+	token := c.client.Subscribe(topic, qos, c.wrapHandler(func(_ mqtt.Client, msg mqtt.Message) {
+		select {
+		case received <- msg.Payload():
+		default:
+			// only the first message is returned
+		}
+		msg.Ack()
+	}))
+	defer c.UnSub(topic)
+
+	select {
+	case <-ctx.Done():
+		c.metricsRecorder().ObserveSubscribe(topic, qos, ctx.Err())
+		return nil, ctx.Err()
+	case <-token.Done():
+	}
+	c.metricsRecorder().ObserveSubscribe(topic, qos, token.Error())
+	if token.Error() != nil {
+		return nil, token.Error()
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case payload := <-received:
+		return payload, nil
+	}
+}
+
+// checkGrantedQos compare the granted qos in SUBACK with the requested ones
+func checkGrantedQos(requested map[string]byte, granted map[string]byte) error {
+	failed := make([]string, 0)
+	for filter, qos := range requested {
+		grantedQos, has := granted[filter]
+		if !has || grantedQos == 0x80 {
+			failed = append(failed, fmt.Sprintf("%s: rejected", filter))
+			continue
+		}
+		if grantedQos < qos {
+			failed = append(failed, fmt.Sprintf("%s: granted qos %d lower than requested %d", filter, grantedQos, qos))
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	sort.Strings(failed)
+	return fmt.Errorf("subscribe failed for filters [%s]", strings.Join(failed, ", "))
 }
 
 // UnSub unsubscribe a topic
 func (c *Client) UnSub(topic string) bool {
+	if c.disconnected.Load() {
+		return false
+	}
+	c.subscriptions.remove(topic)
 	return c.client.Unsubscribe(topic).Wait()
 }
+
+// UnSubMultiple unsubscribe topic filters in a single control packet, return false if failed
+func (c *Client) UnSubMultiple(topics ...string) bool {
+	return c.UnSubMultipleE(topics...) == nil
+}
+
+// UnSubMultipleE unsubscribe topic filters in a single control packet, filters with wildcards are
+// validated and sent verbatim so they match the filters used on subscribing
+func (c *Client) UnSubMultipleE(topics ...string) error {
+	if c.disconnected.Load() {
+		return ErrClientDisconnected
+	}
+	if len(topics) == 0 {
+		return nil
+	}
+	for _, topic := range topics {
+		if err := ValidateTopicFilter(topic); err != nil {
+			return err
+		}
+	}
+	c.subscriptions.remove(topics...)
+	token := c.client.Unsubscribe(topics...)
+	token.Wait()
+	return token.Error()
+}
+
+// Disconnect close the connection to broker, waiting quiesce milliseconds for existing work to be completed.
+// the client is unusable after disconnected, subsequent pub/sub would fail
+func (c *Client) Disconnect(quiesce uint) {
+	if c.disconnected.Swap(true) {
+		return
+	}
+	c.client.Disconnect(quiesce)
+}
@@ -1,9 +1,19 @@
 package mqtt
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/sirupsen/logrus"
+	logrustest "github.com/sirupsen/logrus/hooks/test"
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+	logruslogger "github.com/virtual-kubelet/virtual-kubelet/log/logrus"
 	"gotest.tools/assert"
+	"net"
+	"os"
+	"strings"
 	"testing"
 	"time"
 )
@@ -47,6 +57,24 @@ func TestNewMqttClient_CA_WithClient(t *testing.T) {
 	assert.Assert(t, client == nil)
 }
 
+func TestNewMqttClient_ConnectTimeout(t *testing.T) {
+	// a broker accepting tcp connections but never answering CONNECT
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NilError(t, err)
+	defer listener.Close()
+
+	start := time.Now()
+	client, err := NewMqttClient(&ClientConfig{
+		Broker:         "127.0.0.1",
+		Port:           listener.Addr().(*net.TCPAddr).Port,
+		ClientID:       "TestNewMqttClientID",
+		ConnectTimeout: 200 * time.Millisecond,
+	})
+	assert.Assert(t, errors.Is(err, ErrConnectTimeout))
+	assert.Assert(t, client == nil)
+	assert.Assert(t, time.Since(start) < 5*time.Second)
+}
+
 func TestClient_Pub_Sub(t *testing.T) {
 	client, err := NewMqttClient(&ClientConfig{
 		Broker:   "broker.emqx.io",
@@ -105,3 +133,535 @@ func TestClient_Pub_Sub_Timeout(t *testing.T) {
 	<-recieved
 	assert.Assert(t, len(msgList) >= 1)
 }
+
+func TestClient_SubOnce(t *testing.T) {
+	client, err := NewMqttClient(&ClientConfig{
+		Broker:   "broker.emqx.io",
+		Port:     1883,
+		ClientID: "TestNewMqttClientID",
+		Username: "emqx",
+		Password: "public",
+	})
+	assert.Assert(t, err == nil)
+	assert.Assert(t, client != nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	go func() {
+		// publish until the subscription made
+		for ctx.Err() == nil {
+			client.PubWithRetained(ctx, "topic/test/virtual-kubelet/once", Qos1, false, "test-reply")
+			time.Sleep(100 * time.Millisecond)
+		}
+	}()
+	payload, err := client.SubOnce(ctx, "topic/test/virtual-kubelet/once", Qos1)
+	assert.NilError(t, err)
+	assert.Equal(t, string(payload), "test-reply")
+}
+
+func TestClient_SubOnce_NotConnected(t *testing.T) {
+	client := &Client{
+		client: mqtt.NewClient(mqtt.NewClientOptions()),
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_, err := client.SubOnce(ctx, "topic/test/virtual-kubelet", Qos1)
+	assert.Assert(t, err != nil)
+
+	_, err = client.SubOnce(ctx, "topic/test/virtual-kubelet", 3)
+	assert.Assert(t, errors.Is(err, ErrInvalidQos))
+
+	// a topic covered by an active subscription is not subscribed and torn down again
+	client.subscriptions.add("topic/+/virtual-kubelet", Qos1, nil)
+	_, err = client.SubOnce(ctx, "topic/test/virtual-kubelet", Qos1)
+	assert.Assert(t, errors.Is(err, ErrAlreadySubscribed))
+	assert.Equal(t, len(client.Subscriptions()), 1)
+
+	client.Disconnect(0)
+	_, err = client.SubOnce(ctx, "topic/test/virtual-kubelet", Qos1)
+	assert.Assert(t, errors.Is(err, ErrClientDisconnected))
+}
+
+func TestNewTlsConfig_Verify(t *testing.T) {
+	config, err := newTlsConfig(&ClientConfig{
+		Broker: "broker.emqx.io",
+		CAPath: "../../samples/sample-ca.crt",
+	})
+	assert.NilError(t, err)
+	assert.Assert(t, !config.InsecureSkipVerify)
+	assert.Assert(t, config.ServerName == "broker.emqx.io")
+}
+
+func TestNewTlsConfig_InsecureSkipVerify(t *testing.T) {
+	config, err := newTlsConfig(&ClientConfig{
+		Broker:             "broker.emqx.io",
+		CAPath:             "../../samples/sample-ca.crt",
+		InsecureSkipVerify: true,
+	})
+	assert.NilError(t, err)
+	assert.Assert(t, config.InsecureSkipVerify)
+}
+
+func TestNewClientOptions_Will(t *testing.T) {
+	opts, err := newClientOptions(&ClientConfig{
+		Broker:       "broker.emqx.io",
+		Port:         1883,
+		ClientID:     "TestNewMqttClientID",
+		WillTopic:    "koupleless/test/base/status",
+		WillPayload:  []byte{0x00, 0x01},
+		WillQos:      Qos1,
+		WillRetained: true,
+	})
+	assert.NilError(t, err)
+	assert.Assert(t, opts.WillEnabled)
+	assert.Assert(t, opts.WillTopic == "koupleless/test/base/status")
+	assert.DeepEqual(t, opts.WillPayload, []byte{0x00, 0x01})
+	assert.Assert(t, opts.WillQos == Qos1)
+	assert.Assert(t, opts.WillRetained)
+}
+
+func TestNewClientOptions_NoWill(t *testing.T) {
+	opts, err := newClientOptions(&ClientConfig{
+		Broker:   "broker.emqx.io",
+		Port:     1883,
+		ClientID: "TestNewMqttClientID",
+	})
+	assert.NilError(t, err)
+	assert.Assert(t, !opts.WillEnabled)
+}
+
+func TestNewClientOptions_Brokers(t *testing.T) {
+	opts, err := newClientOptions(&ClientConfig{
+		Broker:   "broker-a",
+		Brokers:  []string{"broker-b", "broker-c:2883", "::1", "[::2]:3883"},
+		Port:     1883,
+		ClientID: "TestNewMqttClientID",
+	})
+	assert.NilError(t, err)
+	servers := make([]string, 0, len(opts.Servers))
+	for _, server := range opts.Servers {
+		servers = append(servers, server.String())
+	}
+	assert.DeepEqual(t, servers, []string{"tcp://broker-a:1883", "tcp://broker-b:1883", "tcp://broker-c:2883", "tcp://[::1]:1883", "tcp://[::2]:3883"})
+
+	opts, err = newClientOptions(&ClientConfig{
+		Brokers:  []string{"broker-a:8883", "broker-b:8883"},
+		Port:     8883,
+		ClientID: "TestNewMqttClientID",
+		CAPath:   "../../samples/sample-ca.crt",
+	})
+	assert.NilError(t, err)
+	assert.Equal(t, len(opts.Servers), 2)
+	assert.Equal(t, opts.Servers[1].String(), "ssl://broker-b:8883")
+	// inferred from the broker dialed
+	assert.Equal(t, opts.TLSConfig.ServerName, "")
+}
+
+func TestNewClientOptions_Credentials(t *testing.T) {
+	opts, err := newClientOptions(&ClientConfig{
+		Broker:   "broker.emqx.io",
+		Port:     8883,
+		ClientID: "TestNewMqttClientID",
+		Username: "emqx",
+		Password: "public",
+		CAPath:   "../../samples/sample-ca.crt",
+	})
+	assert.NilError(t, err)
+	assert.Assert(t, opts.TLSConfig != nil)
+	assert.Equal(t, opts.Servers[0].Scheme, "ssl")
+	assert.Equal(t, opts.Username, "emqx")
+	assert.Equal(t, opts.Password, "public")
+
+	opts, err = newClientOptions(&ClientConfig{
+		Broker:   "broker.emqx.io",
+		Port:     1883,
+		ClientID: "TestNewMqttClientID",
+		Username: "emqx",
+		Password: "public",
+	})
+	assert.NilError(t, err)
+	assert.Equal(t, opts.Servers[0].Scheme, "tcp")
+	assert.Equal(t, opts.Username, "emqx")
+	assert.Equal(t, opts.Password, "public")
+}
+
+func TestClient_PubE_NotConnected(t *testing.T) {
+	client := &Client{
+		client: mqtt.NewClient(mqtt.NewClientOptions()),
+	}
+	err := client.PubE("topic/test/virtual-kubelet", Qos1, "test-message")
+	assert.Assert(t, err != nil)
+	err = client.PubWithTimeoutE("topic/test/virtual-kubelet", Qos1, "test-message", time.Second)
+	assert.Assert(t, err != nil)
+	assert.Assert(t, !client.Pub("topic/test/virtual-kubelet", Qos1, "test-message"))
+}
+
+func TestClient_PubWithContext_Canceled(t *testing.T) {
+	opts := mqtt.NewClientOptions()
+	opts.AddBroker("tcp://127.0.0.1:1")
+	opts.SetConnectRetry(true)
+	client := &Client{
+		client: mqtt.NewClient(opts),
+	}
+	// connect retry keeps the client in connecting state, publish would be pending
+	client.client.Connect()
+	defer client.client.Disconnect(0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := client.PubWithContext(ctx, "topic/test/virtual-kubelet", Qos1, "test-message")
+	assert.Assert(t, err == context.Canceled)
+}
+
+func TestClient_PubWithRetained_NotConnected(t *testing.T) {
+	client := &Client{
+		client: mqtt.NewClient(mqtt.NewClientOptions()),
+	}
+	err := client.PubWithRetained(context.Background(), "topic/test/virtual-kubelet", Qos1, false, "test-message")
+	assert.Assert(t, err != nil)
+}
+
+func TestClient_ClearRetained(t *testing.T) {
+	session := newFakeBrokerSession()
+	client := &Client{client: session}
+	assert.NilError(t, client.PubWithRetained(context.Background(), "topic/test/virtual-kubelet", Qos1, true, []byte("status")))
+	assert.DeepEqual(t, session.retained["topic/test/virtual-kubelet"], []byte("status"))
+
+	assert.NilError(t, client.ClearRetained("topic/test/virtual-kubelet"))
+	_, has := session.retained["topic/test/virtual-kubelet"]
+	assert.Assert(t, !has)
+}
+
+func TestClient_Disconnect(t *testing.T) {
+	client := &Client{
+		client: mqtt.NewClient(mqtt.NewClientOptions()),
+	}
+	client.Disconnect(0)
+	// disconnect twice should be safe
+	client.Disconnect(0)
+	assert.Assert(t, client.PubE("topic/test/virtual-kubelet", Qos1, "test-message") == ErrClientDisconnected)
+	assert.Assert(t, client.PubWithTimeoutE("topic/test/virtual-kubelet", Qos1, "test-message", time.Second) == ErrClientDisconnected)
+	assert.Assert(t, client.PubWithContext(context.Background(), "topic/test/virtual-kubelet", Qos1, "test-message") == ErrClientDisconnected)
+	assert.Assert(t, !client.Sub("topic/test/virtual-kubelet", Qos1, nil))
+	assert.Assert(t, !client.UnSub("topic/test/virtual-kubelet"))
+}
+
+func TestClient_OfflineQueue(t *testing.T) {
+	client := &Client{
+		client:       mqtt.NewClient(mqtt.NewClientOptions()),
+		offlineQueue: newOfflineQueue(2),
+	}
+	assert.NilError(t, client.PubE("topic/test/virtual-kubelet", Qos1, "test-message-1"))
+	assert.NilError(t, client.PubE("topic/test/virtual-kubelet", Qos1, "test-message-2"))
+	assert.NilError(t, client.PubE("topic/test/virtual-kubelet", Qos1, "test-message-3"))
+	assert.Assert(t, client.QueueLen() == 2)
+
+	// the oldest message should be dropped
+	messages := client.offlineQueue.drain()
+	assert.Assert(t, messages[0].payload == "test-message-2")
+	assert.Assert(t, messages[1].payload == "test-message-3")
+	assert.Assert(t, client.QueueLen() == 0)
+}
+
+func TestClient_ConnectionState(t *testing.T) {
+	client := &Client{
+		client:          mqtt.NewClient(mqtt.NewClientOptions()),
+		connectionState: make(chan bool, 1),
+	}
+	assert.Assert(t, !client.IsConnected())
+	client.notifyConnectionState(true)
+	// stale state should be replaced by the latest one
+	client.notifyConnectionState(false)
+	assert.Assert(t, <-client.ConnectionState() == false)
+}
+
+func TestCheckGrantedQos(t *testing.T) {
+	requested := map[string]byte{
+		"topic/test/1": Qos1,
+		"topic/test/2": Qos2,
+		"topic/test/3": Qos1,
+	}
+	assert.NilError(t, checkGrantedQos(requested, map[string]byte{
+		"topic/test/1": Qos1,
+		"topic/test/2": Qos2,
+		"topic/test/3": Qos2,
+	}))
+	err := checkGrantedQos(requested, map[string]byte{
+		"topic/test/1": Qos1,
+		"topic/test/2": Qos1,
+		"topic/test/3": 0x80,
+	})
+	assert.Error(t, err, "subscribe failed for filters [topic/test/2: granted qos 1 lower than requested 2, topic/test/3: rejected]")
+}
+
+func TestResolveGrantedQos(t *testing.T) {
+	granted, err := resolveGrantedQos("topic/test/1", Qos2, map[string]byte{"topic/test/1": Qos1})
+	assert.NilError(t, err)
+	assert.Equal(t, granted, byte(Qos1))
+
+	_, err = resolveGrantedQos("topic/test/1", Qos1, map[string]byte{"topic/test/1": 0x80})
+	assert.Assert(t, errors.Is(err, ErrSubscriptionRejected))
+
+	_, err = resolveGrantedQos("topic/test/1", Qos1, map[string]byte{})
+	assert.Assert(t, errors.Is(err, ErrSubscriptionRejected))
+}
+
+func TestClient_SubWithGrantedQos_NotConnected(t *testing.T) {
+	client := &Client{
+		client: mqtt.NewClient(mqtt.NewClientOptions()),
+	}
+	_, err := client.SubWithGrantedQos("topic/test/virtual-kubelet", Qos1, nil)
+	assert.Assert(t, err != nil)
+
+	_, err = client.SubWithGrantedQos("topic/test/virtual-kubelet", 3, nil)
+	assert.Assert(t, errors.Is(err, ErrInvalidQos))
+
+	client.Disconnect(0)
+	_, err = client.SubWithGrantedQos("topic/test/virtual-kubelet", Qos1, nil)
+	assert.Assert(t, errors.Is(err, ErrClientDisconnected))
+}
+
+func TestClient_UnSubMultiple(t *testing.T) {
+	client := &Client{
+		client: mqtt.NewClient(mqtt.NewClientOptions()),
+	}
+	assert.NilError(t, client.UnSubMultipleE())
+	assert.Assert(t, client.UnSubMultipleE("topic/+/base/#", "topic/test/#/base") != nil)
+	assert.Assert(t, !client.UnSubMultiple("topic/+/base/heart", "topic/+/base/biz"))
+
+	client.Disconnect(0)
+	assert.Assert(t, errors.Is(client.UnSubMultipleE("topic/+/base/heart"), ErrClientDisconnected))
+}
+
+func TestDefaultConnectionHandlers(t *testing.T) {
+	logger, hook := logrustest.NewNullLogger()
+	defaultLogger := log.L
+	log.L = logruslogger.FromLogrus(logrus.NewEntry(logger))
+	defer func() {
+		log.L = defaultLogger
+	}()
+
+	newDefaultOnConnectHandler("tcp://broker-a:1883", "client-a")(nil)
+	newDefaultConnectionLostHandler("tcp://broker-b:1883", "client-b")(nil, errors.New("test"))
+
+	entries := hook.AllEntries()
+	assert.Equal(t, len(entries), 2)
+	assert.Equal(t, entries[0].Data["broker"], "tcp://broker-a:1883")
+	assert.Equal(t, entries[0].Data["clientID"], "client-a")
+	assert.Equal(t, entries[1].Data["broker"], "tcp://broker-b:1883")
+	assert.Equal(t, entries[1].Data["clientID"], "client-b")
+	assert.Equal(t, entries[1].Level, logrus.WarnLevel)
+}
+
+func TestClient_PubAsync_NotConnected(t *testing.T) {
+	client := &Client{
+		client: mqtt.NewClient(mqtt.NewClientOptions()),
+	}
+	results := make(chan error, 3)
+	onComplete := func(err error) {
+		results <- err
+	}
+	client.PubAsync("topic/test/virtual-kubelet", Qos1, "msg", onComplete)
+	assert.Assert(t, <-results != nil)
+
+	client.PubAsync("topic/test/virtual-kubelet", 3, "msg", onComplete)
+	assert.Assert(t, errors.Is(<-results, ErrInvalidQos))
+
+	client.Disconnect(0)
+	client.PubAsync("topic/test/virtual-kubelet", Qos1, "msg", onComplete)
+	assert.Assert(t, errors.Is(<-results, ErrClientDisconnected))
+
+	// nil callback is allowed
+	client.PubAsync("topic/test/virtual-kubelet", Qos1, "msg", nil)
+}
+
+func TestNewClientOptions_Reconnect(t *testing.T) {
+	opts, err := newClientOptions(&ClientConfig{
+		Broker:               "broker.emqx.io",
+		Port:                 1883,
+		ClientID:             "TestNewMqttClientID",
+		MaxReconnectInterval: time.Minute,
+		ConnectRetryInterval: time.Second * 10,
+	})
+	assert.NilError(t, err)
+	assert.Assert(t, opts.ConnectRetry)
+	assert.Assert(t, opts.MaxReconnectInterval >= time.Minute && opts.MaxReconnectInterval <= time.Minute*6/5)
+	assert.Assert(t, opts.ConnectRetryInterval >= time.Second*10 && opts.ConnectRetryInterval <= time.Second*12)
+
+	opts, err = newClientOptions(&ClientConfig{
+		Broker:   "broker.emqx.io",
+		Port:     1883,
+		ClientID: "TestNewMqttClientID",
+	})
+	assert.NilError(t, err)
+	assert.Assert(t, !opts.ConnectRetry)
+}
+
+func TestNewTlsConfig_MissingFile(t *testing.T) {
+	_, err := newTlsConfig(&ClientConfig{
+		Broker: "broker.emqx.io",
+		CAPath: "../../samples/not-exist-ca.crt",
+	})
+	var tlsErr *TLSConfigError
+	assert.Assert(t, errors.As(err, &tlsErr))
+	assert.Assert(t, tlsErr.File == TLSFileCA)
+	assert.Assert(t, tlsErr.Path == "../../samples/not-exist-ca.crt")
+	assert.Assert(t, errors.Is(err, os.ErrNotExist))
+
+	_, err = newTlsConfig(&ClientConfig{
+		Broker:        "broker.emqx.io",
+		CAPath:        "../../samples/sample-ca.crt",
+		ClientCrtPath: "../../samples/sample-ca.crt",
+		ClientKeyPath: "../../samples/not-exist.key",
+	})
+	assert.Assert(t, errors.As(err, &tlsErr))
+	assert.Assert(t, tlsErr.File == TLSFileClientKey)
+}
+
+func TestClientConfig_Validate(t *testing.T) {
+	valid := ClientConfig{
+		Broker:   "broker.emqx.io",
+		Port:     1883,
+		ClientID: "TestNewMqttClientID",
+	}
+	assert.NilError(t, valid.Validate())
+
+	noBroker := valid
+	noBroker.Broker = ""
+	invalidPort := valid
+	invalidPort.Port = 0
+	noClientID := valid
+	noClientID.ClientID = ""
+	noClientKey := valid
+	noClientKey.CAPath = "ca"
+	noClientKey.ClientCrtPath = "crt"
+	noCA := valid
+	noCA.ClientCrtPath = "crt"
+	noCA.ClientKeyPath = "key"
+	longClientID := valid
+	longClientID.ClientID = strings.Repeat("a", MaxClientIDLength+1)
+	invalidClientID := valid
+	invalidClientID.ClientID = "\xff"
+	noCAPem := valid
+	noCAPem.ClientCrtPem = []byte("crt")
+	noCAPem.ClientKeyPem = []byte("key")
+	noClientKeyPem := valid
+	noClientKeyPem.CAPem = []byte("ca")
+	noClientKeyPem.ClientCrtPem = []byte("crt")
+	invalidBrokerPort := valid
+	invalidBrokerPort.Brokers = []string{"broker-b:0"}
+	noBrokerHost := valid
+	noBrokerHost.Brokers = []string{":1883"}
+	for _, cfg := range []ClientConfig{noBroker, invalidPort, noClientID, noClientKey, noCA, longClientID, invalidClientID, noCAPem, noClientKeyPem, invalidBrokerPort, noBrokerHost} {
+		assert.Assert(t, errors.Is(cfg.Validate(), ErrInvalidClientConfig))
+	}
+
+	pem := noCAPem
+	pem.CAPem = []byte("ca")
+	assert.NilError(t, pem.Validate())
+
+	// failover brokers only
+	brokers := noBroker
+	brokers.Brokers = []string{"broker-a", "broker-b:2883"}
+	assert.NilError(t, brokers.Validate())
+
+	client, err := NewMqttClient(&noBroker)
+	assert.Assert(t, errors.Is(err, ErrInvalidClientConfig))
+	assert.Assert(t, client == nil)
+}
+
+func TestClient_InvalidQos(t *testing.T) {
+	client := &Client{
+		client: mqtt.NewClient(mqtt.NewClientOptions()),
+	}
+	assert.Assert(t, errors.Is(client.PubE("topic/test/virtual-kubelet", 3, "test-message"), ErrInvalidQos))
+	assert.Assert(t, errors.Is(client.PubWithTimeoutE("topic/test/virtual-kubelet", 3, "test-message", time.Second), ErrInvalidQos))
+	assert.Assert(t, !client.Pub("topic/test/virtual-kubelet", 3, "test-message"))
+	assert.Assert(t, !client.Sub("topic/test/virtual-kubelet", 3, nil))
+	assert.Assert(t, !client.SubWithTimeout("topic/test/virtual-kubelet", 3, time.Second, nil))
+	assert.Assert(t, errors.Is(client.SubMultiple(map[string]byte{"topic/test/virtual-kubelet": 3}, nil), ErrInvalidQos))
+}
+
+func TestClient_MaxPayloadBytes(t *testing.T) {
+	client := &Client{
+		client:          mqtt.NewClient(mqtt.NewClientOptions()),
+		maxPayloadBytes: 8,
+	}
+	assert.Assert(t, errors.Is(client.PubE("topic/test/virtual-kubelet", Qos1, "too-large-message"), ErrPayloadTooLarge))
+	assert.Assert(t, errors.Is(client.PubE("topic/test/virtual-kubelet", Qos1, []byte("too-large-message")), ErrPayloadTooLarge))
+	assert.Assert(t, errors.Is(client.PubWithTimeoutE("topic/test/virtual-kubelet", Qos1, "too-large-message", time.Second), ErrPayloadTooLarge))
+	// objects are sized as encoded
+	assert.Assert(t, errors.Is(client.PubE("topic/test/virtual-kubelet", Qos1, map[string]string{"key": "value"}), ErrPayloadTooLarge))
+	assert.Assert(t, errors.Is(client.PubWithTimeoutE("topic/test/virtual-kubelet", Qos1, map[string]string{"key": "value"}, time.Second), ErrPayloadTooLarge))
+	assert.Assert(t, errors.Is(client.PubWithRetained(context.Background(), "topic/test/virtual-kubelet", Qos1, false, map[string]string{"key": "value"}), ErrPayloadTooLarge))
+	assert.Assert(t, !client.Pub("topic/test/virtual-kubelet", Qos1, "too-large-message"))
+	assert.Assert(t, !client.PubWithTimeout("topic/test/virtual-kubelet", Qos1, "too-large-message", time.Second))
+
+	// payload within limit is not rejected by the guard, but fails as not connected
+	err := client.PubE("topic/test/virtual-kubelet", Qos1, "small")
+	assert.Assert(t, err != nil)
+	assert.Assert(t, !errors.Is(err, ErrPayloadTooLarge))
+}
+
+type testMarshaler struct{}
+
+func (testMarshaler) Marshal(v interface{}) ([]byte, error) {
+	return nil, errors.New("test marshal error")
+}
+
+func TestClient_PubJSON(t *testing.T) {
+	client := &Client{
+		client: mqtt.NewClient(mqtt.NewClientOptions()),
+	}
+	payload, err := client.encode(map[string]string{"bizName": "test"})
+	assert.NilError(t, err)
+	assert.Assert(t, string(payload) == `{"bizName":"test"}`)
+	// not connected
+	assert.Assert(t, client.PubJSON("topic/test/virtual-kubelet", Qos1, map[string]string{"bizName": "test"}) != nil)
+
+	client.marshaler = testMarshaler{}
+	assert.Error(t, client.PubJSON("topic/test/virtual-kubelet", Qos1, map[string]string{"bizName": "test"}), "test marshal error")
+	assert.Error(t, client.PubWithRetained(context.Background(), "topic/test/virtual-kubelet", Qos1, false, map[string]string{"bizName": "test"}), "test marshal error")
+	assert.Error(t, client.PubE("topic/test/virtual-kubelet", Qos1, map[string]string{"bizName": "test"}), "test marshal error")
+}
+
+func TestClient_EncodePayload(t *testing.T) {
+	client := &Client{marshaler: testMarshaler{}}
+	buffer := bytes.NewBufferString("raw")
+	// raw payloads are passed to paho as is instead of encoded
+	for _, msg := range []interface{}{"raw", []byte("raw"), *buffer, buffer} {
+		payload, err := client.encodePayload(msg)
+		assert.NilError(t, err)
+		assert.Equal(t, fmt.Sprintf("%T:%s", payload, payload), fmt.Sprintf("%T:%s", msg, msg))
+	}
+	payload, err := client.encodePayload(buffer)
+	assert.NilError(t, err)
+	assert.Equal(t, payload.(*bytes.Buffer), buffer)
+	_, err = client.encodePayload(map[string]string{"bizName": "test"})
+	assert.Error(t, err, "test marshal error")
+}
+
+func TestClient_WaitForConnection(t *testing.T) {
+	client := &Client{client: mqtt.NewClient(mqtt.NewClientOptions()), connectionState: make(chan bool, 10)}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, client.WaitForConnection(ctx), context.DeadlineExceeded)
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		client.notifyConnectionState(true)
+	}()
+	assert.NilError(t, client.WaitForConnection(context.Background()))
+
+	// lost connection should block waiters again
+	client.notifyConnectionState(false)
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, client.WaitForConnection(ctx), context.DeadlineExceeded)
+}
+
+func TestClient_WaitForConnection_Disconnected(t *testing.T) {
+	client := &Client{client: mqtt.NewClient(mqtt.NewClientOptions())}
+	client.Disconnect(0)
+	assert.Assert(t, errors.Is(client.WaitForConnection(context.Background()), ErrClientDisconnected))
+}
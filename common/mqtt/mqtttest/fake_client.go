@@ -0,0 +1,306 @@
+package mqtttest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/koupleless/virtual-kubelet/common/mqtt"
+)
+
+// PublishedMessage is a message recorded by FakeClient
+type PublishedMessage struct {
+	Topic    string
+	Qos      byte
+	Retained bool
+	Payload  []byte
+}
+
+// FakeClient is an in-memory mqtt.PubSubClient, it records published messages and
+// delivers messages passed to Deliver to the matching subscriptions
+type FakeClient struct {
+	sync.Mutex
+	published     []PublishedMessage
+	subscriptions map[string]paho.MessageHandler
+	disconnected  bool
+
+	// PubErr is returned by all publishes if set
+	PubErr error
+
+	// FailPubs is the count of following publishes failing with ErrFakePubFailed, decreased on each failure
+	FailPubs int
+
+	// SubErr is returned by all subscriptions if set
+	SubErr error
+}
+
+var _ mqtt.PubSubClient = &FakeClient{}
+
+// ErrFakePubFailed is returned by publishes failed by FailPubs
+var ErrFakePubFailed = errors.New("fake publish failed")
+
+func NewFakeClient() *FakeClient {
+	return &FakeClient{
+		subscriptions: map[string]paho.MessageHandler{},
+	}
+}
+
+func encode(msg interface{}) ([]byte, error) {
+	switch m := msg.(type) {
+	case []byte:
+		return m, nil
+	case string:
+		return []byte(m), nil
+	default:
+		return json.Marshal(m)
+	}
+}
+
+func (c *FakeClient) record(topic string, qos byte, retained bool, msg interface{}) error {
+	if c.PubErr != nil {
+		return c.PubErr
+	}
+	payload, err := encode(msg)
+	if err != nil {
+		return err
+	}
+	c.Lock()
+	defer c.Unlock()
+	if c.disconnected {
+		return mqtt.ErrClientDisconnected
+	}
+	if c.FailPubs > 0 {
+		c.FailPubs--
+		return ErrFakePubFailed
+	}
+	c.published = append(c.published, PublishedMessage{
+		Topic:    topic,
+		Qos:      qos,
+		Retained: retained,
+		Payload:  payload,
+	})
+	return nil
+}
+
+func (c *FakeClient) Pub(topic string, qos byte, msg interface{}) bool {
+	return c.record(topic, qos, true, msg) == nil
+}
+
+func (c *FakeClient) PubWithRetained(ctx context.Context, topic string, qos byte, retained bool, msg interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.record(topic, qos, retained, msg)
+}
+
+func (c *FakeClient) ClearRetained(topic string) error {
+	return c.record(topic, mqtt.Qos1, true, []byte{})
+}
+
+func (c *FakeClient) Sub(topic string, qos byte, callBack paho.MessageHandler) bool {
+	return c.SubMultiple(map[string]byte{topic: qos}, callBack) == nil
+}
+
+func (c *FakeClient) SubWithContext(ctx context.Context, topic string, qos byte, callBack paho.MessageHandler) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := c.SubMultiple(map[string]byte{topic: qos}, callBack); err != nil {
+		return err
+	}
+	go func() {
+		<-ctx.Done()
+		c.UnSub(topic)
+	}()
+	return nil
+}
+
+func (c *FakeClient) SubMultiple(filters map[string]byte, callBack paho.MessageHandler) error {
+	if c.SubErr != nil {
+		return c.SubErr
+	}
+	c.Lock()
+	defer c.Unlock()
+	if c.disconnected {
+		return mqtt.ErrClientDisconnected
+	}
+	for filter := range filters {
+		c.subscriptions[filter] = callBack
+	}
+	return nil
+}
+
+func (c *FakeClient) SubOnce(ctx context.Context, topic string, qos byte) ([]byte, error) {
+	if filter, has := c.matchingSubscription(topic); has {
+		return nil, fmt.Errorf("%w: %s by %s", mqtt.ErrAlreadySubscribed, topic, filter)
+	}
+	received := make(chan []byte, 1)
+	err := c.SubMultiple(map[string]byte{topic: qos}, func(_ paho.Client, msg paho.Message) {
+		select {
+		case received <- msg.Payload():
+		default:
+			// only the first message is returned
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer c.UnSub(topic)
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case payload := <-received:
+		return payload, nil
+	}
+}
+
+func (c *FakeClient) UnSub(topic string) bool {
+	c.Lock()
+	defer c.Unlock()
+	delete(c.subscriptions, topic)
+	return true
+}
+
+func (c *FakeClient) UnSubMultipleE(topics ...string) error {
+	c.Lock()
+	defer c.Unlock()
+	if c.disconnected {
+		return mqtt.ErrClientDisconnected
+	}
+	for _, topic := range topics {
+		delete(c.subscriptions, topic)
+	}
+	return nil
+}
+
+func (c *FakeClient) Disconnect(_ uint) {
+	c.Lock()
+	defer c.Unlock()
+	c.disconnected = true
+}
+
+// Disconnected returns true if Disconnect has been called
+func (c *FakeClient) Disconnected() bool {
+	c.Lock()
+	defer c.Unlock()
+	return c.disconnected
+}
+
+// Published returns a copy of all published messages in publish order
+func (c *FakeClient) Published() []PublishedMessage {
+	c.Lock()
+	defer c.Unlock()
+	return append([]PublishedMessage{}, c.published...)
+}
+
+// PublishedTo returns the published messages of target topic in publish order
+func (c *FakeClient) PublishedTo(topic string) []PublishedMessage {
+	ret := make([]PublishedMessage, 0)
+	for _, msg := range c.Published() {
+		if msg.Topic == topic {
+			ret = append(ret, msg)
+		}
+	}
+	return ret
+}
+
+// Subscribed returns true if topic filter is subscribed
+func (c *FakeClient) Subscribed(filter string) bool {
+	c.Lock()
+	defer c.Unlock()
+	_, ok := c.subscriptions[filter]
+	return ok
+}
+
+func (c *FakeClient) matchingSubscription(topic string) (string, bool) {
+	c.Lock()
+	defer c.Unlock()
+	for filter := range c.subscriptions {
+		if filter == topic || MatchTopic(filter, topic) {
+			return filter, true
+		}
+	}
+	return "", false
+}
+
+// Deliver call the callbacks of subscriptions matching topic with payload, return the count of callbacks invoked
+func (c *FakeClient) Deliver(topic string, payload []byte) int {
+	c.Lock()
+	handlers := make([]paho.MessageHandler, 0)
+	for filter, handler := range c.subscriptions {
+		if handler != nil && MatchTopic(filter, topic) {
+			handlers = append(handlers, handler)
+		}
+	}
+	c.Unlock()
+	for _, handler := range handlers {
+		handler(nil, &FakeMessage{TopicName: topic, PayloadBytes: payload})
+	}
+	return len(handlers)
+}
+
+// MatchTopic check topic matches filter, supporting '+' and '#' wildcards
+func MatchTopic(filter, topic string) bool {
+	filterLevels := strings.Split(filter, "/")
+	topicLevels := strings.Split(topic, "/")
+	for i, level := range filterLevels {
+		if level == "#" {
+			return true
+		}
+		if i >= len(topicLevels) {
+			return false
+		}
+		if level != "+" && level != topicLevels[i] {
+			return false
+		}
+	}
+	return len(filterLevels) == len(topicLevels)
+}
+
+// FakeMessage is a paho.Message delivered by FakeClient
+type FakeMessage struct {
+	TopicName    string
+	PayloadBytes []byte
+	QosLevel     byte
+	IsRetained   bool
+	acked        bool
+}
+
+var _ paho.Message = &FakeMessage{}
+
+func (m *FakeMessage) Duplicate() bool {
+	return false
+}
+
+func (m *FakeMessage) Qos() byte {
+	return m.QosLevel
+}
+
+func (m *FakeMessage) Retained() bool {
+	return m.IsRetained
+}
+
+func (m *FakeMessage) Topic() string {
+	return m.TopicName
+}
+
+func (m *FakeMessage) MessageID() uint16 {
+	return 0
+}
+
+func (m *FakeMessage) Payload() []byte {
+	return m.PayloadBytes
+}
+
+func (m *FakeMessage) Ack() {
+	m.acked = true
+}
+
+// Acked returns true if Ack has been called
+func (m *FakeMessage) Acked() bool {
+	return m.acked
+}
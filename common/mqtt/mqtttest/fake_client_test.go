@@ -0,0 +1,101 @@
+package mqtttest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/koupleless/virtual-kubelet/common/mqtt"
+	"gotest.tools/assert"
+)
+
+func TestFakeClient_Pub(t *testing.T) {
+	client := NewFakeClient()
+	assert.Assert(t, client.Pub("test/a", mqtt.Qos1, "msg"))
+	assert.NilError(t, client.PubWithRetained(context.Background(), "test/b", mqtt.Qos0, false, map[string]string{"k": "v"}))
+	published := client.Published()
+	assert.Equal(t, len(published), 2)
+	assert.DeepEqual(t, published[0], PublishedMessage{Topic: "test/a", Qos: mqtt.Qos1, Retained: true, Payload: []byte("msg")})
+	assert.DeepEqual(t, client.PublishedTo("test/b")[0].Payload, []byte(`{"k":"v"}`))
+
+	client.Disconnect(0)
+	assert.Assert(t, errors.Is(client.PubWithRetained(context.Background(), "test/a", mqtt.Qos0, false, "msg"), mqtt.ErrClientDisconnected))
+}
+
+func TestFakeClient_ClearRetained(t *testing.T) {
+	client := NewFakeClient()
+	assert.NilError(t, client.ClearRetained("test/a"))
+	assert.DeepEqual(t, client.PublishedTo("test/a"), []PublishedMessage{{Topic: "test/a", Qos: mqtt.Qos1, Retained: true, Payload: []byte{}}})
+}
+
+func TestFakeClient_Deliver(t *testing.T) {
+	client := NewFakeClient()
+	received := make([]string, 0)
+	assert.NilError(t, client.SubMultiple(map[string]byte{"test/+/base/heart": mqtt.Qos1}, func(_ paho.Client, msg paho.Message) {
+		received = append(received, msg.Topic())
+	}))
+	assert.Assert(t, client.Subscribed("test/+/base/heart"))
+	assert.Equal(t, client.Deliver("test/node/base/heart", []byte("{}")), 1)
+	assert.Equal(t, client.Deliver("test/node/base/health", []byte("{}")), 0)
+	assert.DeepEqual(t, received, []string{"test/node/base/heart"})
+
+	assert.Assert(t, client.UnSub("test/+/base/heart"))
+	assert.Equal(t, client.Deliver("test/node/base/heart", []byte("{}")), 0)
+}
+
+func TestFakeClient_UnSubMultipleE(t *testing.T) {
+	client := NewFakeClient()
+	assert.NilError(t, client.SubMultiple(map[string]byte{"test/+/base/heart": mqtt.Qos1, "test/+/base/biz": mqtt.Qos1}, nil))
+	assert.NilError(t, client.UnSubMultipleE("test/+/base/heart", "test/+/base/biz"))
+	assert.Assert(t, !client.Subscribed("test/+/base/heart"))
+	assert.Assert(t, !client.Subscribed("test/+/base/biz"))
+
+	client.Disconnect(0)
+	assert.Assert(t, errors.Is(client.UnSubMultipleE("test/+/base/heart"), mqtt.ErrClientDisconnected))
+}
+
+func TestMatchTopic(t *testing.T) {
+	assert.Assert(t, MatchTopic("a/+/c", "a/b/c"))
+	assert.Assert(t, MatchTopic("a/#", "a/b/c"))
+	assert.Assert(t, MatchTopic("a/b", "a/b"))
+	assert.Assert(t, !MatchTopic("a/+", "a/b/c"))
+	assert.Assert(t, !MatchTopic("a/b/c", "a/b"))
+}
+
+func TestFakeClient_SubOnce(t *testing.T) {
+	client := NewFakeClient()
+	go func() {
+		// deliver until subscribed
+		for client.Deliver("test/node/base/biz", []byte("reply")) == 0 {
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	payload, err := client.SubOnce(ctx, "test/node/base/biz", mqtt.Qos1)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, payload, []byte("reply"))
+	assert.Assert(t, !client.Subscribed("test/node/base/biz"))
+
+	assert.Assert(t, client.Sub("test/+/base/biz", mqtt.Qos1, nil))
+	_, err = client.SubOnce(ctx, "test/node/base/biz", mqtt.Qos1)
+	assert.Assert(t, errors.Is(err, mqtt.ErrAlreadySubscribed))
+	assert.Assert(t, client.Subscribed("test/+/base/biz"))
+}
+
+func TestFakeClient_SubWithContext(t *testing.T) {
+	client := NewFakeClient()
+	ctx, cancel := context.WithCancel(context.Background())
+	assert.NilError(t, client.SubWithContext(ctx, "test/node/base/heart", mqtt.Qos1, func(paho.Client, paho.Message) {}))
+	assert.Assert(t, client.Subscribed("test/node/base/heart"))
+
+	cancel()
+	deadline := time.Now().Add(5 * time.Second)
+	for client.Subscribed("test/node/base/heart") && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Assert(t, !client.Subscribed("test/node/base/heart"))
+	assert.Assert(t, errors.Is(client.SubWithContext(ctx, "test/node/base/heart", mqtt.Qos1, nil), context.Canceled))
+}
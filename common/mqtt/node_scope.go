@@ -0,0 +1,120 @@
+package mqtt
+
+import (
+	"context"
+	"errors"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+)
+
+// NodeScopedClient is a PubSubClient restricted to the topic subtree of one node, mirroring the broker ACL of a
+// multi-tenant deployment, so that a topic outside the subtree fails fast with ErrTopicNotPermitted instead of being
+// dropped by broker. The underlying client is shared, so Disconnect is a noop.
+type NodeScopedClient struct {
+	client  PubSubClient
+	builder *TopicBuilder
+	nodeID  string
+}
+
+var _ PubSubClient = &NodeScopedClient{}
+
+// NewNodeScopedClient create a client scoped to the topics of nodeID built by builder, DefaultTopicBuilder if nil
+func NewNodeScopedClient(client PubSubClient, builder *TopicBuilder, nodeID string) (*NodeScopedClient, error) {
+	if builder == nil {
+		builder = DefaultTopicBuilder
+	}
+	if _, err := builder.NodeTopicPrefix(nodeID); err != nil {
+		return nil, err
+	}
+	return &NodeScopedClient{
+		client:  client,
+		builder: builder,
+		nodeID:  nodeID,
+	}, nil
+}
+
+// NodeID returns the node the client is scoped to
+func (c *NodeScopedClient) NodeID() string {
+	return c.nodeID
+}
+
+func (c *NodeScopedClient) check(topics ...string) error {
+	for _, topic := range topics {
+		if err := c.builder.CheckNodeTopic(c.nodeID, topic); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkOrWarn check the topics for the bool returning operations, logging the permission error
+func (c *NodeScopedClient) checkOrWarn(topics ...string) bool {
+	err := c.check(topics...)
+	if err != nil {
+		log.G(context.Background()).WithError(err).Warn("topic not permitted for node")
+	}
+	return err == nil
+}
+
+func (c *NodeScopedClient) Pub(topic string, qos byte, msg interface{}) bool {
+	return c.checkOrWarn(topic) && c.client.Pub(topic, qos, msg)
+}
+
+func (c *NodeScopedClient) PubWithRetained(ctx context.Context, topic string, qos byte, retained bool, msg interface{}) error {
+	if err := c.check(topic); err != nil {
+		return err
+	}
+	return c.client.PubWithRetained(ctx, topic, qos, retained, msg)
+}
+
+func (c *NodeScopedClient) ClearRetained(topic string) error {
+	if err := c.check(topic); err != nil {
+		return err
+	}
+	return c.client.ClearRetained(topic)
+}
+
+func (c *NodeScopedClient) Sub(topic string, qos byte, callBack mqtt.MessageHandler) bool {
+	return c.checkOrWarn(topic) && c.client.Sub(topic, qos, callBack)
+}
+
+func (c *NodeScopedClient) SubWithContext(ctx context.Context, topic string, qos byte, callBack mqtt.MessageHandler) error {
+	if err := c.check(topic); err != nil {
+		return err
+	}
+	return c.client.SubWithContext(ctx, topic, qos, callBack)
+}
+
+func (c *NodeScopedClient) SubMultiple(filters map[string]byte, callBack mqtt.MessageHandler) error {
+	errs := make([]error, 0)
+	for filter := range filters {
+		if err := c.check(filter); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	return c.client.SubMultiple(filters, callBack)
+}
+
+func (c *NodeScopedClient) SubOnce(ctx context.Context, topic string, qos byte) ([]byte, error) {
+	if err := c.check(topic); err != nil {
+		return nil, err
+	}
+	return c.client.SubOnce(ctx, topic, qos)
+}
+
+func (c *NodeScopedClient) UnSub(topic string) bool {
+	return c.checkOrWarn(topic) && c.client.UnSub(topic)
+}
+
+func (c *NodeScopedClient) UnSubMultipleE(topics ...string) error {
+	if err := c.check(topics...); err != nil {
+		return err
+	}
+	return c.client.UnSubMultipleE(topics...)
+}
+
+// Disconnect is a noop, the shared connection is released by its owner
+func (c *NodeScopedClient) Disconnect(uint) {}
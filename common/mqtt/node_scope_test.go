@@ -0,0 +1,38 @@
+package mqtt
+
+import (
+	"context"
+	"errors"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"gotest.tools/assert"
+	"testing"
+)
+
+func TestNodeScopedClient(t *testing.T) {
+	session := newFakeBrokerSession()
+	client, err := NewNodeScopedClient(&Client{client: session}, nil, "test")
+	assert.NilError(t, err)
+	assert.Equal(t, client.NodeID(), "test")
+
+	assert.NilError(t, client.PubWithRetained(context.Background(), "koupleless/test/base/status", Qos1, true, []byte("online")))
+	assert.DeepEqual(t, session.retained["koupleless/test/base/status"], []byte("online"))
+	err = client.PubWithRetained(context.Background(), "koupleless/other/base/status", Qos1, true, []byte("online"))
+	assert.Assert(t, errors.Is(err, ErrTopicNotPermitted))
+	assert.ErrorContains(t, err, "koupleless/other/base/status")
+	_, has := session.retained["koupleless/other/base/status"]
+	assert.Assert(t, !has)
+	assert.Assert(t, !client.Pub("koupleless/other/health", Qos1, "{}"))
+	assert.Assert(t, errors.Is(client.ClearRetained("koupleless/other/base/status"), ErrTopicNotPermitted))
+
+	callBack := func(mqtt.Client, mqtt.Message) {}
+	assert.Assert(t, client.Sub("koupleless/test/health", Qos1, callBack))
+	assert.Assert(t, !client.Sub("koupleless/+/health", Qos1, callBack))
+	err = client.SubMultiple(map[string]byte{"koupleless/test/biz": Qos1, "koupleless/other/biz": Qos1}, callBack)
+	assert.Assert(t, errors.Is(err, ErrTopicNotPermitted))
+	assert.Assert(t, !session.deliver("koupleless/test/biz"))
+	assert.Assert(t, session.deliver("koupleless/test/health"))
+	assert.Assert(t, errors.Is(client.UnSubMultipleE("koupleless/test/health", "koupleless/other/health"), ErrTopicNotPermitted))
+
+	_, err = NewNodeScopedClient(&Client{client: session}, nil, "test/1")
+	assert.Assert(t, err != nil)
+}
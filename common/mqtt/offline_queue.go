@@ -0,0 +1,83 @@
+package mqtt
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// offlineMessage is a publish buffered while the client is disconnected
+type offlineMessage struct {
+	topic    string
+	qos      byte
+	retained bool
+	payload  interface{}
+}
+
+// offlineQueue buffers publishes while disconnected, the oldest message is dropped when the queue is full
+type offlineQueue struct {
+	sync.Mutex
+	maxSize  int
+	messages *list.List
+}
+
+func newOfflineQueue(maxSize int) *offlineQueue {
+	return &offlineQueue{
+		maxSize:  maxSize,
+		messages: list.New(),
+	}
+}
+
+func (q *offlineQueue) push(msg offlineMessage) {
+	q.Lock()
+	defer q.Unlock()
+	if q.messages.Len() >= q.maxSize {
+		q.messages.Remove(q.messages.Front())
+	}
+	q.messages.PushBack(msg)
+}
+
+// drain pop all buffered messages in publish order
+func (q *offlineQueue) drain() []offlineMessage {
+	q.Lock()
+	defer q.Unlock()
+	ret := make([]offlineMessage, 0, q.messages.Len())
+	for e := q.messages.Front(); e != nil; e = e.Next() {
+		ret = append(ret, e.Value.(offlineMessage))
+	}
+	q.messages.Init()
+	return ret
+}
+
+func (q *offlineQueue) len() int {
+	q.Lock()
+	defer q.Unlock()
+	return q.messages.Len()
+}
+
+// queuedToken is returned for publishes buffered in offline queue, it is completed immediately
+type queuedToken struct {
+	done chan struct{}
+}
+
+func newQueuedToken() *queuedToken {
+	done := make(chan struct{})
+	close(done)
+	return &queuedToken{done: done}
+}
+
+func (t *queuedToken) Wait() bool {
+	return true
+}
+
+func (t *queuedToken) WaitTimeout(_ time.Duration) bool {
+	return true
+}
+
+func (t *queuedToken) Done() <-chan struct{} {
+	return t.done
+}
+
+func (t *queuedToken) Error() error {
+	return nil
+}
@@ -0,0 +1,41 @@
+package mqtt
+
+import (
+	"context"
+	"runtime/debug"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+)
+
+// maxLoggedPayloadBytes bounds the payload logged with a handler panic
+const maxLoggedPayloadBytes = 512
+
+// HandlerPanicHandler is called with the message and the recovered value once a message handler panicked
+type HandlerPanicHandler func(msg mqtt.Message, recovered interface{})
+
+// recoverHandler wrap handler to recover its panic, so that a malformed message doesn't crash the process from the
+// paho callback goroutine. the panic is logged with the topic and payload, then passed to onPanic if set
+func recoverHandler(onPanic HandlerPanicHandler, handler mqtt.MessageHandler) mqtt.MessageHandler {
+	if handler == nil {
+		return nil
+	}
+	return func(client mqtt.Client, msg mqtt.Message) {
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			payload := msg.Payload()
+			if len(payload) > maxLoggedPayloadBytes {
+				payload = payload[:maxLoggedPayloadBytes]
+			}
+			log.G(context.Background()).WithField("topic", msg.Topic()).WithField("payload", string(payload)).
+				Errorf("message handler panicked: %v\n%s", recovered, debug.Stack())
+			if onPanic != nil {
+				onPanic(msg, recovered)
+			}
+		}()
+		handler(client, msg)
+	}
+}
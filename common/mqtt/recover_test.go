@@ -0,0 +1,56 @@
+package mqtt
+
+import (
+	"testing"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"gotest.tools/assert"
+)
+
+func TestRecoverHandler(t *testing.T) {
+	var panicked []interface{}
+	handler := recoverHandler(func(msg mqtt.Message, recovered interface{}) {
+		assert.Equal(t, msg.Topic(), "test/topic")
+		panicked = append(panicked, recovered)
+	}, func(client mqtt.Client, msg mqtt.Message) {
+		var data *struct{ Name string }
+		_ = data.Name
+	})
+	handler(nil, &qosMessage{fakeMessage: fakeMessage{topic: "test/topic"}, payload: []byte("malformed")})
+	assert.Equal(t, len(panicked), 1)
+
+	// handlers not panicking are called as is
+	handled := 0
+	recoverHandler(nil, func(client mqtt.Client, msg mqtt.Message) {
+		handled++
+	})(nil, &qosMessage{fakeMessage: fakeMessage{topic: "test/topic"}})
+	assert.Equal(t, handled, 1)
+
+	assert.Assert(t, recoverHandler(nil, nil) == nil)
+}
+
+func TestClient_WrapHandler_Panic(t *testing.T) {
+	recorder := &fakeMetricsRecorder{}
+	panicked := 0
+	client := &Client{
+		client:  mqtt.NewClient(mqtt.NewClientOptions()),
+		metrics: recorder,
+		onHandlerPanic: func(msg mqtt.Message, recovered interface{}) {
+			panicked++
+		},
+	}
+	handled := 0
+	handler := client.wrapHandler(func(_ mqtt.Client, msg mqtt.Message) {
+		handled++
+		if string(msg.Payload()) == "malformed" {
+			panic("bad payload")
+		}
+	})
+
+	handler(nil, &qosMessage{fakeMessage: fakeMessage{topic: "test/topic"}, payload: []byte("malformed")})
+	// the client survives and keeps handling messages
+	handler(nil, &qosMessage{fakeMessage: fakeMessage{topic: "test/topic"}, payload: []byte("ok")})
+	assert.Equal(t, handled, 2)
+	assert.Equal(t, panicked, 1)
+	assert.DeepEqual(t, recorder.received, []string{"test/topic", "test/topic"})
+}
@@ -0,0 +1,84 @@
+package mqtt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/google/uuid"
+)
+
+// DefaultRequestTimeout is the default timeout of waiting for the reply of a request
+const DefaultRequestTimeout = 10 * time.Second
+
+// ErrReplyTimeout is returned by RequestReply if no reply arrived within the request timeout
+var ErrReplyTimeout = errors.New("reply timeout")
+
+// Request is the request published by RequestReply, awaiting one reply correlated by a generated id
+type Request struct {
+	// Topic is the topic to publish the request to
+	Topic string
+
+	// ReplyTopicPrefix is the prefix of reply topic, the reply is awaited on <ReplyTopicPrefix>/<correlation id>
+	ReplyTopicPrefix string
+
+	// Qos is the qos of the request and the reply subscription
+	Qos byte
+
+	// Timeout bounds waiting for the reply, DefaultRequestTimeout if zero
+	Timeout time.Duration
+
+	// Payload returns the request payload carrying the correlation id and reply topic, so that the responder
+	// knows where to reply
+	Payload func(correlationID, replyTopic string) interface{}
+}
+
+// RequestReply subscribe the reply topic of a new correlation id, publish the request and return the payload of the
+// first reply, the reply topic is unsubscribed before return. each request has its own reply topic, so that replies
+// of concurrent outstanding requests never cross
+func RequestReply(ctx context.Context, client PubSubClient, request Request) ([]byte, error) {
+	if err := validateQos(request.Qos); err != nil {
+		return nil, err
+	}
+	if request.Payload == nil {
+		return nil, errors.New("request payload cannot be nil")
+	}
+	timeout := request.Timeout
+	if timeout <= 0 {
+		timeout = DefaultRequestTimeout
+	}
+	correlationID := uuid.NewString()
+	replyTopic := request.ReplyTopicPrefix + "/" + correlationID
+
+	replied := make(chan []byte, 1)
+	subscribed := client.Sub(replyTopic, request.Qos, func(_ mqtt.Client, msg mqtt.Message) {
+		select {
+		case replied <- msg.Payload():
+		default:
+			// only the first reply is returned
+		}
+		msg.Ack()
+	})
+	if !subscribed {
+		return nil, fmt.Errorf("failed to subscribe reply topic %s", replyTopic)
+	}
+	defer client.UnSub(replyTopic)
+
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	if err := client.PubWithRetained(waitCtx, request.Topic, request.Qos, false, request.Payload(correlationID, replyTopic)); err != nil {
+		return nil, err
+	}
+
+	select {
+	case reply := <-replied:
+		return reply, nil
+	case <-waitCtx.Done():
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("%w: no reply of %s on %s in %s", ErrReplyTimeout, request.Topic, replyTopic, timeout)
+	}
+}
@@ -0,0 +1,149 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"gotest.tools/assert"
+)
+
+type replyMessage struct {
+	fakeMessage
+	payload []byte
+}
+
+func (m *replyMessage) Payload() []byte {
+	return m.payload
+}
+
+func (m *replyMessage) Ack() {}
+
+type testRequest struct {
+	CorrelationID string `json:"correlationId"`
+	ReplyTo       string `json:"replyTo"`
+	Data          int    `json:"data"`
+}
+
+// loopbackClient passes published requests to respond, which replies by deliver
+type loopbackClient struct {
+	PubSubClient
+	lock     sync.Mutex
+	handlers map[string]mqtt.MessageHandler
+	respond  func(request testRequest)
+}
+
+func newLoopbackClient() *loopbackClient {
+	return &loopbackClient{handlers: map[string]mqtt.MessageHandler{}}
+}
+
+func (c *loopbackClient) Sub(topic string, _ byte, callBack mqtt.MessageHandler) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.handlers[topic] = callBack
+	return true
+}
+
+func (c *loopbackClient) UnSub(topic string) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.handlers, topic)
+	return true
+}
+
+func (c *loopbackClient) PubWithRetained(_ context.Context, _ string, _ byte, _ bool, msg interface{}) error {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	var request testRequest
+	if err = json.Unmarshal(payload, &request); err != nil {
+		return err
+	}
+	if c.respond != nil {
+		go c.respond(request)
+	}
+	return nil
+}
+
+func (c *loopbackClient) deliver(topic string, payload []byte) {
+	c.lock.Lock()
+	handler := c.handlers[topic]
+	c.lock.Unlock()
+	if handler != nil {
+		handler(nil, &replyMessage{fakeMessage: fakeMessage{topic: topic}, payload: payload})
+	}
+}
+
+func (c *loopbackClient) subscriptionCount() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return len(c.handlers)
+}
+
+func testRequestOf(data int) Request {
+	return Request{
+		Topic:            "koupleless/test-device/command",
+		ReplyTopicPrefix: "koupleless/test-device/reply",
+		Qos:              Qos1,
+		Timeout:          time.Second,
+		Payload: func(correlationID, replyTopic string) interface{} {
+			return testRequest{CorrelationID: correlationID, ReplyTo: replyTopic, Data: data}
+		},
+	}
+}
+
+func TestRequestReply_Concurrent(t *testing.T) {
+	client := newLoopbackClient()
+	client.respond = func(request testRequest) {
+		assert.Assert(t, strings.HasSuffix(request.ReplyTo, "/"+request.CorrelationID))
+		// later requests replied first
+		time.Sleep(time.Duration(20-request.Data) * time.Millisecond)
+		client.deliver(request.ReplyTo, []byte(fmt.Sprintf("reply-%d", request.Data)))
+	}
+
+	replies := make([]string, 20)
+	wg := sync.WaitGroup{}
+	for i := range replies {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			reply, err := RequestReply(context.Background(), client, testRequestOf(i))
+			assert.NilError(t, err)
+			replies[i] = string(reply)
+		}(i)
+	}
+	wg.Wait()
+
+	for i, reply := range replies {
+		assert.Equal(t, reply, fmt.Sprintf("reply-%d", i))
+	}
+	assert.Equal(t, client.subscriptionCount(), 0)
+}
+
+func TestRequestReply_Timeout(t *testing.T) {
+	client := newLoopbackClient()
+	request := testRequestOf(0)
+	request.Timeout = 50 * time.Millisecond
+	_, err := RequestReply(context.Background(), client, request)
+	assert.Assert(t, errors.Is(err, ErrReplyTimeout))
+	assert.Equal(t, client.subscriptionCount(), 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = RequestReply(ctx, client, testRequestOf(0))
+	assert.Assert(t, errors.Is(err, context.Canceled))
+}
+
+func TestRequestReply_InvalidQos(t *testing.T) {
+	request := testRequestOf(0)
+	request.Qos = 3
+	_, err := RequestReply(context.Background(), newLoopbackClient(), request)
+	assert.Assert(t, errors.Is(err, ErrInvalidQos))
+}
@@ -0,0 +1,131 @@
+package mqtt
+
+import (
+	"context"
+	"fmt"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+	"strings"
+	"sync"
+)
+
+// TopicRouter dispatch messages to the handlers whose topic filter matches the message topic,
+// messages matching no filter are passed to the fallback handler
+type TopicRouter struct {
+	sync.RWMutex
+	routes   []topicRoute
+	fallback mqtt.MessageHandler
+}
+
+type topicRoute struct {
+	filter  string
+	handler mqtt.MessageHandler
+}
+
+// NewTopicRouter returns an empty router, unmatched messages are dropped with a debug log if fallback is nil
+func NewTopicRouter(fallback mqtt.MessageHandler) *TopicRouter {
+	if fallback == nil {
+		fallback = func(_ mqtt.Client, msg mqtt.Message) {
+			log.G(context.Background()).Debugf("Unrouted message from topic: %s", msg.Topic())
+		}
+	}
+	return &TopicRouter{
+		fallback: fallback,
+	}
+}
+
+// Handle register the handler for topic filter, the handler of an already registered filter is replaced
+func (r *TopicRouter) Handle(filter string, handler mqtt.MessageHandler) error {
+	if err := ValidateTopicFilter(filter); err != nil {
+		return err
+	}
+	if handler == nil {
+		return fmt.Errorf("handler of topic filter %s cannot be nil", filter)
+	}
+	r.Lock()
+	defer r.Unlock()
+	for i := range r.routes {
+		if r.routes[i].filter == filter {
+			r.routes[i].handler = handler
+			return nil
+		}
+	}
+	r.routes = append(r.routes, topicRoute{filter: filter, handler: handler})
+	return nil
+}
+
+// Remove unregister the handler of topic filter
+func (r *TopicRouter) Remove(filter string) {
+	r.Lock()
+	defer r.Unlock()
+	for i := range r.routes {
+		if r.routes[i].filter == filter {
+			r.routes = append(r.routes[:i], r.routes[i+1:]...)
+			return
+		}
+	}
+}
+
+// HandleMessage is a mqtt.MessageHandler calling every matched handler in registration order
+func (r *TopicRouter) HandleMessage(client mqtt.Client, msg mqtt.Message) {
+	r.RLock()
+	handlers := make([]mqtt.MessageHandler, 0, 1)
+	for _, route := range r.routes {
+		if MatchTopic(route.filter, msg.Topic()) {
+			handlers = append(handlers, route.handler)
+		}
+	}
+	r.RUnlock()
+
+	if len(handlers) == 0 {
+		r.fallback(client, msg)
+		return
+	}
+	for _, handler := range handlers {
+		handler(client, msg)
+	}
+}
+
+// ValidateTopicFilter check the wildcards of filter, '+' must occupy a whole level and '#' must be the last level
+func ValidateTopicFilter(filter string) error {
+	if filter == "" {
+		return fmt.Errorf("topic filter cannot be empty")
+	}
+	levels := strings.Split(filter, "/")
+	for i, level := range levels {
+		if level == "#" {
+			if i != len(levels)-1 {
+				return fmt.Errorf("topic filter %q: '#' must be the last level", filter)
+			}
+			continue
+		}
+		if level == "+" {
+			continue
+		}
+		if strings.ContainsAny(level, "+#") {
+			return fmt.Errorf("topic filter %q: wildcard must occupy an entire level", filter)
+		}
+	}
+	return nil
+}
+
+// MatchTopic returns true if topic matches filter, wildcards don't match topics starting with '$'
+func MatchTopic(filter, topic string) bool {
+	filterLevels := strings.Split(filter, "/")
+	topicLevels := strings.Split(topic, "/")
+	if strings.HasPrefix(topic, "$") && (filterLevels[0] == "+" || filterLevels[0] == "#") {
+		return false
+	}
+	for i, filterLevel := range filterLevels {
+		if filterLevel == "#" {
+			return true
+		}
+		if i >= len(topicLevels) {
+			return false
+		}
+		if filterLevel != "+" && filterLevel != topicLevels[i] {
+			return false
+		}
+	}
+	return len(filterLevels) == len(topicLevels)
+}
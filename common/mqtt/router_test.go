@@ -0,0 +1,98 @@
+package mqtt
+
+import (
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"gotest.tools/assert"
+	"testing"
+)
+
+func TestMatchTopic(t *testing.T) {
+	cases := []struct {
+		filter string
+		topic  string
+		match  bool
+	}{
+		{"koupleless/test/base/heart", "koupleless/test/base/heart", true},
+		{"koupleless/+/base/heart", "koupleless/test/base/heart", true},
+		{"koupleless/+/base/heart", "koupleless/test/base/biz", false},
+		{"koupleless/+/base/heart", "koupleless/test/base/heart/extra", false},
+		{"koupleless/#", "koupleless/test/base/heart", true},
+		{"koupleless/#", "koupleless", true},
+		{"koupleless/+", "koupleless", false},
+		{"#", "$SYS/broker", false},
+		{"+/broker", "$SYS/broker", false},
+		{"$SYS/#", "$SYS/broker", true},
+	}
+	for _, c := range cases {
+		assert.Equal(t, MatchTopic(c.filter, c.topic), c.match, "filter %s topic %s", c.filter, c.topic)
+	}
+}
+
+func TestValidateTopicFilter(t *testing.T) {
+	assert.NilError(t, ValidateTopicFilter("koupleless/+/base/#"))
+	assert.Assert(t, ValidateTopicFilter("") != nil)
+	assert.Assert(t, ValidateTopicFilter("koupleless/#/base") != nil)
+	assert.Assert(t, ValidateTopicFilter("koupleless/te+st") != nil)
+	assert.Assert(t, ValidateTopicFilter("koupleless/test#") != nil)
+}
+
+func TestTopicRouter_HandleMessage(t *testing.T) {
+	routed := make([]string, 0)
+	router := NewTopicRouter(func(_ mqtt.Client, msg mqtt.Message) {
+		routed = append(routed, "fallback:"+msg.Topic())
+	})
+	assert.NilError(t, router.Handle(DefaultTopicBuilder.BaseTopicFilter(TopicTypeHeartBeat), func(_ mqtt.Client, msg mqtt.Message) {
+		routed = append(routed, "heart:"+msg.Topic())
+	}))
+	assert.NilError(t, router.Handle(DefaultTopicBuilder.BaseTopicFilter(TopicTypeStatus), func(_ mqtt.Client, msg mqtt.Message) {
+		routed = append(routed, "status:"+msg.Topic())
+	}))
+	assert.Assert(t, router.Handle("koupleless/#/base", func(_ mqtt.Client, _ mqtt.Message) {}) != nil)
+	assert.Assert(t, router.Handle("koupleless/#", nil) != nil)
+
+	router.HandleMessage(nil, fakeMessage{topic: "koupleless/test/base/heart"})
+	router.HandleMessage(nil, fakeMessage{topic: "koupleless/test/base/status"})
+	router.HandleMessage(nil, fakeMessage{topic: "koupleless/test/base/biz"})
+	assert.DeepEqual(t, routed, []string{
+		"heart:koupleless/test/base/heart",
+		"status:koupleless/test/base/status",
+		"fallback:koupleless/test/base/biz",
+	})
+
+	router.Remove(DefaultTopicBuilder.BaseTopicFilter(TopicTypeHeartBeat))
+	router.HandleMessage(nil, fakeMessage{topic: "koupleless/test/base/heart"})
+	assert.Equal(t, routed[len(routed)-1], "fallback:koupleless/test/base/heart")
+}
+
+func TestTopicRouter_HandleReplace(t *testing.T) {
+	calls := 0
+	router := NewTopicRouter(nil)
+	assert.NilError(t, router.Handle("koupleless/+/base/biz", func(_ mqtt.Client, _ mqtt.Message) {
+		calls += 1
+	}))
+	assert.NilError(t, router.Handle("koupleless/+/base/biz", func(_ mqtt.Client, _ mqtt.Message) {
+		calls += 10
+	}))
+	router.HandleMessage(nil, fakeMessage{topic: "koupleless/test/base/biz"})
+	// unmatched messages are dropped by default fallback
+	router.HandleMessage(nil, fakeMessage{topic: "koupleless/test/base/heart"})
+	assert.Equal(t, calls, 10)
+}
+
+func TestNewClientOptions_Router(t *testing.T) {
+	routed := make([]string, 0)
+	router := NewTopicRouter(nil)
+	assert.NilError(t, router.Handle("koupleless/+/base/heart", func(_ mqtt.Client, msg mqtt.Message) {
+		routed = append(routed, msg.Topic())
+	}))
+	opts, err := newClientOptions(&ClientConfig{
+		Broker:   "broker.emqx.io",
+		Port:     1883,
+		ClientID: "TestNewMqttClientID",
+		Router:   router,
+	})
+	assert.NilError(t, err)
+	// messages delivered to no subscription callback go through the router
+	opts.DefaultPublishHandler(nil, fakeMessage{topic: "koupleless/test/base/heart"})
+	assert.DeepEqual(t, routed, []string{"koupleless/test/base/heart"})
+}
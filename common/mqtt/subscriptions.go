@@ -0,0 +1,107 @@
+package mqtt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+)
+
+// subscriptionRegistry track the active subscriptions of client, so that they are replayed once reconnected,
+// the broker drops all subscriptions of a clean session once the connection lost
+type subscriptionRegistry struct {
+	sync.Mutex
+	subscriptions map[string]subscription
+}
+
+type subscription struct {
+	qos     byte
+	handler mqtt.MessageHandler
+}
+
+func (r *subscriptionRegistry) add(filter string, qos byte, handler mqtt.MessageHandler) {
+	r.Lock()
+	defer r.Unlock()
+	if r.subscriptions == nil {
+		r.subscriptions = make(map[string]subscription)
+	}
+	r.subscriptions[filter] = subscription{qos: qos, handler: handler}
+}
+
+func (r *subscriptionRegistry) remove(filters ...string) {
+	r.Lock()
+	defer r.Unlock()
+	for _, filter := range filters {
+		delete(r.subscriptions, filter)
+	}
+}
+
+// matching returns a registered filter matching topic, false if none
+func (r *subscriptionRegistry) matching(topic string) (string, bool) {
+	r.Lock()
+	defer r.Unlock()
+	for filter := range r.subscriptions {
+		if filter == topic || MatchTopic(filter, topic) {
+			return filter, true
+		}
+	}
+	return "", false
+}
+
+func (r *subscriptionRegistry) snapshot() map[string]subscription {
+	r.Lock()
+	defer r.Unlock()
+	ret := make(map[string]subscription, len(r.subscriptions))
+	for filter, sub := range r.subscriptions {
+		ret[filter] = sub
+	}
+	return ret
+}
+
+// Subscriptions returns the qos of active subscriptions by topic filter, which are replayed once reconnected
+func (c *Client) Subscriptions() map[string]byte {
+	ret := make(map[string]byte)
+	for filter, sub := range c.subscriptions.snapshot() {
+		ret[filter] = sub.qos
+	}
+	return ret
+}
+
+// Resubscribe replay the active subscriptions with their callbacks, return error describing the filters failed to subscribe
+func (c *Client) Resubscribe() error {
+	subscriptions := c.subscriptions.snapshot()
+	filters := make([]string, 0, len(subscriptions))
+	for filter := range subscriptions {
+		filters = append(filters, filter)
+	}
+	sort.Strings(filters)
+	errs := make([]error, 0)
+	for _, filter := range filters {
+		sub := subscriptions[filter]
+		token := c.client.Subscribe(filter, sub.qos, sub.handler)
+		token.Wait()
+		c.metricsRecorder().ObserveSubscribe(filter, sub.qos, token.Error())
+		if token.Error() != nil {
+			errs = append(errs, fmt.Errorf("failed to resubscribe %s: %w", filter, token.Error()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// onConnected restore the session state once connected, subscriptions are replayed before the buffered messages
+// flushed, so that replies to them are not missed
+func (c *Client) onConnected() {
+	if c.resubscribe {
+		if err := c.Resubscribe(); err != nil {
+			log.G(context.Background()).WithError(err).Error("Resubscribe failed")
+		}
+	}
+	if c.offlineQueue != nil {
+		c.flushOfflineQueue()
+	}
+	c.notifyConnectionState(true)
+}
@@ -0,0 +1,165 @@
+package mqtt
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"gotest.tools/assert"
+)
+
+type fakeToken struct {
+	err error
+}
+
+func (t *fakeToken) Wait() bool { return true }
+
+func (t *fakeToken) WaitTimeout(time.Duration) bool { return true }
+
+func (t *fakeToken) Done() <-chan struct{} {
+	done := make(chan struct{})
+	close(done)
+	return done
+}
+
+func (t *fakeToken) Error() error { return t.err }
+
+// fakeBrokerSession is a paho client keeping the subscriptions like a broker session
+type fakeBrokerSession struct {
+	mqtt.Client
+	sync.Mutex
+	subscriptions map[string]mqtt.MessageHandler
+	retained      map[string][]byte
+}
+
+func newFakeBrokerSession() *fakeBrokerSession {
+	return &fakeBrokerSession{subscriptions: make(map[string]mqtt.MessageHandler), retained: make(map[string][]byte)}
+}
+
+// Publish keep the retained messages like a broker, a zero-length retained message removes the one retained
+func (s *fakeBrokerSession) Publish(topic string, _ byte, retained bool, payload interface{}) mqtt.Token {
+	s.Lock()
+	defer s.Unlock()
+	if !retained {
+		return &fakeToken{}
+	}
+	if payload := payload.([]byte); len(payload) > 0 {
+		s.retained[topic] = payload
+	} else {
+		delete(s.retained, topic)
+	}
+	return &fakeToken{}
+}
+
+func (s *fakeBrokerSession) Subscribe(topic string, _ byte, callback mqtt.MessageHandler) mqtt.Token {
+	s.Lock()
+	defer s.Unlock()
+	s.subscriptions[topic] = callback
+	return &fakeToken{}
+}
+
+func (s *fakeBrokerSession) SubscribeMultiple(filters map[string]byte, callback mqtt.MessageHandler) mqtt.Token {
+	s.Lock()
+	defer s.Unlock()
+	for filter := range filters {
+		s.subscriptions[filter] = callback
+	}
+	return &fakeToken{}
+}
+
+func (s *fakeBrokerSession) Unsubscribe(topics ...string) mqtt.Token {
+	s.Lock()
+	defer s.Unlock()
+	for _, topic := range topics {
+		delete(s.subscriptions, topic)
+	}
+	return &fakeToken{}
+}
+
+// lose drop the subscriptions as broker does for a clean session once the connection lost
+func (s *fakeBrokerSession) lose() {
+	s.Lock()
+	defer s.Unlock()
+	s.subscriptions = make(map[string]mqtt.MessageHandler)
+}
+
+func (s *fakeBrokerSession) deliver(topic string) bool {
+	s.Lock()
+	handler, has := s.subscriptions[topic]
+	s.Unlock()
+	if has {
+		handler(s, fakeMessage{topic: topic})
+	}
+	return has
+}
+
+func TestClient_ResubscribeOnReconnect(t *testing.T) {
+	session := newFakeBrokerSession()
+	client := &Client{
+		client:          session,
+		connectionState: make(chan bool, 1),
+		resubscribe:     true,
+	}
+	received := make([]string, 0)
+	callBack := func(_ mqtt.Client, msg mqtt.Message) {
+		received = append(received, msg.Topic())
+	}
+	assert.Assert(t, client.Sub("koupleless/test/base/heart", Qos1, callBack))
+	assert.NilError(t, client.SubMultiple(map[string]byte{
+		"koupleless/test/base/biz":    Qos1,
+		"koupleless/test/base/status": Qos0,
+	}, callBack))
+	assert.Assert(t, client.UnSub("koupleless/test/base/status"))
+	assert.DeepEqual(t, client.Subscriptions(), map[string]byte{
+		"koupleless/test/base/heart": Qos1,
+		"koupleless/test/base/biz":   Qos1,
+	})
+
+	session.lose()
+	assert.Assert(t, !session.deliver("koupleless/test/base/heart"))
+
+	client.onConnected()
+	assert.Assert(t, <-client.ConnectionState())
+	assert.Assert(t, session.deliver("koupleless/test/base/heart"))
+	assert.Assert(t, session.deliver("koupleless/test/base/biz"))
+	assert.Assert(t, !session.deliver("koupleless/test/base/status"))
+	assert.DeepEqual(t, received, []string{"koupleless/test/base/heart", "koupleless/test/base/biz"})
+}
+
+func TestClient_SubWithContext(t *testing.T) {
+	session := newFakeBrokerSession()
+	client := &Client{client: session}
+	ctx, cancel := context.WithCancel(context.Background())
+	assert.NilError(t, client.SubWithContext(ctx, "koupleless/test/base/heart", Qos1, func(mqtt.Client, mqtt.Message) {}))
+	assert.Assert(t, session.deliver("koupleless/test/base/heart"))
+	assert.DeepEqual(t, client.Subscriptions(), map[string]byte{"koupleless/test/base/heart": Qos1})
+
+	cancel()
+	deadline := time.Now().Add(5 * time.Second)
+	for session.deliver("koupleless/test/base/heart") && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Assert(t, !session.deliver("koupleless/test/base/heart"))
+	assert.Equal(t, len(client.Subscriptions()), 0)
+
+	// subscribing with a done context is rejected
+	err := client.SubWithContext(ctx, "koupleless/test/base/heart", Qos1, func(mqtt.Client, mqtt.Message) {})
+	assert.Assert(t, errors.Is(err, context.Canceled))
+	assert.Assert(t, !session.deliver("koupleless/test/base/heart"))
+}
+
+func TestClient_ResubscribeDisabled(t *testing.T) {
+	session := newFakeBrokerSession()
+	client := &Client{
+		client:          session,
+		connectionState: make(chan bool, 1),
+	}
+	assert.Assert(t, client.Sub("koupleless/test/base/heart", Qos1, func(_ mqtt.Client, _ mqtt.Message) {}))
+	session.lose()
+	client.onConnected()
+	// a persistent session keeps the subscriptions on broker
+	assert.Assert(t, !session.deliver("koupleless/test/base/heart"))
+}
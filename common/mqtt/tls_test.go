@@ -0,0 +1,175 @@
+package mqtt
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"gotest.tools/assert"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	der  []byte
+}
+
+// newTestCert issue a certificate signed by parent, self-signed if parent is nil
+func newTestCert(t *testing.T, commonName string, isCA bool, parent *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NilError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	signerCert, signerKey := template, key
+	if parent != nil {
+		signerCert, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signerCert, &key.PublicKey, signerKey)
+	assert.NilError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.NilError(t, err)
+	return &testCert{cert: cert, key: key, der: der}
+}
+
+func (c *testCert) pem(t *testing.T) (crtPem, keyPem []byte) {
+	keyDer, err := x509.MarshalECPrivateKey(c.key)
+	assert.NilError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.der}), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+}
+
+func (c *testCert) writeFiles(t *testing.T, dir, name string) (crtPath, keyPath string) {
+	crtPath = filepath.Join(dir, name+".crt")
+	keyPath = filepath.Join(dir, name+".key")
+	crtPem, keyPem := c.pem(t)
+	assert.NilError(t, os.WriteFile(crtPath, crtPem, 0600))
+	assert.NilError(t, os.WriteFile(keyPath, keyPem, 0600))
+	return crtPath, keyPath
+}
+
+// handshake dial a tls listener configured by serverConfig with the client config, returns the peer certificates seen by server
+func handshake(t *testing.T, serverConfig, clientConfig *tls.Config) ([]*x509.Certificate, error) {
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", serverConfig)
+	assert.NilError(t, err)
+	defer listener.Close()
+	peerCerts := make(chan []*x509.Certificate, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		tlsConn := conn.(*tls.Conn)
+		if tlsConn.Handshake() == nil {
+			peerCerts <- tlsConn.ConnectionState().PeerCertificates
+		}
+		close(peerCerts)
+	}()
+	conn, err := tls.Dial("tcp", listener.Addr().String(), clientConfig)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	// the server verifies the client certificate after the client side handshake finished in tls 1.3
+	_, _ = conn.Read(make([]byte, 1))
+	return <-peerCerts, nil
+}
+
+func TestNewTlsConfig_MutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "test-ca", true, nil)
+	caPath, _ := ca.writeFiles(t, dir, "ca")
+	server := newTestCert(t, "127.0.0.1", false, ca)
+	client := newTestCert(t, "test-client", false, ca)
+	clientCrtPath, clientKeyPath := client.writeFiles(t, dir, "client")
+
+	clientConfig, err := newTlsConfig(&ClientConfig{
+		Broker:        "127.0.0.1",
+		CAPath:        caPath,
+		ClientCrtPath: clientCrtPath,
+		ClientKeyPath: clientKeyPath,
+	})
+	assert.NilError(t, err)
+
+	caPool := x509.NewCertPool()
+	caPool.AddCert(ca.cert)
+	serverCert := tls.Certificate{Certificate: [][]byte{server.der}, PrivateKey: server.key}
+	peerCerts, err := handshake(t, &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    caPool,
+	}, clientConfig)
+	assert.NilError(t, err)
+	assert.Equal(t, len(peerCerts), 1)
+	assert.Equal(t, peerCerts[0].Subject.CommonName, "test-client")
+
+	// broker advertising acceptable CAs not matching the client certificate issuer
+	otherPool := x509.NewCertPool()
+	otherPool.AddCert(newTestCert(t, "other-ca", true, nil).cert)
+	peerCerts, err = handshake(t, &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientAuth:   tls.RequireAnyClientCert,
+		ClientCAs:    otherPool,
+	}, clientConfig)
+	assert.NilError(t, err)
+	assert.Equal(t, len(peerCerts), 1)
+	assert.Equal(t, peerCerts[0].Subject.CommonName, "test-client")
+}
+
+func TestNewTlsConfig_Pem(t *testing.T) {
+	ca := newTestCert(t, "test-ca", true, nil)
+	caPem, _ := ca.pem(t)
+	server := newTestCert(t, "127.0.0.1", false, ca)
+	client := newTestCert(t, "test-client", false, ca)
+	clientCrtPem, clientKeyPem := client.pem(t)
+
+	// pem takes precedence over the not existing paths
+	clientConfig, err := newTlsConfig(&ClientConfig{
+		Broker:        "127.0.0.1",
+		CAPath:        "not-exist-ca.crt",
+		ClientCrtPath: "not-exist-client.crt",
+		ClientKeyPath: "not-exist-client.key",
+		CAPem:         caPem,
+		ClientCrtPem:  clientCrtPem,
+		ClientKeyPem:  clientKeyPem,
+	})
+	assert.NilError(t, err)
+
+	caPool := x509.NewCertPool()
+	caPool.AddCert(ca.cert)
+	peerCerts, err := handshake(t, &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{server.der}, PrivateKey: server.key}},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    caPool,
+	}, clientConfig)
+	assert.NilError(t, err)
+	assert.Equal(t, len(peerCerts), 1)
+	assert.Equal(t, peerCerts[0].Subject.CommonName, "test-client")
+
+	_, err = newTlsConfig(&ClientConfig{
+		Broker: "127.0.0.1",
+		CAPem:  []byte("invalid"),
+	})
+	var tlsErr *TLSConfigError
+	assert.Assert(t, errors.As(err, &tlsErr))
+	assert.Equal(t, tlsErr.File, TLSFileCA)
+	assert.Equal(t, tlsErr.Path, "")
+}
@@ -0,0 +1,112 @@
+package mqtt
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	// DefaultTopicPrefix is the root segment of all koupleless topics
+	DefaultTopicPrefix = "koupleless"
+
+	// TopicTypeHeartBeat is the topic type of base heart beat messages
+	TopicTypeHeartBeat = "heart"
+
+	// TopicTypeHealth is the topic type of base health responses
+	TopicTypeHealth = "health"
+
+	// TopicTypeBiz is the topic type of base biz list responses
+	TopicTypeBiz = "biz"
+
+	// TopicTypeLog is the topic type of base biz log responses
+	TopicTypeLog = "log"
+
+	// TopicTypeStatus is the topic type of base online/offline status messages
+	TopicTypeStatus = "status"
+)
+
+// ErrTopicNotPermitted is returned when publishing or subscribing a topic outside the subtree of a node,
+// which a broker restricting each node to its own subtree by ACL would deny
+var ErrTopicNotPermitted = errors.New("topic not permitted")
+
+// TopicBuilder centralize the koupleless topic naming scheme:
+// commands are sent to <prefix>/<nodeID>/<command>, base messages are sent to <prefix>/<nodeID>/base/<topicType>
+type TopicBuilder struct {
+	Prefix string
+}
+
+// DefaultTopicBuilder builds topics under DefaultTopicPrefix
+var DefaultTopicBuilder = NewTopicBuilder(DefaultTopicPrefix)
+
+func NewTopicBuilder(prefix string) *TopicBuilder {
+	return &TopicBuilder{
+		Prefix: prefix,
+	}
+}
+
+// validateTopicSegment check the segment is a single level topic name without wildcards
+func validateTopicSegment(segment string) error {
+	if segment == "" {
+		return fmt.Errorf("topic segment cannot be empty")
+	}
+	if strings.ContainsAny(segment, "/+#") {
+		return fmt.Errorf("topic segment %q cannot contain '/', '+' or '#'", segment)
+	}
+	return nil
+}
+
+func (b *TopicBuilder) build(segments ...string) (string, error) {
+	for _, segment := range segments {
+		if err := validateTopicSegment(segment); err != nil {
+			return "", err
+		}
+	}
+	return b.Prefix + "/" + strings.Join(segments, "/"), nil
+}
+
+// NodeTopicPrefix returns the prefix of all topics of target node, i.e. <prefix>/<nodeID>
+func (b *TopicBuilder) NodeTopicPrefix(nodeID string) (string, error) {
+	return b.build(nodeID)
+}
+
+// NodeTopicFilter returns the filter matching all topics of target node, e.g. for the ACL rule of the node
+func (b *TopicBuilder) NodeTopicFilter(nodeID string) (string, error) {
+	prefix, err := b.NodeTopicPrefix(nodeID)
+	if err != nil {
+		return "", err
+	}
+	return prefix + "/#", nil
+}
+
+// CheckNodeTopic returns ErrTopicNotPermitted if topic or topic filter is not under the prefix of target node
+func (b *TopicBuilder) CheckNodeTopic(nodeID, topic string) error {
+	prefix, err := b.NodeTopicPrefix(nodeID)
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(topic, prefix+"/") {
+		return fmt.Errorf("%w: %s is not under %s of node %s", ErrTopicNotPermitted, topic, prefix, nodeID)
+	}
+	return nil
+}
+
+// NodeCommandTopic returns the topic a command for target node should be published to
+func (b *TopicBuilder) NodeCommandTopic(nodeID, command string) (string, error) {
+	return b.build(nodeID, command)
+}
+
+// NodeBaseTopic returns the topic target node publishes the topicType messages to
+func (b *TopicBuilder) NodeBaseTopic(nodeID, topicType string) (string, error) {
+	return b.build(nodeID, "base", topicType)
+}
+
+// NodeStatusTopic returns the topic of target node online/offline status
+func (b *TopicBuilder) NodeStatusTopic(nodeID string) (string, error) {
+	return b.NodeBaseTopic(nodeID, TopicTypeStatus)
+}
+
+// BaseTopicFilter returns the filter matching topicType messages of all nodes
+func (b *TopicBuilder) BaseTopicFilter(topicType string) string {
+	return b.Prefix + "/+/base/" + topicType
+}
@@ -0,0 +1,62 @@
+package mqtt
+
+import (
+	"errors"
+	"gotest.tools/assert"
+	"testing"
+)
+
+func TestTopicBuilder_NodeCommandTopic(t *testing.T) {
+	topic, err := DefaultTopicBuilder.NodeCommandTopic("test", "health")
+	assert.NilError(t, err)
+	assert.Assert(t, topic == "koupleless/test/health")
+}
+
+func TestTopicBuilder_NodeStatusTopic(t *testing.T) {
+	topic, err := NewTopicBuilder("test-prefix").NodeStatusTopic("test")
+	assert.NilError(t, err)
+	assert.Assert(t, topic == "test-prefix/test/base/status")
+}
+
+func TestTopicBuilder_InvalidSegment(t *testing.T) {
+	_, err := DefaultTopicBuilder.NodeCommandTopic("test/1", "health")
+	assert.Assert(t, err != nil)
+	_, err = DefaultTopicBuilder.NodeCommandTopic("+", "health")
+	assert.Assert(t, err != nil)
+	_, err = DefaultTopicBuilder.NodeBaseTopic("test", "#")
+	assert.Assert(t, err != nil)
+	_, err = DefaultTopicBuilder.NodeStatusTopic("")
+	assert.Assert(t, err != nil)
+}
+
+func TestTopicBuilder_BaseTopicFilter(t *testing.T) {
+	assert.Assert(t, DefaultTopicBuilder.BaseTopicFilter(TopicTypeHeartBeat) == "koupleless/+/base/heart")
+}
+
+func TestTopicBuilder_NodeTopicFilter(t *testing.T) {
+	prefix, err := DefaultTopicBuilder.NodeTopicPrefix("test")
+	assert.NilError(t, err)
+	assert.Equal(t, prefix, "koupleless/test")
+	filter, err := NewTopicBuilder("tenant").NodeTopicFilter("test")
+	assert.NilError(t, err)
+	assert.Equal(t, filter, "tenant/test/#")
+	_, err = DefaultTopicBuilder.NodeTopicFilter("test/1")
+	assert.Assert(t, err != nil)
+}
+
+func TestTopicBuilder_CheckNodeTopic(t *testing.T) {
+	commandTopic, _ := DefaultTopicBuilder.NodeCommandTopic("test", "health")
+	assert.NilError(t, DefaultTopicBuilder.CheckNodeTopic("test", commandTopic))
+	statusTopic, _ := DefaultTopicBuilder.NodeStatusTopic("test")
+	assert.NilError(t, DefaultTopicBuilder.CheckNodeTopic("test", statusTopic))
+
+	for _, topic := range []string{
+		"koupleless/test",
+		"koupleless/test-2/health",
+		"koupleless/other/base/status",
+		"koupleless/+/base/heart",
+		"tenant/test/health",
+	} {
+		assert.Assert(t, errors.Is(DefaultTopicBuilder.CheckNodeTopic("test", topic), ErrTopicNotPermitted), topic)
+	}
+}
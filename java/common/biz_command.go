@@ -0,0 +1,152 @@
+package common
+
+import (
+	"errors"
+	"github.com/koupleless/arkctl/v1/service/ark"
+	"sort"
+	"sync"
+)
+
+// ErrBizCommandTimeout is returned when base not confirmed a biz command within the command timeout
+var ErrBizCommandTimeout = errors.New("biz command timeout")
+
+// BizCommandWaiters correlate biz commands waiting for confirmation with the biz info lists reported by base,
+// keyed by node id and biz identity
+type BizCommandWaiters struct {
+	sync.Mutex
+	modelUtils ModelUtils
+	waiters    map[string]map[string][]*BizCommandWaiter
+}
+
+// BizCommandWaiter is a biz command waiting for confirmation
+type BizCommandWaiter struct {
+	command string
+	// confirmed returns true if the reported biz info, nil if not reported, confirms the command
+	confirmed func(bizInfo *ark.ArkBizInfo) bool
+	result    chan *ark.ArkBizInfo
+}
+
+// PendingBizCommand is a biz command waiting for base confirmation
+type PendingBizCommand struct {
+	Command     string `json:"command"`
+	BizIdentity string `json:"bizIdentity"`
+}
+
+func NewBizCommandWaiters() *BizCommandWaiters {
+	return &BizCommandWaiters{
+		waiters: make(map[string]map[string][]*BizCommandWaiter),
+	}
+}
+
+// Result returns the channel receiving the biz info confirming the command, nil if the biz is not reported
+func (w *BizCommandWaiter) Result() <-chan *ark.ArkBizInfo {
+	return w.result
+}
+
+// BizInstallConfirmed returns true if base reported the biz activated or broken
+func BizInstallConfirmed(bizInfo *ark.ArkBizInfo) bool {
+	if bizInfo == nil {
+		return false
+	}
+	state := ModelUtils{}.NormalizeBizState(bizInfo.BizState)
+	return state == BizStateActivated || state == BizStateBroken
+}
+
+// BizUnInstallConfirmed returns true if base reported a biz list without the biz
+func BizUnInstallConfirmed(bizInfo *ark.ArkBizInfo) bool {
+	return bizInfo == nil
+}
+
+// Wait register a waiter of biz on node, the returned func should be called once the waiter is no longer needed
+func (c *BizCommandWaiters) Wait(nodeID, command, bizIdentity string, confirmed func(bizInfo *ark.ArkBizInfo) bool) (*BizCommandWaiter, func()) {
+	waiter := &BizCommandWaiter{
+		command:   command,
+		confirmed: confirmed,
+		result:    make(chan *ark.ArkBizInfo, 1),
+	}
+	c.Lock()
+	defer c.Unlock()
+	if c.waiters[nodeID] == nil {
+		c.waiters[nodeID] = make(map[string][]*BizCommandWaiter)
+	}
+	c.waiters[nodeID][bizIdentity] = append(c.waiters[nodeID][bizIdentity], waiter)
+	return waiter, func() {
+		c.remove(nodeID, bizIdentity, waiter)
+	}
+}
+
+func (c *BizCommandWaiters) remove(nodeID, bizIdentity string, target *BizCommandWaiter) {
+	c.Lock()
+	defer c.Unlock()
+	waiters := c.waiters[nodeID][bizIdentity]
+	for i, waiter := range waiters {
+		if waiter == target {
+			waiters = append(waiters[:i], waiters[i+1:]...)
+			break
+		}
+	}
+	if len(waiters) > 0 {
+		c.waiters[nodeID][bizIdentity] = waiters
+		return
+	}
+	delete(c.waiters[nodeID], bizIdentity)
+	if len(c.waiters[nodeID]) == 0 {
+		delete(c.waiters, nodeID)
+	}
+}
+
+// Observe resolve the waiters of node confirmed by the biz info list reported by base, invalid biz infos are skipped
+func (c *BizCommandWaiters) Observe(nodeID string, bizInfos []*ark.ArkBizInfo) {
+	identityToBizInfo := make(map[string]*ark.ArkBizInfo, len(bizInfos))
+	for _, bizInfo := range bizInfos {
+		bizIdentity, err := c.modelUtils.GetBizIdentityFromBizInfoChecked(bizInfo)
+		if err != nil {
+			continue
+		}
+		identityToBizInfo[bizIdentity] = bizInfo
+	}
+	c.Lock()
+	defer c.Unlock()
+	for bizIdentity, waiters := range c.waiters[nodeID] {
+		bizInfo := identityToBizInfo[bizIdentity]
+		for _, waiter := range waiters {
+			if !waiter.confirmed(bizInfo) {
+				continue
+			}
+			select {
+			case waiter.result <- bizInfo:
+			default:
+				// already confirmed
+			}
+		}
+	}
+}
+
+// Pending returns the commands of node waiting for confirmation, sorted by biz identity
+func (c *BizCommandWaiters) Pending(nodeID string) []PendingBizCommand {
+	c.Lock()
+	defer c.Unlock()
+	ret := make([]PendingBizCommand, 0)
+	for bizIdentity, waiters := range c.waiters[nodeID] {
+		for _, waiter := range waiters {
+			ret = append(ret, PendingBizCommand{Command: waiter.command, BizIdentity: bizIdentity})
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].BizIdentity < ret[j].BizIdentity
+	})
+	return ret
+}
+
+// PendingCount returns the count of commands of all nodes waiting for confirmation
+func (c *BizCommandWaiters) PendingCount() int {
+	c.Lock()
+	defer c.Unlock()
+	count := 0
+	for _, identityToWaiters := range c.waiters {
+		for _, waiters := range identityToWaiters {
+			count += len(waiters)
+		}
+	}
+	return count
+}
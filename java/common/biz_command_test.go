@@ -0,0 +1,44 @@
+package common
+
+import (
+	"github.com/koupleless/arkctl/v1/service/ark"
+	"github.com/koupleless/virtual-kubelet/java/model"
+	"gotest.tools/assert"
+	"testing"
+)
+
+func TestBizCommandWaiters_Observe(t *testing.T) {
+	waiters := NewBizCommandWaiters()
+	installWaiter, cancelInstall := waiters.Wait("test-device", model.CommandInstallBiz, "biz1:0.0.1", BizInstallConfirmed)
+	uninstallWaiter, cancelUnInstall := waiters.Wait("test-device", model.CommandUnInstallBiz, "biz2:0.0.1", BizUnInstallConfirmed)
+	assert.DeepEqual(t, waiters.Pending("test-device"), []PendingBizCommand{
+		{Command: model.CommandInstallBiz, BizIdentity: "biz1:0.0.1"},
+		{Command: model.CommandUnInstallBiz, BizIdentity: "biz2:0.0.1"},
+	})
+
+	// biz of other nodes confirm nothing
+	waiters.Observe("other-device", []*ark.ArkBizInfo{{BizName: "biz1", BizVersion: "0.0.1", BizState: "ACTIVATED"}})
+	assert.Equal(t, len(installWaiter.Result()), 0)
+
+	waiters.Observe("test-device", []*ark.ArkBizInfo{{BizName: "biz1", BizVersion: "0.0.1", BizState: "ACTIVATED"}})
+	bizInfo := <-installWaiter.Result()
+	assert.Equal(t, bizInfo.BizName, "biz1")
+	assert.Equal(t, (<-uninstallWaiter.Result()) == nil, true)
+
+	cancelInstall()
+	cancelUnInstall()
+	assert.Equal(t, waiters.PendingCount(), 0)
+	assert.Equal(t, len(waiters.waiters), 0)
+}
+
+func TestBizCommandWaiters_Observe_InvalidBizInfo(t *testing.T) {
+	waiters := NewBizCommandWaiters()
+	waiter, cancelWait := waiters.Wait("test-device", model.CommandUnInstallBiz, ":", func(bizInfo *ark.ArkBizInfo) bool {
+		return bizInfo != nil
+	})
+	defer cancelWait()
+
+	// nil and nameless biz infos are skipped instead of keyed by a degenerate identity
+	waiters.Observe("test-device", []*ark.ArkBizInfo{nil, {BizState: "ACTIVATED"}})
+	assert.Equal(t, len(waiter.Result()), 0)
+}
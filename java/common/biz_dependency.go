@@ -0,0 +1,132 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"github.com/koupleless/arkctl/v1/service/ark"
+	corev1 "k8s.io/api/core/v1"
+	"strings"
+)
+
+// BizDependsOnEnv is the container env listing the names of biz in the same pod that the biz depends on, separated by comma,
+// the biz is installed only after its dependencies activated
+const BizDependsOnEnv = "BIZ_DEPENDS_ON"
+
+// ErrBizDependencyNotFound is returned when a biz depends on a biz not in the same pod
+var ErrBizDependencyNotFound = errors.New("biz dependency not found")
+
+// ErrBizDependencyCycle is returned when the biz of a pod depend on each other
+var ErrBizDependencyCycle = errors.New("biz dependency cycle")
+
+// GetBizDependenciesFromCoreV1Container returns the biz names the container depends on by BizDependsOnEnv
+func (c ModelUtils) GetBizDependenciesFromCoreV1Container(container corev1.Container) []string {
+	ret := make([]string, 0)
+	for _, env := range container.Env {
+		if env.Name != BizDependsOnEnv {
+			continue
+		}
+		for _, name := range strings.Split(env.Value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				ret = append(ret, name)
+			}
+		}
+	}
+	return ret
+}
+
+// GetBizDependencyGraphFromCoreV1Pod returns the biz names each biz of pod depends on, keyed by biz name
+func (c ModelUtils) GetBizDependencyGraphFromCoreV1Pod(pod *corev1.Pod) map[string][]string {
+	ret := make(map[string][]string)
+	for _, container := range c.GetBizContainersFromCoreV1Pod(pod) {
+		bizModel := c.TranslateCoreV1ContainerToBizModel(container)
+		ret[bizModel.BizName] = c.GetBizDependenciesFromCoreV1Container(container)
+	}
+	return ret
+}
+
+// GetOrderedBizModelsFromCoreV1Pod is GetBizModelsFromCoreV1PodChecked sorted in install order, every biz after its dependencies,
+// returns ErrBizDependencyNotFound or ErrBizDependencyCycle if the dependencies can't be satisfied
+func (c ModelUtils) GetOrderedBizModelsFromCoreV1Pod(pod *corev1.Pod) ([]*ark.BizModel, error) {
+	bizModels, err := c.GetBizModelsFromCoreV1PodChecked(pod)
+	if err != nil {
+		return bizModels, err
+	}
+	return c.SortBizModelsByDependency(bizModels, c.GetBizDependencyGraphFromCoreV1Pod(pod))
+}
+
+// GetInstallBizModelsFromCoreV1Pod returns the init biz models in declaration order followed by
+// GetOrderedBizModelsFromCoreV1Pod, i.e. all biz of pod in install order
+func (c ModelUtils) GetInstallBizModelsFromCoreV1Pod(pod *corev1.Pod) ([]*ark.BizModel, error) {
+	initBizModels, err := c.GetInitBizModelsFromCoreV1Pod(pod)
+	if err != nil {
+		return nil, err
+	}
+	bizModels, err := c.GetOrderedBizModelsFromCoreV1Pod(pod)
+	if err != nil {
+		return nil, err
+	}
+	return append(initBizModels, bizModels...), nil
+}
+
+// GetInitBizDependenciesFromCoreV1Pod returns the init biz names which must be activated before installing the biz of pod,
+// the init biz declared before it if it is an init biz, otherwise all init biz
+func (c ModelUtils) GetInitBizDependenciesFromCoreV1Pod(pod *corev1.Pod, bizName string) []string {
+	ret := make([]string, 0, len(pod.Spec.InitContainers))
+	for _, container := range pod.Spec.InitContainers {
+		initBizName := c.TranslateCoreV1ContainerToBizModel(container).BizName
+		if initBizName == bizName {
+			break
+		}
+		ret = append(ret, initBizName)
+	}
+	return ret
+}
+
+// SortBizModelsByDependency sort biz models topologically by the dependency graph keyed by biz name,
+// independent biz keep their relative order
+func (c ModelUtils) SortBizModelsByDependency(bizModels []*ark.BizModel, dependencies map[string][]string) ([]*ark.BizModel, error) {
+	nameToModel := make(map[string]*ark.BizModel, len(bizModels))
+	for _, bizModel := range bizModels {
+		nameToModel[bizModel.BizName] = bizModel
+	}
+	remaining := make(map[string]int, len(bizModels))
+	for _, bizModel := range bizModels {
+		for _, dependency := range dependencies[bizModel.BizName] {
+			if _, has := nameToModel[dependency]; !has {
+				return nil, fmt.Errorf("%w: biz %s depends on %s", ErrBizDependencyNotFound, bizModel.BizName, dependency)
+			}
+		}
+		remaining[bizModel.BizName] = len(dependencies[bizModel.BizName])
+	}
+
+	ret := make([]*ark.BizModel, 0, len(bizModels))
+	installed := make(map[string]bool, len(bizModels))
+	for len(ret) < len(bizModels) {
+		progressed := false
+		for _, bizModel := range bizModels {
+			if installed[bizModel.BizName] || remaining[bizModel.BizName] > 0 {
+				continue
+			}
+			installed[bizModel.BizName] = true
+			ret = append(ret, bizModel)
+			progressed = true
+			for _, dependent := range bizModels {
+				for _, dependency := range dependencies[dependent.BizName] {
+					if dependency == bizModel.BizName {
+						remaining[dependent.BizName]--
+					}
+				}
+			}
+		}
+		if !progressed {
+			cyclic := make([]string, 0)
+			for _, bizModel := range bizModels {
+				if !installed[bizModel.BizName] {
+					cyclic = append(cyclic, bizModel.BizName)
+				}
+			}
+			return nil, fmt.Errorf("%w: among biz %s", ErrBizDependencyCycle, strings.Join(cyclic, ", "))
+		}
+	}
+	return ret, nil
+}
@@ -0,0 +1,110 @@
+package common
+
+import (
+	"errors"
+	"github.com/koupleless/arkctl/v1/service/ark"
+	"gotest.tools/assert"
+	corev1 "k8s.io/api/core/v1"
+	"testing"
+)
+
+func bizNames(bizModels []*ark.BizModel) []string {
+	ret := make([]string, 0, len(bizModels))
+	for _, bizModel := range bizModels {
+		ret = append(ret, bizModel.BizName)
+	}
+	return ret
+}
+
+func TestModelUtils_GetBizDependenciesFromCoreV1Container(t *testing.T) {
+	dependencies := moduleUtils.GetBizDependenciesFromCoreV1Container(corev1.Container{
+		Env: []corev1.EnvVar{{Name: BizDependsOnEnv, Value: " biz1, ,biz2 "}},
+	})
+	assert.DeepEqual(t, dependencies, []string{"biz1", "biz2"})
+	assert.Equal(t, len(moduleUtils.GetBizDependenciesFromCoreV1Container(corev1.Container{})), 0)
+}
+
+func TestModelUtils_GetOrderedBizModelsFromCoreV1Pod(t *testing.T) {
+	pod := &corev1.Pod{
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Name:  "biz1",
+					Image: "file:///test/biz1.jar",
+					Env: []corev1.EnvVar{
+						{Name: "BIZ_VERSION", Value: "1.0.0"},
+						{Name: BizDependsOnEnv, Value: "biz2,biz3"},
+					},
+				},
+				{
+					Name:  "biz2",
+					Image: "file:///test/biz2.jar",
+					Env: []corev1.EnvVar{
+						{Name: "BIZ_VERSION", Value: "1.0.0"},
+						{Name: BizDependsOnEnv, Value: "biz3"},
+					},
+				},
+				{
+					Name:  "biz3",
+					Image: "file:///test/biz3.jar",
+					Env:   []corev1.EnvVar{{Name: "BIZ_VERSION", Value: "1.0.0"}},
+				},
+				{
+					Name:  "biz4",
+					Image: "file:///test/biz4.jar",
+					Env:   []corev1.EnvVar{{Name: "BIZ_VERSION", Value: "1.0.0"}},
+				},
+			},
+		},
+	}
+	bizModels, err := moduleUtils.GetOrderedBizModelsFromCoreV1Pod(pod)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, bizNames(bizModels), []string{"biz3", "biz4", "biz2", "biz1"})
+}
+
+func TestModelUtils_GetInstallBizModelsFromCoreV1Pod(t *testing.T) {
+	pod := &corev1.Pod{
+		Spec: corev1.PodSpec{
+			InitContainers: []corev1.Container{
+				{Name: "init1", Image: "file:///test/init1-1.0.0.jar"},
+				{Name: "init2", Image: "file:///test/init2-1.0.0.jar"},
+			},
+			Containers: []corev1.Container{
+				{
+					Name:  "biz1",
+					Image: "file:///test/biz1-1.0.0.jar",
+					Env:   []corev1.EnvVar{{Name: BizDependsOnEnv, Value: "biz2"}},
+				},
+				{Name: "biz2", Image: "file:///test/biz2-1.0.0.jar"},
+			},
+		},
+	}
+	bizModels, err := moduleUtils.GetInstallBizModelsFromCoreV1Pod(pod)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, bizNames(bizModels), []string{"init1", "init2", "biz2", "biz1"})
+
+	assert.DeepEqual(t, moduleUtils.GetInitBizDependenciesFromCoreV1Pod(pod, "init1"), []string{})
+	assert.DeepEqual(t, moduleUtils.GetInitBizDependenciesFromCoreV1Pod(pod, "init2"), []string{"init1"})
+	assert.DeepEqual(t, moduleUtils.GetInitBizDependenciesFromCoreV1Pod(pod, "biz1"), []string{"init1", "init2"})
+
+	pod.Spec.InitContainers[1].Image = "file:///test/init2.jar"
+	_, err = moduleUtils.GetInstallBizModelsFromCoreV1Pod(pod)
+	assert.Assert(t, errors.Is(err, ErrBizVersionNotFound))
+}
+
+func TestModelUtils_SortBizModelsByDependency_NotFound(t *testing.T) {
+	_, err := moduleUtils.SortBizModelsByDependency([]*ark.BizModel{
+		{BizName: "biz1", BizVersion: "1.0.0"},
+	}, map[string][]string{"biz1": {"missing"}})
+	assert.Assert(t, errors.Is(err, ErrBizDependencyNotFound))
+}
+
+func TestModelUtils_SortBizModelsByDependency_Cycle(t *testing.T) {
+	_, err := moduleUtils.SortBizModelsByDependency([]*ark.BizModel{
+		{BizName: "biz1", BizVersion: "1.0.0"},
+		{BizName: "biz2", BizVersion: "1.0.0"},
+		{BizName: "biz3", BizVersion: "1.0.0"},
+	}, map[string][]string{"biz1": {"biz2"}, "biz2": {"biz1"}})
+	assert.Assert(t, errors.Is(err, ErrBizDependencyCycle))
+	assert.ErrorContains(t, err, "biz1, biz2")
+}
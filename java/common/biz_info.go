@@ -0,0 +1,58 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/koupleless/arkctl/v1/service/ark"
+)
+
+// ErrInvalidBizInfo is returned when a biz info misses required fields
+var ErrInvalidBizInfo = errors.New("invalid biz info")
+
+// ParseBizInfoList decode the biz info list reported by base, each biz info must have name, version and state
+func ParseBizInfoList(payload []byte) ([]*ark.ArkBizInfo, error) {
+	var bizInfos []*ark.ArkBizInfo
+	if err := json.Unmarshal(payload, &bizInfos); err != nil {
+		return nil, fmt.Errorf("error unmarshalling biz info list: %w", err)
+	}
+	if err := validateBizInfoList(bizInfos); err != nil {
+		return nil, err
+	}
+	return bizInfos, nil
+}
+
+// EncodeBizInfoList encode the biz info list in the schema accepted by ParseBizInfoList
+func EncodeBizInfoList(bizInfos []*ark.ArkBizInfo) ([]byte, error) {
+	if err := validateBizInfoList(bizInfos); err != nil {
+		return nil, err
+	}
+	if bizInfos == nil {
+		bizInfos = make([]*ark.ArkBizInfo, 0)
+	}
+	return json.Marshal(bizInfos)
+}
+
+func validateBizInfoList(bizInfos []*ark.ArkBizInfo) error {
+	errs := make([]error, 0)
+	for i, bizInfo := range bizInfos {
+		if bizInfo == nil {
+			errs = append(errs, fmt.Errorf("%w: index %d is null", ErrInvalidBizInfo, i))
+			continue
+		}
+		missing := make([]string, 0)
+		if bizInfo.BizName == "" {
+			missing = append(missing, "bizName")
+		}
+		if bizInfo.BizVersion == "" {
+			missing = append(missing, "bizVersion")
+		}
+		if bizInfo.BizState == "" {
+			missing = append(missing, "bizState")
+		}
+		if len(missing) > 0 {
+			errs = append(errs, fmt.Errorf("%w: index %d missing %v", ErrInvalidBizInfo, i, missing))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,88 @@
+package common
+
+import (
+	"errors"
+	"github.com/koupleless/arkctl/v1/service/ark"
+	"gotest.tools/assert"
+	"testing"
+)
+
+func TestParseBizInfoList(t *testing.T) {
+	payload := []byte(`[
+		{
+			"bizName": "biz1",
+			"bizState": "ACTIVATED",
+			"bizVersion": "0.0.1-SNAPSHOT",
+			"mainClass": "com.alipay.sofa.web.biz1.Biz1Application",
+			"webContextPath": "biz1",
+			"bizStateRecords": [
+				{"changeTime": "2024-07-02 17:40:37.443", "state": "RESOLVED", "reason": "", "message": ""},
+				{"changeTime": "2024-07-02 17:40:38.221", "state": "ACTIVATED", "reason": "", "message": ""}
+			]
+		},
+		{
+			"bizName": "biz2",
+			"bizState": "RESOLVED",
+			"bizVersion": "1.0.0",
+			"mainClass": "com.alipay.sofa.web.biz2.Biz2Application",
+			"webContextPath": "biz2"
+		}
+	]`)
+	bizInfos, err := ParseBizInfoList(payload)
+	assert.NilError(t, err)
+	assert.Assert(t, len(bizInfos) == 2)
+	assert.Assert(t, bizInfos[0].BizName == "biz1")
+	assert.Assert(t, bizInfos[0].BizVersion == "0.0.1-SNAPSHOT")
+	assert.Assert(t, bizInfos[0].BizState == "ACTIVATED")
+	assert.Assert(t, len(bizInfos[0].BizStateRecords) == 2)
+	assert.Assert(t, bizInfos[1].BizName == "biz2")
+	assert.Assert(t, bizInfos[1].BizState == "RESOLVED")
+}
+
+func TestParseBizInfoList_Empty(t *testing.T) {
+	bizInfos, err := ParseBizInfoList([]byte(`[]`))
+	assert.NilError(t, err)
+	assert.Assert(t, len(bizInfos) == 0)
+}
+
+func TestParseBizInfoList_Malformed(t *testing.T) {
+	_, err := ParseBizInfoList([]byte(`[{"bizName": "biz1",`))
+	assert.Assert(t, err != nil)
+	assert.Assert(t, !errors.Is(err, ErrInvalidBizInfo))
+
+	_, err = ParseBizInfoList([]byte(`{"bizName": "biz1"}`))
+	assert.Assert(t, err != nil)
+}
+
+func TestParseBizInfoList_MissingFields(t *testing.T) {
+	_, err := ParseBizInfoList([]byte(`[{"bizName": "biz1", "bizVersion": "1.0.0"}]`))
+	assert.Assert(t, errors.Is(err, ErrInvalidBizInfo))
+
+	_, err = ParseBizInfoList([]byte(`[{"bizVersion": "1.0.0", "bizState": "ACTIVATED"}]`))
+	assert.Assert(t, errors.Is(err, ErrInvalidBizInfo))
+
+	_, err = ParseBizInfoList([]byte(`[null]`))
+	assert.Assert(t, errors.Is(err, ErrInvalidBizInfo))
+}
+
+func TestEncodeBizInfoList(t *testing.T) {
+	bizInfos := []*ark.ArkBizInfo{
+		{
+			BizName:    "biz1",
+			BizVersion: "0.0.1",
+			BizState:   "ACTIVATED",
+		},
+	}
+	payload, err := EncodeBizInfoList(bizInfos)
+	assert.NilError(t, err)
+	decoded, err := ParseBizInfoList(payload)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, decoded, bizInfos)
+
+	payload, err = EncodeBizInfoList(nil)
+	assert.NilError(t, err)
+	assert.Equal(t, string(payload), "[]")
+
+	_, err = EncodeBizInfoList([]*ark.ArkBizInfo{{BizName: "biz1"}})
+	assert.Assert(t, errors.Is(err, ErrInvalidBizInfo))
+}
@@ -0,0 +1,62 @@
+package common
+
+import (
+	"context"
+	"github.com/koupleless/virtual-kubelet/java/model"
+	"golang.org/x/sync/semaphore"
+	"sync"
+)
+
+// BizOpLimiter bounds the outstanding biz commands of each node, nodes are limited independently
+type BizOpLimiter struct {
+	sync.Mutex
+	limit int64
+	nodes map[string]*nodeBizOps
+}
+
+// nodeBizOps is the slots of a node, removed once no command holds or waits for a slot
+type nodeBizOps struct {
+	slots *semaphore.Weighted
+	refs  int
+}
+
+// NewBizOpLimiter create the limiter of limit slots per node, model.DefaultMaxConcurrentBizOps if not positive
+func NewBizOpLimiter(limit int) *BizOpLimiter {
+	if limit <= 0 {
+		limit = model.DefaultMaxConcurrentBizOps
+	}
+	return &BizOpLimiter{
+		limit: int64(limit),
+		nodes: make(map[string]*nodeBizOps),
+	}
+}
+
+// Acquire block until a slot of node is available or ctx done, the returned func releases the slot
+func (l *BizOpLimiter) Acquire(ctx context.Context, nodeID string) (func(), error) {
+	l.Lock()
+	ops := l.nodes[nodeID]
+	if ops == nil {
+		ops = &nodeBizOps{slots: semaphore.NewWeighted(l.limit)}
+		l.nodes[nodeID] = ops
+	}
+	ops.refs++
+	l.Unlock()
+
+	if err := ops.slots.Acquire(ctx, 1); err != nil {
+		l.unref(nodeID, ops)
+		return nil, err
+	}
+	return func() {
+		ops.slots.Release(1)
+		l.unref(nodeID, ops)
+	}, nil
+}
+
+func (l *BizOpLimiter) unref(nodeID string, ops *nodeBizOps) {
+	l.Lock()
+	defer l.Unlock()
+	ops.refs--
+	if ops.refs == 0 {
+		delete(l.nodes, nodeID)
+	}
+}
@@ -0,0 +1,38 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"github.com/koupleless/virtual-kubelet/java/model"
+	"gotest.tools/assert"
+	"testing"
+	"time"
+)
+
+func TestBizOpLimiter(t *testing.T) {
+	limiter := NewBizOpLimiter(2)
+	release1, err := limiter.Acquire(context.Background(), "test-device")
+	assert.NilError(t, err)
+	release2, err := limiter.Acquire(context.Background(), "test-device")
+	assert.NilError(t, err)
+
+	// the third op of the node waits for a slot
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = limiter.Acquire(ctx, "test-device")
+	assert.Assert(t, errors.Is(err, context.DeadlineExceeded))
+
+	// other nodes are not limited by the node
+	releaseOther, err := limiter.Acquire(context.Background(), "other-device")
+	assert.NilError(t, err)
+	releaseOther()
+
+	release1()
+	release3, err := limiter.Acquire(context.Background(), "test-device")
+	assert.NilError(t, err)
+	release2()
+	release3()
+	assert.Equal(t, len(limiter.nodes), 0)
+
+	assert.Equal(t, NewBizOpLimiter(0).limit, int64(model.DefaultMaxConcurrentBizOps))
+}
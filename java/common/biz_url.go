@@ -0,0 +1,39 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"github.com/koupleless/arkctl/common/fileutil"
+	"net/url"
+	"strings"
+)
+
+// ErrUnsupportedBizUrl is returned when the biz url is not a file, http or https url the ark runtime can fetch
+var ErrUnsupportedBizUrl = errors.New("unsupported biz url")
+
+// supportedBizUrlSchemes are the biz url schemes understood by ark runtime
+var supportedBizUrlSchemes = map[string]bool{
+	"file":  true,
+	"http":  true,
+	"https": true,
+}
+
+// NormalizeBizUrl validate the scheme of biz url is file, http or https, and lower case the scheme. an absolute path
+// without scheme is rewritten to a file url, ErrUnsupportedBizUrl is returned for other urls, e.g. a typo'd docker image
+func (c ModelUtils) NormalizeBizUrl(bizUrl string) (fileutil.FileUrl, error) {
+	if strings.HasPrefix(bizUrl, "/") {
+		return fileutil.FileUrl("file://" + bizUrl), nil
+	}
+	parsed, err := url.Parse(bizUrl)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s: %v", ErrUnsupportedBizUrl, bizUrl, err)
+	}
+	scheme := strings.ToLower(parsed.Scheme)
+	if !supportedBizUrlSchemes[scheme] {
+		return "", fmt.Errorf("%w: %s, expect a file, http or https url", ErrUnsupportedBizUrl, bizUrl)
+	}
+	if scheme != "file" && parsed.Host == "" {
+		return "", fmt.Errorf("%w: %s, host is empty", ErrUnsupportedBizUrl, bizUrl)
+	}
+	return fileutil.FileUrl(scheme + bizUrl[len(parsed.Scheme):]), nil
+}
@@ -0,0 +1,53 @@
+package common
+
+import (
+	"errors"
+	"github.com/koupleless/arkctl/common/fileutil"
+	"gotest.tools/assert"
+	corev1 "k8s.io/api/core/v1"
+	"testing"
+)
+
+func TestModelUtils_NormalizeBizUrl(t *testing.T) {
+	for bizUrl, expected := range map[string]fileutil.FileUrl{
+		"https://serverless.oss.example.com/biz1-0.0.1-ark-biz.jar": "https://serverless.oss.example.com/biz1-0.0.1-ark-biz.jar",
+		"HTTP://example.com/biz1.jar":                               "http://example.com/biz1.jar",
+		"file:///test/biz1.jar":                                     "file:///test/biz1.jar",
+		"/test/biz1.jar":                                            "file:///test/biz1.jar",
+	} {
+		normalized, err := moduleUtils.NormalizeBizUrl(bizUrl)
+		assert.NilError(t, err)
+		assert.Equal(t, normalized, expected)
+	}
+
+	for _, bizUrl := range []string{"ftp://example.com/biz1.jar", "httpss://example.com/biz1.jar", "https:///biz1.jar", "biz1:0.0.1", "test/biz1.jar", ""} {
+		_, err := moduleUtils.NormalizeBizUrl(bizUrl)
+		assert.Assert(t, errors.Is(err, ErrUnsupportedBizUrl), bizUrl)
+	}
+}
+
+func TestModelUtils_GetBizModelsFromCoreV1Pod_UnsupportedBizUrl(t *testing.T) {
+	bizModels, err := moduleUtils.GetBizModelsFromCoreV1Pod(&corev1.Pod{
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Name:  "biz1",
+					Image: "https://example.com/biz1-0.0.1.jar",
+				},
+				{
+					Name:  "biz2",
+					Image: "ftp://example.com/biz2-0.0.2.jar",
+				},
+				{
+					Name:  "biz3",
+					Image: "/test/biz3-0.0.3.jar",
+				},
+			},
+		},
+	})
+	assert.Assert(t, errors.Is(err, ErrUnsupportedBizUrl))
+	assert.ErrorContains(t, err, "container biz2")
+	assert.Equal(t, len(bizModels), 3)
+	assert.Equal(t, bizModels[0].BizUrl, fileutil.FileUrl("https://example.com/biz1-0.0.1.jar"))
+	assert.Equal(t, bizModels[2].BizUrl, fileutil.FileUrl("file:///test/biz3-0.0.3.jar"))
+}
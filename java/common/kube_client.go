@@ -0,0 +1,117 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/util/retry"
+	"os"
+)
+
+// ErrNoKubeConfig is returned if neither a kubeconfig is set nor running in a cluster
+var ErrNoKubeConfig = errors.New("no kubeconfig set and not running in a cluster")
+
+// NewKubeRestConfig returns the rest config of the service account if inCluster, or of the kubeconfig file if set,
+// and falls back to the in-cluster config if kubeConfigPath is empty
+func NewKubeRestConfig(kubeConfigPath string, inCluster bool) (*rest.Config, error) {
+	if inCluster {
+		config, err := rest.InClusterConfig()
+		if err != nil {
+			return nil, fmt.Errorf("in-cluster config required but not available: %w", err)
+		}
+		return config, nil
+	}
+	if kubeConfigPath != "" {
+		// a missing kubeconfig is reported instead of silently falling back to the in-cluster config
+		if _, err := os.Stat(kubeConfigPath); err != nil {
+			return nil, fmt.Errorf("kubeconfig %s not available: %w", kubeConfigPath, err)
+		}
+		return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+			&clientcmd.ClientConfigLoadingRules{ExplicitPath: kubeConfigPath},
+			&clientcmd.ConfigOverrides{},
+		).ClientConfig()
+	}
+	config, err := rest.InClusterConfig()
+	if errors.Is(err, rest.ErrNotInCluster) {
+		return nil, fmt.Errorf("%w: set the kubeconfig path or run in a cluster", ErrNoKubeConfig)
+	}
+	return config, err
+}
+
+// NewKubeClientSet create the kube client set with the config of NewKubeRestConfig
+func NewKubeClientSet(kubeConfigPath string, inCluster bool) (*kubernetes.Clientset, error) {
+	config, err := NewKubeRestConfig(kubeConfigPath, inCluster)
+	if err != nil {
+		return nil, err
+	}
+	return kubernetes.NewForConfig(config)
+}
+
+// RegisterVirtualNode create the desired node built by BuildVirtualNode, if the node already exists, e.g. left by the
+// last run of controller, the desired labels, annotations and taints are merged into it instead of failing.
+// the update is retried on resource version conflicts
+func RegisterVirtualNode(ctx context.Context, nodes typedcorev1.NodeInterface, desired *corev1.Node) (*corev1.Node, error) {
+	created, err := nodes.Create(ctx, desired, metav1.CreateOptions{})
+	if err == nil {
+		return created, nil
+	}
+	if !apierrors.IsAlreadyExists(err) {
+		return nil, err
+	}
+
+	var updated *corev1.Node
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		existing, err := nodes.Get(ctx, desired.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		updated, err = nodes.Update(ctx, mergeVirtualNode(existing, desired), metav1.UpdateOptions{})
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error updating existing node %s: %w", desired.Name, err)
+	}
+	return updated, nil
+}
+
+// mergeVirtualNode returns a copy of existing with the labels, annotations and taints of desired, the labels,
+// annotations and taints only in existing are kept, e.g. added by users or the node lifecycle controller
+func mergeVirtualNode(existing, desired *corev1.Node) *corev1.Node {
+	merged := existing.DeepCopy()
+	if merged.Labels == nil {
+		merged.Labels = make(map[string]string)
+	}
+	for key, value := range desired.Labels {
+		merged.Labels[key] = value
+	}
+	if len(desired.Annotations) > 0 && merged.Annotations == nil {
+		merged.Annotations = make(map[string]string)
+	}
+	for key, value := range desired.Annotations {
+		merged.Annotations[key] = value
+	}
+
+	taints := make([]corev1.Taint, 0, len(existing.Spec.Taints)+len(desired.Spec.Taints))
+	taints = append(taints, desired.Spec.Taints...)
+	for _, taint := range existing.Spec.Taints {
+		replaced := false
+		for _, desiredTaint := range desired.Spec.Taints {
+			if taint.MatchTaint(&desiredTaint) {
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			taints = append(taints, taint)
+		}
+	}
+	merged.Spec.Taints = taints
+	return merged
+}
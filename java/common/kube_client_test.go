@@ -0,0 +1,135 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"github.com/koupleless/virtual-kubelet/java/model"
+	"gotest.tools/assert"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+	k8stesting "k8s.io/client-go/testing"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testKubeConfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: test
+  cluster:
+    server: https://127.0.0.1:6443
+contexts:
+- name: test
+  context:
+    cluster: test
+    user: test
+current-context: test
+users:
+- name: test
+  user:
+    token: test-token
+`
+
+func TestNewKubeRestConfig_KubeConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kubeconfig")
+	assert.NilError(t, os.WriteFile(path, []byte(testKubeConfig), 0600))
+	config, err := NewKubeRestConfig(path, false)
+	assert.NilError(t, err)
+	assert.Equal(t, config.Host, "https://127.0.0.1:6443")
+	assert.Equal(t, config.BearerToken, "test-token")
+
+	clientSet, err := NewKubeClientSet(path, false)
+	assert.NilError(t, err)
+	assert.Assert(t, clientSet != nil)
+}
+
+func TestNewKubeRestConfig_MissingKubeConfig(t *testing.T) {
+	_, err := NewKubeRestConfig(filepath.Join(t.TempDir(), "not-exist"), false)
+	assert.Assert(t, errors.Is(err, os.ErrNotExist))
+}
+
+func TestNewKubeRestConfig_NotInCluster(t *testing.T) {
+	t.Setenv("KUBERNETES_SERVICE_HOST", "")
+	t.Setenv("KUBERNETES_SERVICE_PORT", "")
+	_, err := NewKubeRestConfig("", false)
+	assert.Assert(t, errors.Is(err, ErrNoKubeConfig))
+
+	_, err = NewKubeRestConfig("", true)
+	assert.Assert(t, errors.Is(err, rest.ErrNotInCluster))
+	assert.ErrorContains(t, err, "in-cluster")
+}
+
+func buildTestVirtualNode(version string) *corev1.Node {
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "vnode.test-device"}}
+	ModelUtils{}.BuildVirtualNode(&model.BuildVirtualNodeConfig{
+		NodeIP:    "127.0.0.1",
+		TechStack: "java",
+		BizName:   "base",
+		Version:   version,
+	}, node)
+	return node
+}
+
+func TestRegisterVirtualNode_Twice(t *testing.T) {
+	clientSet := fake.NewSimpleClientset()
+	nodes := clientSet.CoreV1().Nodes()
+	ctx := context.Background()
+
+	_, err := RegisterVirtualNode(ctx, nodes, buildTestVirtualNode("1.0.0"))
+	assert.NilError(t, err)
+
+	// changed by users or other controllers meanwhile
+	existing, err := nodes.Get(ctx, "vnode.test-device", metav1.GetOptions{})
+	assert.NilError(t, err)
+	existing.Labels["custom"] = "value"
+	existing.Spec.Taints = append(existing.Spec.Taints, corev1.Taint{Key: corev1.TaintNodeUnreachable, Effect: corev1.TaintEffectNoExecute})
+	_, err = nodes.Update(ctx, existing, metav1.UpdateOptions{})
+	assert.NilError(t, err)
+
+	desired := buildTestVirtualNode("2.0.0")
+	registered, err := RegisterVirtualNode(ctx, nodes, desired)
+	assert.NilError(t, err)
+	assert.Equal(t, registered.Labels[model.LabelKeyBizVersion], "2.0.0")
+
+	nodeList, err := nodes.List(ctx, metav1.ListOptions{})
+	assert.NilError(t, err)
+	assert.Equal(t, len(nodeList.Items), 1)
+	node := nodeList.Items[0]
+	assert.Equal(t, node.Labels[model.LabelKeyBizVersion], "2.0.0")
+	assert.Equal(t, node.Labels["custom"], "value")
+	assert.Equal(t, len(node.Spec.Taints), len(desired.Spec.Taints)+1)
+	assert.DeepEqual(t, node.Spec.Taints[:len(desired.Spec.Taints)], desired.Spec.Taints)
+	assert.Equal(t, node.Spec.Taints[len(desired.Spec.Taints)].Key, corev1.TaintNodeUnreachable)
+}
+
+func TestRegisterVirtualNode_Conflict(t *testing.T) {
+	clientSet := fake.NewSimpleClientset(buildTestVirtualNode("1.0.0"))
+	conflicts := 2
+	clientSet.PrependReactor("update", "nodes", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if conflicts > 0 {
+			conflicts--
+			return true, nil, apierrors.NewConflict(corev1.Resource("nodes"), "vnode.test-device", errors.New("resource version changed"))
+		}
+		return false, nil, nil
+	})
+
+	node, err := RegisterVirtualNode(context.Background(), clientSet.CoreV1().Nodes(), buildTestVirtualNode("2.0.0"))
+	assert.NilError(t, err)
+	assert.Equal(t, conflicts, 0)
+	assert.Equal(t, node.Labels[model.LabelKeyBizVersion], "2.0.0")
+}
+
+func TestRegisterVirtualNode_Error(t *testing.T) {
+	clientSet := fake.NewSimpleClientset()
+	clientSet.PrependReactor("create", "nodes", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(corev1.Resource("nodes"), "vnode.test-device", errors.New("forbidden"))
+	})
+
+	_, err := RegisterVirtualNode(context.Background(), clientSet.CoreV1().Nodes(), buildTestVirtualNode("1.0.0"))
+	assert.Assert(t, apierrors.IsForbidden(err))
+}
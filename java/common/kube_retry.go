@@ -0,0 +1,126 @@
+package common
+
+import (
+	"context"
+	"github.com/koupleless/virtual-kubelet/java/model"
+	"net/http"
+	"sync"
+)
+
+// KubeClientHealth retries the kube api requests failed to reach the api server with backoff, kube clients are
+// degraded while a request is being retried, and failed once a request exhausted the retries
+type KubeClientHealth struct {
+	retry model.PublishRetryConfig
+
+	lock     sync.Mutex
+	retrying int
+	err      error
+	failed   chan struct{}
+}
+
+// NewKubeClientHealth returns the kube client health retrying requests by retry, zero fields fall back to the DefaultKube ones
+func NewKubeClientHealth(retry model.PublishRetryConfig) *KubeClientHealth {
+	if retry.MaxAttempts <= 0 {
+		retry.MaxAttempts = model.DefaultKubeMaxAttempts
+	}
+	if retry.InitialBackoff <= 0 {
+		retry.InitialBackoff = model.DefaultKubeInitialBackoff
+	}
+	if retry.MaxBackoff <= 0 {
+		retry.MaxBackoff = model.DefaultKubeMaxBackoff
+	}
+	return &KubeClientHealth{
+		retry:  retry,
+		failed: make(chan struct{}),
+	}
+}
+
+// WrapTransport returns the transport retrying the requests of rt, used to wrap the transport of kube rest config
+func (h *KubeClientHealth) WrapTransport(rt http.RoundTripper) http.RoundTripper {
+	return &retryRoundTripper{health: h, next: rt}
+}
+
+// Degraded returns true while a request is being retried or once a request exhausted the retries
+func (h *KubeClientHealth) Degraded() bool {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return h.retrying > 0 || h.err != nil
+}
+
+// Failed returns a channel closed once a request exhausted the retries
+func (h *KubeClientHealth) Failed() <-chan struct{} {
+	return h.failed
+}
+
+// Err returns the error of the first request exhausted the retries, nil if none
+func (h *KubeClientHealth) Err() error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return h.err
+}
+
+func (h *KubeClientHealth) beginRetry() {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.retrying++
+}
+
+// endRetry record the result of a retried request, err is nil if the request recovered
+func (h *KubeClientHealth) endRetry(err error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.retrying--
+	if err != nil && h.err == nil {
+		h.err = err
+		close(h.failed)
+	}
+}
+
+// retryRoundTripper retries the requests failed with transport errors, e.g. connection refused or reset.
+// the responses from api server, including errors, are returned as is and left to the kube client
+type retryRoundTripper struct {
+	health *KubeClientHealth
+	next   http.RoundTripper
+}
+
+func (t *retryRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		// the body can't be sent again
+		return t.next.RoundTrip(req)
+	}
+
+	var resp *http.Response
+	retried := false
+	err := RetryWithBackoff(req.Context(), t.health.retry, func(ctx context.Context) error {
+		attemptReq := req
+		if retried {
+			attemptReq = req.Clone(ctx)
+			if req.GetBody != nil {
+				body, err := req.GetBody()
+				if err != nil {
+					return err
+				}
+				attemptReq.Body = body
+			}
+		}
+		var err error
+		resp, err = t.next.RoundTrip(attemptReq)
+		if err != nil && !retried {
+			retried = true
+			t.health.beginRetry()
+		}
+		return err
+	})
+	if retried {
+		if req.Context().Err() != nil {
+			// canceled by the caller, not a failure of api server
+			t.health.endRetry(nil)
+		} else {
+			t.health.endRetry(err)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
@@ -0,0 +1,106 @@
+package common
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/koupleless/virtual-kubelet/java/model"
+	"gotest.tools/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// newFlakyApiServer serves the node until failures, the connections are closed without response before
+func newFlakyApiServer(t *testing.T, health *KubeClientHealth, failures int32) (*httptest.Server, *atomic.Bool, *atomic.Value) {
+	var requests atomic.Int32
+	degradedSeen := &atomic.Bool{}
+	patchBody := &atomic.Value{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) <= failures {
+			if health.Degraded() {
+				degradedSeen.Store(true)
+			}
+			conn, _, err := w.(http.Hijacker).Hijack()
+			if err == nil {
+				conn.Close()
+			}
+			return
+		}
+		if r.Method == http.MethodPatch {
+			body, _ := io.ReadAll(r.Body)
+			patchBody.Store(string(body))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"kind":"Node","apiVersion":"v1","metadata":{"name":"vnode"}}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, degradedSeen, patchBody
+}
+
+func newRetryingClientSet(t *testing.T, health *KubeClientHealth, host string) *kubernetes.Clientset {
+	config := &rest.Config{Host: host}
+	config.Wrap(health.WrapTransport)
+	clientSet, err := kubernetes.NewForConfig(config)
+	assert.NilError(t, err)
+	return clientSet
+}
+
+func TestKubeClientHealth_WrapTransport_Recover(t *testing.T) {
+	health := NewKubeClientHealth(model.PublishRetryConfig{MaxAttempts: 5, InitialBackoff: 10 * time.Millisecond, MaxBackoff: 20 * time.Millisecond})
+	srv, degradedSeen, patchBody := newFlakyApiServer(t, health, 2)
+	clientSet := newRetryingClientSet(t, health, srv.URL)
+
+	node, err := clientSet.CoreV1().Nodes().Patch(context.Background(), "vnode", types.MergePatchType, []byte(`{"status":{"phase":"Running"}}`), metav1.PatchOptions{}, "status")
+	assert.NilError(t, err)
+	assert.Equal(t, node.Name, "vnode")
+	assert.Assert(t, degradedSeen.Load())
+	// the body is sent again on retry
+	assert.Equal(t, patchBody.Load(), `{"status":{"phase":"Running"}}`)
+
+	assert.Assert(t, !health.Degraded())
+	assert.NilError(t, health.Err())
+	select {
+	case <-health.Failed():
+		t.Fatal("health failed after recovered")
+	default:
+	}
+}
+
+func TestKubeClientHealth_WrapTransport_Exhausted(t *testing.T) {
+	health := NewKubeClientHealth(model.PublishRetryConfig{MaxAttempts: 2, InitialBackoff: 10 * time.Millisecond, MaxBackoff: 20 * time.Millisecond})
+	srv, _, _ := newFlakyApiServer(t, health, 1000)
+	clientSet := newRetryingClientSet(t, health, srv.URL)
+
+	_, err := clientSet.CoreV1().Nodes().Get(context.Background(), "vnode", metav1.GetOptions{})
+	assert.Assert(t, err != nil)
+
+	assert.Assert(t, health.Degraded())
+	assert.Assert(t, health.Err() != nil)
+	select {
+	case <-health.Failed():
+	default:
+		t.Fatal("health not failed after retries exhausted")
+	}
+}
+
+func TestKubeClientHealth_WrapTransport_Canceled(t *testing.T) {
+	health := NewKubeClientHealth(model.PublishRetryConfig{MaxAttempts: 100, InitialBackoff: time.Second, MaxBackoff: time.Second})
+	srv, _, _ := newFlakyApiServer(t, health, 1000)
+	clientSet := newRetryingClientSet(t, health, srv.URL)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err := clientSet.CoreV1().Nodes().Get(ctx, "vnode", metav1.GetOptions{})
+	assert.Assert(t, err != nil)
+
+	// canceled by the caller is not a failure of api server
+	assert.Assert(t, !health.Degraded())
+	assert.NilError(t, health.Err())
+}
@@ -16,6 +16,8 @@ package common
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"github.com/koupleless/arkctl/common/fileutil"
 	"github.com/koupleless/arkctl/v1/service/ark"
 	"github.com/koupleless/virtual-kubelet/java/model"
@@ -23,21 +25,168 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/version"
+	"regexp"
+	"runtime"
+	"strings"
 	"time"
 )
 
+const (
+	// BizStateResolved means biz is resolved and being installed
+	BizStateResolved = "RESOLVED"
+
+	// BizStateActivated means biz is installed and running
+	BizStateActivated = "ACTIVATED"
+
+	// BizStateDeactivated means biz is stopped
+	BizStateDeactivated = "DEACTIVATED"
+
+	// BizStateBroken means biz failed to install, e.g. class load error
+	BizStateBroken = "BROKEN"
+
+	// BizStateTimeout is not reported by base, it marks biz whose command not confirmed by base within timeout
+	BizStateTimeout = "TIMEOUT"
+)
+
+const (
+	// EventReasonInstallRequested is the event reason of publishing biz install command
+	EventReasonInstallRequested = "InstallRequested"
+
+	// EventReasonResolved is the event reason of biz resolved by base
+	EventReasonResolved = "Resolved"
+
+	// EventReasonActivated is the event reason of biz activated by base
+	EventReasonActivated = "Activated"
+
+	// EventReasonInstallFailed is the event reason of biz failed to install
+	EventReasonInstallFailed = "InstallFailed"
+
+	// EventReasonDowngradeRejected is the event reason of a pod update downgrading biz rejected
+	EventReasonDowngradeRejected = "DowngradeRejected"
+)
+
+// UnknownBizVersion is the version of biz models whose version is neither set in env nor parsed from image
+const UnknownBizVersion = "UNKNOWN"
+
+// BizContainersAnnotation is the pod annotation listing the biz container names separated by comma,
+// containers not listed such as logging sidecars are not installed. all containers are biz if absent
+const BizContainersAnnotation = "koupleless.io/biz-containers"
+
+// ErrBizVersionNotFound is returned when the biz version of a container cannot be resolved
+var ErrBizVersionNotFound = errors.New("biz version not found")
+
+// ErrInvalidBizVersion is returned when the biz version is not a semantic version
+var ErrInvalidBizVersion = errors.New("invalid biz version")
+
+// ErrDuplicateBizIdentity is returned when containers of a pod resolve to the same biz identity
+var ErrDuplicateBizIdentity = errors.New("duplicate biz identity")
+
+var (
+	// imageTagVersionPattern matches the version tag of image, e.g. file:///test/test1.jar:1.2.3
+	imageTagVersionPattern = regexp.MustCompile(`^[0-9]+(\.[0-9]+)*([-+][0-9A-Za-z.-]+)?$`)
+
+	// jarFileVersionPattern matches the version suffix of jar file name, e.g. file:///test/test1-1.2.3.jar
+	jarFileVersionPattern = regexp.MustCompile(`-([0-9]+(\.[0-9]+)+(-[0-9A-Za-z.]+)?)\.jar$`)
+)
+
 // ModelUtils
 // reference spec: https://github.com/koupleless/module-controller/discussions/8
 // the corresponding implementation in the above spec.
 type ModelUtils struct {
+	// DefaultBizVersion is the version of biz containers providing none by BIZ_VERSION env or image, e.g. 0.0.0-SNAPSHOT
+	// in dev clusters. the strict behavior is kept if empty, such containers fail with ErrBizVersionNotFound
+	DefaultBizVersion string
 }
 
+// CmpBizModel returns true if a and b are the same biz with the same version
 func (c ModelUtils) CmpBizModel(a, b *ark.BizModel) bool {
 	return a.BizName == b.BizName && a.BizVersion == b.BizVersion
 }
 
+// CmpBizModelName returns true if a and b are the same biz, regardless of version
+func (c ModelUtils) CmpBizModelName(a, b *ark.BizModel) bool {
+	return a.BizName == b.BizName
+}
+
+// DiffBizModels compare the biz models of a pod before and after update by CmpBizModel, returns the new biz models to
+// install in their order and the old ones to uninstall, a biz with version changed, e.g. by BIZ_VERSION env, is in both
+func (c ModelUtils) DiffBizModels(oldModels, newModels []*ark.BizModel) (installs, uninstalls []*ark.BizModel) {
+	installs = make([]*ark.BizModel, 0)
+	uninstalls = make([]*ark.BizModel, 0)
+	for _, newModel := range newModels {
+		if !c.containsBizModel(oldModels, newModel) {
+			installs = append(installs, newModel)
+		}
+	}
+	for _, oldModel := range oldModels {
+		if !c.containsBizModel(newModels, oldModel) {
+			uninstalls = append(uninstalls, oldModel)
+		}
+	}
+	return installs, uninstalls
+}
+
+// GetBizDowngrades returns the biz models of installs older than the version of the same biz in uninstalls, e.g. the
+// diff of DiffBizModels, versions not comparable by semantic versioning are not downgrades
+func (c ModelUtils) GetBizDowngrades(installs, uninstalls []*ark.BizModel) []*ark.BizModel {
+	downgrades := make([]*ark.BizModel, 0)
+	for _, install := range installs {
+		for _, uninstall := range uninstalls {
+			if !c.CmpBizModelName(install, uninstall) {
+				continue
+			}
+			if cmp, err := c.CompareBizVersion(install.BizVersion, uninstall.BizVersion); err == nil && cmp < 0 {
+				downgrades = append(downgrades, install)
+				break
+			}
+		}
+	}
+	return downgrades
+}
+
+func (c ModelUtils) containsBizModel(bizModels []*ark.BizModel, target *ark.BizModel) bool {
+	for _, bizModel := range bizModels {
+		if c.CmpBizModel(bizModel, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// CompareBizVersion compare biz versions by semantic versioning, returns -1, 0 or 1 if a is older than, the same as
+// or newer than b, pre-release versions are older than the release, e.g. 1.2.0-rc1 < 1.2.0, build metadata is ignored.
+// ErrInvalidBizVersion is returned if either version is not a semantic version
+func (c ModelUtils) CompareBizVersion(a, b string) (int, error) {
+	versionA, err := version.ParseSemantic(a)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrInvalidBizVersion, err)
+	}
+	versionB, err := version.ParseSemantic(b)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrInvalidBizVersion, err)
+	}
+	if versionA.LessThan(versionB) {
+		return -1, nil
+	}
+	if versionB.LessThan(versionA) {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// GetPodKey returns namespace/name of pod, empty namespace is treated as default namespace
 func (c ModelUtils) GetPodKey(pod *corev1.Pod) string {
-	return pod.Namespace + "/" + pod.Name
+	return c.GetPodKeyFromNamespacedName(pod.Namespace, pod.Name)
+}
+
+// GetPodKeyFromNamespacedName returns the pod key of namespace and name, empty namespace is treated as default namespace
+func (c ModelUtils) GetPodKeyFromNamespacedName(namespace, name string) string {
+	if namespace == "" {
+		namespace = metav1.NamespaceDefault
+	}
+	return namespace + "/" + name
 }
 
 func (c ModelUtils) GetBizIdentityFromBizModel(biz *ark.BizModel) string {
@@ -48,34 +197,276 @@ func (c ModelUtils) GetBizIdentityFromBizInfo(biz *ark.ArkBizInfo) string {
 	return biz.BizName + ":" + biz.BizVersion
 }
 
+// GetBizIdentityFromBizInfoChecked is GetBizIdentityFromBizInfo returning ErrInvalidBizInfo if biz is nil or misses
+// name or version, instead of a degenerate identity
+func (c ModelUtils) GetBizIdentityFromBizInfoChecked(biz *ark.ArkBizInfo) (string, error) {
+	if biz == nil {
+		return "", fmt.Errorf("%w: biz info is null", ErrInvalidBizInfo)
+	}
+	missing := make([]string, 0)
+	if biz.BizName == "" {
+		missing = append(missing, "bizName")
+	}
+	if biz.BizVersion == "" {
+		missing = append(missing, "bizVersion")
+	}
+	if len(missing) > 0 {
+		return "", fmt.Errorf("%w: missing %v", ErrInvalidBizInfo, missing)
+	}
+	return c.GetBizIdentityFromBizInfo(biz), nil
+}
+
+// parseImageVersion returns the version parsed from image tag or jar file name, empty if not found. only a tag of the
+// last path segment is parsed, so that the port of e.g. http://repo:8080/biz.jar is not taken as the version
+func parseImageVersion(image string) string {
+	fileName := image[strings.LastIndex(image, "/")+1:]
+	if idx := strings.LastIndex(fileName, ":"); idx >= 0 {
+		tag := fileName[idx+1:]
+		if imageTagVersionPattern.MatchString(tag) {
+			return tag
+		}
+	}
+	if match := jarFileVersionPattern.FindStringSubmatch(fileName); match != nil {
+		return match[1]
+	}
+	return ""
+}
+
+// TranslateCoreV1ContainerToBizModel translate container to biz model, version is resolved from BIZ_VERSION env first,
+// then the image tag or jar file name, then DefaultBizVersion, UnknownBizVersion is used if not found
 func (c ModelUtils) TranslateCoreV1ContainerToBizModel(container corev1.Container) ark.BizModel {
+	bizName := container.Name
 	bizVersion := ""
 	for _, env := range container.Env {
-		if env.Name == "BIZ_VERSION" {
+		switch env.Name {
+		case "BIZ_NAME":
+			// container name may be sanitized, real biz name is overridden by env
+			if env.Value != "" {
+				bizName = env.Value
+			}
+		case "BIZ_VERSION":
 			bizVersion = env.Value
-			break
 		}
 	}
 
+	if bizVersion == "" {
+		bizVersion = parseImageVersion(container.Image)
+	}
+	if bizVersion == "" {
+		bizVersion = c.DefaultBizVersion
+	}
+	if bizVersion == "" {
+		bizVersion = UnknownBizVersion
+	}
+	// unsupported url is kept as is, the error is surfaced by GetBizModelsFromCoreV1Pod
+	normalizedUrl, err := c.NormalizeBizUrl(container.Image)
+	if err != nil {
+		normalizedUrl = fileutil.FileUrl(container.Image)
+	}
+
 	return ark.BizModel{
-		BizName:    container.Name,
+		BizName:    bizName,
 		BizVersion: bizVersion,
-		BizUrl:     fileutil.FileUrl(container.Image),
+		BizUrl:     normalizedUrl,
 	}
 }
 
-func (c ModelUtils) GetBizModelsFromCoreV1Pod(pod *corev1.Pod) []*ark.BizModel {
-	ret := make([]*ark.BizModel, len(pod.Spec.Containers))
-	for i, container := range pod.Spec.Containers {
+// TranslateBizModelToCoreV1Container is the inverse of TranslateCoreV1ContainerToBizModel,
+// used to reconstruct pod spec from biz reported by ark runtime
+func (c ModelUtils) TranslateBizModelToCoreV1Container(biz *ark.BizModel) corev1.Container {
+	return corev1.Container{
+		Name:  biz.BizName,
+		Image: string(biz.BizUrl),
+		Env: []corev1.EnvVar{
+			{
+				Name:  "BIZ_VERSION",
+				Value: biz.BizVersion,
+			},
+		},
+	}
+}
+
+// GetBizResourcesFromCoreV1Container returns the cpu and memory hint of biz from container resources,
+// limits take precedence over requests, defaults are used for the resources specified in neither
+func (c ModelUtils) GetBizResourcesFromCoreV1Container(container corev1.Container, defaults corev1.ResourceList) corev1.ResourceList {
+	ret := corev1.ResourceList{}
+	for _, resourceName := range []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory} {
+		if quantity, has := container.Resources.Limits[resourceName]; has {
+			ret[resourceName] = quantity
+		} else if quantity, has = container.Resources.Requests[resourceName]; has {
+			ret[resourceName] = quantity
+		} else if quantity, has = defaults[resourceName]; has {
+			ret[resourceName] = quantity
+		}
+	}
+	return ret
+}
+
+// GetBizResourcesFromCoreV1Pod returns the resources of all biz in pod, keyed by biz identity
+func (c ModelUtils) GetBizResourcesFromCoreV1Pod(pod *corev1.Pod, defaults corev1.ResourceList) map[string]corev1.ResourceList {
+	containers := c.GetBizContainersFromCoreV1Pod(pod)
+	ret := make(map[string]corev1.ResourceList, len(containers))
+	for _, container := range containers {
 		bizModel := c.TranslateCoreV1ContainerToBizModel(container)
-		ret[i] = &bizModel
+		ret[c.GetBizIdentityFromBizModel(&bizModel)] = c.GetBizResourcesFromCoreV1Container(container, defaults)
+	}
+	return ret
+}
+
+// GetBizContainersFromCoreV1Pod returns the containers of pod to be installed as biz, all containers if the pod
+// has no BizContainersAnnotation, otherwise only the containers listed in it, so that sidecars are skipped
+func (c ModelUtils) GetBizContainersFromCoreV1Pod(pod *corev1.Pod) []corev1.Container {
+	value, has := pod.Annotations[BizContainersAnnotation]
+	if !has {
+		return pod.Spec.Containers
+	}
+	bizContainerNames := make(map[string]bool)
+	for _, name := range strings.Split(value, ",") {
+		bizContainerNames[strings.TrimSpace(name)] = true
+	}
+	ret := make([]corev1.Container, 0, len(pod.Spec.Containers))
+	for _, container := range pod.Spec.Containers {
+		if bizContainerNames[container.Name] {
+			ret = append(ret, container)
+		}
 	}
 	return ret
 }
 
+// GetBizModelsFromCoreV1Pod translate the biz containers of pod to biz models, return ErrBizVersionNotFound describing
+// the containers whose version cannot be resolved and ErrUnsupportedBizUrl describing the ones with unsupported image url
+func (c ModelUtils) GetBizModelsFromCoreV1Pod(pod *corev1.Pod) ([]*ark.BizModel, error) {
+	return c.translateCoreV1ContainersToBizModels(c.GetBizContainersFromCoreV1Pod(pod))
+}
+
+// GetInitBizModelsFromCoreV1Pod translate init containers of pod to biz models in declaration order,
+// they are expected to be installed and activated before the biz models of regular containers
+func (c ModelUtils) GetInitBizModelsFromCoreV1Pod(pod *corev1.Pod) ([]*ark.BizModel, error) {
+	return c.translateCoreV1ContainersToBizModels(pod.Spec.InitContainers)
+}
+
+func (c ModelUtils) translateCoreV1ContainersToBizModels(containers []corev1.Container) ([]*ark.BizModel, error) {
+	ret := make([]*ark.BizModel, len(containers))
+	var errs []error
+	for i, container := range containers {
+		bizModel := c.TranslateCoreV1ContainerToBizModel(container)
+		if bizModel.BizVersion == UnknownBizVersion {
+			errs = append(errs, fmt.Errorf("%w: container %s, set BIZ_VERSION env or a version tag in image %s", ErrBizVersionNotFound, container.Name, container.Image))
+		}
+		if _, err := c.NormalizeBizUrl(string(bizModel.BizUrl)); err != nil {
+			errs = append(errs, fmt.Errorf("container %s: %w", container.Name, err))
+		}
+		ret[i] = &bizModel
+	}
+	return ret, errors.Join(errs...)
+}
+
+// GetBizModelsFromCoreV1PodChecked is GetBizModelsFromCoreV1Pod additionally returning ErrDuplicateBizIdentity
+// describing the containers resolved to the same biz identity, which would produce conflicting install commands
+func (c ModelUtils) GetBizModelsFromCoreV1PodChecked(pod *corev1.Pod) ([]*ark.BizModel, error) {
+	containers := c.GetBizContainersFromCoreV1Pod(pod)
+	bizModels, err := c.translateCoreV1ContainersToBizModels(containers)
+	errs := []error{err}
+	identityToContainer := make(map[string]string, len(bizModels))
+	for i, bizModel := range bizModels {
+		identity := c.GetBizIdentityFromBizModel(bizModel)
+		containerName := containers[i].Name
+		if existing, has := identityToContainer[identity]; has {
+			errs = append(errs, fmt.Errorf("%w: containers %s and %s both resolve to %s", ErrDuplicateBizIdentity, existing, containerName, identity))
+			continue
+		}
+		identityToContainer[identity] = containerName
+	}
+	return bizModels, errors.Join(errs...)
+}
+
+// GetBizLifecycleEvent returns the event type, reason and message of the biz lifecycle milestone derived from its container status,
+// empty reason if the status is not a milestone
+func (c ModelUtils) GetBizLifecycleEvent(status *corev1.ContainerStatus) (eventType, reason, message string) {
+	if status == nil {
+		return "", "", ""
+	}
+	switch {
+	case status.State.Running != nil:
+		return corev1.EventTypeNormal, EventReasonActivated, fmt.Sprintf("Biz %s activated", status.ContainerID)
+	case status.State.Waiting != nil && status.State.Waiting.Reason == "BizResolved":
+		return corev1.EventTypeNormal, EventReasonResolved, fmt.Sprintf("Biz %s resolved", status.ContainerID)
+	case status.State.Terminated != nil && status.State.Terminated.Reason == "BizInstallFailed":
+		return corev1.EventTypeWarning, EventReasonInstallFailed, fmt.Sprintf("Biz %s failed to install: %s", status.ContainerID, status.State.Terminated.Message)
+	}
+	return "", "", ""
+}
+
+// NormalizeBizState returns the upper case biz state, variants reported by different ark runtimes such as
+// "activate" are mapped to the corresponding BizState constant
+func (c ModelUtils) NormalizeBizState(state string) string {
+	state = strings.ToUpper(strings.TrimSpace(state))
+	switch state {
+	case "ACTIVATE":
+		return BizStateActivated
+	case "RESOLVE":
+		return BizStateResolved
+	case "DEACTIVATE":
+		return BizStateDeactivated
+	case "FAILED", "BROKE":
+		return BizStateBroken
+	}
+	return state
+}
+
+// getLatestStateRecord returns the latest record of state in biz state records and its change time
+func (c ModelUtils) getLatestStateRecord(bizInfo *ark.ArkBizInfo, state string) (*ark.ArkBizStateRecord, time.Time) {
+	var latestRecord *ark.ArkBizStateRecord
+	latestChangeTime := time.UnixMilli(0)
+	for i, record := range bizInfo.BizStateRecords {
+		if c.NormalizeBizState(record.State) != state {
+			continue
+		}
+		// change time is like 2024-07-09 16:48:56.921, fractional seconds are accepted by time.Parse
+		changeTime, err := time.Parse("2006-01-02 15:04:05", record.ChangeTime)
+		if err != nil {
+			log.G(context.Background()).Errorf("failed to parse change time %s", record.ChangeTime)
+			continue
+		}
+		if changeTime.UnixMilli() > latestChangeTime.UnixMilli() {
+			latestChangeTime = changeTime
+			latestRecord = &bizInfo.BizStateRecords[i]
+		}
+	}
+	return latestRecord, latestChangeTime
+}
+
+// stateChangeTime returns the latest change time of state in biz state records, the tracked time if base reported no record of state
+func (c ModelUtils) stateChangeTime(bizInfo *ark.ArkBizInfo, state string, tracked time.Time) time.Time {
+	record, changeTime := c.getLatestStateRecord(bizInfo, state)
+	if record == nil {
+		return tracked
+	}
+	return changeTime
+}
+
+// BizTimes is the lifecycle times of a biz tracked by controller, zero if not observed yet
+type BizTimes struct {
+	// ActivatedAt is the time biz was first seen activated since its latest deactivation
+	ActivatedAt time.Time
+	// DeactivatedAt is the time biz was first seen not activated after being activated
+	DeactivatedAt time.Time
+	// TimedOutAt is the time the latest command of biz was given up unconfirmed
+	TimedOutAt time.Time
+}
+
 func (c ModelUtils) TranslateArkBizInfoToV1ContainerStatus(bizModel *ark.BizModel, bizInfo *ark.ArkBizInfo) *corev1.ContainerStatus {
-	started :=
-		bizInfo != nil && bizInfo.BizState == "ACTIVATED"
+	return c.TranslateArkBizInfoToV1ContainerStatusWithTimes(bizModel, bizInfo, BizTimes{})
+}
+
+// TranslateArkBizInfoToV1ContainerStatusWithTimes translate biz info to container status, the started and finished times
+// are taken from the biz state records, or from times tracked by controller if base reported no records
+func (c ModelUtils) TranslateArkBizInfoToV1ContainerStatusWithTimes(bizModel *ark.BizModel, bizInfo *ark.ArkBizInfo, times BizTimes) *corev1.ContainerStatus {
+	bizState := ""
+	if bizInfo != nil {
+		bizState = c.NormalizeBizState(bizInfo.BizState)
+	}
+	started := bizState == BizStateActivated
 
 	ret := &corev1.ContainerStatus{
 		Name:        bizModel.BizName,
@@ -95,7 +486,7 @@ func (c ModelUtils) TranslateArkBizInfoToV1ContainerStatus(bizModel *ark.BizMode
 		return ret
 	}
 
-	if bizInfo.BizState == "RESOLVED" {
+	if bizState == BizStateResolved {
 		// installing
 		ret.State.Waiting = &corev1.ContainerStateWaiting{
 			Reason:  "BizResolved",
@@ -107,60 +498,56 @@ func (c ModelUtils) TranslateArkBizInfoToV1ContainerStatus(bizModel *ark.BizMode
 	// the module install progress is ultra fast, usually on takes seconds.
 	// therefore, the operation method should all be performed in sync way.
 	// and there would be no waiting state
-	if bizInfo.BizState == "ACTIVATED" {
-		latestActivatedTime := time.UnixMilli(0)
-		for _, record := range bizInfo.BizStateRecords {
-			if record.State != "ACTIVATED" {
-				continue
-			}
-			if len(record.ChangeTime) < 3 {
-				continue
-			}
-			changeTime, err := time.Parse("2006-01-02 15:04:05", record.ChangeTime[:len(record.ChangeTime)-3])
-			if err != nil {
-				log.G(context.Background()).Errorf("failed to parse change time %s", record.ChangeTime)
-				continue
-			}
-			if changeTime.UnixMilli() > latestActivatedTime.UnixMilli() {
-				latestActivatedTime = changeTime
-			}
-		}
+	switch bizState {
+	case BizStateActivated:
 		ret.State.Running = &corev1.ContainerStateRunning{
-			// for now we can just leave it empty,
-			// in the future when the arklet supports this, we can fill this field.
 			StartedAt: metav1.Time{
-				Time: latestActivatedTime,
+				Time: c.stateChangeTime(bizInfo, BizStateActivated, times.ActivatedAt),
 			},
 		}
-	}
-
-	if bizInfo.BizState == "DEACTIVATED" {
-		latestDeactivatedTime := time.UnixMilli(0)
-		for _, record := range bizInfo.BizStateRecords {
-			if record.State != "DEACTIVATED" {
-				continue
-			}
-			if len(record.ChangeTime) < 3 {
-				continue
-			}
-			changeTime, err := time.Parse("2006-01-02 15:04:05", record.ChangeTime[:len(record.ChangeTime)-3])
-			if err != nil {
-				log.G(context.Background()).Errorf("failed to parse change time %s", record.ChangeTime)
-				continue
-			}
-			if changeTime.UnixMilli() > latestDeactivatedTime.UnixMilli() {
-				latestDeactivatedTime = changeTime
-			}
-		}
+	case BizStateDeactivated:
 		ret.State.Terminated = &corev1.ContainerStateTerminated{
 			ExitCode: 1,
 			Reason:   "BizDeactivated",
 			Message:  "Biz is deactivated",
+			StartedAt: metav1.Time{
+				Time: c.stateChangeTime(bizInfo, BizStateActivated, times.ActivatedAt),
+			},
+			FinishedAt: metav1.Time{
+				Time: c.stateChangeTime(bizInfo, BizStateDeactivated, times.DeactivatedAt),
+			},
+			ContainerID: c.GetBizIdentityFromBizModel(bizModel),
+		}
+	case BizStateBroken:
+		record, changeTime := c.getLatestStateRecord(bizInfo, BizStateBroken)
+		message := "Biz failed to install"
+		if record != nil && record.Message != "" {
+			message = record.Message
+		} else if record != nil && record.Reason != "" {
+			message = record.Reason
+		}
+		ret.State.Terminated = &corev1.ContainerStateTerminated{
+			ExitCode: 1,
+			Reason:   "BizInstallFailed",
+			Message:  message,
 			FinishedAt: metav1.Time{
-				Time: latestDeactivatedTime,
+				Time: changeTime,
 			},
 			ContainerID: c.GetBizIdentityFromBizModel(bizModel),
 		}
+	case BizStateTimeout:
+		ret.State.Terminated = &corev1.ContainerStateTerminated{
+			ExitCode:    1,
+			Reason:      "BizCommandTimeout",
+			Message:     "Biz command not confirmed by base in time",
+			FinishedAt:  metav1.Time{Time: times.TimedOutAt},
+			ContainerID: c.GetBizIdentityFromBizModel(bizModel),
+		}
+	default:
+		ret.State.Waiting = &corev1.ContainerStateWaiting{
+			Reason:  "BizStateUnknown",
+			Message: fmt.Sprintf("Biz is in unknown state %s", bizInfo.BizState),
+		}
 	}
 	return ret
 }
@@ -169,16 +556,22 @@ func (c ModelUtils) BuildVirtualNode(config *model.BuildVirtualNodeConfig, node
 	if node.ObjectMeta.Labels == nil {
 		node.ObjectMeta.Labels = make(map[string]string)
 	}
-	node.Labels["base.koupleless.io/stack"] = config.TechStack
-	node.Labels["base.koupleless.io/version"] = config.Version
-	node.Labels["base.koupleless.io/name"] = config.BizName
-	node.Spec.Taints = []corev1.Taint{
-		{
-			Key:    "schedule.koupleless.io/virtual-node",
-			Value:  "True",
-			Effect: corev1.TaintEffectNoExecute,
-		},
+	for key, value := range map[string]string{
+		model.LabelKeyTechStack:  config.TechStack,
+		model.LabelKeyBizName:    config.BizName,
+		model.LabelKeyBizVersion: config.Version,
+		model.LabelKeyNodeIP:     config.NodeIP,
+	} {
+		// a node with an invalid label value is rejected by api server, e.g. version 1.0+build is not labeled
+		if len(validation.IsValidLabelValue(value)) == 0 {
+			node.Labels[key] = value
+		}
 	}
+	node.Labels[corev1.LabelOSStable] = "linux"
+	if node.Name != "" {
+		node.Labels[corev1.LabelHostname] = node.Name
+	}
+	node.Spec.Taints = c.buildNodeTaints(config)
 	node.Status = corev1.NodeStatus{
 		Phase: corev1.NodePending,
 		Addresses: []corev1.NodeAddress{
@@ -187,17 +580,103 @@ func (c ModelUtils) BuildVirtualNode(config *model.BuildVirtualNodeConfig, node
 				Address: config.NodeIP,
 			},
 		},
-		Conditions: []corev1.NodeCondition{
-			{
-				Type:   corev1.NodeReady,
-				Status: corev1.ConditionFalse,
+		Conditions:  c.BuildNodeConditions(corev1.ConditionFalse, time.Now()),
+		Capacity:    c.buildNodeCapacity(config),
+		Allocatable: c.buildNodeCapacity(config),
+		NodeInfo: corev1.NodeSystemInfo{
+			OperatingSystem:         "linux",
+			Architecture:            runtime.GOARCH,
+			KubeletVersion:          model.KubeletVersion,
+			ContainerRuntimeVersion: fmt.Sprintf("koupleless://%s-%s", config.TechStack, config.Version),
+		},
+		DaemonEndpoints: corev1.NodeDaemonEndpoints{
+			KubeletEndpoint: corev1.DaemonEndpoint{
+				Port: config.KubeletPort,
 			},
 		},
-		Capacity: map[corev1.ResourceName]resource.Quantity{
-			corev1.ResourcePods: resource.MustParse("2000"),
+	}
+}
+
+// BuildNodeConditions returns the Ready condition with readyStatus and the MemoryPressure, DiskPressure and
+// PIDPressure conditions as False, all with heartbeatTime
+func (c ModelUtils) BuildNodeConditions(readyStatus corev1.ConditionStatus, heartbeatTime time.Time) []corev1.NodeCondition {
+	readyReason := "BaseNotReady"
+	readyMessage := "base is not ready"
+	if readyStatus == corev1.ConditionTrue {
+		readyReason = "BaseReady"
+		readyMessage = "base is healthy"
+	}
+	conditions := []corev1.NodeCondition{
+		{
+			Type:    corev1.NodeReady,
+			Status:  readyStatus,
+			Reason:  readyReason,
+			Message: readyMessage,
 		},
-		Allocatable: map[corev1.ResourceName]resource.Quantity{
-			corev1.ResourcePods: resource.MustParse("2000"),
+		{
+			Type:    corev1.NodeMemoryPressure,
+			Status:  corev1.ConditionFalse,
+			Reason:  "BaseHasSufficientMemory",
+			Message: "base has sufficient memory available",
+		},
+		{
+			Type:    corev1.NodeDiskPressure,
+			Status:  corev1.ConditionFalse,
+			Reason:  "BaseHasNoDiskPressure",
+			Message: "base has no disk pressure",
 		},
+		{
+			Type:    corev1.NodePIDPressure,
+			Status:  corev1.ConditionFalse,
+			Reason:  "BaseHasSufficientPID",
+			Message: "base has sufficient PID available",
+		},
+	}
+	for i := range conditions {
+		conditions[i].LastHeartbeatTime = metav1.NewTime(heartbeatTime)
+	}
+	return conditions
+}
+
+// buildNodeTaints returns the taint of config, defaults are used if unset, nil if NoTaint
+func (c ModelUtils) buildNodeTaints(config *model.BuildVirtualNodeConfig) []corev1.Taint {
+	if config.NoTaint {
+		return nil
+	}
+	taint := corev1.Taint{
+		Key:    config.TaintKey,
+		Value:  config.TaintValue,
+		Effect: config.TaintEffect,
+	}
+	if taint.Key == "" {
+		taint.Key = model.DefaultNodeTaintKey
+	}
+	if taint.Value == "" {
+		taint.Value = model.DefaultNodeTaintValue
+	}
+	if taint.Effect == "" {
+		taint.Effect = model.DefaultNodeTaintEffect
+	}
+	return []corev1.Taint{taint}
+}
+
+// buildNodeCapacity returns the cpu, memory and pods capacity of config, defaults are used if unset
+func (c ModelUtils) buildNodeCapacity(config *model.BuildVirtualNodeConfig) corev1.ResourceList {
+	cpu := config.CPU
+	if cpu.IsZero() {
+		cpu = resource.MustParse(model.DefaultNodeCPUCapacity)
+	}
+	memory := config.Memory
+	if memory.IsZero() {
+		memory = resource.MustParse(model.DefaultNodeMemoryCapacity)
+	}
+	pods := config.Pods
+	if pods == 0 {
+		pods = model.DefaultNodePodsCapacity
+	}
+	return corev1.ResourceList{
+		corev1.ResourceCPU:    cpu,
+		corev1.ResourceMemory: memory,
+		corev1.ResourcePods:   *resource.NewQuantity(pods, resource.DecimalSI),
 	}
 }
@@ -1,12 +1,15 @@
 package common
 
 import (
+	"errors"
 	"github.com/koupleless/arkctl/v1/service/ark"
 	"github.com/koupleless/virtual-kubelet/java/model"
 	"gotest.tools/assert"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"testing"
+	"time"
 )
 
 var moduleUtils = ModelUtils{}
@@ -23,9 +26,106 @@ func TestModelUtils_BuildVirtualNode(t *testing.T) {
 		BizName:   "test",
 		TechStack: "java",
 		Version:   "1.1.1",
+
+		KubeletPort: 10250,
 	}, node)
 	assert.Assert(t, len(node.Spec.Taints) == 1)
 	assert.Assert(t, node.Status.Phase == corev1.NodePending)
+	assert.Assert(t, node.Status.NodeInfo.OperatingSystem == "linux")
+	assert.Assert(t, node.Status.NodeInfo.Architecture != "")
+	assert.Assert(t, node.Status.NodeInfo.KubeletVersion == model.KubeletVersion)
+	assert.Assert(t, node.Status.NodeInfo.ContainerRuntimeVersion == "koupleless://java-1.1.1")
+	assert.Assert(t, node.Labels["koupleless.io/tech-stack"] == "java")
+	assert.Assert(t, node.Labels["koupleless.io/biz-name"] == "test")
+	assert.Assert(t, node.Labels["koupleless.io/biz-version"] == "1.1.1")
+	assert.Assert(t, node.Labels["koupleless.io/node-ip"] == "127.0.0.1")
+	assert.Assert(t, node.Labels[corev1.LabelOSStable] == "linux")
+	assert.Equal(t, node.Status.DaemonEndpoints.KubeletEndpoint.Port, int32(10250))
+}
+
+func TestModelUtils_BuildVirtualNode_InvalidLabelValue(t *testing.T) {
+	node := &corev1.Node{}
+	ModelUtils{}.BuildVirtualNode(&model.BuildVirtualNodeConfig{
+		NodeIP:    "::1",
+		BizName:   "test",
+		TechStack: "java",
+		Version:   "1.0+build",
+	}, node)
+	assert.Assert(t, node.Labels[model.LabelKeyBizName] == "test")
+	_, has := node.Labels[model.LabelKeyBizVersion]
+	assert.Assert(t, !has)
+	_, has = node.Labels[model.LabelKeyNodeIP]
+	assert.Assert(t, !has)
+	assert.Assert(t, node.Status.NodeInfo.ContainerRuntimeVersion == "koupleless://java-1.0+build")
+}
+
+func TestModelUtils_BuildVirtualNode_Hostname(t *testing.T) {
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "test-node",
+		},
+	}
+	moduleUtils.BuildVirtualNode(&model.BuildVirtualNodeConfig{
+		NodeIP: "127.0.0.1",
+	}, node)
+	assert.Assert(t, node.Labels[corev1.LabelHostname] == "test-node")
+}
+
+func TestModelUtils_BuildVirtualNode_Taint(t *testing.T) {
+	node := &corev1.Node{}
+	moduleUtils.BuildVirtualNode(&model.BuildVirtualNodeConfig{
+		NodeIP: "127.0.0.1",
+	}, node)
+	assert.Assert(t, len(node.Spec.Taints) == 1)
+	assert.Assert(t, node.Spec.Taints[0].Key == model.DefaultNodeTaintKey)
+	assert.Assert(t, node.Spec.Taints[0].Effect == corev1.TaintEffectNoExecute)
+
+	node = &corev1.Node{}
+	moduleUtils.BuildVirtualNode(&model.BuildVirtualNodeConfig{
+		NodeIP:      "127.0.0.1",
+		TaintKey:    "test.koupleless.io/pool",
+		TaintValue:  "test",
+		TaintEffect: corev1.TaintEffectNoSchedule,
+	}, node)
+	assert.Assert(t, len(node.Spec.Taints) == 1)
+	assert.Assert(t, node.Spec.Taints[0].Key == "test.koupleless.io/pool")
+	assert.Assert(t, node.Spec.Taints[0].Value == "test")
+	assert.Assert(t, node.Spec.Taints[0].Effect == corev1.TaintEffectNoSchedule)
+
+	node = &corev1.Node{}
+	moduleUtils.BuildVirtualNode(&model.BuildVirtualNodeConfig{
+		NodeIP:  "127.0.0.1",
+		NoTaint: true,
+	}, node)
+	assert.Assert(t, len(node.Spec.Taints) == 0)
+}
+
+func TestModelUtils_BuildVirtualNode_Capacity(t *testing.T) {
+	node := &corev1.Node{}
+	moduleUtils.BuildVirtualNode(&model.BuildVirtualNodeConfig{
+		NodeIP:    "127.0.0.1",
+		BizName:   "test",
+		TechStack: "java",
+		Version:   "1.1.1",
+	}, node)
+	pods := node.Status.Allocatable[corev1.ResourcePods]
+	assert.Assert(t, pods.Value() == model.DefaultNodePodsCapacity)
+	cpu := node.Status.Capacity[corev1.ResourceCPU]
+	assert.Assert(t, cpu.String() == model.DefaultNodeCPUCapacity)
+
+	node = &corev1.Node{}
+	moduleUtils.BuildVirtualNode(&model.BuildVirtualNodeConfig{
+		NodeIP: "127.0.0.1",
+		CPU:    resource.MustParse("4"),
+		Memory: resource.MustParse("8Gi"),
+		Pods:   100,
+	}, node)
+	pods = node.Status.Allocatable[corev1.ResourcePods]
+	memory := node.Status.Allocatable[corev1.ResourceMemory]
+	cpu = node.Status.Capacity[corev1.ResourceCPU]
+	assert.Assert(t, pods.Value() == 100)
+	assert.Assert(t, memory.String() == "8Gi")
+	assert.Assert(t, cpu.String() == "4")
 }
 
 func TestModelUtils_CmpBizModel(t *testing.T) {
@@ -59,6 +159,116 @@ func TestModelUtils_CmpBizModel(t *testing.T) {
 	}
 }
 
+func TestModelUtils_CompareBizVersion(t *testing.T) {
+	cases := []struct {
+		a, b string
+		ret  int
+	}{
+		{"1.2.0", "1.2.0", 0},
+		{"1.2.0", "1.10.0", -1},
+		{"2.0.0", "1.10.0", 1},
+		{"1.2.0-rc1", "1.2.0", -1},
+		{"1.2.0", "1.2.0-rc1", 1},
+		{"1.2.0-rc1", "1.2.0-rc2", -1},
+		{"1.2.0-alpha", "1.2.0-alpha.1", -1},
+		{"0.0.1-SNAPSHOT", "0.0.1", -1},
+		{"1.2.0+build1", "1.2.0+build2", 0},
+		{"v1.2.0", "1.2.0", 0},
+	}
+	for _, c := range cases {
+		ret, err := moduleUtils.CompareBizVersion(c.a, c.b)
+		assert.NilError(t, err)
+		assert.Equal(t, ret, c.ret, "%s vs %s", c.a, c.b)
+	}
+
+	_, err := moduleUtils.CompareBizVersion("1.2", "1.2.0")
+	assert.Assert(t, errors.Is(err, ErrInvalidBizVersion))
+	_, err = moduleUtils.CompareBizVersion("1.2.0", UnknownBizVersion)
+	assert.Assert(t, errors.Is(err, ErrInvalidBizVersion))
+}
+
+func TestModelUtils_CmpBizModelName(t *testing.T) {
+	bizModel1 := &ark.BizModel{
+		BizName:    "test-biz1",
+		BizVersion: "0.0.1",
+	}
+	bizModel2 := &ark.BizModel{
+		BizName:    "test-biz1",
+		BizVersion: "0.0.2",
+	}
+	bizModel3 := &ark.BizModel{
+		BizName:    "test-biz2",
+		BizVersion: "0.0.1",
+	}
+	bizModel4 := &ark.BizModel{
+		BizName:    "test-biz2",
+		BizVersion: "0.0.2",
+	}
+	assert.Assert(t, moduleUtils.CmpBizModelName(bizModel1, bizModel2))
+	assert.Assert(t, moduleUtils.CmpBizModelName(bizModel3, bizModel4))
+	assert.Assert(t, !moduleUtils.CmpBizModelName(bizModel1, bizModel3))
+	assert.Assert(t, !moduleUtils.CmpBizModelName(bizModel2, bizModel4))
+	assert.Assert(t, !moduleUtils.CmpBizModelName(bizModel1, bizModel4))
+}
+
+func TestModelUtils_DiffBizModels(t *testing.T) {
+	bizContainer := func(name, bizVersion string) corev1.Container {
+		return corev1.Container{
+			Name:  name,
+			Image: "file:///test/" + name + ".jar",
+			Env: []corev1.EnvVar{
+				{
+					Name:  "BIZ_VERSION",
+					Value: bizVersion,
+				},
+			},
+		}
+	}
+	oldModels, err := moduleUtils.GetBizModelsFromCoreV1Pod(&corev1.Pod{
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{bizContainer("biz1", "0.0.1"), bizContainer("biz2", "0.0.1"), bizContainer("biz3", "0.0.1")},
+		},
+	})
+	assert.NilError(t, err)
+	// only the BIZ_VERSION env of biz1 changed, biz2 removed and biz4 added
+	newModels, err := moduleUtils.GetBizModelsFromCoreV1Pod(&corev1.Pod{
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{bizContainer("biz4", "0.0.1"), bizContainer("biz1", "0.0.2"), bizContainer("biz3", "0.0.1")},
+		},
+	})
+	assert.NilError(t, err)
+
+	installs, uninstalls := moduleUtils.DiffBizModels(oldModels, newModels)
+	assert.DeepEqual(t, installs, []*ark.BizModel{newModels[0], newModels[1]})
+	assert.DeepEqual(t, uninstalls, []*ark.BizModel{oldModels[0], oldModels[1]})
+	assert.Equal(t, uninstalls[0].BizVersion, "0.0.1")
+	assert.Equal(t, installs[1].BizVersion, "0.0.2")
+
+	installs, uninstalls = moduleUtils.DiffBizModels(newModels, newModels)
+	assert.Equal(t, len(installs), 0)
+	assert.Equal(t, len(uninstalls), 0)
+
+	installs, uninstalls = moduleUtils.DiffBizModels(nil, newModels)
+	assert.DeepEqual(t, installs, newModels)
+	assert.Equal(t, len(uninstalls), 0)
+}
+
+func TestModelUtils_GetBizDowngrades(t *testing.T) {
+	installs := []*ark.BizModel{
+		{BizName: "biz1", BizVersion: "0.0.1"},
+		{BizName: "biz2", BizVersion: "0.0.2"},
+		{BizName: "biz3", BizVersion: "0.0.1"},
+		{BizName: "biz4", BizVersion: "snapshot"},
+	}
+	uninstalls := []*ark.BizModel{
+		{BizName: "biz1", BizVersion: "0.0.2"},
+		{BizName: "biz2", BizVersion: "0.0.1"},
+		{BizName: "biz4", BizVersion: "0.0.2"},
+	}
+	assert.DeepEqual(t, moduleUtils.GetBizDowngrades(installs, uninstalls), []*ark.BizModel{installs[0]})
+	assert.Equal(t, len(moduleUtils.GetBizDowngrades(installs, nil)), 0)
+}
+
 func TestModelUtils_GetBizIdentityFromBizInfo(t *testing.T) {
 	assert.Assert(t, moduleUtils.GetBizIdentityFromBizInfo(&ark.ArkBizInfo{
 		BizName:        "test-biz",
@@ -69,6 +279,30 @@ func TestModelUtils_GetBizIdentityFromBizInfo(t *testing.T) {
 	}) == "test-biz:1.1.1")
 }
 
+func TestModelUtils_GetBizIdentityFromBizInfoChecked(t *testing.T) {
+	bizIdentity, err := moduleUtils.GetBizIdentityFromBizInfoChecked(&ark.ArkBizInfo{
+		BizName:    "test-biz",
+		BizState:   "ACTIVATED",
+		BizVersion: "1.1.1",
+	})
+	assert.NilError(t, err)
+	assert.Equal(t, bizIdentity, "test-biz:1.1.1")
+
+	_, err = moduleUtils.GetBizIdentityFromBizInfoChecked(nil)
+	assert.Assert(t, errors.Is(err, ErrInvalidBizInfo))
+
+	_, err = moduleUtils.GetBizIdentityFromBizInfoChecked(&ark.ArkBizInfo{BizVersion: "1.1.1"})
+	assert.Assert(t, errors.Is(err, ErrInvalidBizInfo))
+	assert.ErrorContains(t, err, "bizName")
+
+	_, err = moduleUtils.GetBizIdentityFromBizInfoChecked(&ark.ArkBizInfo{BizName: "test-biz"})
+	assert.Assert(t, errors.Is(err, ErrInvalidBizInfo))
+	assert.ErrorContains(t, err, "bizVersion")
+
+	_, err = moduleUtils.GetBizIdentityFromBizInfoChecked(&ark.ArkBizInfo{})
+	assert.ErrorContains(t, err, "[bizName bizVersion]")
+}
+
 func TestModelUtils_GetBizIdentityFromBizModel(t *testing.T) {
 	assert.Assert(t, moduleUtils.GetBizIdentityFromBizModel(&ark.BizModel{
 		BizName:    "test-biz",
@@ -94,8 +328,27 @@ func TestModelUtils_TranslateCoreV1ContainerToBizModel(t *testing.T) {
 	assert.Assert(t, bizModel.BizVersion == "1.1.1")
 }
 
+func TestModelUtils_TranslateCoreV1ContainerToBizModel_BizNameEnv(t *testing.T) {
+	bizModel := moduleUtils.TranslateCoreV1ContainerToBizModel(corev1.Container{
+		Name:  "my-container",
+		Image: "file:///test/test1",
+		Env: []corev1.EnvVar{
+			{
+				Name:  "BIZ_NAME",
+				Value: "com.example.biz",
+			},
+			{
+				Name:  "BIZ_VERSION",
+				Value: "1.1.1",
+			},
+		},
+	})
+	assert.Assert(t, bizModel.BizName == "com.example.biz")
+	assert.Assert(t, bizModel.BizVersion == "1.1.1")
+}
+
 func TestModelUtils_GetBizModelsFromCoreV1Pod(t *testing.T) {
-	bizModelList := moduleUtils.GetBizModelsFromCoreV1Pod(&corev1.Pod{
+	bizModelList, err := moduleUtils.GetBizModelsFromCoreV1Pod(&corev1.Pod{
 		Spec: corev1.PodSpec{
 			Containers: []corev1.Container{
 				{
@@ -123,9 +376,207 @@ func TestModelUtils_GetBizModelsFromCoreV1Pod(t *testing.T) {
 			},
 		},
 	})
+	assert.NilError(t, err)
 	assert.Assert(t, len(bizModelList) == 2)
 }
 
+func TestModelUtils_TranslateCoreV1ContainerToBizModel_VersionFromImage(t *testing.T) {
+	bizModel := moduleUtils.TranslateCoreV1ContainerToBizModel(corev1.Container{
+		Name:  "test_container",
+		Image: "file:///test/test1.jar:1.2.3",
+	})
+	assert.Assert(t, bizModel.BizUrl == "file:///test/test1.jar:1.2.3")
+	assert.Assert(t, bizModel.BizVersion == "1.2.3")
+
+	// port of the url is not a version
+	bizModel = moduleUtils.TranslateCoreV1ContainerToBizModel(corev1.Container{
+		Name:  "test_container",
+		Image: "http://repo:8080/biz.jar",
+	})
+	assert.Assert(t, bizModel.BizUrl == "http://repo:8080/biz.jar")
+	assert.Assert(t, bizModel.BizVersion == UnknownBizVersion)
+
+	bizModel = moduleUtils.TranslateCoreV1ContainerToBizModel(corev1.Container{
+		Name:  "test_container",
+		Image: "http://repo:8080/biz-1.0.0.jar",
+	})
+	assert.Assert(t, bizModel.BizUrl == "http://repo:8080/biz-1.0.0.jar")
+	assert.Assert(t, bizModel.BizVersion == "1.0.0")
+
+	bizModel = moduleUtils.TranslateCoreV1ContainerToBizModel(corev1.Container{
+		Name:  "test_container",
+		Image: "file:///test/test1-1.2.3-SNAPSHOT.jar",
+	})
+	assert.Assert(t, bizModel.BizUrl == "file:///test/test1-1.2.3-SNAPSHOT.jar")
+	assert.Assert(t, bizModel.BizVersion == "1.2.3-SNAPSHOT")
+
+	// env takes precedence over image
+	bizModel = moduleUtils.TranslateCoreV1ContainerToBizModel(corev1.Container{
+		Name:  "test_container",
+		Image: "file:///test/test1.jar:1.2.3",
+		Env: []corev1.EnvVar{
+			{
+				Name:  "BIZ_VERSION",
+				Value: "1.1.1",
+			},
+		},
+	})
+	assert.Assert(t, bizModel.BizVersion == "1.1.1")
+}
+
+func TestModelUtils_GetBizModelsFromCoreV1Pod_VersionNotFound(t *testing.T) {
+	bizModelList, err := moduleUtils.GetBizModelsFromCoreV1Pod(&corev1.Pod{
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Name:  "test_container",
+					Image: "file:///test/test1.jar",
+				},
+			},
+		},
+	})
+	assert.Assert(t, errors.Is(err, ErrBizVersionNotFound))
+	assert.Assert(t, len(bizModelList) == 1)
+	assert.Assert(t, bizModelList[0].BizVersion == UnknownBizVersion)
+}
+
+func TestModelUtils_TranslateCoreV1ContainerToBizModel_DefaultBizVersion(t *testing.T) {
+	devUtils := ModelUtils{DefaultBizVersion: "0.0.0-SNAPSHOT"}
+	bizModel := devUtils.TranslateCoreV1ContainerToBizModel(corev1.Container{
+		Name:  "test_container",
+		Image: "file:///test/test1.jar",
+	})
+	assert.Assert(t, bizModel.BizVersion == "0.0.0-SNAPSHOT")
+
+	// image takes precedence over default
+	bizModel = devUtils.TranslateCoreV1ContainerToBizModel(corev1.Container{
+		Name:  "test_container",
+		Image: "file:///test/test1.jar:1.2.3",
+	})
+	assert.Assert(t, bizModel.BizVersion == "1.2.3")
+
+	bizModelList, err := devUtils.GetBizModelsFromCoreV1Pod(&corev1.Pod{
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Name:  "test_container",
+					Image: "file:///test/test1.jar",
+				},
+			},
+		},
+	})
+	assert.NilError(t, err)
+	assert.Assert(t, len(bizModelList) == 1)
+	assert.Assert(t, bizModelList[0].BizVersion == "0.0.0-SNAPSHOT")
+}
+
+func TestModelUtils_GetInitBizModelsFromCoreV1Pod(t *testing.T) {
+	pod := &corev1.Pod{
+		Spec: corev1.PodSpec{
+			InitContainers: []corev1.Container{
+				{
+					Name:  "setup-biz",
+					Image: "file:///test/setup.jar:1.0.0",
+				},
+			},
+			Containers: []corev1.Container{
+				{
+					Name:  "test-biz1",
+					Image: "file:///test/test1.jar:1.1.1",
+				},
+				{
+					Name:  "test-biz2",
+					Image: "file:///test/test2.jar:2.2.2",
+				},
+			},
+		},
+	}
+	initBizModels, err := moduleUtils.GetInitBizModelsFromCoreV1Pod(pod)
+	assert.NilError(t, err)
+	assert.Assert(t, len(initBizModels) == 1)
+	assert.Assert(t, initBizModels[0].BizName == "setup-biz")
+	assert.Assert(t, initBizModels[0].BizVersion == "1.0.0")
+
+	bizModels, err := moduleUtils.GetBizModelsFromCoreV1Pod(pod)
+	assert.NilError(t, err)
+	assert.Assert(t, len(bizModels) == 2)
+	assert.Assert(t, bizModels[0].BizName == "test-biz1")
+	assert.Assert(t, bizModels[1].BizName == "test-biz2")
+}
+
+func TestModelUtils_GetBizModelsFromCoreV1Pod_Sidecar(t *testing.T) {
+	pod := &corev1.Pod{
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Name:  "test-biz",
+					Image: "file:///test/test1.jar:1.1.1",
+				},
+				{
+					Name:  "log-agent",
+					Image: "log-agent:1.0.0",
+				},
+			},
+		},
+	}
+	// all containers are biz by default, the sidecar image is not a biz url
+	bizModels, err := moduleUtils.GetBizModelsFromCoreV1Pod(pod)
+	assert.Assert(t, errors.Is(err, ErrUnsupportedBizUrl))
+	assert.Assert(t, len(bizModels) == 2)
+
+	pod.Annotations = map[string]string{BizContainersAnnotation: "test-biz"}
+	bizModels, err = moduleUtils.GetBizModelsFromCoreV1PodChecked(pod)
+	assert.NilError(t, err)
+	assert.Assert(t, len(bizModels) == 1)
+	assert.Assert(t, bizModels[0].BizName == "test-biz")
+	resources := moduleUtils.GetBizResourcesFromCoreV1Pod(pod, nil)
+	assert.Assert(t, len(resources) == 1)
+
+	pod.Annotations[BizContainersAnnotation] = " log-agent , test-biz"
+	bizModels, err = moduleUtils.GetBizModelsFromCoreV1Pod(pod)
+	assert.Assert(t, errors.Is(err, ErrUnsupportedBizUrl))
+	assert.Assert(t, len(bizModels) == 2)
+}
+
+func TestModelUtils_GetBizModelsFromCoreV1PodChecked(t *testing.T) {
+	container := corev1.Container{
+		Name:  "test-biz",
+		Image: "file:///test/test1.jar",
+		Env: []corev1.EnvVar{
+			{
+				Name:  "BIZ_VERSION",
+				Value: "1.1.1",
+			},
+		},
+	}
+	duplicated := container
+	duplicated.Name = "test-biz-copy"
+	duplicated.Env = append(duplicated.Env, corev1.EnvVar{Name: "BIZ_NAME", Value: "test-biz"})
+
+	bizModelList, err := moduleUtils.GetBizModelsFromCoreV1PodChecked(&corev1.Pod{
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{container, duplicated},
+		},
+	})
+	assert.Assert(t, errors.Is(err, ErrDuplicateBizIdentity))
+	assert.ErrorContains(t, err, "test-biz:1.1.1")
+	assert.Assert(t, len(bizModelList) == 2)
+
+	_, err = moduleUtils.GetBizModelsFromCoreV1PodChecked(&corev1.Pod{
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{container, container},
+		},
+	})
+	assert.Assert(t, errors.Is(err, ErrDuplicateBizIdentity))
+
+	_, err = moduleUtils.GetBizModelsFromCoreV1PodChecked(&corev1.Pod{
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{container},
+		},
+	})
+	assert.NilError(t, err)
+}
+
 func TestModelUtils_GetPodKey(t *testing.T) {
 	assert.Assert(t, moduleUtils.GetPodKey(&corev1.Pod{
 		ObjectMeta: metav1.ObjectMeta{
@@ -162,3 +613,225 @@ func TestModelUtils_TranslateArkBizInfoToV1ContainerStatus(t *testing.T) {
 	assert.Assert(t, moduleUtils.TranslateArkBizInfoToV1ContainerStatus(bizModel, infoActivated).State.Running != nil)
 	assert.Assert(t, moduleUtils.TranslateArkBizInfoToV1ContainerStatus(bizModel, infoDeactivated).State.Terminated != nil)
 }
+
+func TestModelUtils_TranslateArkBizInfoToV1ContainerStatus_Times(t *testing.T) {
+	bizModel := &ark.BizModel{
+		BizName:    "test-biz",
+		BizVersion: "1.1.1",
+	}
+	activatedAt := time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+	deactivatedAt := activatedAt.Add(time.Hour)
+	times := BizTimes{ActivatedAt: activatedAt, DeactivatedAt: deactivatedAt}
+
+	status := moduleUtils.TranslateArkBizInfoToV1ContainerStatusWithTimes(bizModel, &ark.ArkBizInfo{BizState: "ACTIVATED"}, times)
+	assert.Assert(t, status.State.Running.StartedAt.Time.Equal(activatedAt))
+
+	status = moduleUtils.TranslateArkBizInfoToV1ContainerStatusWithTimes(bizModel, &ark.ArkBizInfo{BizState: "DEACTIVATED"}, times)
+	assert.Assert(t, status.State.Terminated.StartedAt.Time.Equal(activatedAt))
+	assert.Assert(t, status.State.Terminated.FinishedAt.Time.Equal(deactivatedAt))
+
+	// state records reported by base take precedence
+	status = moduleUtils.TranslateArkBizInfoToV1ContainerStatusWithTimes(bizModel, &ark.ArkBizInfo{
+		BizState: "ACTIVATED",
+		BizStateRecords: []ark.ArkBizStateRecord{
+			{ChangeTime: "2024-07-02 08:00:00.000", State: "ACTIVATED"},
+		},
+	}, times)
+	assert.Assert(t, status.State.Running.StartedAt.Time.Equal(time.Date(2024, 7, 2, 8, 0, 0, 0, time.UTC)))
+
+	status = moduleUtils.TranslateArkBizInfoToV1ContainerStatus(bizModel, &ark.ArkBizInfo{BizState: "ACTIVATED"})
+	assert.Assert(t, status.State.Running.StartedAt.IsZero())
+}
+
+func TestModelUtils_GetBizLifecycleEvent(t *testing.T) {
+	bizModel := &ark.BizModel{
+		BizName:    "test-biz",
+		BizVersion: "1.1.1",
+	}
+	eventReason := func(state string) (string, string) {
+		eventType, reason, _ := moduleUtils.GetBizLifecycleEvent(moduleUtils.TranslateArkBizInfoToV1ContainerStatus(bizModel, &ark.ArkBizInfo{
+			BizName:    "test-biz",
+			BizState:   state,
+			BizVersion: "1.1.1",
+		}))
+		return eventType, reason
+	}
+	eventType, reason := eventReason("RESOLVED")
+	assert.Equal(t, eventType, corev1.EventTypeNormal)
+	assert.Equal(t, reason, EventReasonResolved)
+	eventType, reason = eventReason("ACTIVATED")
+	assert.Equal(t, eventType, corev1.EventTypeNormal)
+	assert.Equal(t, reason, EventReasonActivated)
+	eventType, reason = eventReason("BROKEN")
+	assert.Equal(t, eventType, corev1.EventTypeWarning)
+	assert.Equal(t, reason, EventReasonInstallFailed)
+	_, reason = eventReason("DEACTIVATED")
+	assert.Equal(t, reason, "")
+	_, reason, _ = moduleUtils.GetBizLifecycleEvent(moduleUtils.TranslateArkBizInfoToV1ContainerStatus(bizModel, nil))
+	assert.Equal(t, reason, "")
+}
+
+func TestModelUtils_TranslateArkBizInfoToV1ContainerStatus_StateCasing(t *testing.T) {
+	bizModel := &ark.BizModel{
+		BizName:    "test-biz",
+		BizVersion: "1.1.1",
+		BizUrl:     "file:///test/test1.jar",
+	}
+	for _, state := range []string{"ACTIVATED", "activated", "Activated", "ACTIVATE", "activate"} {
+		status := moduleUtils.TranslateArkBizInfoToV1ContainerStatus(bizModel, &ark.ArkBizInfo{
+			BizName:    "test-biz",
+			BizState:   state,
+			BizVersion: "1.1.1",
+		})
+		assert.Assert(t, status.State.Running != nil, state)
+		assert.Assert(t, status.Ready, state)
+	}
+	for _, state := range []string{"resolved", "Resolved"} {
+		status := moduleUtils.TranslateArkBizInfoToV1ContainerStatus(bizModel, &ark.ArkBizInfo{BizState: state})
+		assert.Assert(t, status.State.Waiting.Reason == "BizResolved", state)
+	}
+	for _, state := range []string{"deactivated", "Deactivated"} {
+		status := moduleUtils.TranslateArkBizInfoToV1ContainerStatus(bizModel, &ark.ArkBizInfo{BizState: state})
+		assert.Assert(t, status.State.Terminated != nil, state)
+	}
+	status := moduleUtils.TranslateArkBizInfoToV1ContainerStatus(bizModel, &ark.ArkBizInfo{BizState: "UNKNOWN_STATE"})
+	assert.Assert(t, status.State.Waiting.Reason == "BizStateUnknown")
+	assert.Assert(t, !status.Ready)
+}
+
+func TestModelUtils_TranslateArkBizInfoToV1ContainerStatus_InstallFailed(t *testing.T) {
+	bizModel := &ark.BizModel{
+		BizName:    "test-biz",
+		BizVersion: "1.1.1",
+		BizUrl:     "file:///test/test1.jar",
+	}
+	status := moduleUtils.TranslateArkBizInfoToV1ContainerStatus(bizModel, &ark.ArkBizInfo{
+		BizName:    "test-biz",
+		BizState:   "BROKEN",
+		BizVersion: "1.1.1",
+		BizStateRecords: []ark.ArkBizStateRecord{
+			{
+				ChangeTime: "2024-07-01 12:00:00.000",
+				State:      "BROKEN",
+				Reason:     "ClassNotFound",
+				Message:    "class com.example.Main not found",
+			},
+		},
+	})
+	assert.Assert(t, status.State.Terminated != nil)
+	assert.Assert(t, status.State.Terminated.ExitCode != 0)
+	assert.Assert(t, status.State.Terminated.Reason == "BizInstallFailed")
+	assert.Assert(t, status.State.Terminated.Message == "class com.example.Main not found")
+	assert.Assert(t, !status.Ready)
+
+	status = moduleUtils.TranslateArkBizInfoToV1ContainerStatus(bizModel, &ark.ArkBizInfo{BizState: "failed"})
+	assert.Assert(t, status.State.Terminated.Reason == "BizInstallFailed")
+	assert.Assert(t, status.State.Terminated.Message == "Biz failed to install")
+}
+
+func TestModelUtils_TranslateArkBizInfoToV1ContainerStatus_Timeout(t *testing.T) {
+	bizModel := &ark.BizModel{
+		BizName:    "test-biz",
+		BizVersion: "1.1.1",
+	}
+	status := moduleUtils.TranslateArkBizInfoToV1ContainerStatus(bizModel, &ark.ArkBizInfo{
+		BizName:    "test-biz",
+		BizVersion: "1.1.1",
+		BizState:   BizStateTimeout,
+	})
+	assert.Assert(t, status.State.Terminated != nil)
+	assert.Assert(t, status.State.Terminated.Reason == "BizCommandTimeout")
+	assert.Assert(t, !status.Ready)
+
+	// the finish time is when the timeout fired, stable across status computations
+	timedOutAt := time.Now().Add(-time.Minute)
+	status = moduleUtils.TranslateArkBizInfoToV1ContainerStatusWithTimes(bizModel, &ark.ArkBizInfo{
+		BizName:    "test-biz",
+		BizVersion: "1.1.1",
+		BizState:   BizStateTimeout,
+	}, BizTimes{TimedOutAt: timedOutAt})
+	assert.Assert(t, status.State.Terminated.FinishedAt.Time.Equal(timedOutAt))
+}
+
+func TestModelUtils_TranslateArkBizInfoToV1ContainerStatus_Ready(t *testing.T) {
+	bizModel := &ark.BizModel{
+		BizName:    "test-biz",
+		BizVersion: "1.1.1",
+		BizUrl:     "file:///test/test1.jar",
+	}
+	assert.Assert(t, !moduleUtils.TranslateArkBizInfoToV1ContainerStatus(bizModel, nil).Ready)
+	assert.Assert(t, !moduleUtils.TranslateArkBizInfoToV1ContainerStatus(bizModel, &ark.ArkBizInfo{BizState: "RESOLVED"}).Ready)
+	assert.Assert(t, moduleUtils.TranslateArkBizInfoToV1ContainerStatus(bizModel, &ark.ArkBizInfo{BizState: "ACTIVATED"}).Ready)
+	assert.Assert(t, !moduleUtils.TranslateArkBizInfoToV1ContainerStatus(bizModel, &ark.ArkBizInfo{BizState: "DEACTIVATED"}).Ready)
+}
+
+func TestModelUtils_GetBizResourcesFromCoreV1Container(t *testing.T) {
+	defaults := corev1.ResourceList{
+		corev1.ResourceCPU:    resource.MustParse("1"),
+		corev1.ResourceMemory: resource.MustParse("256Mi"),
+	}
+	resources := moduleUtils.GetBizResourcesFromCoreV1Container(corev1.Container{
+		Name:  "test_container",
+		Image: "file:///test/test1.jar:1.2.3",
+		Resources: corev1.ResourceRequirements{
+			Limits: corev1.ResourceList{
+				corev1.ResourceMemory: resource.MustParse("512Mi"),
+			},
+			Requests: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("500m"),
+				corev1.ResourceMemory: resource.MustParse("128Mi"),
+			},
+		},
+	}, defaults)
+	memory := resources[corev1.ResourceMemory]
+	cpu := resources[corev1.ResourceCPU]
+	assert.Assert(t, memory.String() == "512Mi")
+	assert.Assert(t, cpu.String() == "500m")
+
+	resources = moduleUtils.GetBizResourcesFromCoreV1Container(corev1.Container{Name: "test_container"}, defaults)
+	memory = resources[corev1.ResourceMemory]
+	assert.Assert(t, memory.String() == "256Mi")
+	assert.Assert(t, len(moduleUtils.GetBizResourcesFromCoreV1Container(corev1.Container{Name: "test_container"}, nil)) == 0)
+}
+
+func TestModelUtils_TranslateBizModelToCoreV1Container(t *testing.T) {
+	bizModel := &ark.BizModel{
+		BizName:    "test-biz",
+		BizVersion: "1.1.1",
+		BizUrl:     "file:///test/test1.jar",
+	}
+	container := moduleUtils.TranslateBizModelToCoreV1Container(bizModel)
+	assert.Assert(t, container.Name == "test-biz")
+	assert.Assert(t, container.Image == "file:///test/test1.jar")
+
+	translated := moduleUtils.TranslateCoreV1ContainerToBizModel(container)
+	assert.DeepEqual(t, translated, *bizModel)
+}
+
+func TestModelUtils_GetPodKey_EmptyNamespace(t *testing.T) {
+	assert.Assert(t, moduleUtils.GetPodKey(&corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "test-pod",
+		},
+	}) == "default/test-pod")
+	assert.Assert(t, moduleUtils.GetPodKeyFromNamespacedName("", "test-pod") == "default/test-pod")
+	assert.Assert(t, moduleUtils.GetPodKeyFromNamespacedName("test-namespace", "test-pod") == "test-namespace/test-pod")
+}
+
+func TestModelUtils_BuildVirtualNode_Conditions(t *testing.T) {
+	node := &corev1.Node{}
+	moduleUtils.BuildVirtualNode(&model.BuildVirtualNodeConfig{
+		NodeIP: "127.0.0.1",
+	}, node)
+	conditions := make(map[corev1.NodeConditionType]corev1.NodeCondition)
+	for _, condition := range node.Status.Conditions {
+		conditions[condition.Type] = condition
+	}
+	ready, has := conditions[corev1.NodeReady]
+	assert.Assert(t, has)
+	assert.Assert(t, ready.Status == corev1.ConditionFalse)
+	assert.Assert(t, !ready.LastHeartbeatTime.IsZero())
+	for _, conditionType := range []corev1.NodeConditionType{corev1.NodeMemoryPressure, corev1.NodeDiskPressure, corev1.NodePIDPressure} {
+		assert.Assert(t, conditions[conditionType].Status == corev1.ConditionFalse, conditionType)
+	}
+}
@@ -0,0 +1,81 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"github.com/koupleless/virtual-kubelet/java/model"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"time"
+)
+
+// ErrInvalidNodeHeartbeat is returned when a node heartbeat carries malformed resources or unknown pressures
+var ErrInvalidNodeHeartbeat = errors.New("invalid node heartbeat")
+
+var nodePressureReasons = map[corev1.NodeConditionType]string{
+	corev1.NodeMemoryPressure: "BaseHasInsufficientMemory",
+	corev1.NodeDiskPressure:   "BaseHasDiskPressure",
+	corev1.NodePIDPressure:    "BaseHasInsufficientPID",
+}
+
+// ApplyNodeHeartbeat reflect the node heartbeat reported by base onto node status, the node is set ready with the reported
+// pressures, and its capacity and allocatable are overridden by the reported ones. The node is unchanged if heartbeat is invalid.
+func (c ModelUtils) ApplyNodeHeartbeat(node *corev1.Node, heartbeat *model.NodeHeartbeat, heartbeatTime time.Time) error {
+	capacity, err := parseResourceList(heartbeat.Capacity)
+	if err != nil {
+		return err
+	}
+	allocatable, err := parseResourceList(heartbeat.Allocatable)
+	if err != nil {
+		return err
+	}
+	for _, pressure := range heartbeat.Pressures {
+		if _, has := nodePressureReasons[pressure]; !has {
+			return fmt.Errorf("%w: unknown pressure %s", ErrInvalidNodeHeartbeat, pressure)
+		}
+	}
+
+	if node.Status.Capacity == nil {
+		node.Status.Capacity = corev1.ResourceList{}
+	}
+	if node.Status.Allocatable == nil {
+		node.Status.Allocatable = corev1.ResourceList{}
+	}
+	for name, quantity := range capacity {
+		node.Status.Capacity[name] = quantity
+		if _, has := allocatable[name]; !has {
+			node.Status.Allocatable[name] = quantity
+		}
+	}
+	for name, quantity := range allocatable {
+		node.Status.Allocatable[name] = quantity
+	}
+	if heartbeat.Version != "" {
+		node.Status.NodeInfo.ContainerRuntimeVersion = fmt.Sprintf("koupleless://%s-%s", node.Labels[model.LabelKeyTechStack], heartbeat.Version)
+	}
+
+	node.Status.Phase = corev1.NodeRunning
+	node.Status.Conditions = c.BuildNodeConditions(corev1.ConditionTrue, heartbeatTime)
+	for _, pressure := range heartbeat.Pressures {
+		for i := range node.Status.Conditions {
+			if node.Status.Conditions[i].Type == pressure {
+				node.Status.Conditions[i].Status = corev1.ConditionTrue
+				node.Status.Conditions[i].Reason = nodePressureReasons[pressure]
+				node.Status.Conditions[i].Message = fmt.Sprintf("base reported %s", pressure)
+			}
+		}
+	}
+	return nil
+}
+
+func parseResourceList(resources map[corev1.ResourceName]string) (corev1.ResourceList, error) {
+	ret := make(corev1.ResourceList, len(resources))
+	for name, value := range resources {
+		quantity, err := resource.ParseQuantity(value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: resource %s: %v", ErrInvalidNodeHeartbeat, name, err)
+		}
+		ret[name] = quantity
+	}
+	return ret, nil
+}
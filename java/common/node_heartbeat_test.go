@@ -0,0 +1,65 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/koupleless/virtual-kubelet/java/model"
+	"gotest.tools/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"testing"
+	"time"
+)
+
+func TestModelUtils_ApplyNodeHeartbeat(t *testing.T) {
+	var heartbeat model.NodeHeartbeat
+	assert.NilError(t, json.Unmarshal([]byte(`{
+		"version": "1.2.0",
+		"load": 0.75,
+		"capacity": {"cpu": "4", "memory": "8Gi"},
+		"allocatable": {"memory": "6Gi"},
+		"pressures": ["MemoryPressure"]
+	}`), &heartbeat))
+	assert.Equal(t, heartbeat.Load, 0.75)
+
+	node := &corev1.Node{}
+	moduleUtils.BuildVirtualNode(&model.BuildVirtualNodeConfig{
+		NodeIP:    "127.0.0.1",
+		TechStack: "java",
+		BizName:   "base",
+		Version:   "1.0.0",
+	}, node)
+	heartbeatTime := time.Now()
+	assert.NilError(t, moduleUtils.ApplyNodeHeartbeat(node, &heartbeat, heartbeatTime))
+
+	assert.Assert(t, node.Status.Capacity.Cpu().Equal(resource.MustParse("4")))
+	assert.Assert(t, node.Status.Capacity.Memory().Equal(resource.MustParse("8Gi")))
+	assert.Assert(t, node.Status.Allocatable.Cpu().Equal(resource.MustParse("4")))
+	assert.Assert(t, node.Status.Allocatable.Memory().Equal(resource.MustParse("6Gi")))
+	assert.Equal(t, node.Status.NodeInfo.ContainerRuntimeVersion, "koupleless://java-1.2.0")
+	assert.Equal(t, node.Status.Phase, corev1.NodeRunning)
+	for _, condition := range node.Status.Conditions {
+		switch condition.Type {
+		case corev1.NodeReady, corev1.NodeMemoryPressure:
+			assert.Equal(t, condition.Status, corev1.ConditionTrue)
+		default:
+			assert.Equal(t, condition.Status, corev1.ConditionFalse)
+		}
+		assert.Assert(t, condition.LastHeartbeatTime.Time.Equal(heartbeatTime))
+	}
+}
+
+func TestModelUtils_ApplyNodeHeartbeat_Invalid(t *testing.T) {
+	node := &corev1.Node{}
+	err := moduleUtils.ApplyNodeHeartbeat(node, &model.NodeHeartbeat{
+		Capacity: map[corev1.ResourceName]string{corev1.ResourceMemory: "lots"},
+	}, time.Now())
+	assert.Assert(t, errors.Is(err, ErrInvalidNodeHeartbeat))
+
+	err = moduleUtils.ApplyNodeHeartbeat(node, &model.NodeHeartbeat{
+		Pressures: []corev1.NodeConditionType{corev1.NodeReady},
+	}, time.Now())
+	assert.Assert(t, errors.Is(err, ErrInvalidNodeHeartbeat))
+	assert.Assert(t, node.Status.Capacity == nil)
+	assert.Assert(t, node.Status.Conditions == nil)
+}
@@ -0,0 +1,91 @@
+package common
+
+import (
+	"github.com/koupleless/arkctl/v1/service/ark"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// ComputePodStatus translate the biz info of each biz container of pod to container status and aggregate them to pod status,
+// biz infos not related to the pod are ignored
+func (c ModelUtils) ComputePodStatus(pod *corev1.Pod, bizInfos []*ark.ArkBizInfo) corev1.PodStatus {
+	identityToBizInfo := make(map[string]*ark.ArkBizInfo, len(bizInfos))
+	for _, bizInfo := range bizInfos {
+		bizIdentity, err := c.GetBizIdentityFromBizInfoChecked(bizInfo)
+		if err != nil {
+			continue
+		}
+		identityToBizInfo[bizIdentity] = bizInfo
+	}
+	// biz models with unresolved version are still reported, as pending biz
+	bizModels, _ := c.GetBizModelsFromCoreV1Pod(pod)
+	containerStatuses := make([]corev1.ContainerStatus, 0, len(bizModels))
+	for _, bizModel := range bizModels {
+		bizInfo := identityToBizInfo[c.GetBizIdentityFromBizModel(bizModel)]
+		containerStatuses = append(containerStatuses, *c.TranslateArkBizInfoToV1ContainerStatus(bizModel, bizInfo))
+	}
+	return c.AggregatePodStatus(containerStatuses)
+}
+
+// AggregatePodStatus derive pod phase and conditions from the biz container statuses, the pod is Running only if all biz
+// are ready, Failed if any biz terminated, e.g. deactivated or failed to install, and Pending otherwise
+func (c ModelUtils) AggregatePodStatus(containerStatuses []corev1.ContainerStatus) corev1.PodStatus {
+	isAllContainerReady := true
+	isSomeContainerFailed := false
+	for _, status := range containerStatuses {
+		if !status.Ready {
+			isAllContainerReady = false
+		}
+		if status.State.Terminated != nil {
+			isSomeContainerFailed = true
+		}
+	}
+
+	podStatus := corev1.PodStatus{
+		Phase:             corev1.PodPending,
+		ContainerStatuses: containerStatuses,
+	}
+	if isAllContainerReady {
+		podStatus.Phase = corev1.PodRunning
+		podStatus.Conditions = []corev1.PodCondition{
+			{
+				Type:   "module.koupleless.io/installed",
+				Status: corev1.ConditionTrue,
+			},
+			{
+				Type:   "module.koupleless.io/ready",
+				Status: corev1.ConditionTrue,
+			},
+			{
+				Type:   "Ready",
+				Status: corev1.ConditionTrue,
+			},
+			{
+				Type:   "ContainersReady",
+				Status: corev1.ConditionTrue,
+			},
+		}
+	}
+
+	if isSomeContainerFailed {
+		podStatus.Phase = corev1.PodFailed
+		podStatus.Conditions = []corev1.PodCondition{
+			{
+				Type:   "basement.koupleless.io/installed",
+				Status: corev1.ConditionFalse,
+			},
+			{
+				Type:   "basement.koupleless.io/ready",
+				Status: corev1.ConditionFalse,
+			},
+			{
+				Type:   "Ready",
+				Status: corev1.ConditionFalse,
+			},
+			{
+				Type:   "ContainersReady",
+				Status: corev1.ConditionFalse,
+			},
+		}
+	}
+	return podStatus
+}
@@ -0,0 +1,72 @@
+package common
+
+import (
+	"github.com/koupleless/arkctl/v1/service/ark"
+	"gotest.tools/assert"
+	corev1 "k8s.io/api/core/v1"
+	"testing"
+)
+
+var podWithTwoBiz = &corev1.Pod{
+	Spec: corev1.PodSpec{
+		Containers: []corev1.Container{
+			{
+				Name:  "biz1",
+				Image: "file:///test/biz1.jar",
+				Env:   []corev1.EnvVar{{Name: "BIZ_VERSION", Value: "1.0.0"}},
+			},
+			{
+				Name:  "biz2",
+				Image: "file:///test/biz2.jar",
+				Env:   []corev1.EnvVar{{Name: "BIZ_VERSION", Value: "2.0.0"}},
+			},
+		},
+	},
+}
+
+func TestModelUtils_ComputePodStatus_AllRunning(t *testing.T) {
+	status := moduleUtils.ComputePodStatus(podWithTwoBiz, []*ark.ArkBizInfo{
+		{BizName: "biz1", BizVersion: "1.0.0", BizState: "ACTIVATED"},
+		{BizName: "biz2", BizVersion: "2.0.0", BizState: "ACTIVATED"},
+		{BizName: "other", BizVersion: "1.0.0", BizState: "ACTIVATED"},
+	})
+	assert.Equal(t, status.Phase, corev1.PodRunning)
+	assert.Equal(t, len(status.ContainerStatuses), 2)
+	assert.Equal(t, status.ContainerStatuses[0].Name, "biz1")
+	assert.Equal(t, status.ContainerStatuses[1].Name, "biz2")
+	for _, condition := range status.Conditions {
+		assert.Equal(t, condition.Status, corev1.ConditionTrue)
+	}
+}
+
+func TestModelUtils_ComputePodStatus_Partial(t *testing.T) {
+	status := moduleUtils.ComputePodStatus(podWithTwoBiz, []*ark.ArkBizInfo{
+		{BizName: "biz1", BizVersion: "1.0.0", BizState: "ACTIVATED"},
+		{BizName: "biz2", BizVersion: "2.0.0", BizState: "RESOLVED"},
+	})
+	assert.Equal(t, status.Phase, corev1.PodPending)
+	assert.Assert(t, status.ContainerStatuses[0].Ready)
+	assert.Assert(t, !status.ContainerStatuses[1].Ready)
+
+	// not installed yet
+	status = moduleUtils.ComputePodStatus(podWithTwoBiz, nil)
+	assert.Equal(t, status.Phase, corev1.PodPending)
+	assert.Equal(t, status.ContainerStatuses[0].State.Waiting.Reason, "BizPending")
+}
+
+func TestModelUtils_ComputePodStatus_Failed(t *testing.T) {
+	status := moduleUtils.ComputePodStatus(podWithTwoBiz, []*ark.ArkBizInfo{
+		{BizName: "biz1", BizVersion: "1.0.0", BizState: "ACTIVATED"},
+		{BizName: "biz2", BizVersion: "2.0.0", BizState: "BROKEN"},
+	})
+	assert.Equal(t, status.Phase, corev1.PodFailed)
+	for _, condition := range status.Conditions {
+		assert.Equal(t, condition.Status, corev1.ConditionFalse)
+	}
+
+	status = moduleUtils.ComputePodStatus(podWithTwoBiz, []*ark.ArkBizInfo{
+		{BizName: "biz1", BizVersion: "1.0.0", BizState: "RESOLVED"},
+		{BizName: "biz2", BizVersion: "2.0.0", BizState: "DEACTIVATED"},
+	})
+	assert.Equal(t, status.Phase, corev1.PodFailed)
+}
@@ -3,7 +3,12 @@ package common
 import (
 	"context"
 	"fmt"
+	"github.com/koupleless/virtual-kubelet/common/mqtt"
+	"github.com/koupleless/virtual-kubelet/java/model"
 	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"math/rand"
+	"strings"
 	"time"
 )
 
@@ -21,6 +26,35 @@ func TimedTaskWithInterval(ctx context.Context, interval time.Duration, task fun
 	}
 }
 
+// TimedTaskWithJitter runs task immediately and then repeatedly, the next run is scheduled after
+// JitteredInterval(interval, jitterPercent) so the gap between runs never exceeds interval
+func TimedTaskWithJitter(ctx context.Context, interval time.Duration, jitterPercent int, task func(context.Context)) {
+	task(ctx)
+	timer := time.NewTimer(JitteredInterval(interval, jitterPercent))
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+			task(ctx)
+			timer.Reset(JitteredInterval(interval, jitterPercent))
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// JitteredInterval returns a random duration in [interval*(100-jitterPercent)/100, interval],
+// jitterPercent is clamped to [0, 100]. the jitter only shortens the interval, so a task scheduled
+// with it still runs at least once per interval in the worst case
+func JitteredInterval(interval time.Duration, jitterPercent int) time.Duration {
+	jitterPercent = max(0, min(jitterPercent, 100))
+	maxJitter := int64(interval) * int64(jitterPercent) / 100
+	if maxJitter <= 0 {
+		return interval
+	}
+	return interval - time.Duration(rand.Int63n(maxJitter+1))
+}
+
 func ConvertByteNumToResourceQuantity(byteNum int64) resource.Quantity {
 	resourceStr := ""
 	byteNum /= 1024
@@ -31,6 +65,61 @@ func ConvertByteNumToResourceQuantity(byteNum int64) resource.Quantity {
 	return resource.MustParse(resourceStr)
 }
 
-func FormatArkletCommandTopic(deviceID, command string) string {
-	return fmt.Sprintf("koupleless/%s/%s", deviceID, command)
+// FormatArkletCommandTopic returns the command topic of target device, error if deviceID or command is not a valid topic segment
+func FormatArkletCommandTopic(deviceID, command string) (string, error) {
+	return mqtt.DefaultTopicBuilder.NodeCommandTopic(deviceID, command)
+}
+
+// RetryWithBackoff call fn until it succeeds or max attempts exhausted, the backoff between attempts starts from
+// initial backoff and doubles up to max backoff. The last error is returned if all attempts failed, ctx error if canceled.
+func RetryWithBackoff(ctx context.Context, config model.PublishRetryConfig, fn func(context.Context) error) error {
+	maxAttempts := config.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = model.DefaultPublishMaxAttempts
+	}
+	backoff := config.InitialBackoff
+	if backoff <= 0 {
+		backoff = model.DefaultPublishInitialBackoff
+	}
+	maxBackoff := config.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = model.DefaultPublishMaxBackoff
+	}
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = fn(ctx); err == nil {
+			return nil
+		}
+		if attempt >= maxAttempts {
+			return fmt.Errorf("failed after %d attempts: %w", attempt, err)
+		}
+		timer := time.NewTimer(min(backoff, maxBackoff))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+		backoff *= 2
+	}
+}
+
+// ValidateNodeNamePrefix returns error if the prefix is not empty and not a RFC 1123 label
+func ValidateNodeNamePrefix(prefix string) error {
+	if prefix == "" {
+		return nil
+	}
+	if errs := validation.IsDNS1123Label(prefix); len(errs) > 0 {
+		return fmt.Errorf("invalid node name prefix %q: %s", prefix, strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// FormatVirtualNodeName returns the virtual node name of base node id, prefixed by prefix if set
+func FormatVirtualNodeName(prefix, nodeID string) string {
+	if prefix == "" {
+		return nodeID
+	}
+	return prefix + "-" + nodeID
 }
@@ -2,8 +2,12 @@ package common
 
 import (
 	"context"
+	"errors"
+	"github.com/koupleless/virtual-kubelet/common/mqtt"
+	"github.com/koupleless/virtual-kubelet/common/mqtt/mqtttest"
 	"github.com/koupleless/virtual-kubelet/java/model"
 	"gotest.tools/assert"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -43,6 +47,98 @@ func TestConvertByteNumToResourceQuantity(t *testing.T) {
 }
 
 func TestFormatArkletCommandTopic(t *testing.T) {
-	topic := FormatArkletCommandTopic("test", model.CommandHealth)
+	topic, err := FormatArkletCommandTopic("test", model.CommandHealth)
+	assert.NilError(t, err)
 	assert.Assert(t, topic == "koupleless/test/health")
+
+	_, err = FormatArkletCommandTopic("test/+", model.CommandHealth)
+	assert.Assert(t, err != nil)
+}
+
+func TestRetryWithBackoff(t *testing.T) {
+	client := mqtttest.NewFakeClient()
+	client.FailPubs = 2
+	retryConfig := model.PublishRetryConfig{
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     time.Millisecond * 2,
+	}
+	attempts := 0
+	err := RetryWithBackoff(context.Background(), retryConfig, func(ctx context.Context) error {
+		attempts++
+		return client.PubWithRetained(ctx, "test/install", mqtt.Qos1, false, "{}")
+	})
+	assert.NilError(t, err)
+	assert.Equal(t, attempts, 3)
+	assert.Equal(t, len(client.PublishedTo("test/install")), 1)
+}
+
+func TestRetryWithBackoff_Exhausted(t *testing.T) {
+	client := mqtttest.NewFakeClient()
+	client.FailPubs = 3
+	attempts := 0
+	err := RetryWithBackoff(context.Background(), model.PublishRetryConfig{
+		MaxAttempts:    2,
+		InitialBackoff: time.Millisecond,
+	}, func(ctx context.Context) error {
+		attempts++
+		return client.PubWithRetained(ctx, "test/install", mqtt.Qos1, false, "{}")
+	})
+	assert.Assert(t, errors.Is(err, mqtttest.ErrFakePubFailed))
+	assert.Equal(t, attempts, 2)
+	assert.Equal(t, len(client.PublishedTo("test/install")), 0)
+}
+
+func TestRetryWithBackoff_Canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	attempts := 0
+	err := RetryWithBackoff(ctx, model.PublishRetryConfig{
+		MaxAttempts:    5,
+		InitialBackoff: time.Minute,
+	}, func(_ context.Context) error {
+		attempts++
+		cancel()
+		return errors.New("test")
+	})
+	assert.Assert(t, errors.Is(err, context.Canceled))
+	assert.Equal(t, attempts, 1)
+}
+
+func TestValidateNodeNamePrefix(t *testing.T) {
+	assert.NilError(t, ValidateNodeNamePrefix(""))
+	assert.NilError(t, ValidateNodeNamePrefix("env-prod"))
+	assert.Assert(t, ValidateNodeNamePrefix("Env_Prod") != nil)
+	assert.Assert(t, ValidateNodeNamePrefix("-prod") != nil)
+}
+
+func TestFormatVirtualNodeName(t *testing.T) {
+	assert.Equal(t, FormatVirtualNodeName("", "base-1"), "base-1")
+	assert.Equal(t, FormatVirtualNodeName("env-prod", "base-1"), "env-prod-base-1")
+}
+
+func TestJitteredInterval(t *testing.T) {
+	interval := 10 * time.Second
+	for i := 0; i < 1000; i++ {
+		next := JitteredInterval(interval, 20)
+		assert.Assert(t, next >= 8*time.Second, next)
+		assert.Assert(t, next <= interval, next)
+	}
+	assert.Equal(t, JitteredInterval(interval, 0), interval)
+	assert.Equal(t, JitteredInterval(interval, -10), interval)
+	for i := 0; i < 100; i++ {
+		next := JitteredInterval(interval, 200)
+		assert.Assert(t, next >= 0 && next <= interval, next)
+	}
+}
+
+func TestTimedTaskWithJitter(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	count := atomic.Int32{}
+	go TimedTaskWithJitter(ctx, 100*time.Millisecond, 50, func(_ context.Context) {
+		count.Add(1)
+	})
+	time.Sleep(350 * time.Millisecond)
+	// at least once per interval even in the worst case
+	assert.Assert(t, count.Load() >= 4, count.Load())
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	paho "github.com/eclipse/paho.mqtt.golang"
 	"github.com/koupleless/arkctl/v1/service/ark"
 	"github.com/koupleless/virtual-kubelet/common/mqtt"
@@ -11,71 +12,347 @@ import (
 	"github.com/koupleless/virtual-kubelet/java/model"
 	"github.com/koupleless/virtual-kubelet/java/pod/node"
 	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/version"
+	"runtime"
+	"sync"
 	"time"
 )
 
+// ErrDrainTimeout is returned by Err if in-flight message handlers not finished within drain timeout on shutdown
+var ErrDrainTimeout = errors.New("controller drain timeout")
+
+// ErrShutdownTimeout is returned by Err if draining not finished within shutdown timeout, e.g. blocked by a handler
+// or the broker, Done is closed regardless and the draining is left in background
+var ErrShutdownTimeout = errors.New("controller shutdown timeout")
+
 type BaseRegisterController struct {
 	config *model.BuildBaseRegisterControllerConfig
 
-	mqttClient *mqtt.Client
+	mqttClient mqtt.PubSubClient
 	done       chan struct{}
 	ready      chan struct{}
 
-	err error
+	// err is the first error stopping the controller, guarded by errLock as set by the leader election, kube health
+	// and shutdown goroutines
+	errLock sync.Mutex
+	err     error
 
 	localStore *RuntimeInfoStore
+	modelUtils common.ModelUtils
+
+	// router dispatch base messages to the handler of their topic, shared with the client if created from MqttConfig
+	router *mqtt.TopicRouter
+
+	metrics MetricsRecorder
+	clock   Clock
+
+	// kubeHealth retries the kube api requests of nodes and tracks whether the api server is reachable
+	kubeHealth *common.KubeClientHealth
+
+	// protocolWarned is the set of device and protocol version pairs already warned unsupported
+	protocolWarned sync.Map
+
+	// drainLock guards draining and the registration of in-flight handlers
+	drainLock sync.Mutex
+	draining  bool
+	inflight  sync.WaitGroup
 }
 
 func NewBaseRegisterController(config *model.BuildBaseRegisterControllerConfig) (*BaseRegisterController, error) {
-	return &BaseRegisterController{
+	if err := common.ValidateNodeNamePrefix(config.NodeNamePrefix); err != nil {
+		return nil, wrapError(ErrConfigInvalid, err)
+	}
+	if config.DefaultBizVersion != "" {
+		if _, err := version.ParseSemantic(config.DefaultBizVersion); err != nil {
+			return nil, fmt.Errorf("%w: default biz version must be a semantic version: %w", ErrConfigInvalid, err)
+		}
+	}
+	if config.MaxConcurrentBizOps < 0 {
+		return nil, fmt.Errorf("%w: max concurrent biz ops must not be negative, got %d", ErrConfigInvalid, config.MaxConcurrentBizOps)
+	}
+	if config.HeartbeatJitterPercent < 0 || config.HeartbeatJitterPercent > 100 {
+		return nil, fmt.Errorf("%w: heartbeat jitter percent must be in [0, 100], got %d", ErrConfigInvalid, config.HeartbeatJitterPercent)
+	}
+	if err := validateNodeLease(config); err != nil {
+		return nil, err
+	}
+	if err := validateQos(config); err != nil {
+		return nil, err
+	}
+	router := mqtt.NewTopicRouter(nil)
+	if config.MqttConfig != nil && config.MqttConfig.Router != nil {
+		router = config.MqttConfig.Router
+	}
+	brc := &BaseRegisterController{
 		config:     config,
 		done:       make(chan struct{}),
 		ready:      make(chan struct{}),
 		localStore: NewRuntimeInfoStore(),
-	}, nil
+		modelUtils: common.ModelUtils{},
+		router:     router,
+		clock:      realClock{},
+		kubeHealth: common.NewKubeClientHealth(config.KubeRetry),
+	}
+	if err := brc.registerRoutes(); err != nil {
+		return nil, wrapError(ErrConfigInvalid, err)
+	}
+	return brc, nil
 }
 
+// Run subscribe base messages and start registering nodes, if leader election enabled it blocks until
+// the controller becomes the leader or ctx done, and the controller stops once leadership lost
 func (brc *BaseRegisterController) Run(ctx context.Context) {
-	mqttClient, err := mqtt.NewMqttClient(brc.config.MqttConfig)
-	if err != nil {
-		brc.err = err
-		close(brc.done)
-		return
+	if brc.config.LeaderElection {
+		leaderCtx, err := brc.acquireLeadership(ctx)
+		if err != nil {
+			brc.setErr(err)
+			close(brc.done)
+			return
+		}
+		ctx = leaderCtx
 	}
+
+	mqttClient := brc.config.MqttClient
 	if mqttClient == nil {
-		brc.err = errors.New("mqtt client is nil")
+		mqttConfig := brc.config.MqttConfig
+		if mqttConfig != nil && mqttConfig.Router == nil {
+			// messages redelivered before subscribed are routed as the subscribed ones
+			withRouter := *mqttConfig
+			withRouter.Router = brc.router
+			mqttConfig = &withRouter
+		}
+		client, err := mqtt.NewMqttClient(mqttConfig)
+		if err != nil {
+			brc.setErr(WrapMqttClientError(err))
+			close(brc.done)
+			return
+		}
+		if client == nil {
+			brc.setErr(fmt.Errorf("%w: mqtt client is nil", ErrMqttConnect))
+			close(brc.done)
+			return
+		}
+		mqttClient = client
+	}
+	brc.mqttClient = mqttClient
+
+	err := brc.mqttClient.SubMultiple(map[string]byte{
+		BaseHeartBeatTopic: brc.qosHeartbeat(),
+		BaseHealthTopic:    brc.qosHeartbeat(),
+		BaseBizTopic:       brc.qosCommand(),
+		BaseStatusTopic:    brc.qosStatus(),
+	}, brc.router.HandleMessage)
+	if err != nil {
+		// release the broker connection as the controller never runs, whether the client is injected or created
+		brc.mqttClient.Disconnect(250)
+		brc.setErr(wrapError(ErrMqttConnect, err))
 		close(brc.done)
 		return
 	}
-	brc.mqttClient = mqttClient
 
-	brc.mqttClient.Sub(BaseHeartBeatTopic, 1, brc.heartBeatMsgCallback)
-	brc.mqttClient.Sub(BaseHealthTopic, 1, brc.healthMsgCallback)
-	brc.mqttClient.Sub(BaseBizTopic, 1, brc.bizMsgCallback)
+	close(brc.ready)
+
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-brc.kubeHealth.Failed():
+			// api server unreachable after retries, stop instead of running nodes never synced to kube
+			logrus.Errorf("kube client failed after retries: %v", brc.kubeHealth.Err())
+			brc.setErr(wrapError(ErrKubeClient, brc.kubeHealth.Err()))
+			cancel()
+		}
+	}()
 
 	go common.TimedTaskWithInterval(ctx, time.Second*2, brc.checkAndDeleteOfflineBase)
+
+	if brc.config.BizPollInterval > 0 {
+		go common.TimedTaskWithInterval(ctx, brc.config.BizPollInterval, brc.pollBizInfos)
+	}
+
+	go func() {
+		<-ctx.Done()
+		cancel()
+		brc.shutdown()
+		close(brc.done)
+	}()
+}
+
+// shutdown drain the controller within shutdown timeout, the goroutines are dumped to find the stuck ones
+// if draining not finished in time
+func (brc *BaseRegisterController) shutdown() {
+	shutdownTimeout := brc.config.ShutdownTimeout
+	if shutdownTimeout <= 0 {
+		shutdownTimeout = model.DefaultShutdownTimeout
+	}
+	drained := make(chan error, 1)
+	go func() {
+		drained <- brc.drain()
+	}()
+	select {
+	case err := <-drained:
+		if err != nil {
+			brc.setErr(err)
+		}
+	case <-brc.clock.After(shutdownTimeout):
+		stack := make([]byte, 1<<20)
+		stack = stack[:runtime.Stack(stack, true)]
+		logrus.Errorf("controller not shut down in %s, goroutines:\n%s", shutdownTimeout, stack)
+		brc.setErr(ErrShutdownTimeout)
+	}
+}
+
+// drain stop accepting base messages, wait for in-flight handlers within drain timeout and then release the broker
+// connection. ErrDrainTimeout is returned if in-flight handlers not finished in time
+func (brc *BaseRegisterController) drain() error {
+	brc.drainLock.Lock()
+	brc.draining = true
+	brc.drainLock.Unlock()
+	if err := brc.mqttClient.UnSubMultipleE(BaseHeartBeatTopic, BaseHealthTopic, BaseBizTopic, BaseStatusTopic); err != nil {
+		logrus.Warnf("Error unsubscribing base topics: %v", err)
+	}
+
+	drainTimeout := brc.config.DrainTimeout
+	if drainTimeout == 0 {
+		drainTimeout = model.DefaultDrainTimeout
+	}
+	var drainErr error
+	finished := make(chan struct{})
+	go func() {
+		brc.inflight.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-brc.clock.After(drainTimeout):
+		logrus.Warnf("in-flight message handlers not finished in %s", drainTimeout)
+		drainErr = ErrDrainTimeout
+	}
+
+	// node status is left to the bases, the status topic is their last will, an offline status published on their
+	// behalf would make the new leader tear down live nodes during a rolling restart. just release the connection
+	brc.mqttClient.Disconnect(250)
+	return drainErr
+}
+
+// beginHandle register an in-flight handler, return false if draining
+func (brc *BaseRegisterController) beginHandle() bool {
+	brc.drainLock.Lock()
+	defer brc.drainLock.Unlock()
+	if brc.draining {
+		return false
+	}
+	brc.inflight.Add(1)
+	return true
 }
 
 func (brc *BaseRegisterController) checkAndDeleteOfflineBase(_ context.Context) {
-	offlineDevices := brc.localStore.GetOfflineDevices(1000 * 10)
+	heartbeatTimeout := brc.config.HeartbeatTimeout
+	if heartbeatTimeout == 0 {
+		heartbeatTimeout = model.DefaultHeartbeatTimeout
+	}
+	gracePeriod := brc.config.OfflineGracePeriod
+	if gracePeriod == 0 {
+		gracePeriod = model.DefaultOfflineGracePeriod
+	}
+	offlineDevices := brc.localStore.GetOfflineDevices(heartbeatTimeout.Milliseconds())
 	for _, deviceID := range offlineDevices {
-		kouplelessNode := brc.localStore.GetKouplelessNode(deviceID)
-		if kouplelessNode == nil {
+		offlineTime, newlyOffline := brc.localStore.MarkDeviceOffline(deviceID)
+		if newlyOffline {
+			if kouplelessNode := brc.localStore.GetKouplelessNode(deviceID); kouplelessNode != nil {
+				// stop scheduling and fail the pods while the node still exists, torn down after the grace period
+				kouplelessNode.MarkOffline()
+				logrus.Infof("base heartbeat timeout, koupleless node NotReady: %s", deviceID)
+			}
+		}
+		if brc.clock.Now().UnixMilli()-offlineTime < gracePeriod.Milliseconds() {
 			continue
 		}
-		close(kouplelessNode.BaseBizExitChan)
-		brc.localStore.DeleteKouplelessNode(deviceID)
+		if brc.shutdownNode(deviceID) {
+			logrus.Infof("base offline for %s, koupleless node shutdown: %s", gracePeriod, deviceID)
+		}
 	}
 }
 
+// shutdownNode tear down the virtual node of device, return false if not exist
+func (brc *BaseRegisterController) shutdownNode(deviceID string) bool {
+	kouplelessNode := brc.localStore.PopKouplelessNode(deviceID)
+	if kouplelessNode == nil {
+		return false
+	}
+	close(kouplelessNode.BaseBizExitChan)
+	// published asynchronously as teardown may be triggered from a message handler
+	go brc.clearRetainedNodeTopics(deviceID)
+	return true
+}
+
+// clearRetainedNodeTopics remove the messages of removed node retained on broker, which would otherwise be replayed
+// to future controllers, e.g. a stale heartbeat recreating the node
+func (brc *BaseRegisterController) clearRetainedNodeTopics(deviceID string) {
+	if brc.mqttClient == nil {
+		return
+	}
+	nodeClient, err := brc.nodeMqttClient(deviceID)
+	if err != nil {
+		return
+	}
+	for _, topicType := range []string{mqtt.TopicTypeHeartBeat, mqtt.TopicTypeHealth, mqtt.TopicTypeBiz, mqtt.TopicTypeStatus} {
+		topic, err := mqtt.DefaultTopicBuilder.NodeBaseTopic(deviceID, topicType)
+		if err != nil {
+			continue
+		}
+		if brc.config.DryRun {
+			logrus.Infof("dry run, skip clearing retained message of %s", topic)
+			continue
+		}
+		if err = nodeClient.ClearRetained(topic); err != nil {
+			logrus.Errorf("Error clearing retained message of %s: %v", topic, err)
+		}
+	}
+}
+
+// nodeMqttClient returns the mqtt client restricted to the topics of device, all publishes and subscriptions
+// on behalf of a node go through it so that they stay in the topic subtree the broker ACL grants to the node
+func (brc *BaseRegisterController) nodeMqttClient(deviceID string) (*mqtt.NodeScopedClient, error) {
+	return mqtt.NewNodeScopedClient(brc.mqttClient, mqtt.DefaultTopicBuilder, deviceID)
+}
+
+// NodeCount returns the count of virtual nodes managed by controller
+func (brc *BaseRegisterController) NodeCount() int {
+	return brc.localStore.KouplelessNodeCount()
+}
+
+// Ready returns a channel closed once the controller connected to mqtt and subscribed base topics
+func (brc *BaseRegisterController) Ready() <-chan struct{} {
+	return brc.ready
+}
+
+// KubeDegraded returns true while kube api requests of nodes are being retried for the api server unreachable
+func (brc *BaseRegisterController) KubeDegraded() bool {
+	return brc.kubeHealth.Degraded()
+}
+
 func (brc *BaseRegisterController) Done() chan struct{} {
 	return brc.done
 }
 
+// Err returns the first error stopping the controller, nil if stopped by ctx
 func (brc *BaseRegisterController) Err() error {
+	brc.errLock.Lock()
+	defer brc.errLock.Unlock()
 	return brc.err
 }
 
+// setErr record err stopping the controller unless an earlier one recorded, so that the cause, e.g. ErrKubeClient or
+// ErrLeadershipLost, is not overwritten by the shutdown errors following it
+func (brc *BaseRegisterController) setErr(err error) {
+	brc.errLock.Lock()
+	defer brc.errLock.Unlock()
+	if brc.err == nil {
+		brc.err = err
+	}
+}
+
 func (brc *BaseRegisterController) startVirtualKubelet(deviceID string, initData HeartBeatData) {
 	// first apply for local lock
 	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), "deviceID", deviceID))
@@ -84,15 +361,52 @@ func (brc *BaseRegisterController) startVirtualKubelet(deviceID string, initData
 		initData.NetworkInfo.LocalIP = "127.0.0.1"
 	}
 
+	if brc.localStore.GetKouplelessNode(deviceID) != nil {
+		// already started by an earlier heartbeat, skip building a node only to drop it
+		return
+	}
+
+	nodeClient, err := brc.nodeMqttClient(deviceID)
+	if err != nil {
+		logrus.Errorf("Error creating mqtt client of node %s: %v", deviceID, err)
+		return
+	}
+
 	// TODO apply for lock in future, to support sharding, after getting lock, create node
 	kn, err := node.NewKouplelessNode(&model.BuildKouplelessNodeConfig{
 		KubeConfigPath: brc.config.KubeConfigPath,
-		MqttClient:     brc.mqttClient,
+		InCluster:      brc.config.InCluster,
+		MqttClient:     nodeClient,
 		NodeID:         deviceID,
 		NodeIP:         initData.NetworkInfo.LocalIP,
+		NodeName:       common.FormatVirtualNodeName(brc.config.NodeNamePrefix, deviceID),
 		TechStack:      "java",
 		BizName:        initData.MasterBizInfo.BizName,
 		BizVersion:     initData.MasterBizInfo.BizVersion,
+		PublishRetry:   brc.config.PublishRetry,
+		DryRun:         brc.config.DryRun,
+
+		DefaultBizVersion: brc.config.DefaultBizVersion,
+
+		WrapKubeTransport: brc.kubeHealth.WrapTransport,
+
+		HeartbeatInterval:      brc.config.HeartbeatInterval,
+		HeartbeatJitterPercent: brc.config.HeartbeatJitterPercent,
+		HeartbeatTimeout:       brc.config.HeartbeatTimeout,
+
+		NodeLeaseDuration:      brc.config.NodeLeaseDuration,
+		NodeLeaseRenewInterval: brc.config.NodeLeaseRenewInterval,
+
+		QosHeartbeat: brc.qosHeartbeat(),
+		QosCommand:   brc.qosCommand(),
+
+		CommandTimeout:      brc.config.CommandTimeout,
+		MaxConcurrentBizOps: brc.config.MaxConcurrentBizOps,
+		RejectBizDowngrade:  brc.config.RejectBizDowngrade,
+
+		KubeletPort: brc.config.KubeletPort,
+
+		MetricsRecorder: brc.metrics,
 	})
 	if err != nil {
 		logrus.Errorf("Error creating Koleless node: %v", err)
@@ -101,7 +415,8 @@ func (brc *BaseRegisterController) startVirtualKubelet(deviceID string, initData
 
 	err = brc.localStore.PutKouplelessNodeNX(deviceID, kn)
 	if err != nil {
-		// already exist, return
+		// already exist, started concurrently by another heartbeat, release the node never run
+		kn.Shutdown()
 		return
 	}
 
@@ -126,6 +441,46 @@ func (brc *BaseRegisterController) startVirtualKubelet(deviceID string, initData
 	}
 }
 
+// registerRoutes route the base messages of each topic to its handler
+func (brc *BaseRegisterController) registerRoutes() error {
+	for filter, handler := range map[string]paho.MessageHandler{
+		BaseHeartBeatTopic: brc.heartBeatMsgCallback,
+		BaseHealthTopic:    brc.healthMsgCallback,
+		BaseBizTopic:       brc.bizMsgCallback,
+		BaseStatusTopic:    brc.statusMsgCallback,
+	} {
+		if err := brc.router.Handle(filter, brc.trackInflight(ignoreEmptyPayload(handler))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ignoreEmptyPayload wraps handler to drop the empty messages clearing retained ones, e.g. by clearRetainedNodeTopics,
+// which carry no base message to decode
+func ignoreEmptyPayload(handler paho.MessageHandler) paho.MessageHandler {
+	return func(client paho.Client, msg paho.Message) {
+		if len(msg.Payload()) == 0 {
+			msg.Ack()
+			return
+		}
+		handler(client, msg)
+	}
+}
+
+// trackInflight wraps handler so that draining waits for it, messages arriving once draining are acked unhandled
+func (brc *BaseRegisterController) trackInflight(handler paho.MessageHandler) paho.MessageHandler {
+	return func(client paho.Client, msg paho.Message) {
+		if !brc.beginHandle() {
+			// draining, stop accepting new messages
+			msg.Ack()
+			return
+		}
+		defer brc.inflight.Done()
+		handler(client, msg)
+	}
+}
+
 func (brc *BaseRegisterController) heartBeatMsgCallback(_ paho.Client, msg paho.Message) {
 	defer msg.Ack()
 	deviceID := getDeviceIDFromTopic(msg.Topic())
@@ -134,21 +489,48 @@ func (brc *BaseRegisterController) heartBeatMsgCallback(_ paho.Client, msg paho.
 	}
 	// check local storage
 	vNode := brc.localStore.GetKouplelessNode(deviceID)
+	if vNode != nil {
+		// only started device set latest msg time
+		brc.localStore.DeviceMsgArrived(deviceID)
+	}
+	var heartBeatMsg ArkMqttMsg[HeartBeatData]
+	err := json.Unmarshal(msg.Payload(), &heartBeatMsg)
+	if err != nil {
+		logrus.Errorf("Error unmarshalling heart beat data: %v", err)
+		return
+	}
+	if !brc.supportsProtocolVersion(deviceID, heartBeatMsg.Version) {
+		return
+	}
+	if expired(brc.clock.Now(), heartBeatMsg.PublishTimestamp, 1000*10) {
+		return
+	}
 	if vNode == nil {
 		// not started
-		var heartBeatMsg ArkMqttMsg[HeartBeatData]
-		err := json.Unmarshal(msg.Payload(), &heartBeatMsg)
-		if err != nil {
-			logrus.Errorf("Error unmarshalling heart beat data: %v", err)
+		go brc.startVirtualKubelet(deviceID, heartBeatMsg.Data)
+		return
+	}
+	if heartBeatMsg.Data.Node != nil {
+		sendLatest(vNode.BaseHeartbeatChan, *heartBeatMsg.Data.Node)
+	}
+}
+
+// sendLatest send v on ch without blocking, dropping the oldest queued value if ch is full as only the latest state of
+// base matters, so that a stalled node doesn't block the message handlers shared by all bases
+func sendLatest[T any](ch chan T, v T) {
+	if ch == nil {
+		return
+	}
+	for {
+		select {
+		case ch <- v:
 			return
+		default:
 		}
-		if expired(heartBeatMsg.PublishTimestamp, 1000*10) {
-			return
+		select {
+		case <-ch:
+		default:
 		}
-		go brc.startVirtualKubelet(deviceID, heartBeatMsg.Data)
-	} else {
-		// only started device set latest msg time
-		brc.localStore.DeviceMsgArrived(deviceID)
 	}
 }
 
@@ -164,7 +546,10 @@ func (brc *BaseRegisterController) healthMsgCallback(_ paho.Client, msg paho.Mes
 		logrus.Errorf("Error unmarshalling health response: %v", err)
 		return
 	}
-	if expired(data.PublishTimestamp, 1000*10) {
+	if !brc.supportsProtocolVersion(deviceID, data.Version) {
+		return
+	}
+	if expired(brc.clock.Now(), data.PublishTimestamp, 1000*10) {
 		return
 	}
 	if data.Data.Code != "SUCCESS" {
@@ -176,7 +561,7 @@ func (brc *BaseRegisterController) healthMsgCallback(_ paho.Client, msg paho.Mes
 	}
 	brc.localStore.DeviceMsgArrived(deviceID)
 
-	kouplelessNode.BaseHealthInfoChan <- data.Data.Data.HealthData
+	sendLatest(kouplelessNode.BaseHealthInfoChan, data.Data.Data.HealthData)
 }
 
 func (brc *BaseRegisterController) bizMsgCallback(_ paho.Client, msg paho.Message) {
@@ -185,22 +570,80 @@ func (brc *BaseRegisterController) bizMsgCallback(_ paho.Client, msg paho.Messag
 	if deviceID == "" {
 		return
 	}
-	var data ArkMqttMsg[ark.QueryAllArkBizResponse]
-	err := json.Unmarshal(msg.Payload(), &data)
-	if err != nil {
-		logrus.Errorf("Error unmarshalling biz response: %v", err)
+	bizInfos, err := brc.decodeBizMsg(deviceID, msg.Payload())
+	if errors.Is(err, errBizMsgIgnored) {
 		return
 	}
-	if expired(data.PublishTimestamp, 1000*10) {
+	if err != nil {
+		logrus.Errorf("Error decoding biz response of %s: %v", deviceID, err)
 		return
 	}
+	if brc.localStore.GetKouplelessNode(deviceID) != nil {
+		brc.localStore.DeviceBizPushed(deviceID)
+	}
+	brc.applyBizInfos(deviceID, bizInfos)
+}
+
+// errBizMsgIgnored is returned by decodeBizMsg for expired, failed or unsupported protocol version biz responses
+var errBizMsgIgnored = errors.New("biz response ignored")
+
+// decodeBizMsg decode the biz info list of biz response
+func (brc *BaseRegisterController) decodeBizMsg(deviceID string, payload []byte) ([]*ark.ArkBizInfo, error) {
+	// biz info list is decoded by common.ParseBizInfoList, which owns the wire schema
+	var data ArkMqttMsg[ark.GenericArkResponseBase[json.RawMessage]]
+	if err := json.Unmarshal(payload, &data); err != nil {
+		return nil, err
+	}
+	if !brc.supportsProtocolVersion(deviceID, data.Version) {
+		return nil, errBizMsgIgnored
+	}
+	if expired(brc.clock.Now(), data.PublishTimestamp, 1000*10) {
+		return nil, errBizMsgIgnored
+	}
 	if data.Data.Code != "SUCCESS" {
-		return
+		return nil, errBizMsgIgnored
 	}
+	return common.ParseBizInfoList(data.Data.Data)
+}
+
+// applyBizInfos sync the biz info list reported by device to the node
+func (brc *BaseRegisterController) applyBizInfos(deviceID string, bizInfos []*ark.ArkBizInfo) {
 	kouplelessNode := brc.localStore.GetKouplelessNode(deviceID)
 	if kouplelessNode == nil {
 		return
 	}
 	brc.localStore.DeviceMsgArrived(deviceID)
-	kouplelessNode.BaseBizInfoChan <- data.Data.Data
+	bizInfoList := make([]ark.ArkBizInfo, 0, len(bizInfos))
+	for _, bizInfo := range bizInfos {
+		bizInfoList = append(bizInfoList, *bizInfo)
+	}
+	brc.localStore.PutDeviceBizInfos(deviceID, bizInfoList)
+	sendLatest(kouplelessNode.BaseBizInfoChan, bizInfoList)
+}
+
+// statusMsgCallback tear down the virtual node once the base goes offline, e.g. by its last will message
+func (brc *BaseRegisterController) statusMsgCallback(_ paho.Client, msg paho.Message) {
+	defer msg.Ack()
+	deviceID := getDeviceIDFromTopic(msg.Topic())
+	if deviceID == "" {
+		return
+	}
+	var data ArkMqttMsg[NodeStatusData]
+	err := json.Unmarshal(msg.Payload(), &data)
+	if err != nil {
+		logrus.Errorf("Error unmarshalling status data: %v", err)
+		return
+	}
+	if !brc.supportsProtocolVersion(deviceID, data.Version) {
+		return
+	}
+	if data.Data.Status != NodeStatusOffline {
+		if brc.localStore.GetKouplelessNode(deviceID) != nil {
+			brc.localStore.DeviceMsgArrived(deviceID)
+		}
+		return
+	}
+	if brc.shutdownNode(deviceID) {
+		logrus.Infof("base offline, koupleless node shutdown: %s", deviceID)
+	}
 }
@@ -0,0 +1,435 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/koupleless/virtual-kubelet/common/mqtt"
+	"github.com/koupleless/virtual-kubelet/common/mqtt/mqtttest"
+	"github.com/koupleless/virtual-kubelet/java/model"
+	"github.com/koupleless/virtual-kubelet/java/pod/node"
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	"gotest.tools/assert"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func runTestController(t *testing.T, client *mqtttest.FakeClient) (*BaseRegisterController, context.CancelFunc) {
+	brc, err := NewBaseRegisterController(&model.BuildBaseRegisterControllerConfig{
+		MqttClient: client,
+	})
+	assert.NilError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	brc.Run(ctx)
+	<-brc.Ready()
+	return brc, cancel
+}
+
+func TestBaseRegisterController_RunWithFakeClient(t *testing.T) {
+	client := mqtttest.NewFakeClient()
+	brc, err := NewBaseRegisterController(&model.BuildBaseRegisterControllerConfig{
+		MqttClient: client,
+	})
+	assert.NilError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	brc.Run(ctx)
+	assert.NilError(t, brc.Err())
+	<-brc.Ready()
+	assert.Assert(t, client.Subscribed(BaseHeartBeatTopic))
+	assert.Assert(t, client.Subscribed(BaseHealthTopic))
+	assert.Assert(t, client.Subscribed(BaseBizTopic))
+	assert.Assert(t, client.Subscribed(BaseStatusTopic))
+
+	// expired heart beat should not start a node
+	assert.Equal(t, client.Deliver("koupleless/test-device/base/heart", []byte(`{"publishTimestamp":0}`)), 1)
+	assert.Assert(t, brc.localStore.GetKouplelessNode("test-device") == nil)
+
+	cancel()
+	<-brc.Done()
+	assert.NilError(t, brc.Err())
+	assert.Assert(t, client.Disconnected())
+	assert.Assert(t, !client.Subscribed(BaseHeartBeatTopic))
+}
+
+func TestBaseRegisterController_ShutdownKeepsNodeStatus(t *testing.T) {
+	client := mqtttest.NewFakeClient()
+	brc, err := NewBaseRegisterController(&model.BuildBaseRegisterControllerConfig{
+		MqttClient: client,
+	})
+	assert.NilError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	brc.Run(ctx)
+	<-brc.Ready()
+	brc.localStore.PutKouplelessNode("test-device", &node.KouplelessNode{BaseBizExitChan: make(chan struct{})})
+
+	// a leader stepping down must not report live bases offline, the new leader would tear their nodes down
+	cancel()
+	<-brc.Done()
+	assert.Equal(t, len(client.PublishedTo("koupleless/test-device/base/status")), 0)
+	assert.Assert(t, client.Disconnected())
+}
+
+func TestBaseRegisterController_DrainTimeout(t *testing.T) {
+	client := mqtttest.NewFakeClient()
+	brc, err := NewBaseRegisterController(&model.BuildBaseRegisterControllerConfig{
+		MqttClient:   client,
+		DrainTimeout: 50 * time.Millisecond,
+	})
+	assert.NilError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	brc.Run(ctx)
+	<-brc.Ready()
+
+	// simulate a handler never finishes
+	assert.Assert(t, brc.beginHandle())
+	cancel()
+	<-brc.Done()
+	assert.Equal(t, brc.Err(), ErrDrainTimeout)
+	assert.Assert(t, !brc.beginHandle())
+	assert.Assert(t, client.Disconnected())
+}
+
+func TestBaseRegisterController_ShutdownTimeout(t *testing.T) {
+	client := mqtttest.NewFakeClient()
+	brc, err := NewBaseRegisterController(&model.BuildBaseRegisterControllerConfig{
+		MqttClient:      client,
+		DrainTimeout:    time.Minute,
+		ShutdownTimeout: 100 * time.Millisecond,
+	})
+	assert.NilError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	brc.Run(ctx)
+	<-brc.Ready()
+
+	// simulate a handler blocked longer than the drain timeout
+	assert.Assert(t, brc.beginHandle())
+	defer brc.inflight.Done()
+	cancel()
+	select {
+	case <-brc.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("controller not shut down within shutdown timeout")
+	}
+	assert.Equal(t, brc.Err(), ErrShutdownTimeout)
+}
+
+func TestBaseRegisterController_RunSubscribeFailed(t *testing.T) {
+	client := mqtttest.NewFakeClient()
+	client.SubErr = context.DeadlineExceeded
+	brc, err := NewBaseRegisterController(&model.BuildBaseRegisterControllerConfig{
+		MqttClient: client,
+	})
+	assert.NilError(t, err)
+	brc.Run(context.Background())
+	<-brc.Done()
+	assert.Assert(t, errors.Is(brc.Err(), ErrMqttConnect))
+	assert.Assert(t, errors.Is(brc.Err(), context.DeadlineExceeded))
+	assert.Assert(t, client.Disconnected())
+	select {
+	case <-brc.Ready():
+		t.Fatal("controller should not be ready if subscription failed")
+	default:
+	}
+}
+
+func TestBaseRegisterController_RunLeaderElectionFailed(t *testing.T) {
+	client := mqtttest.NewFakeClient()
+	brc, err := NewBaseRegisterController(&model.BuildBaseRegisterControllerConfig{
+		MqttClient:     client,
+		KubeConfigPath: "/not/exist/kubeconfig",
+		LeaderElection: true,
+	})
+	assert.NilError(t, err)
+	brc.Run(context.Background())
+	<-brc.Done()
+	assert.Assert(t, errors.Is(brc.Err(), ErrKubeClient))
+	// non leader should never subscribe base messages
+	assert.Assert(t, !client.Subscribed(BaseHeartBeatTopic))
+}
+
+// flakyTransport is a transport failing the first failures requests and responding ok afterwards
+type flakyTransport struct {
+	failures atomic.Int32
+}
+
+func (t *flakyTransport) RoundTrip(_ *http.Request) (*http.Response, error) {
+	if t.failures.Add(-1) >= 0 {
+		return nil, errors.New("connection refused")
+	}
+	return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+}
+
+func TestBaseRegisterController_KubeClientRecover(t *testing.T) {
+	client := mqtttest.NewFakeClient()
+	brc, err := NewBaseRegisterController(&model.BuildBaseRegisterControllerConfig{
+		MqttClient: client,
+		KubeRetry:  model.PublishRetryConfig{MaxAttempts: 3, InitialBackoff: 10 * time.Millisecond},
+	})
+	assert.NilError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	brc.Run(ctx)
+	<-brc.Ready()
+
+	transport := &flakyTransport{}
+	transport.failures.Store(2)
+	_, err = brc.kubeHealth.WrapTransport(transport).RoundTrip(httptest.NewRequest(http.MethodGet, "/api/v1/nodes", nil))
+	assert.NilError(t, err)
+	assert.Assert(t, !brc.KubeDegraded())
+
+	select {
+	case <-brc.Done():
+		t.Fatal("controller stopped after kube client recovered")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestBaseRegisterController_KubeClientExhausted(t *testing.T) {
+	client := mqtttest.NewFakeClient()
+	brc, err := NewBaseRegisterController(&model.BuildBaseRegisterControllerConfig{
+		MqttClient: client,
+		KubeRetry:  model.PublishRetryConfig{MaxAttempts: 2, InitialBackoff: 10 * time.Millisecond},
+	})
+	assert.NilError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	brc.Run(ctx)
+	<-brc.Ready()
+
+	transport := &flakyTransport{}
+	transport.failures.Store(2)
+	_, err = brc.kubeHealth.WrapTransport(transport).RoundTrip(httptest.NewRequest(http.MethodGet, "/api/v1/nodes", nil))
+	assert.Assert(t, err != nil)
+	assert.Assert(t, brc.KubeDegraded())
+
+	select {
+	case <-brc.Done():
+	case <-time.After(time.Second):
+		t.Fatal("controller not stopped after kube retries exhausted")
+	}
+	assert.Assert(t, errors.Is(brc.Err(), ErrKubeClient))
+}
+
+func TestNewBaseRegisterController_InvalidNodeNamePrefix(t *testing.T) {
+	_, err := NewBaseRegisterController(&model.BuildBaseRegisterControllerConfig{
+		NodeNamePrefix: "Invalid_Prefix",
+	})
+	assert.Assert(t, errors.Is(err, ErrConfigInvalid))
+}
+
+func TestNewBaseRegisterController_InvalidDefaultBizVersion(t *testing.T) {
+	_, err := NewBaseRegisterController(&model.BuildBaseRegisterControllerConfig{
+		DefaultBizVersion: "snapshot",
+	})
+	assert.Assert(t, errors.Is(err, ErrConfigInvalid))
+}
+
+func TestNewBaseRegisterController_InvalidHeartbeatJitterPercent(t *testing.T) {
+	_, err := NewBaseRegisterController(&model.BuildBaseRegisterControllerConfig{
+		HeartbeatJitterPercent: 101,
+	})
+	assert.Assert(t, errors.Is(err, ErrConfigInvalid))
+}
+
+func TestNewBaseRegisterController_InvalidQos(t *testing.T) {
+	_, err := NewBaseRegisterController(&model.BuildBaseRegisterControllerConfig{
+		QosCommand: 3,
+	})
+	assert.Assert(t, errors.Is(err, ErrConfigInvalid))
+}
+
+func TestBaseRegisterController_StatusOffline(t *testing.T) {
+	client := mqtttest.NewFakeClient()
+	brc, err := NewBaseRegisterController(&model.BuildBaseRegisterControllerConfig{
+		MqttClient: client,
+	})
+	assert.NilError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	brc.Run(ctx)
+	<-brc.Ready()
+
+	kouplelessNode := &node.KouplelessNode{BaseBizExitChan: make(chan struct{})}
+	brc.localStore.PutKouplelessNode("test-device", kouplelessNode)
+	brc.localStore.PutKouplelessNode("test-device-2", &node.KouplelessNode{BaseBizExitChan: make(chan struct{})})
+	assert.Equal(t, brc.NodeCount(), 2)
+
+	client.Deliver("koupleless/test-device/base/status", []byte(`{"data":{"status":"online"}}`))
+	assert.Equal(t, brc.NodeCount(), 2)
+
+	client.Deliver("koupleless/test-device/base/status", []byte(`{"data":{"status":"offline"}}`))
+	assert.Equal(t, brc.NodeCount(), 1)
+	<-kouplelessNode.BaseBizExitChan
+
+	// duplicated offline message should be ignored
+	client.Deliver("koupleless/test-device/base/status", []byte(`{"data":{"status":"offline"}}`))
+	assert.Equal(t, brc.NodeCount(), 1)
+}
+
+func TestBaseRegisterController_HeartbeatTimeout(t *testing.T) {
+	brc, err := NewBaseRegisterController(&model.BuildBaseRegisterControllerConfig{
+		MqttClient:       mqtttest.NewFakeClient(),
+		HeartbeatTimeout: time.Minute,
+	})
+	assert.NilError(t, err)
+	kouplelessNode := &node.KouplelessNode{BaseBizExitChan: make(chan struct{})}
+	brc.localStore.PutKouplelessNode("test-device", kouplelessNode)
+
+	// heartbeat within timeout
+	brc.localStore.deviceLatestMsgTime["test-device"] = time.Now().Add(-30 * time.Second).UnixMilli()
+	brc.checkAndDeleteOfflineBase(context.Background())
+	assert.Equal(t, brc.NodeCount(), 1)
+
+	// missed heartbeat, node kept NotReady in the grace period
+	brc.localStore.deviceLatestMsgTime["test-device"] = time.Now().Add(-2 * time.Minute).UnixMilli()
+	brc.checkAndDeleteOfflineBase(context.Background())
+	assert.Equal(t, brc.NodeCount(), 1)
+
+	// grace period passed
+	brc.localStore.deviceOfflineTime["test-device"] = time.Now().Add(-time.Hour).UnixMilli()
+	brc.checkAndDeleteOfflineBase(context.Background())
+	assert.Equal(t, brc.NodeCount(), 0)
+	<-kouplelessNode.BaseBizExitChan
+}
+
+func TestBaseRegisterController_ClearRetainedOnTeardown(t *testing.T) {
+	client := mqtttest.NewFakeClient()
+	brc, err := NewBaseRegisterController(&model.BuildBaseRegisterControllerConfig{
+		MqttClient: client,
+	})
+	assert.NilError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	brc.Run(ctx)
+	<-brc.Ready()
+
+	brc.localStore.PutKouplelessNode("test-device", &node.KouplelessNode{BaseBizExitChan: make(chan struct{})})
+	brc.localStore.deviceLatestMsgTime["test-device"] = time.Now().Add(-time.Hour).UnixMilli()
+	brc.localStore.deviceOfflineTime["test-device"] = time.Now().Add(-time.Hour).UnixMilli()
+	brc.checkAndDeleteOfflineBase(context.Background())
+	assert.Equal(t, brc.NodeCount(), 0)
+
+	for _, topic := range []string{
+		"koupleless/test-device/base/heart",
+		"koupleless/test-device/base/health",
+		"koupleless/test-device/base/biz",
+		"koupleless/test-device/base/status",
+	} {
+		deadline := time.Now().Add(5 * time.Second)
+		for len(client.PublishedTo(topic)) == 0 && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		published := client.PublishedTo(topic)
+		assert.Equal(t, len(published), 1, topic)
+		assert.Assert(t, published[0].Retained)
+		assert.Equal(t, len(published[0].Payload), 0)
+	}
+
+	// the clearing messages delivered back are dropped silently
+	hook := logtest.NewGlobal()
+	defer hook.Reset()
+	for _, topic := range []string{
+		"koupleless/test-device/base/heart",
+		"koupleless/test-device/base/health",
+		"koupleless/test-device/base/biz",
+		"koupleless/test-device/base/status",
+	} {
+		assert.Equal(t, client.Deliver(topic, []byte{}), 1)
+	}
+	for _, entry := range hook.AllEntries() {
+		assert.Assert(t, entry.Level > logrus.WarnLevel, entry.Message)
+	}
+	assert.Assert(t, brc.localStore.GetKouplelessNode("test-device") == nil)
+}
+
+func TestBaseRegisterController_NodeMqttClient(t *testing.T) {
+	client := mqtttest.NewFakeClient()
+	brc, cancel := runTestController(t, client)
+	defer cancel()
+
+	nodeClient, err := brc.nodeMqttClient("test-device")
+	assert.NilError(t, err)
+	assert.NilError(t, nodeClient.PubWithRetained(context.Background(), "koupleless/test-device/health", mqtt.Qos1, false, "{}"))
+	err = nodeClient.PubWithRetained(context.Background(), "koupleless/test-device-2/health", mqtt.Qos1, false, "{}")
+	assert.Assert(t, errors.Is(err, mqtt.ErrTopicNotPermitted))
+	assert.Equal(t, len(client.PublishedTo("koupleless/test-device/health")), 1)
+	assert.Equal(t, len(client.PublishedTo("koupleless/test-device-2/health")), 0)
+
+	_, err = brc.nodeMqttClient("test/device")
+	assert.Assert(t, err != nil)
+}
+
+func TestBaseRegisterController_NodeHeartbeat(t *testing.T) {
+	client := mqtttest.NewFakeClient()
+	brc, err := NewBaseRegisterController(&model.BuildBaseRegisterControllerConfig{
+		MqttClient: client,
+	})
+	assert.NilError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	brc.Run(ctx)
+	<-brc.Ready()
+
+	kouplelessNode := &node.KouplelessNode{BaseHeartbeatChan: make(chan model.NodeHeartbeat, 1)}
+	brc.localStore.PutKouplelessNode("test-device", kouplelessNode)
+
+	// heartbeat without node metadata only refreshes the latest message time
+	client.Deliver("koupleless/test-device/base/heart", []byte(fmt.Sprintf(`{"publishTimestamp":%d,"data":{}}`, time.Now().UnixMilli())))
+	assert.Equal(t, len(kouplelessNode.BaseHeartbeatChan), 0)
+
+	client.Deliver("koupleless/test-device/base/heart", []byte(fmt.Sprintf(`{"publishTimestamp":%d,"data":{"node":{"version":"1.2.0","capacity":{"memory":"8Gi"}}}}`, time.Now().UnixMilli())))
+	heartbeat := <-kouplelessNode.BaseHeartbeatChan
+	assert.Equal(t, heartbeat.Version, "1.2.0")
+	assert.Equal(t, heartbeat.Capacity[corev1.ResourceMemory], "8Gi")
+
+	// node not consuming, the oldest heartbeat is dropped instead of blocking the handler
+	for _, version := range []string{"1.2.1", "1.2.2"} {
+		client.Deliver("koupleless/test-device/base/heart", []byte(fmt.Sprintf(`{"publishTimestamp":%d,"data":{"node":{"version":"%s"}}}`, time.Now().UnixMilli(), version)))
+	}
+	assert.Equal(t, len(kouplelessNode.BaseHeartbeatChan), 1)
+	heartbeat = <-kouplelessNode.BaseHeartbeatChan
+	assert.Equal(t, heartbeat.Version, "1.2.2")
+}
+
+func TestNewBaseRegisterController_InvalidNodeLease(t *testing.T) {
+	for _, config := range []*model.BuildBaseRegisterControllerConfig{
+		{NodeLeaseDuration: -time.Second},
+		{NodeLeaseDuration: 1500 * time.Millisecond},
+		{NodeLeaseRenewInterval: -time.Second},
+		{NodeLeaseRenewInterval: model.DefaultNodeLeaseDuration},
+		{NodeLeaseDuration: 10 * time.Second, NodeLeaseRenewInterval: 10 * time.Second},
+	} {
+		_, err := NewBaseRegisterController(config)
+		assert.Assert(t, errors.Is(err, ErrConfigInvalid))
+	}
+	_, err := NewBaseRegisterController(&model.BuildBaseRegisterControllerConfig{
+		NodeLeaseDuration:      10 * time.Second,
+		NodeLeaseRenewInterval: 2 * time.Second,
+	})
+	assert.NilError(t, err)
+}
+
+func TestNewBaseRegisterController_InvalidMaxConcurrentBizOps(t *testing.T) {
+	_, err := NewBaseRegisterController(&model.BuildBaseRegisterControllerConfig{
+		MaxConcurrentBizOps: -1,
+	})
+	assert.Assert(t, errors.Is(err, ErrConfigInvalid))
+}
+
+func TestBaseRegisterController_SetErr(t *testing.T) {
+	brc, err := NewBaseRegisterController(&model.BuildBaseRegisterControllerConfig{})
+	assert.NilError(t, err)
+	assert.NilError(t, brc.Err())
+
+	// the cause stopping the controller is kept over the shutdown errors following it
+	brc.setErr(wrapError(ErrKubeClient, context.DeadlineExceeded))
+	brc.setErr(ErrShutdownTimeout)
+	assert.Assert(t, errors.Is(brc.Err(), ErrKubeClient))
+	assert.Assert(t, !errors.Is(brc.Err(), ErrShutdownTimeout))
+}
@@ -0,0 +1,30 @@
+package controller
+
+import (
+	"time"
+)
+
+// Clock provides the time for heartbeat timeouts, drain timeout and message timestamps,
+// so that tests can inject a fake one and advance time deterministically
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+// realClock is the Clock of wall time
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// SetClock set the clock of controller and its runtime info store, the real clock if not set,
+// it should be set before Run
+func (brc *BaseRegisterController) SetClock(clock Clock) {
+	brc.clock = clock
+	brc.localStore.setClock(clock)
+}
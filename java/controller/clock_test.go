@@ -0,0 +1,131 @@
+package controller
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/koupleless/virtual-kubelet/common/mqtt/mqtttest"
+	"github.com/koupleless/virtual-kubelet/java/model"
+	"github.com/koupleless/virtual-kubelet/java/pod/node"
+	"gotest.tools/assert"
+)
+
+type fakeClockWaiter struct {
+	deadline time.Time
+	ch       chan time.Time
+}
+
+// fakeClock is a Clock only advanced by Advance, firing the After channels whose deadline reached
+type fakeClock struct {
+	sync.Mutex
+	now     time.Time
+	waiters []fakeClockWaiter
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.Lock()
+	defer c.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.Lock()
+	defer c.Unlock()
+	ch := make(chan time.Time, 1)
+	c.waiters = append(c.waiters, fakeClockWaiter{deadline: c.now.Add(d), ch: ch})
+	return ch
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.Lock()
+	defer c.Unlock()
+	c.now = c.now.Add(d)
+	waiters := make([]fakeClockWaiter, 0, len(c.waiters))
+	for _, waiter := range c.waiters {
+		if waiter.deadline.After(c.now) {
+			waiters = append(waiters, waiter)
+			continue
+		}
+		waiter.ch <- c.now
+	}
+	c.waiters = waiters
+}
+
+// waitWaiters wait until n After channels pending
+func (c *fakeClock) waitWaiters(t *testing.T, n int) {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		c.Lock()
+		pending := len(c.waiters)
+		c.Unlock()
+		if pending >= n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("%d pending After expected", n)
+}
+
+func TestBaseRegisterController_HeartbeatTimeoutWithClock(t *testing.T) {
+	brc, err := NewBaseRegisterController(&model.BuildBaseRegisterControllerConfig{
+		MqttClient:         mqtttest.NewFakeClient(),
+		HeartbeatTimeout:   time.Minute,
+		OfflineGracePeriod: 30 * time.Second,
+	})
+	assert.NilError(t, err)
+	clock := newFakeClock()
+	brc.SetClock(clock)
+	brc.localStore.PutKouplelessNode("test-device", &node.KouplelessNode{BaseBizExitChan: make(chan struct{})})
+	brc.localStore.DeviceMsgArrived("test-device")
+
+	clock.Advance(59 * time.Second)
+	brc.checkAndDeleteOfflineBase(context.Background())
+	assert.Equal(t, brc.NodeCount(), 1)
+
+	// NotReady in the grace period
+	clock.Advance(2 * time.Second)
+	brc.checkAndDeleteOfflineBase(context.Background())
+	assert.Equal(t, brc.NodeCount(), 1)
+
+	// base back in the grace period
+	clock.Advance(20 * time.Second)
+	brc.localStore.DeviceMsgArrived("test-device")
+	brc.checkAndDeleteOfflineBase(context.Background())
+	assert.Equal(t, brc.NodeCount(), 1)
+
+	clock.Advance(61 * time.Second)
+	brc.checkAndDeleteOfflineBase(context.Background())
+	assert.Equal(t, brc.NodeCount(), 1)
+
+	clock.Advance(30 * time.Second)
+	brc.checkAndDeleteOfflineBase(context.Background())
+	assert.Equal(t, brc.NodeCount(), 0)
+}
+
+func TestBaseRegisterController_DrainTimeoutWithClock(t *testing.T) {
+	client := mqtttest.NewFakeClient()
+	brc, err := NewBaseRegisterController(&model.BuildBaseRegisterControllerConfig{
+		MqttClient:   client,
+		DrainTimeout: time.Hour,
+	})
+	assert.NilError(t, err)
+	clock := newFakeClock()
+	brc.SetClock(clock)
+	ctx, cancel := context.WithCancel(context.Background())
+	brc.Run(ctx)
+	<-brc.Ready()
+
+	// simulate a handler never finishes
+	assert.Assert(t, brc.beginHandle())
+	cancel()
+	clock.waitWaiters(t, 1)
+	clock.Advance(time.Hour)
+	<-brc.Done()
+	assert.Equal(t, brc.Err(), ErrDrainTimeout)
+}
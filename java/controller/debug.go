@@ -0,0 +1,57 @@
+package controller
+
+import (
+	"github.com/koupleless/arkctl/v1/service/ark"
+	"github.com/koupleless/virtual-kubelet/java/common"
+	"sort"
+	"time"
+)
+
+// NodeDebugInfo is what controller believes about a base node, dumped for debugging
+type NodeDebugInfo struct {
+	NodeID string `json:"nodeID"`
+	// LastMessageTime is the arrival time of the latest base message, nil if none arrived
+	LastMessageTime *time.Time `json:"lastMessageTime,omitempty"`
+	// DesiredBiz is the biz models of pods scheduled to the node
+	DesiredBiz []*ark.BizModel `json:"desiredBiz"`
+	// ReportedBiz is the latest biz info list reported by base
+	ReportedBiz []ark.ArkBizInfo `json:"reportedBiz"`
+	// PendingCommands is the biz commands waiting for base confirmation
+	PendingCommands []PendingCommand `json:"pendingCommands"`
+}
+
+// PendingCommand is a biz command waiting for base confirmation
+type PendingCommand = common.PendingBizCommand
+
+// DumpNodes returns the debug info of all managed nodes sorted by node id
+func (brc *BaseRegisterController) DumpNodes() []NodeDebugInfo {
+	deviceIDs := brc.localStore.GetDeviceIDs()
+	sort.Strings(deviceIDs)
+	ret := make([]NodeDebugInfo, 0, len(deviceIDs))
+	for _, deviceID := range deviceIDs {
+		info := NodeDebugInfo{
+			NodeID:          deviceID,
+			DesiredBiz:      make([]*ark.BizModel, 0),
+			ReportedBiz:     brc.localStore.GetDeviceBizInfos(deviceID),
+			PendingCommands: make([]PendingCommand, 0),
+		}
+		if kouplelessNode := brc.localStore.GetKouplelessNode(deviceID); kouplelessNode != nil {
+			if desired := kouplelessNode.DesiredBizModels(); desired != nil {
+				info.DesiredBiz = desired
+			}
+			// commands of pods are published by the node provider
+			if pending := kouplelessNode.PendingBizCommands(); pending != nil {
+				info.PendingCommands = pending
+			}
+		}
+		if info.ReportedBiz == nil {
+			info.ReportedBiz = make([]ark.ArkBizInfo, 0)
+		}
+		if msgTime := brc.localStore.GetDeviceLatestMsgTime(deviceID); msgTime > 0 {
+			lastMessageTime := time.UnixMilli(msgTime)
+			info.LastMessageTime = &lastMessageTime
+		}
+		ret = append(ret, info)
+	}
+	return ret
+}
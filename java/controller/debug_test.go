@@ -0,0 +1,32 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/koupleless/arkctl/v1/service/ark"
+	"github.com/koupleless/virtual-kubelet/java/model"
+	"github.com/koupleless/virtual-kubelet/java/pod/node"
+	"gotest.tools/assert"
+)
+
+func TestBaseRegisterController_DumpNodes(t *testing.T) {
+	brc, err := NewBaseRegisterController(&model.BuildBaseRegisterControllerConfig{})
+	assert.NilError(t, err)
+	brc.localStore.PutKouplelessNode("test-device-2", &node.KouplelessNode{})
+	brc.localStore.PutKouplelessNode("test-device-1", &node.KouplelessNode{})
+	brc.localStore.DeviceMsgArrived("test-device-1")
+	brc.localStore.PutDeviceBizInfos("test-device-1", []ark.ArkBizInfo{
+		{BizName: "biz1", BizVersion: "0.0.1", BizState: "ACTIVATED"},
+	})
+
+	nodes := brc.DumpNodes()
+	assert.Equal(t, len(nodes), 2)
+	assert.Equal(t, nodes[0].NodeID, "test-device-1")
+	assert.Assert(t, nodes[0].LastMessageTime != nil)
+	assert.Equal(t, len(nodes[0].ReportedBiz), 1)
+	assert.DeepEqual(t, nodes[0].PendingCommands, []PendingCommand{})
+	assert.Equal(t, nodes[1].NodeID, "test-device-2")
+	assert.Assert(t, nodes[1].LastMessageTime == nil)
+	assert.Equal(t, len(nodes[1].ReportedBiz), 0)
+	assert.Equal(t, len(nodes[1].DesiredBiz), 0)
+}
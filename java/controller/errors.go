@@ -0,0 +1,33 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"github.com/koupleless/virtual-kubelet/common/mqtt"
+)
+
+var (
+	// ErrConfigInvalid is wrapped by the errors of invalid controller or mqtt client config
+	ErrConfigInvalid = errors.New("controller config invalid")
+
+	// ErrMqttConnect is wrapped by the errors of connecting mqtt broker or subscribing base topics
+	ErrMqttConnect = errors.New("controller mqtt connect failed")
+
+	// ErrKubeClient is wrapped by the errors of creating or using the kube client
+	ErrKubeClient = errors.New("controller kube client failed")
+)
+
+// wrapError wrap err with kind, keeping err available to errors.Is and errors.As
+func wrapError(kind error, err error) error {
+	return fmt.Errorf("%w: %w", kind, err)
+}
+
+// WrapMqttClientError wrap the error of creating mqtt client, ErrConfigInvalid for invalid client config or tls material,
+// ErrMqttConnect otherwise
+func WrapMqttClientError(err error) error {
+	var tlsErr *mqtt.TLSConfigError
+	if errors.Is(err, mqtt.ErrInvalidClientConfig) || errors.As(err, &tlsErr) {
+		return wrapError(ErrConfigInvalid, err)
+	}
+	return wrapError(ErrMqttConnect, err)
+}
@@ -0,0 +1,63 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/koupleless/virtual-kubelet/common/mqtt"
+	"github.com/koupleless/virtual-kubelet/java/model"
+	"gotest.tools/assert"
+)
+
+func runWithMqttConfig(t *testing.T, config *mqtt.ClientConfig) error {
+	brc, err := NewBaseRegisterController(&model.BuildBaseRegisterControllerConfig{
+		MqttConfig: config,
+	})
+	assert.NilError(t, err)
+	brc.Run(context.Background())
+	<-brc.Done()
+	return brc.Err()
+}
+
+func TestBaseRegisterController_RunMqttConfigInvalid(t *testing.T) {
+	err := runWithMqttConfig(t, &mqtt.ClientConfig{
+		Port:     1883,
+		ClientID: "test-client",
+	})
+	assert.Assert(t, errors.Is(err, ErrConfigInvalid))
+	assert.Assert(t, errors.Is(err, mqtt.ErrInvalidClientConfig))
+	assert.Assert(t, !errors.Is(err, ErrMqttConnect))
+
+	err = runWithMqttConfig(t, &mqtt.ClientConfig{
+		Broker:   "127.0.0.1",
+		Port:     8883,
+		ClientID: "test-client",
+		CAPath:   "/not/exist/ca.crt",
+	})
+	var tlsErr *mqtt.TLSConfigError
+	assert.Assert(t, errors.Is(err, ErrConfigInvalid))
+	assert.Assert(t, errors.As(err, &tlsErr))
+}
+
+func TestBaseRegisterController_RunMqttUnreachable(t *testing.T) {
+	err := runWithMqttConfig(t, &mqtt.ClientConfig{
+		Broker:         "127.0.0.1",
+		Port:           1,
+		ClientID:       "test-client",
+		ConnectTimeout: time.Second,
+	})
+	assert.Assert(t, errors.Is(err, ErrMqttConnect))
+	assert.Assert(t, !errors.Is(err, ErrConfigInvalid))
+}
+
+func TestWrapMqttClientError(t *testing.T) {
+	err := WrapMqttClientError(mqtt.ErrInvalidClientConfig)
+	assert.Assert(t, errors.Is(err, ErrConfigInvalid))
+	assert.Assert(t, errors.Is(err, mqtt.ErrInvalidClientConfig))
+
+	err = WrapMqttClientError(context.DeadlineExceeded)
+	assert.Assert(t, errors.Is(err, ErrMqttConnect))
+	assert.Assert(t, errors.Is(err, context.DeadlineExceeded))
+}
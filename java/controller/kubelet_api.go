@@ -0,0 +1,28 @@
+package controller
+
+import (
+	"context"
+	"io"
+	"net/http"
+
+	"github.com/virtual-kubelet/virtual-kubelet/errdefs"
+	"github.com/virtual-kubelet/virtual-kubelet/node/api"
+)
+
+// KubeletHandler serves the kubelet api of the virtual nodes, which share it as the nodes of one controller report
+// the same kubelet port, only container logs are supported, the others respond not implemented
+func (brc *BaseRegisterController) KubeletHandler() http.Handler {
+	return api.PodHandler(api.PodHandlerConfig{
+		GetContainerLogs: brc.getContainerLogs,
+	}, false)
+}
+
+// getContainerLogs fetch the container logs from the base of the node running the pod
+func (brc *BaseRegisterController) getContainerLogs(ctx context.Context, namespace, podName, containerName string, opts api.ContainerLogOpts) (io.ReadCloser, error) {
+	for _, kouplelessNode := range brc.localStore.GetKouplelessNodes() {
+		if kouplelessNode.HasPod(namespace, podName) {
+			return kouplelessNode.GetContainerLogs(ctx, namespace, podName, containerName, opts)
+		}
+	}
+	return nil, errdefs.NotFoundf("pod %s/%s not found on nodes", namespace, podName)
+}
@@ -0,0 +1,28 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/koupleless/virtual-kubelet/java/model"
+	"github.com/koupleless/virtual-kubelet/java/pod/node"
+	"gotest.tools/assert"
+)
+
+func TestBaseRegisterController_KubeletHandler(t *testing.T) {
+	brc, err := NewBaseRegisterController(&model.BuildBaseRegisterControllerConfig{})
+	assert.NilError(t, err)
+	brc.localStore.PutKouplelessNode("test-device", &node.KouplelessNode{})
+	handler := brc.KubeletHandler()
+	statusCode := func(method, path string) int {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(method, path, nil))
+		return recorder.Code
+	}
+
+	// pod not on nodes of controller
+	assert.Equal(t, statusCode(http.MethodGet, "/containerLogs/default/test-pod/biz1"), http.StatusNotFound)
+	assert.Equal(t, statusCode(http.MethodGet, "/containerLogs/default/test-pod/biz1?tailLines=-1"), http.StatusBadRequest)
+	assert.Equal(t, statusCode(http.MethodPost, "/exec/default/test-pod/biz1"), http.StatusNotImplemented)
+}
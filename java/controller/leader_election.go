@@ -0,0 +1,100 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"os"
+	"time"
+
+	"github.com/koupleless/virtual-kubelet/java/common"
+	"github.com/koupleless/virtual-kubelet/java/model"
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+// ErrLeadershipLost is returned by Err if the controller stopped because another instance took over the lease
+var ErrLeadershipLost = errors.New("controller leadership lost")
+
+const (
+	leaseDuration = 15 * time.Second
+	renewDeadline = 10 * time.Second
+	retryPeriod   = 2 * time.Second
+)
+
+// acquireLeadership block until the controller becomes the leader or ctx done,
+// the returned context is canceled once leadership lost
+func (brc *BaseRegisterController) acquireLeadership(ctx context.Context) (context.Context, error) {
+	clientSet, err := common.NewKubeClientSet(brc.config.KubeConfigPath, brc.config.InCluster)
+	if err != nil {
+		return nil, wrapError(ErrKubeClient, err)
+	}
+
+	leaseName := brc.config.LeaseName
+	if leaseName == "" {
+		leaseName = model.DefaultLeaseName
+	}
+	leaseNamespace := brc.config.LeaseNamespace
+	if leaseNamespace == "" {
+		leaseNamespace = model.DefaultLeaseNamespace
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+	identity := hostname + "_" + string(uuid.NewUUID())
+
+	leaderCtx, cancel := context.WithCancel(ctx)
+	leading := make(chan struct{})
+	elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock: &resourcelock.LeaseLock{
+			LeaseMeta: metav1.ObjectMeta{
+				Name:      leaseName,
+				Namespace: leaseNamespace,
+			},
+			Client: clientSet.CoordinationV1(),
+			LockConfig: resourcelock.ResourceLockConfig{
+				Identity: identity,
+			},
+		},
+		LeaseDuration:   leaseDuration,
+		RenewDeadline:   renewDeadline,
+		RetryPeriod:     retryPeriod,
+		ReleaseOnCancel: true,
+		Name:            leaseName,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(_ context.Context) {
+				logrus.Infof("leader election won: %s", identity)
+				close(leading)
+			},
+			OnStoppedLeading: func() {
+				if ctx.Err() == nil {
+					logrus.Warnf("leadership lost: %s", identity)
+					brc.setErr(ErrLeadershipLost)
+				}
+				cancel()
+			},
+			OnNewLeader: func(leader string) {
+				if leader != identity {
+					logrus.Infof("standby, current leader: %s", leader)
+				}
+			},
+		},
+	})
+	if err != nil {
+		cancel()
+		return nil, wrapError(ErrConfigInvalid, err)
+	}
+
+	go elector.Run(ctx)
+
+	select {
+	case <-leading:
+		return leaderCtx, nil
+	case <-ctx.Done():
+		cancel()
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,76 @@
+package controller
+
+import (
+	"github.com/koupleless/virtual-kubelet/java/model"
+	"github.com/prometheus/client_golang/prometheus"
+	"time"
+)
+
+// MetricsRecorder is invoked by the providers of controller nodes on biz install and reconcile
+type MetricsRecorder = model.MetricsRecorder
+
+// PrometheusMetricsRecorder is a MetricsRecorder exposing biz install counters, reconcile latency histogram
+// and the count of managed nodes
+type PrometheusMetricsRecorder struct {
+	nodes             prometheus.GaugeFunc
+	bizInstallAttempt prometheus.Counter
+	bizInstalls       *prometheus.CounterVec
+	reconcileDuration prometheus.Histogram
+}
+
+var _ MetricsRecorder = &PrometheusMetricsRecorder{}
+
+// NewPrometheusMetricsRecorder create the recorder and register its collectors to registerer,
+// nodeCount is collected on scrape as the managed node count, e.g. BaseRegisterController.NodeCount
+func NewPrometheusMetricsRecorder(registerer prometheus.Registerer, nodeCount func() int) (*PrometheusMetricsRecorder, error) {
+	recorder := &PrometheusMetricsRecorder{
+		nodes: prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: "module_controller",
+			Name:      "managed_nodes",
+			Help:      "Number of virtual nodes managed by the controller.",
+		}, func() float64 {
+			return float64(nodeCount())
+		}),
+		bizInstallAttempt: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "module_controller",
+			Name:      "biz_install_attempts_total",
+			Help:      "Total number of biz install commands attempted.",
+		}),
+		bizInstalls: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "module_controller",
+			Name:      "biz_installs_total",
+			Help:      "Total number of finished biz install commands.",
+		}, []string{"result"}),
+		reconcileDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: "module_controller",
+			Name:      "reconcile_duration_seconds",
+			Help:      "Latency of diffing the desired and actual biz of a node.",
+			Buckets:   prometheus.DefBuckets,
+		}),
+	}
+	for _, collector := range []prometheus.Collector{recorder.nodes, recorder.bizInstallAttempt, recorder.bizInstalls, recorder.reconcileDuration} {
+		if err := registerer.Register(collector); err != nil {
+			return nil, err
+		}
+	}
+	return recorder, nil
+}
+
+func (r *PrometheusMetricsRecorder) ObserveBizInstall(err error) {
+	r.bizInstallAttempt.Inc()
+	if err != nil {
+		r.bizInstalls.WithLabelValues("failed").Inc()
+		return
+	}
+	r.bizInstalls.WithLabelValues("succeeded").Inc()
+}
+
+func (r *PrometheusMetricsRecorder) ObserveReconcile(duration time.Duration) {
+	r.reconcileDuration.Observe(duration.Seconds())
+}
+
+// SetMetricsRecorder set the recorder observing biz installs and reconciles, noop if not set.
+// should be set before Run, nodes started before keep observing nothing
+func (brc *BaseRegisterController) SetMetricsRecorder(recorder MetricsRecorder) {
+	brc.metrics = recorder
+}
@@ -0,0 +1,41 @@
+package controller
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/koupleless/virtual-kubelet/common/mqtt/mqtttest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"gotest.tools/assert"
+)
+
+func TestPrometheusMetricsRecorder(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	recorder, err := NewPrometheusMetricsRecorder(registry, func() int { return 3 })
+	assert.NilError(t, err)
+	recorder.ObserveBizInstall(nil)
+	recorder.ObserveBizInstall(errors.New("failed"))
+	recorder.ObserveReconcile(time.Millisecond)
+	assert.Equal(t, testutil.ToFloat64(recorder.nodes), float64(3))
+	assert.Equal(t, testutil.ToFloat64(recorder.bizInstallAttempt), float64(2))
+	assert.Equal(t, testutil.ToFloat64(recorder.bizInstalls.WithLabelValues("succeeded")), float64(1))
+	assert.Equal(t, testutil.ToFloat64(recorder.bizInstalls.WithLabelValues("failed")), float64(1))
+	assert.Equal(t, testutil.CollectAndCount(recorder.reconcileDuration), 1)
+
+	_, err = NewPrometheusMetricsRecorder(registry, func() int { return 0 })
+	assert.Assert(t, err != nil)
+}
+
+func TestBaseRegisterController_MetricsRecorder(t *testing.T) {
+	client := mqtttest.NewFakeClient()
+	brc, cancel := runTestController(t, client)
+	defer cancel()
+
+	recorder, err := NewPrometheusMetricsRecorder(prometheus.NewRegistry(), brc.NodeCount)
+	assert.NilError(t, err)
+	brc.SetMetricsRecorder(recorder)
+	assert.Equal(t, brc.metrics, MetricsRecorder(recorder))
+	assert.Equal(t, testutil.ToFloat64(recorder.nodes), float64(0))
+}
@@ -2,12 +2,15 @@ package controller
 
 import (
 	"github.com/koupleless/arkctl/v1/service/ark"
+	"github.com/koupleless/virtual-kubelet/common/mqtt"
+	"github.com/koupleless/virtual-kubelet/java/model"
 )
 
-const (
-	BaseHeartBeatTopic = "koupleless/+/base/heart"
-	BaseHealthTopic    = "koupleless/+/base/health"
-	BaseBizTopic       = "koupleless/+/base/biz"
+var (
+	BaseHeartBeatTopic = mqtt.DefaultTopicBuilder.BaseTopicFilter(mqtt.TopicTypeHeartBeat)
+	BaseHealthTopic    = mqtt.DefaultTopicBuilder.BaseTopicFilter(mqtt.TopicTypeHealth)
+	BaseBizTopic       = mqtt.DefaultTopicBuilder.BaseTopicFilter(mqtt.TopicTypeBiz)
+	BaseStatusTopic    = mqtt.DefaultTopicBuilder.BaseTopicFilter(mqtt.TopicTypeStatus)
 )
 
 // HeartBeatData is the data of base heart beat.
@@ -17,10 +20,34 @@ type HeartBeatData struct {
 		LocalIP       string `json:"localIP"`
 		LocalHostName string `json:"localHostName"`
 	} `json:"networkInfo"`
+	// Node is the optional node metadata updating the virtual node status, nil if base reports none
+	Node *model.NodeHeartbeat `json:"node,omitempty"`
+}
+
+// NodeStatusOffline is published to node status topic by the broker as the last will of base
+const NodeStatusOffline = "offline"
+
+// NodeStatusData is the data of node status message.
+type NodeStatusData struct {
+	Status string `json:"status"`
 }
 
 // ArkMqttMsg is the response of mqtt message payload.
 type ArkMqttMsg[T any] struct {
 	PublishTimestamp int64 `json:"publishTimestamp"`
-	Data             T     `json:"data"`
+	// Version is the protocol version of the message, zero if published by a base before versioning
+	Version int `json:"protocolVersion,omitempty"`
+	Data    T   `json:"data"`
+}
+
+// BizInstallCommand is the biz to install on a base node
+type BizInstallCommand struct {
+	NodeID   string
+	BizModel *ark.BizModel
+}
+
+// BizUnInstallCommand is the biz to uninstall from a base node
+type BizUnInstallCommand struct {
+	NodeID   string
+	BizModel *ark.BizModel
 }
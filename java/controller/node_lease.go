@@ -0,0 +1,23 @@
+package controller
+
+import (
+	"fmt"
+	"github.com/koupleless/virtual-kubelet/java/model"
+	"time"
+)
+
+// validateNodeLease returns ErrConfigInvalid if the node lease duration is not whole seconds or the renew interval
+// not shorter than it
+func validateNodeLease(config *model.BuildBaseRegisterControllerConfig) error {
+	if config.NodeLeaseDuration < 0 || config.NodeLeaseDuration%time.Second != 0 {
+		return fmt.Errorf("%w: node lease duration must be whole seconds, got %s", ErrConfigInvalid, config.NodeLeaseDuration)
+	}
+	leaseDuration := config.NodeLeaseDuration
+	if leaseDuration == 0 {
+		leaseDuration = model.DefaultNodeLeaseDuration
+	}
+	if config.NodeLeaseRenewInterval < 0 || config.NodeLeaseRenewInterval >= leaseDuration {
+		return fmt.Errorf("%w: node lease renew interval must be in [0, %s), got %s", ErrConfigInvalid, leaseDuration, config.NodeLeaseRenewInterval)
+	}
+	return nil
+}
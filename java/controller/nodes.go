@@ -0,0 +1,42 @@
+package controller
+
+import (
+	"sort"
+	"time"
+)
+
+// NodeSummary is the overview of a managed base node, e.g. for listing nodes in management api
+type NodeSummary struct {
+	NodeID string `json:"nodeID"`
+	// Ready is true if the virtual node is Ready
+	Ready bool `json:"ready"`
+	// LastHeartbeat is the arrival time of the latest base message, nil if none arrived
+	LastHeartbeat *time.Time `json:"lastHeartbeat,omitempty"`
+	// InstalledBizCount is the count of biz in the latest biz info list reported by base
+	InstalledBizCount int `json:"installedBizCount"`
+}
+
+// ListNodes returns the summary of all managed nodes sorted by node id, safe to call concurrently with message handling
+func (brc *BaseRegisterController) ListNodes() []NodeSummary {
+	deviceIDs := brc.localStore.GetDeviceIDs()
+	sort.Strings(deviceIDs)
+	ret := make([]NodeSummary, 0, len(deviceIDs))
+	for _, deviceID := range deviceIDs {
+		kouplelessNode := brc.localStore.GetKouplelessNode(deviceID)
+		if kouplelessNode == nil {
+			// shutdown after listed
+			continue
+		}
+		summary := NodeSummary{
+			NodeID:            deviceID,
+			Ready:             kouplelessNode.IsReady(),
+			InstalledBizCount: len(brc.localStore.GetDeviceBizInfos(deviceID)),
+		}
+		if msgTime := brc.localStore.GetDeviceLatestMsgTime(deviceID); msgTime > 0 {
+			lastHeartbeat := time.UnixMilli(msgTime)
+			summary.LastHeartbeat = &lastHeartbeat
+		}
+		ret = append(ret, summary)
+	}
+	return ret
+}
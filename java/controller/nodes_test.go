@@ -0,0 +1,58 @@
+package controller
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/koupleless/arkctl/v1/service/ark"
+	"github.com/koupleless/virtual-kubelet/java/model"
+	"github.com/koupleless/virtual-kubelet/java/pod/node"
+	"gotest.tools/assert"
+)
+
+func TestBaseRegisterController_ListNodes(t *testing.T) {
+	brc, err := NewBaseRegisterController(&model.BuildBaseRegisterControllerConfig{})
+	assert.NilError(t, err)
+	assert.Equal(t, len(brc.ListNodes()), 0)
+
+	brc.localStore.PutKouplelessNode("test-device-2", &node.KouplelessNode{})
+	brc.localStore.PutKouplelessNode("test-device-1", &node.KouplelessNode{})
+	brc.localStore.DeviceMsgArrived("test-device-1")
+	brc.localStore.PutDeviceBizInfos("test-device-1", []ark.ArkBizInfo{
+		{BizName: "biz1", BizVersion: "0.0.1", BizState: "ACTIVATED"},
+		{BizName: "biz2", BizVersion: "0.0.1", BizState: "RESOLVED"},
+	})
+
+	nodes := brc.ListNodes()
+	assert.Equal(t, len(nodes), 2)
+	assert.Equal(t, nodes[0].NodeID, "test-device-1")
+	assert.Assert(t, nodes[0].LastHeartbeat != nil)
+	assert.Equal(t, nodes[0].InstalledBizCount, 2)
+	assert.Assert(t, !nodes[0].Ready)
+	assert.Equal(t, nodes[1].NodeID, "test-device-2")
+	assert.Assert(t, nodes[1].LastHeartbeat == nil)
+	assert.Equal(t, nodes[1].InstalledBizCount, 0)
+}
+
+func TestBaseRegisterController_ListNodesConcurrently(t *testing.T) {
+	brc, err := NewBaseRegisterController(&model.BuildBaseRegisterControllerConfig{})
+	assert.NilError(t, err)
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		deviceID := fmt.Sprintf("test-device-%d", i)
+		go func() {
+			defer wg.Done()
+			brc.localStore.PutKouplelessNode(deviceID, &node.KouplelessNode{})
+			brc.localStore.DeviceMsgArrived(deviceID)
+			brc.localStore.DeleteKouplelessNode(deviceID)
+		}()
+		go func() {
+			defer wg.Done()
+			brc.ListNodes()
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, len(brc.ListNodes()), 0)
+}
@@ -0,0 +1,68 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"github.com/koupleless/virtual-kubelet/java/common"
+	"github.com/koupleless/virtual-kubelet/java/model"
+	"github.com/sirupsen/logrus"
+	"sync"
+	"time"
+)
+
+// pollBizInfos poll the biz list of nodes which pushed no biz status within the poll interval, and wait for all polls finished
+func (brc *BaseRegisterController) pollBizInfos(ctx context.Context) {
+	interval := brc.config.BizPollInterval
+	minPushTime := brc.clock.Now().Add(-interval).UnixMilli()
+	wg := sync.WaitGroup{}
+	for _, deviceID := range brc.localStore.GetDeviceIDs() {
+		if brc.localStore.GetDeviceBizPushTime(deviceID) > minPushTime {
+			continue
+		}
+		wg.Add(1)
+		go func(deviceID string) {
+			defer wg.Done()
+			if err := brc.pollNodeBizInfos(ctx, deviceID, interval); err != nil {
+				logrus.WithField("deviceID", deviceID).WithError(err).Warn("PollBizInfosFailed")
+			}
+		}(deviceID)
+	}
+	wg.Wait()
+}
+
+// pollNodeBizInfos publish the query biz list command to node and wait for the reply applied by the biz topic handler,
+// returns error if not replied in timeout
+func (brc *BaseRegisterController) pollNodeBizInfos(ctx context.Context, deviceID string, timeout time.Duration) error {
+	replied, ok := brc.localStore.StartPolling(deviceID)
+	if !ok {
+		return nil
+	}
+	defer brc.localStore.StopPolling(deviceID)
+
+	commandTopic, err := common.FormatArkletCommandTopic(deviceID, model.CommandQueryAllBiz)
+	if err != nil {
+		return fmt.Errorf("invalid node id %q: %w", deviceID, err)
+	}
+	if brc.config.DryRun {
+		logrus.WithField("topic", commandTopic).Info("DryRunSkipPublish")
+		return nil
+	}
+	nodeClient, err := brc.nodeMqttClient(deviceID)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	if err := nodeClient.PubWithRetained(ctx, commandTopic, brc.qosCommand(), false, "{}"); err != nil {
+		return err
+	}
+
+	// the reply arrives on the biz topic subscribed by controller, stale replies are dropped by the handler
+	select {
+	case <-replied:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
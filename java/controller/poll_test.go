@@ -0,0 +1,66 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/koupleless/arkctl/v1/service/ark"
+	"github.com/koupleless/virtual-kubelet/common/mqtt/mqtttest"
+	"github.com/koupleless/virtual-kubelet/java/model"
+	"github.com/koupleless/virtual-kubelet/java/pod/node"
+	"gotest.tools/assert"
+)
+
+func newPollController(t *testing.T, client *mqtttest.FakeClient) *BaseRegisterController {
+	brc, err := NewBaseRegisterController(&model.BuildBaseRegisterControllerConfig{
+		MqttClient:      client,
+		BizPollInterval: 5 * time.Second,
+	})
+	assert.NilError(t, err)
+	// not running the controller, so that the biz list is only applied by polling, replied on the biz topic
+	brc.mqttClient = client
+	assert.Assert(t, client.Sub(BaseBizTopic, brc.qosCommand(), brc.router.HandleMessage))
+	return brc
+}
+
+func TestBaseRegisterController_PollBizInfos(t *testing.T) {
+	client := mqtttest.NewFakeClient()
+	brc := newPollController(t, client)
+	kouplelessNode := &node.KouplelessNode{BaseBizInfoChan: make(chan []ark.ArkBizInfo, 1)}
+	brc.localStore.PutKouplelessNode("test-device", kouplelessNode)
+
+	go func() {
+		// reply once the query published
+		for len(client.PublishedTo("koupleless/test-device/queryAllBiz")) == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		client.Deliver("koupleless/test-device/base/biz", []byte(fmt.Sprintf(
+			`{"publishTimestamp":%d,"data":{"code":"SUCCESS","data":[{"bizName":"biz1","bizVersion":"0.0.1","bizState":"ACTIVATED"}]}}`,
+			time.Now().UnixMilli())))
+	}()
+	brc.pollBizInfos(context.Background())
+
+	published := client.PublishedTo("koupleless/test-device/queryAllBiz")
+	assert.Equal(t, len(published), 1)
+	assert.Assert(t, !published[0].Retained)
+	bizInfos := <-kouplelessNode.BaseBizInfoChan
+	assert.Equal(t, len(bizInfos), 1)
+	assert.Equal(t, bizInfos[0].BizName, "biz1")
+	assert.Equal(t, len(brc.localStore.GetDeviceBizInfos("test-device")), 1)
+	// the biz topic subscription of controller is kept
+	assert.Assert(t, client.Subscribed(BaseBizTopic))
+	// the polled reply is not treated as pushed
+	assert.Equal(t, brc.localStore.GetDeviceBizPushTime("test-device"), int64(0))
+}
+
+func TestBaseRegisterController_PollBizInfos_SkipPushing(t *testing.T) {
+	client := mqtttest.NewFakeClient()
+	brc := newPollController(t, client)
+	brc.localStore.PutKouplelessNode("test-device", &node.KouplelessNode{BaseBizInfoChan: make(chan []ark.ArkBizInfo, 1)})
+	brc.localStore.DeviceBizPushed("test-device")
+
+	brc.pollBizInfos(context.Background())
+	assert.Equal(t, len(client.PublishedTo("koupleless/test-device/queryAllBiz")), 0)
+}
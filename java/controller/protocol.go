@@ -0,0 +1,27 @@
+package controller
+
+import (
+	"fmt"
+	"github.com/koupleless/virtual-kubelet/java/model"
+	"github.com/sirupsen/logrus"
+)
+
+// supportsProtocolVersion returns true if the message of version from device can be handled. messages without
+// version and of the versions in [model.MinProtocolVersion, model.CurrentProtocolVersion] are decoded by the current
+// schema, which is compatible with them. newer messages are rejected instead of being misread, the first message of
+// each unsupported version of a device is warned
+func (brc *BaseRegisterController) supportsProtocolVersion(deviceID string, version int) bool {
+	if version == 0 || (version >= model.MinProtocolVersion && version <= model.CurrentProtocolVersion) {
+		return true
+	}
+	if _, warned := brc.protocolWarned.LoadOrStore(fmt.Sprintf("%s/%d", deviceID, version), struct{}{}); !warned {
+		if version > model.CurrentProtocolVersion {
+			logrus.Warnf("message of protocol version %d from %s rejected, newer than the supported %d, upgrade the controller",
+				version, deviceID, model.CurrentProtocolVersion)
+		} else {
+			logrus.Warnf("message of protocol version %d from %s rejected, older than the supported %d, upgrade the base",
+				version, deviceID, model.MinProtocolVersion)
+		}
+	}
+	return false
+}
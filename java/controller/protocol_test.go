@@ -0,0 +1,89 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/koupleless/virtual-kubelet/common/mqtt"
+	"github.com/koupleless/virtual-kubelet/common/mqtt/mqtttest"
+	"github.com/koupleless/virtual-kubelet/java/model"
+	"github.com/koupleless/virtual-kubelet/java/pod/node"
+	"gotest.tools/assert"
+)
+
+func TestBaseRegisterController_SupportsProtocolVersion(t *testing.T) {
+	brc := &BaseRegisterController{}
+	assert.Assert(t, brc.supportsProtocolVersion("test-device", 0))
+	assert.Assert(t, brc.supportsProtocolVersion("test-device", model.MinProtocolVersion))
+	assert.Assert(t, brc.supportsProtocolVersion("test-device", model.CurrentProtocolVersion))
+	assert.Assert(t, !brc.supportsProtocolVersion("test-device", model.CurrentProtocolVersion+1))
+	assert.Assert(t, !brc.supportsProtocolVersion("test-device", model.MinProtocolVersion-1))
+
+	// warned once per device and version
+	_, warned := brc.protocolWarned.Load(fmt.Sprintf("test-device/%d", model.CurrentProtocolVersion+1))
+	assert.Assert(t, warned)
+	assert.Assert(t, !brc.supportsProtocolVersion("test-device", model.CurrentProtocolVersion+1))
+}
+
+func runProtocolController(t *testing.T) (*BaseRegisterController, *mqtttest.FakeClient, *node.KouplelessNode) {
+	client := mqtttest.NewFakeClient()
+	brc, err := NewBaseRegisterController(&model.BuildBaseRegisterControllerConfig{
+		MqttClient: client,
+	})
+	assert.NilError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	brc.Run(ctx)
+	<-brc.Ready()
+
+	kouplelessNode := &node.KouplelessNode{BaseBizExitChan: make(chan struct{})}
+	brc.localStore.PutKouplelessNode("test-device", kouplelessNode)
+	return brc, client, kouplelessNode
+}
+
+func TestBaseRegisterController_NewerProtocolVersion(t *testing.T) {
+	brc, client, _ := runProtocolController(t)
+
+	// the offline status of a newer protocol is not trusted
+	client.Deliver("koupleless/test-device/base/status", []byte(fmt.Sprintf(`{"protocolVersion":%d,"data":{"status":"offline"}}`, model.CurrentProtocolVersion+1)))
+	assert.Equal(t, brc.NodeCount(), 1)
+
+	client.Deliver("koupleless/test-device/base/status", []byte(fmt.Sprintf(`{"protocolVersion":%d,"data":{"status":"offline"}}`, model.CurrentProtocolVersion)))
+	assert.Equal(t, brc.NodeCount(), 0)
+}
+
+func TestBaseRegisterController_OlderProtocolVersion(t *testing.T) {
+	brc, client, kouplelessNode := runProtocolController(t)
+
+	// bases before versioning publish no version, handled by the current schema
+	client.Deliver("koupleless/test-device/base/status", []byte(`{"data":{"status":"offline"}}`))
+	assert.Equal(t, brc.NodeCount(), 0)
+	<-kouplelessNode.BaseBizExitChan
+}
+
+func TestBaseRegisterController_Router(t *testing.T) {
+	custom := make([]string, 0)
+	router := mqtt.NewTopicRouter(nil)
+	assert.NilError(t, router.Handle("koupleless/+/base/custom", func(_ paho.Client, msg paho.Message) {
+		custom = append(custom, msg.Topic())
+	}))
+	client := mqtttest.NewFakeClient()
+	brc, err := NewBaseRegisterController(&model.BuildBaseRegisterControllerConfig{
+		MqttClient: client,
+		MqttConfig: &mqtt.ClientConfig{Router: router},
+	})
+	assert.NilError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	brc.Run(ctx)
+	<-brc.Ready()
+	brc.localStore.PutKouplelessNode("test-device", &node.KouplelessNode{BaseBizExitChan: make(chan struct{})})
+
+	// base messages routed by the router supplied by caller, along with its own routes
+	router.HandleMessage(nil, &mqtttest.FakeMessage{TopicName: "koupleless/test-device/base/custom"})
+	assert.DeepEqual(t, custom, []string{"koupleless/test-device/base/custom"})
+	client.Deliver("koupleless/test-device/base/status", []byte(`{"data":{"status":"offline"}}`))
+	assert.Equal(t, brc.NodeCount(), 0)
+}
@@ -0,0 +1,42 @@
+package controller
+
+import (
+	"fmt"
+	"github.com/koupleless/virtual-kubelet/common/mqtt"
+	"github.com/koupleless/virtual-kubelet/java/model"
+)
+
+// validateQos returns ErrConfigInvalid if any qos of message classes is not one of Qos0, Qos1 and Qos2
+func validateQos(config *model.BuildBaseRegisterControllerConfig) error {
+	for name, qos := range map[string]byte{
+		"heartbeat": config.QosHeartbeat,
+		"command":   config.QosCommand,
+		"status":    config.QosStatus,
+	} {
+		if qos > mqtt.Qos2 {
+			return fmt.Errorf("%w: %s qos must be in [0, 2], got %d", ErrConfigInvalid, name, qos)
+		}
+	}
+	return nil
+}
+
+// qosHeartbeat returns the qos of base heartbeat and health messages
+func (brc *BaseRegisterController) qosHeartbeat() byte {
+	return brc.config.QosHeartbeat
+}
+
+// qosCommand returns the qos of biz commands and biz status, model.DefaultQosCommand if not set
+func (brc *BaseRegisterController) qosCommand() byte {
+	if brc.config.QosCommand > 0 {
+		return brc.config.QosCommand
+	}
+	return model.DefaultQosCommand
+}
+
+// qosStatus returns the qos of node online/offline status, model.DefaultQosStatus if not set
+func (brc *BaseRegisterController) qosStatus() byte {
+	if brc.config.QosStatus > 0 {
+		return brc.config.QosStatus
+	}
+	return model.DefaultQosStatus
+}
@@ -16,9 +16,9 @@ package controller
 
 import (
 	"fmt"
+	"github.com/koupleless/arkctl/v1/service/ark"
 	"github.com/koupleless/virtual-kubelet/java/pod/node"
 	"sync"
-	"time"
 )
 
 // RuntimeInfoStore provide the in memory runtime information.
@@ -26,6 +26,11 @@ type RuntimeInfoStore struct {
 	sync.RWMutex
 	deviceIDToKouplelessNode map[string]*node.KouplelessNode
 	deviceLatestMsgTime      map[string]int64
+	deviceLatestBizInfos     map[string][]ark.ArkBizInfo
+	deviceLatestBizPushTime  map[string]int64
+	devicePolling            map[string]chan struct{}
+	deviceOfflineTime        map[string]int64
+	clock                    Clock
 }
 
 func NewRuntimeInfoStore() *RuntimeInfoStore {
@@ -33,9 +38,20 @@ func NewRuntimeInfoStore() *RuntimeInfoStore {
 		RWMutex:                  sync.RWMutex{},
 		deviceIDToKouplelessNode: make(map[string]*node.KouplelessNode),
 		deviceLatestMsgTime:      make(map[string]int64),
+		deviceLatestBizInfos:     make(map[string][]ark.ArkBizInfo),
+		deviceLatestBizPushTime:  make(map[string]int64),
+		devicePolling:            make(map[string]chan struct{}),
+		deviceOfflineTime:        make(map[string]int64),
+		clock:                    realClock{},
 	}
 }
 
+func (r *RuntimeInfoStore) setClock(clock Clock) {
+	r.Lock()
+	defer r.Unlock()
+	r.clock = clock
+}
+
 func (r *RuntimeInfoStore) PutKouplelessNode(deviceID string, k *node.KouplelessNode) {
 	r.Lock()
 	defer r.Unlock()
@@ -61,6 +77,29 @@ func (r *RuntimeInfoStore) DeleteKouplelessNode(deviceID string) {
 
 	delete(r.deviceIDToKouplelessNode, deviceID)
 	delete(r.deviceLatestMsgTime, deviceID)
+	delete(r.deviceLatestBizInfos, deviceID)
+	delete(r.deviceLatestBizPushTime, deviceID)
+	delete(r.deviceOfflineTime, deviceID)
+}
+
+// PopKouplelessNode delete the node of device and return it, nil if not exist
+func (r *RuntimeInfoStore) PopKouplelessNode(deviceID string) *node.KouplelessNode {
+	r.Lock()
+	defer r.Unlock()
+
+	kouplelessNode := r.deviceIDToKouplelessNode[deviceID]
+	delete(r.deviceIDToKouplelessNode, deviceID)
+	delete(r.deviceLatestMsgTime, deviceID)
+	delete(r.deviceLatestBizInfos, deviceID)
+	delete(r.deviceLatestBizPushTime, deviceID)
+	delete(r.deviceOfflineTime, deviceID)
+	return kouplelessNode
+}
+
+func (r *RuntimeInfoStore) KouplelessNodeCount() int {
+	r.RLock()
+	defer r.RUnlock()
+	return len(r.deviceIDToKouplelessNode)
 }
 
 func (r *RuntimeInfoStore) GetKouplelessNode(deviceID string) *node.KouplelessNode {
@@ -79,17 +118,104 @@ func (r *RuntimeInfoStore) GetKouplelessNodes() []*node.KouplelessNode {
 	return ret
 }
 
+func (r *RuntimeInfoStore) GetDeviceIDs() []string {
+	r.RLock()
+	defer r.RUnlock()
+	ret := make([]string, 0, len(r.deviceIDToKouplelessNode))
+	for deviceID := range r.deviceIDToKouplelessNode {
+		ret = append(ret, deviceID)
+	}
+	return ret
+}
+
 func (r *RuntimeInfoStore) DeviceMsgArrived(deviceID string) {
 	r.Lock()
 	defer r.Unlock()
-	r.deviceLatestMsgTime[deviceID] = time.Now().UnixMilli()
+	r.deviceLatestMsgTime[deviceID] = r.clock.Now().UnixMilli()
+	delete(r.deviceOfflineTime, deviceID)
+}
+
+// MarkDeviceOffline record the unix milli time device found offline unless recorded, returns the recorded time and
+// true if newly recorded. the record is removed once a message of device arrives
+func (r *RuntimeInfoStore) MarkDeviceOffline(deviceID string) (int64, bool) {
+	r.Lock()
+	defer r.Unlock()
+	if offlineTime, has := r.deviceOfflineTime[deviceID]; has {
+		return offlineTime, false
+	}
+	offlineTime := r.clock.Now().UnixMilli()
+	r.deviceOfflineTime[deviceID] = offlineTime
+	return offlineTime, true
+}
+
+// GetDeviceLatestMsgTime returns the unix milli time of the latest message of device, 0 if no message arrived
+func (r *RuntimeInfoStore) GetDeviceLatestMsgTime(deviceID string) int64 {
+	r.RLock()
+	defer r.RUnlock()
+	return r.deviceLatestMsgTime[deviceID]
+}
+
+// PutDeviceBizInfos record the latest biz info list reported by device
+func (r *RuntimeInfoStore) PutDeviceBizInfos(deviceID string, bizInfos []ark.ArkBizInfo) {
+	r.Lock()
+	defer r.Unlock()
+	r.deviceLatestBizInfos[deviceID] = bizInfos
+}
+
+// GetDeviceBizInfos returns the latest biz info list reported by device
+func (r *RuntimeInfoStore) GetDeviceBizInfos(deviceID string) []ark.ArkBizInfo {
+	r.RLock()
+	defer r.RUnlock()
+	return r.deviceLatestBizInfos[deviceID]
+}
+
+// DeviceBizPushed record the time of biz info list pushed by device proactively, a biz info list arrived while polling
+// is the reply of the poll, which is notified instead
+func (r *RuntimeInfoStore) DeviceBizPushed(deviceID string) {
+	r.Lock()
+	defer r.Unlock()
+	if replied, polling := r.devicePolling[deviceID]; polling {
+		if replied != nil {
+			close(replied)
+			r.devicePolling[deviceID] = nil
+		}
+		return
+	}
+	r.deviceLatestBizPushTime[deviceID] = r.clock.Now().UnixMilli()
+}
+
+// GetDeviceBizPushTime returns the unix milli time of the latest biz info list pushed by device, 0 if never pushed
+func (r *RuntimeInfoStore) GetDeviceBizPushTime(deviceID string) int64 {
+	r.RLock()
+	defer r.RUnlock()
+	return r.deviceLatestBizPushTime[deviceID]
+}
+
+// StartPolling mark the biz info list of device being polled, returns the channel closed once the biz info list
+// replied, false if already polling
+func (r *RuntimeInfoStore) StartPolling(deviceID string) (<-chan struct{}, bool) {
+	r.Lock()
+	defer r.Unlock()
+	if _, polling := r.devicePolling[deviceID]; polling {
+		return nil, false
+	}
+	replied := make(chan struct{})
+	r.devicePolling[deviceID] = replied
+	return replied, true
+}
+
+// StopPolling unmark the biz info list of device being polled
+func (r *RuntimeInfoStore) StopPolling(deviceID string) {
+	r.Lock()
+	defer r.Unlock()
+	delete(r.devicePolling, deviceID)
 }
 
 func (r *RuntimeInfoStore) GetOfflineDevices(maxUnreachableMilliSec int64) []string {
 	r.Lock()
 	defer r.Unlock()
 	offlineDeviceIDs := make([]string, 0)
-	minMsgTime := time.Now().UnixMilli() - maxUnreachableMilliSec
+	minMsgTime := r.clock.Now().UnixMilli() - maxUnreachableMilliSec
 	for deviceID, latestMsgTime := range r.deviceLatestMsgTime {
 		if latestMsgTime >= minMsgTime {
 			continue
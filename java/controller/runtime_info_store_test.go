@@ -57,9 +57,41 @@ func TestRuntimeInfoStore_GetOfflineDevices(t *testing.T) {
 	assert.Assert(t, len(devices) == 1)
 }
 
+func TestRuntimeInfoStore_MarkDeviceOffline(t *testing.T) {
+	store := NewRuntimeInfoStore()
+	offlineTime, newlyOffline := store.MarkDeviceOffline("test")
+	assert.Assert(t, newlyOffline)
+	marked, newlyOffline := store.MarkDeviceOffline("test")
+	assert.Assert(t, !newlyOffline)
+	assert.Equal(t, marked, offlineTime)
+
+	// base back
+	store.DeviceMsgArrived("test")
+	_, newlyOffline = store.MarkDeviceOffline("test")
+	assert.Assert(t, newlyOffline)
+}
+
 func TestRuntimeInfoStore_PutKouplelessNodeNX(t *testing.T) {
 	store := NewRuntimeInfoStore()
 	store.PutKouplelessNode("test", &node.KouplelessNode{})
 	err := store.PutKouplelessNodeNX("test", &node.KouplelessNode{})
 	assert.Assert(t, err != nil)
 }
+
+func TestRuntimeInfoStore_Polling(t *testing.T) {
+	store := NewRuntimeInfoStore()
+	replied, ok := store.StartPolling("test")
+	assert.Assert(t, ok)
+	_, ok = store.StartPolling("test")
+	assert.Assert(t, !ok)
+
+	// the biz info list arrived while polling is the reply, not a push
+	store.DeviceBizPushed("test")
+	store.DeviceBizPushed("test")
+	<-replied
+	assert.Equal(t, store.GetDeviceBizPushTime("test"), int64(0))
+
+	store.StopPolling("test")
+	store.DeviceBizPushed("test")
+	assert.Assert(t, store.GetDeviceBizPushTime("test") > 0)
+}
@@ -16,6 +16,6 @@ func getDeviceIDFromTopic(topic string) string {
 	return fileds[1]
 }
 
-func expired(publishTimestamp int64, maxLiveMilliSec int64) bool {
-	return publishTimestamp+maxLiveMilliSec <= time.Now().UnixMilli()
+func expired(now time.Time, publishTimestamp int64, maxLiveMilliSec int64) bool {
+	return publishTimestamp+maxLiveMilliSec <= now.UnixMilli()
 }
@@ -22,6 +22,8 @@ func TestGetDeviceID_Valid(t *testing.T) {
 }
 
 func TestExpired(t *testing.T) {
-	assert.Assert(t, expired(0, 1000*10))
-	assert.Assert(t, !expired(time.Now().UnixMilli(), 1000*10))
+	now := time.Now()
+	assert.Assert(t, expired(now, 0, 1000*10))
+	assert.Assert(t, !expired(now, now.UnixMilli(), 1000*10))
+	assert.Assert(t, expired(now.Add(10*time.Second), now.UnixMilli(), 1000*10))
 }
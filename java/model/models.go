@@ -15,16 +15,129 @@
 package model
 
 import (
+	"github.com/koupleless/arkctl/v1/service/ark"
 	"github.com/koupleless/virtual-kubelet/common/mqtt"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"net/http"
+	"time"
 )
 
 const (
-	CommandHealth       = "health"
-	CommandQueryAllBiz  = "queryAllBiz"
-	CommandInstallBiz   = "installBiz"
-	CommandUnInstallBiz = "uninstallBiz"
+	CommandHealth          = "health"
+	CommandQueryAllBiz     = "queryAllBiz"
+	CommandInstallBiz      = "installBiz"
+	CommandInstallBizBatch = "installBizBatch"
+	CommandUnInstallBiz    = "uninstallBiz"
+	CommandQueryBizLog     = "queryBizLog"
 )
 
+const (
+	// DefaultNodeCPUCapacity is large enough not to limit module scheduling by default
+	DefaultNodeCPUCapacity = "100"
+
+	// DefaultNodeMemoryCapacity is large enough not to limit module scheduling by default
+	DefaultNodeMemoryCapacity = "100Gi"
+
+	// DefaultNodePodsCapacity is the max pod count of a virtual node by default
+	DefaultNodePodsCapacity = 2000
+
+	// DefaultHeartbeatTimeout is the default max duration without base messages before the base is treated offline
+	DefaultHeartbeatTimeout = 10 * time.Second
+
+	// DefaultOfflineGracePeriod is the default duration of the virtual node of an offline base kept NotReady before
+	// torn down, longer than the pod status sync interval of virtual kubelet, 5s, so that its pods are failed in time
+	DefaultOfflineGracePeriod = 30 * time.Second
+
+	// DefaultNodeLeaseDuration is the default duration of the virtual node lease, as the kubelet default
+	DefaultNodeLeaseDuration = 40 * time.Second
+
+	// DefaultHeartbeatInterval is the default interval of publishing health commands to base as node heartbeat
+	DefaultHeartbeatInterval = 9 * time.Second
+
+	// DefaultCommandTimeout is the default timeout of waiting for base to confirm a biz command
+	DefaultCommandTimeout = 30 * time.Second
+
+	// DefaultMaxConcurrentBizOps is the default max biz commands of a node waiting for confirmation at the same time
+	DefaultMaxConcurrentBizOps = 4
+
+	// DefaultLogFetchTimeout is the default timeout of waiting for base to reply the biz log lines
+	DefaultLogFetchTimeout = 10 * time.Second
+
+	// DefaultDrainTimeout is the default timeout of waiting for in-flight message handlers on controller shutdown
+	DefaultDrainTimeout = 10 * time.Second
+
+	// DefaultShutdownTimeout is the default upper bound of controller shutdown, covering the drain timeout of
+	// in-flight handlers and of publishing offline status
+	DefaultShutdownTimeout = 30 * time.Second
+
+	// DefaultPublishMaxAttempts is the default max attempts of publishing biz install and uninstall commands
+	DefaultPublishMaxAttempts = 3
+
+	// DefaultPublishInitialBackoff is the default backoff before the first retry of publishing biz commands
+	DefaultPublishInitialBackoff = 200 * time.Millisecond
+
+	// DefaultPublishMaxBackoff is the default upper bound of backoff between retries of publishing biz commands
+	DefaultPublishMaxBackoff = 5 * time.Second
+
+	// DefaultKubeMaxAttempts is the default max attempts of a kube api request failed to reach the api server
+	DefaultKubeMaxAttempts = 6
+
+	// DefaultKubeInitialBackoff is the default backoff before the first retry of a kube api request
+	DefaultKubeInitialBackoff = 500 * time.Millisecond
+
+	// DefaultKubeMaxBackoff is the default upper bound of backoff between retries of a kube api request
+	DefaultKubeMaxBackoff = 10 * time.Second
+
+	// DefaultQosCommand is the default qos of biz commands, Qos1 as many brokers cap the granted qos at 1,
+	// a duplicated command is harmless since the result is confirmed by the biz list reported
+	DefaultQosCommand byte = mqtt.Qos1
+
+	// DefaultQosStatus is the default qos of node online/offline status
+	DefaultQosStatus byte = mqtt.Qos1
+
+	// CurrentProtocolVersion is the protocol version of the mqtt message envelopes published by controller,
+	// messages of a newer version are rejected as their schema may have changed
+	CurrentProtocolVersion = 1
+
+	// MinProtocolVersion is the oldest protocol version of mqtt message envelopes handled by controller,
+	// messages without version are from bases before versioning and handled as MinProtocolVersion
+	MinProtocolVersion = 1
+
+	// DefaultLeaseName is the default name of the lease used by controller leader election
+	DefaultLeaseName = "koupleless-base-register-controller"
+
+	// DefaultLeaseNamespace is the default namespace of the lease used by controller leader election
+	DefaultLeaseNamespace = "default"
+
+	// DefaultNodeTaintKey is the taint key of virtual node, only pods tolerating it are scheduled by default
+	DefaultNodeTaintKey = "schedule.koupleless.io/virtual-node"
+
+	// DefaultNodeTaintValue is the taint value of virtual node
+	DefaultNodeTaintValue = "True"
+
+	// DefaultNodeTaintEffect is the taint effect of virtual node
+	DefaultNodeTaintEffect = corev1.TaintEffectNoExecute
+)
+
+const (
+	// LabelKeyTechStack is the node label of base tech stack
+	LabelKeyTechStack = "koupleless.io/tech-stack"
+
+	// LabelKeyBizName is the node label of base master biz name
+	LabelKeyBizName = "koupleless.io/biz-name"
+
+	// LabelKeyBizVersion is the node label of base master biz version
+	LabelKeyBizVersion = "koupleless.io/biz-version"
+
+	// LabelKeyNodeIP is the node label of base ip, an ipv6 address is not labeled
+	LabelKeyNodeIP = "koupleless.io/node-ip"
+)
+
+// KubeletVersion is reported as the kubelet version of virtual nodes,
+// set at build time by -ldflags "-X github.com/koupleless/virtual-kubelet/java/model.KubeletVersion=<version>"
+var KubeletVersion = "v1.30.0-koupleless"
+
 type contextKey string
 
 const (
@@ -43,22 +156,160 @@ type BuildVirtualNodeConfig struct {
 
 	// Version is the version of ths underlying runtime
 	Version string `json:"version"`
+
+	// CPU is the cpu capacity of the node, DefaultNodeCPUCapacity if zero
+	CPU resource.Quantity `json:"cpu"`
+
+	// Memory is the memory capacity of the node, DefaultNodeMemoryCapacity if zero
+	Memory resource.Quantity `json:"memory"`
+
+	// Pods is the max pod count of the node, DefaultNodePodsCapacity if zero
+	Pods int64 `json:"pods"`
+
+	// TaintKey is the key of node taint, DefaultNodeTaintKey if empty
+	TaintKey string `json:"taintKey"`
+
+	// TaintValue is the value of node taint, DefaultNodeTaintValue if empty
+	TaintValue string `json:"taintValue"`
+
+	// TaintEffect is the effect of node taint, DefaultNodeTaintEffect if empty
+	TaintEffect corev1.TaintEffect `json:"taintEffect"`
+
+	// NoTaint disables the node taint, so that pods can be scheduled without tolerations
+	NoTaint bool `json:"noTaint"`
+
+	// HeartbeatTimeout is the max duration without base health data before the node lease stops renewing,
+	// never stops if zero
+	HeartbeatTimeout time.Duration `json:"heartbeatTimeout"`
+
+	// KubeletPort is the port of kubelet api reported by the node, e.g. for kubectl logs, not reported if zero
+	KubeletPort int32 `json:"kubeletPort"`
 }
 
 type BuildBaseRegisterControllerConfig struct {
 	// MqttConfig is the config of mqtt client
 	MqttConfig *mqtt.ClientConfig
 
-	// KubeConfigPath is the path of k8s client
+	// MqttClient is used instead of creating a client with MqttConfig if set, e.g. a fake client in tests
+	MqttClient mqtt.PubSubClient
+
+	// KubeConfigPath is the path of k8s client, the in-cluster config is used if empty
 	KubeConfigPath string
+
+	// InCluster uses the in-cluster config of service account even if KubeConfigPath is set
+	InCluster bool
+
+	// HeartbeatTimeout is the max duration without base messages before its virtual node is set NotReady and pods failed,
+	// DefaultHeartbeatTimeout if zero
+	HeartbeatTimeout time.Duration
+
+	// OfflineGracePeriod is the duration of the virtual node of an offline base kept NotReady before torn down,
+	// the node is kept if base messages arrive within it. DefaultOfflineGracePeriod if zero
+	OfflineGracePeriod time.Duration
+
+	// HeartbeatInterval is the max interval of publishing health commands to base, DefaultHeartbeatInterval if zero
+	HeartbeatInterval time.Duration
+
+	// HeartbeatJitterPercent randomly shortens each heartbeat interval by up to the percent in [0, 100],
+	// so that heartbeats of nodes don't synchronize
+	HeartbeatJitterPercent int
+
+	// NodeLeaseDuration is the duration of the virtual node leases in whole seconds, node lifecycle controller marks a
+	// node NotReady once its lease not renewed within it. DefaultNodeLeaseDuration if zero
+	NodeLeaseDuration time.Duration
+
+	// NodeLeaseRenewInterval is the interval of renewing the virtual node leases, shorter than NodeLeaseDuration,
+	// a quarter of NodeLeaseDuration if zero
+	NodeLeaseRenewInterval time.Duration
+
+	// DrainTimeout bounds waiting for in-flight message handlers on shutdown, DefaultDrainTimeout if zero
+	DrainTimeout time.Duration
+
+	// ShutdownTimeout bounds the whole shutdown after ctx done, Done is closed and Err reports ErrShutdownTimeout
+	// once it elapsed even if draining blocked, DefaultShutdownTimeout if zero
+	ShutdownTimeout time.Duration
+
+	// PublishRetry is the retry policy of publishing biz install and uninstall commands
+	PublishRetry PublishRetryConfig
+
+	// KubeRetry is the retry policy of kube api requests of nodes failed to reach the api server, zero fields fall back
+	// to the DefaultKube ones. the controller stops with ErrKubeClient once a request exhausted the retries
+	KubeRetry PublishRetryConfig
+
+	// CommandTimeout bounds waiting for base to confirm a biz command published by nodes, DefaultCommandTimeout if zero
+	CommandTimeout time.Duration
+
+	// MaxConcurrentBizOps bounds the biz install and uninstall commands of a node waiting for confirmation at the same time,
+	// further commands wait for a slot so that a pod of many biz doesn't overwhelm the base. nodes proceed in parallel,
+	// DefaultMaxConcurrentBizOps if zero
+	MaxConcurrentBizOps int
+
+	// QosHeartbeat is the qos of base heartbeat and health messages and the health commands, Qos0 if zero as loss is tolerated
+	QosHeartbeat byte
+
+	// QosCommand is the qos of biz commands and the biz status replied, DefaultQosCommand if zero.
+	// Run fails if broker grants a lower qos to the biz status subscriptions
+	QosCommand byte
+
+	// QosStatus is the qos of node online/offline status, DefaultQosStatus if zero
+	QosStatus byte
+
+	// BizPollInterval enables polling the biz list of nodes by publishing query commands in the interval, for bases
+	// not pushing biz status proactively. nodes which pushed biz status within the interval are skipped, disabled if zero
+	BizPollInterval time.Duration
+
+	// LeaderElection enables leader election, only the leader subscribes base messages and registers nodes
+	LeaderElection bool
+
+	// LeaseName is the name of the lease for leader election, DefaultLeaseName if empty
+	LeaseName string
+
+	// LeaseNamespace is the namespace of the lease for leader election, DefaultLeaseNamespace if empty
+	LeaseNamespace string
+
+	// RejectBizDowngrade rejects pod updates replacing a biz with an older version, keeping the installed versions,
+	// versions not comparable by semantic versioning are installed as usual
+	RejectBizDowngrade bool
+
+	// KubeletPort is the port of the kubelet api serving container logs of nodes, reported by nodes, not reported if zero
+	KubeletPort int32
+
+	// NodeNamePrefix is prepended to the base node id as the virtual node name, must be a RFC 1123 label if set
+	NodeNamePrefix string
+
+	// DefaultBizVersion is the version of biz containers providing none by BIZ_VERSION env or image, must be a semantic
+	// version if set, e.g. 0.0.0-SNAPSHOT in dev clusters. such containers are rejected if empty, as in production
+	DefaultBizVersion string
+
+	// DryRun logs the biz install and uninstall commands and node status that would be published instead of publishing them,
+	// incoming base messages are processed as usual
+	DryRun bool
+}
+
+// PublishRetryConfig is the retry policy with exponential backoff, zero fields fall back to the defaults
+type PublishRetryConfig struct {
+	// MaxAttempts is the max attempts including the first one, DefaultPublishMaxAttempts if zero
+	MaxAttempts int
+
+	// InitialBackoff is the backoff before the first retry and doubled on each retry, DefaultPublishInitialBackoff if zero
+	InitialBackoff time.Duration
+
+	// MaxBackoff is the upper bound of backoff, DefaultPublishMaxBackoff if zero
+	MaxBackoff time.Duration
 }
 
 type BuildKouplelessNodeConfig struct {
-	// KubeConfigPath is the path of kube config file
+	// KubeConfigPath is the path of kube config file, the in-cluster config is used if empty
 	KubeConfigPath string
 
+	// InCluster uses the in-cluster config of service account even if KubeConfigPath is set
+	InCluster bool
+
 	// MqttClient is the mqtt client, for sub and pub
-	MqttClient *mqtt.Client
+	MqttClient mqtt.PubSubClient
+
+	// WrapKubeTransport wraps the transport of the kube client if set, e.g. to retry requests when the api server is unreachable
+	WrapKubeTransport func(http.RoundTripper) http.RoundTripper
 
 	// NodeID is the device id of base
 	NodeID string
@@ -66,6 +317,9 @@ type BuildKouplelessNodeConfig struct {
 	// NodeIP is the device ip of base
 	NodeIP string
 
+	// NodeName is the name of virtual node, NodeID if empty
+	NodeName string
+
 	// TechStack is the base tech stack, default java
 	TechStack string
 
@@ -74,4 +328,145 @@ type BuildKouplelessNodeConfig struct {
 
 	// BizVersion is the base master biz version
 	BizVersion string
+
+	// DefaultBizResources is the cpu and memory hint of biz whose container specifies no resources
+	DefaultBizResources corev1.ResourceList
+
+	// DefaultBizVersion is the version of biz containers providing none by BIZ_VERSION env or image, such containers
+	// are rejected if empty
+	DefaultBizVersion string
+
+	// PublishRetry is the retry policy of publishing biz install and uninstall commands
+	PublishRetry PublishRetryConfig
+
+	// HeartbeatInterval is the max interval of publishing health commands to base, DefaultHeartbeatInterval if zero
+	HeartbeatInterval time.Duration
+
+	// HeartbeatJitterPercent randomly shortens each heartbeat interval by up to the percent
+	HeartbeatJitterPercent int
+
+	// HeartbeatTimeout is the max duration without base health data before the node lease stops renewing,
+	// DefaultHeartbeatTimeout if zero
+	HeartbeatTimeout time.Duration
+
+	// NodeLeaseDuration is the duration of the node lease, DefaultNodeLeaseDuration if zero
+	NodeLeaseDuration time.Duration
+
+	// NodeLeaseRenewInterval is the interval of renewing the node lease, a quarter of NodeLeaseDuration if zero
+	NodeLeaseRenewInterval time.Duration
+
+	// QosHeartbeat is the qos of publishing health commands
+	QosHeartbeat byte
+
+	// QosCommand is the qos of publishing biz commands, DefaultQosCommand if zero
+	QosCommand byte
+
+	// CommandTimeout bounds waiting for base to confirm a biz command, DefaultCommandTimeout if zero
+	CommandTimeout time.Duration
+
+	// MaxConcurrentBizOps bounds the biz commands of the node waiting for confirmation at the same time,
+	// DefaultMaxConcurrentBizOps if zero
+	MaxConcurrentBizOps int
+
+	// DryRun logs the biz install and uninstall commands instead of publishing them
+	DryRun bool
+
+	// RejectBizDowngrade rejects pod updates replacing a biz with an older version, keeping the installed versions
+	RejectBizDowngrade bool
+
+	// KubeletPort is the port of kubelet api reported by the node, not reported if zero
+	KubeletPort int32
+
+	// MetricsRecorder observes the biz installs and biz info syncs of the node, not observed if nil
+	MetricsRecorder MetricsRecorder
+}
+
+// MetricsRecorder is invoked on biz install and reconcile, for observation of the managed bases
+type MetricsRecorder interface {
+	// ObserveBizInstall is called once an install command finished, err is nil if base activated the biz
+	ObserveBizInstall(err error)
+
+	// ObserveReconcile is called once the diff of desired and actual biz of a node finished
+	ObserveReconcile(duration time.Duration)
+}
+
+// BizModelWithResources is the install command payload, biz model with the resources hint for ark runtime to size the module
+type BizModelWithResources struct {
+	ark.BizModel
+
+	// Resources is the cpu and memory hint of biz, e.g. {"memory": "512Mi"}
+	Resources map[corev1.ResourceName]string `json:"resources,omitempty"`
+}
+
+// InstallBizBatch is the install batch command payload, the base installs the biz one by one in order,
+// so that the biz of a pod are installed by one command
+type InstallBizBatch struct {
+	// Version is the protocol version of the command, CurrentProtocolVersion
+	Version int `json:"protocolVersion,omitempty"`
+
+	// BizModels is the biz to install, every biz after the biz it depends on
+	BizModels []BizModelWithResources `json:"bizModels"`
+}
+
+// BizLogRequest is the query biz log command payload, the base replies BizLogResponse with the same RequestID
+// to its log topic
+type BizLogRequest struct {
+	ark.BizModel
+
+	// Version is the protocol version of the command, CurrentProtocolVersion
+	Version int `json:"protocolVersion,omitempty"`
+
+	// RequestID correlates the reply with the request
+	RequestID string `json:"requestId"`
+
+	// Tail is the count of the latest lines to reply, all lines if zero
+	Tail int64 `json:"tail,omitempty"`
+
+	// SinceSeconds limits the reply to lines logged within the seconds, no limit if zero
+	SinceSeconds int64 `json:"sinceSeconds,omitempty"`
+
+	// SinceTime limits the reply to lines logged after the unix milliseconds, no limit if zero
+	SinceTime int64 `json:"sinceTime,omitempty"`
+}
+
+// BizLogResponse is the biz log lines replied by base, carried as the data of the ark response
+type BizLogResponse struct {
+	// RequestID is the RequestID of the replied BizLogRequest
+	RequestID string `json:"requestId"`
+
+	// Lines is the log lines in logged order, without line breaks
+	Lines []string `json:"lines"`
 }
+
+// NodeHeartbeat is the optional node metadata carried by base heartbeat, so that the virtual node status is updated
+// without a separate health query, its wire format is described by NodeHeartbeatSchema
+type NodeHeartbeat struct {
+	// Version is the version of the base runtime
+	Version string `json:"version,omitempty"`
+
+	// Load is the system load average of the base, reported for observation only
+	Load float64 `json:"load,omitempty"`
+
+	// Capacity is the total resources of the base, e.g. {"cpu": "2", "memory": "4Gi", "pods": "110"}
+	Capacity map[corev1.ResourceName]string `json:"capacity,omitempty"`
+
+	// Allocatable is the resources of the base available for biz, Capacity if empty
+	Allocatable map[corev1.ResourceName]string `json:"allocatable,omitempty"`
+
+	// Pressures is the node conditions the base is under, e.g. ["MemoryPressure"]
+	Pressures []corev1.NodeConditionType `json:"pressures,omitempty"`
+}
+
+// NodeHeartbeatSchema is the json schema of NodeHeartbeat
+const NodeHeartbeatSchema = `{
+  "$schema": "http://json-schema.org/draft-07/schema#",
+  "title": "NodeHeartbeat",
+  "type": "object",
+  "properties": {
+    "version": {"type": "string"},
+    "load": {"type": "number", "minimum": 0},
+    "capacity": {"type": "object", "additionalProperties": {"type": "string"}},
+    "allocatable": {"type": "object", "additionalProperties": {"type": "string"}},
+    "pressures": {"type": "array", "items": {"enum": ["MemoryPressure", "DiskPressure", "PIDPressure"]}}
+  }
+}`
@@ -0,0 +1,160 @@
+package let
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/koupleless/arkctl/v1/service/ark"
+	"github.com/koupleless/virtual-kubelet/common/mqtt"
+	"github.com/koupleless/virtual-kubelet/java/model"
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+	"github.com/virtual-kubelet/virtual-kubelet/node/api"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNodeOffline is returned when the base doesn't reply the biz log in time, e.g. offline or disconnected from broker
+var ErrNodeOffline = errors.New("node offline")
+
+// ErrContainerNotFound is returned when the container is not a biz container of a pod on the node
+var ErrContainerNotFound = errors.New("container not found")
+
+// notFoundError marks err as errdefs.ErrNotFound, so that the kubelet api responds 404 while errors.Is still works
+type notFoundError struct {
+	error
+}
+
+func (e notFoundError) NotFound() bool {
+	return true
+}
+
+func (e notFoundError) Unwrap() error {
+	return e.error
+}
+
+// SetLogFetchTimeout set the timeout of waiting for base to reply the biz log, model.DefaultLogFetchTimeout if zero
+func (b *BaseProvider) SetLogFetchTimeout(timeout time.Duration) {
+	b.logFetchTimeout = timeout
+}
+
+// fetchBizLogs publish the query biz log command of the biz container to base and return the replied lines,
+// tail and since options are passed to base, tail and limit bytes are also applied to the reply.
+// the lines logged till the reply are returned even if follow is requested
+func (b *BaseProvider) fetchBizLogs(ctx context.Context, namespace, podName, containerName string, opts api.ContainerLogOpts) (io.ReadCloser, error) {
+	podKey := b.modelUtils.GetPodKeyFromNamespacedName(namespace, podName)
+	bizModel := b.getBizModelOfContainer(podKey, containerName)
+	if bizModel == nil {
+		return nil, notFoundError{fmt.Errorf("%w: %s of pod %s", ErrContainerNotFound, containerName, podKey)}
+	}
+	logger := log.G(ctx).WithField("podKey", podKey).WithField("bizName", bizModel.BizName).WithField("bizVersion", bizModel.BizVersion)
+
+	request := model.BizLogRequest{
+		BizModel:     *bizModel,
+		Version:      model.CurrentProtocolVersion,
+		RequestID:    b.nodeID + "-" + strconv.FormatInt(time.Now().UnixNano(), 10),
+		Tail:         int64(opts.Tail),
+		SinceSeconds: int64(opts.SinceSeconds),
+	}
+	if !opts.SinceTime.IsZero() {
+		request.SinceTime = opts.SinceTime.UnixMilli()
+	}
+	commandTopic, err := mqtt.DefaultTopicBuilder.NodeCommandTopic(b.nodeID, model.CommandQueryBizLog)
+	if err != nil {
+		return nil, err
+	}
+	replyTopic, err := mqtt.DefaultTopicBuilder.NodeBaseTopic(b.nodeID, mqtt.TopicTypeLog)
+	if err != nil {
+		return nil, err
+	}
+	if b.dryRun {
+		logger.WithField("topic", commandTopic).WithField("payload", request).Info("DryRunSkipPublish")
+		return io.NopCloser(strings.NewReader("")), nil
+	}
+
+	// replies of concurrent requests share the reply topic, fetch one at a time
+	b.logFetchLock.Lock()
+	defer b.logFetchLock.Unlock()
+
+	timeout := b.logFetchTimeout
+	if timeout <= 0 {
+		timeout = model.DefaultLogFetchTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	replied := make(chan ark.GenericArkResponseBase[model.BizLogResponse], 1)
+	subscribed := b.mqttClient.Sub(replyTopic, b.commandQos, func(_ paho.Client, msg paho.Message) {
+		var reply struct {
+			Data ark.GenericArkResponseBase[model.BizLogResponse] `json:"data"`
+		}
+		if err := json.Unmarshal(msg.Payload(), &reply); err != nil || reply.Data.Data.RequestID != request.RequestID {
+			// e.g. a stale reply of a timed out request
+			return
+		}
+		select {
+		case replied <- reply.Data:
+		default:
+		}
+	})
+	if !subscribed {
+		return nil, fmt.Errorf("%w: failed to subscribe %s", ErrNodeOffline, replyTopic)
+	}
+	// unsubscribed before the next fetch subscribes
+	defer b.mqttClient.UnSub(replyTopic)
+	if err = b.mqttClient.PubWithRetained(ctx, commandTopic, b.commandQos, false, request); err != nil {
+		if errors.Is(err, mqtt.ErrClientDisconnected) {
+			return nil, fmt.Errorf("%w: %w", ErrNodeOffline, err)
+		}
+		return nil, err
+	}
+
+	select {
+	case reply := <-replied:
+		if reply.Code != "SUCCESS" {
+			return nil, fmt.Errorf("node %s failed to read log of biz %s: %s", b.nodeID, bizModel.BizName, reply.Message)
+		}
+		logger.Info("BizLogFetched")
+		return io.NopCloser(strings.NewReader(formatLogLines(reply.Data.Lines, opts))), nil
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, fmt.Errorf("%w: node %s replied no log of biz %s in %s", ErrNodeOffline, b.nodeID, bizModel.BizName, timeout)
+		}
+		return nil, ctx.Err()
+	}
+}
+
+// getBizModelOfContainer returns the biz model of the named biz container of pod, nil if not found
+func (b *BaseProvider) getBizModelOfContainer(podKey, containerName string) *ark.BizModel {
+	pod := b.runtimeInfoStore.GetPodByKey(podKey)
+	if pod == nil {
+		return nil
+	}
+	for _, container := range b.modelUtils.GetBizContainersFromCoreV1Pod(pod) {
+		if container.Name == containerName {
+			bizModel := b.modelUtils.TranslateCoreV1ContainerToBizModel(container)
+			return &bizModel
+		}
+	}
+	return nil
+}
+
+// formatLogLines join the latest opts.Tail lines with line breaks, truncated to the first opts.LimitBytes bytes
+func formatLogLines(lines []string, opts api.ContainerLogOpts) string {
+	if opts.Tail > 0 && len(lines) > opts.Tail {
+		lines = lines[len(lines)-opts.Tail:]
+	}
+	builder := strings.Builder{}
+	for _, line := range lines {
+		builder.WriteString(line)
+		builder.WriteString("\n")
+	}
+	ret := builder.String()
+	if opts.LimitBytes > 0 && len(ret) > opts.LimitBytes {
+		ret = ret[:opts.LimitBytes]
+	}
+	return ret
+}
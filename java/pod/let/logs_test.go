@@ -0,0 +1,154 @@
+package let
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/koupleless/arkctl/v1/service/ark"
+	"github.com/koupleless/virtual-kubelet/common/mqtt/mqtttest"
+	"github.com/koupleless/virtual-kubelet/java/model"
+	"github.com/virtual-kubelet/virtual-kubelet/node/api"
+	"gotest.tools/assert"
+)
+
+func bizLogReply(t *testing.T, code string, response model.BizLogResponse) []byte {
+	payload, err := json.Marshal(map[string]interface{}{
+		"publishTimestamp": time.Now().UnixMilli(),
+		"data": ark.GenericArkResponseBase[model.BizLogResponse]{
+			Code: code,
+			Data: response,
+		},
+	})
+	assert.NilError(t, err)
+	return payload
+}
+
+func TestBaseProvider_GetContainerLogs(t *testing.T) {
+	ctx := context.Background()
+	client := mqtttest.NewFakeClient()
+	provider := NewBaseProvider("default", "127.0.0.1", "test-node", client, nil)
+	assert.NilError(t, provider.CreatePod(ctx, deletedPod))
+
+	go func() {
+		published := waitPublished(t, client, commandTopic(t, model.CommandQueryBizLog), 1)
+		var request model.BizLogRequest
+		if err := json.Unmarshal(published[0].Payload, &request); err != nil {
+			return
+		}
+		// the stale reply of another request is ignored
+		client.Deliver("koupleless/test-node/base/log", bizLogReply(t, "SUCCESS", model.BizLogResponse{
+			RequestID: "stale",
+			Lines:     []string{"stale"},
+		}))
+		client.Deliver("koupleless/test-node/base/log", bizLogReply(t, "SUCCESS", model.BizLogResponse{
+			RequestID: request.RequestID,
+			Lines:     []string{"line1", "line2", "line3"},
+		}))
+	}()
+
+	logs, err := provider.GetContainerLogs(ctx, "default", "test-pod", "biz2", api.ContainerLogOpts{
+		Tail:         2,
+		SinceSeconds: 5,
+	})
+	assert.NilError(t, err)
+	content, err := io.ReadAll(logs)
+	assert.NilError(t, err)
+	assert.Equal(t, string(content), "line2\nline3\n")
+	assert.Assert(t, !client.Subscribed("koupleless/test-node/base/log"))
+
+	var request model.BizLogRequest
+	published := client.PublishedTo(commandTopic(t, model.CommandQueryBizLog))
+	assert.NilError(t, json.Unmarshal(published[0].Payload, &request))
+	assert.Equal(t, request.BizName, "biz2")
+	assert.Equal(t, request.BizVersion, "0.0.2")
+	assert.Equal(t, request.Tail, int64(2))
+	assert.Equal(t, request.SinceSeconds, int64(5))
+}
+
+func TestBaseProvider_GetContainerLogs_Failed(t *testing.T) {
+	ctx := context.Background()
+	client := mqtttest.NewFakeClient()
+	provider := NewBaseProvider("default", "127.0.0.1", "test-node", client, nil)
+	provider.SetLogFetchTimeout(50 * time.Millisecond)
+	assert.NilError(t, provider.CreatePod(ctx, deletedPod))
+
+	_, err := provider.GetContainerLogs(ctx, "default", "test-pod", "not-exist", api.ContainerLogOpts{})
+	assert.Assert(t, errors.Is(err, ErrContainerNotFound))
+	_, err = provider.GetContainerLogs(ctx, "default", "not-exist", "biz1", api.ContainerLogOpts{})
+	assert.Assert(t, errors.Is(err, ErrContainerNotFound))
+
+	// base offline, no reply
+	_, err = provider.GetContainerLogs(ctx, "default", "test-pod", "biz1", api.ContainerLogOpts{})
+	assert.Assert(t, errors.Is(err, ErrNodeOffline))
+	assert.Equal(t, len(client.PublishedTo(commandTopic(t, model.CommandQueryBizLog))), 1)
+	assert.Assert(t, !client.Subscribed("koupleless/test-node/base/log"))
+
+	go func() {
+		published := waitPublished(t, client, commandTopic(t, model.CommandQueryBizLog), 2)
+		var request model.BizLogRequest
+		if err := json.Unmarshal(published[1].Payload, &request); err != nil {
+			return
+		}
+		client.Deliver("koupleless/test-node/base/log", bizLogReply(t, "FAILED", model.BizLogResponse{
+			RequestID: request.RequestID,
+		}))
+	}()
+	provider.SetLogFetchTimeout(5 * time.Second)
+	_, err = provider.GetContainerLogs(ctx, "default", "test-pod", "biz1", api.ContainerLogOpts{})
+	assert.Assert(t, err != nil)
+	assert.Assert(t, !errors.Is(err, ErrNodeOffline))
+}
+
+func TestBaseProvider_GetContainerLogs_Handler(t *testing.T) {
+	ctx := context.Background()
+	client := mqtttest.NewFakeClient()
+	provider := NewBaseProvider("default", "127.0.0.1", "test-node", client, nil)
+	assert.NilError(t, provider.CreatePod(ctx, deletedPod))
+	server := httptest.NewServer(api.PodHandler(api.PodHandlerConfig{
+		GetContainerLogs: provider.GetContainerLogs,
+	}, false))
+	defer server.Close()
+
+	go func() {
+		published := waitPublished(t, client, commandTopic(t, model.CommandQueryBizLog), 1)
+		var request model.BizLogRequest
+		if err := json.Unmarshal(published[0].Payload, &request); err != nil {
+			return
+		}
+		client.Deliver("koupleless/test-node/base/log", bizLogReply(t, "SUCCESS", model.BizLogResponse{
+			RequestID: request.RequestID,
+			Lines:     []string{"line1", "line2"},
+		}))
+	}()
+	resp, err := http.Get(server.URL + "/containerLogs/default/test-pod/biz1?tailLines=1")
+	assert.NilError(t, err)
+	content, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.NilError(t, err)
+	assert.Equal(t, resp.StatusCode, http.StatusOK)
+	assert.Equal(t, string(content), "line2\n")
+
+	var request model.BizLogRequest
+	assert.NilError(t, json.Unmarshal(client.PublishedTo(commandTopic(t, model.CommandQueryBizLog))[0].Payload, &request))
+	assert.Equal(t, request.BizName, "biz1")
+	assert.Equal(t, request.Tail, int64(1))
+
+	resp, err = http.Get(server.URL + "/containerLogs/default/test-pod/not-exist")
+	assert.NilError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, resp.StatusCode, http.StatusNotFound)
+}
+
+func TestFormatLogLines(t *testing.T) {
+	lines := []string{"line1", "line2", "line3"}
+	assert.Equal(t, formatLogLines(lines, api.ContainerLogOpts{}), "line1\nline2\nline3\n")
+	assert.Equal(t, formatLogLines(lines, api.ContainerLogOpts{Tail: 1}), "line3\n")
+	assert.Equal(t, formatLogLines(lines, api.ContainerLogOpts{Tail: 5, LimitBytes: 8}), "line1\nli")
+	assert.Equal(t, formatLogLines(nil, api.ContainerLogOpts{}), "")
+}
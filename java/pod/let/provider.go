@@ -16,15 +16,17 @@ package let
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/koupleless/virtual-kubelet/common/mqtt"
 	"github.com/koupleless/virtual-kubelet/java/model"
 	"io"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/utils/ptr"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/koupleless/arkctl/v1/service/ark"
@@ -36,11 +38,15 @@ import (
 	"github.com/virtual-kubelet/virtual-kubelet/node/api/statsv1alpha1"
 	"github.com/virtual-kubelet/virtual-kubelet/node/nodeutil"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/workqueue"
 )
 
 var _ nodeutil.Provider = &BaseProvider{}
 
+// PodReasonNodeLost is the status reason of pods failed as their base is offline, as kubernetes reports pods of lost nodes
+const PodReasonNodeLost = "NodeLost"
+
 type BaseProvider struct {
 	Namespace               string
 	nodeID                  string
@@ -52,9 +58,34 @@ type BaseProvider struct {
 	installOperationQueue   *queue.Queue
 	uninstallOperationQueue *queue.Queue
 
-	mqttClient    *mqtt.Client
-	bizInfosCache bizInfosCache
-	port          int
+	mqttClient        mqtt.PubSubClient
+	bizInfosCache     bizInfosCache
+	pendingUnInstalls pendingUnInstalls
+	port              int
+
+	defaultBizResources corev1.ResourceList
+	publishRetry        model.PublishRetryConfig
+	eventRecorder       record.EventRecorder
+	dryRun              bool
+	commandQos          byte
+	rejectBizDowngrade  bool
+
+	// baseOffline fails the pods of node in status, set by the heartbeat checks of controller
+	baseOffline atomic.Bool
+
+	// bizCommands correlate the published biz commands with the biz info reported by base
+	bizCommands    *common.BizCommandWaiters
+	commandTimeout time.Duration
+
+	// bizOps bounds the biz commands of the node waiting for confirmation, shared by installs and uninstalls
+	bizOps              *common.BizOpLimiter
+	maxConcurrentBizOps int
+
+	// metrics observes biz installs and biz info syncs, nil if not observed
+	metrics model.MetricsRecorder
+
+	logFetchTimeout time.Duration
+	logFetchLock    sync.Mutex
 }
 
 type bizInfosCache struct {
@@ -63,7 +94,34 @@ type bizInfosCache struct {
 	LatestBizInfos []ark.ArkBizInfo
 }
 
-func NewBaseProvider(namespace, localIP, nodeID string, mqttClient *mqtt.Client, k8sClient *kubernetes.Clientset) *BaseProvider {
+// pendingUnInstalls records biz failed to uninstall while base unreachable, retried once base reports biz again
+type pendingUnInstalls struct {
+	sync.Mutex
+
+	bizIdentities map[string]bool
+}
+
+func (p *pendingUnInstalls) add(bizIdentity string) {
+	p.Lock()
+	defer p.Unlock()
+	if p.bizIdentities == nil {
+		p.bizIdentities = make(map[string]bool)
+	}
+	p.bizIdentities[bizIdentity] = true
+}
+
+func (p *pendingUnInstalls) popAll() []string {
+	p.Lock()
+	defer p.Unlock()
+	ret := make([]string, 0, len(p.bizIdentities))
+	for bizIdentity := range p.bizIdentities {
+		ret = append(ret, bizIdentity)
+	}
+	p.bizIdentities = nil
+	return ret
+}
+
+func NewBaseProvider(namespace, localIP, nodeID string, mqttClient mqtt.PubSubClient, k8sClient *kubernetes.Clientset) *BaseProvider {
 	provider := &BaseProvider{
 		Namespace:        namespace,
 		localIP:          localIP,
@@ -72,6 +130,12 @@ func NewBaseProvider(namespace, localIP, nodeID string, mqttClient *mqtt.Client,
 		modelUtils:       common.ModelUtils{},
 		runtimeInfoStore: NewRuntimeInfoStore(),
 		mqttClient:       mqttClient,
+		commandQos:       model.DefaultQosCommand,
+		bizCommands:      common.NewBizCommandWaiters(),
+		commandTimeout:   model.DefaultCommandTimeout,
+
+		bizOps:              common.NewBizOpLimiter(model.DefaultMaxConcurrentBizOps),
+		maxConcurrentBizOps: model.DefaultMaxConcurrentBizOps,
 	}
 
 	provider.installOperationQueue = queue.New(
@@ -98,8 +162,9 @@ func NewBaseProvider(namespace, localIP, nodeID string, mqttClient *mqtt.Client,
 }
 
 func (b *BaseProvider) Run(ctx context.Context) {
-	go b.installOperationQueue.Run(ctx, 1)
-	go b.uninstallOperationQueue.Run(ctx, 1)
+	// each queue may use all slots, the limiter bounds the commands of both in flight
+	go b.installOperationQueue.Run(ctx, b.maxConcurrentBizOps)
+	go b.uninstallOperationQueue.Run(ctx, b.maxConcurrentBizOps)
 	go common.TimedTaskWithInterval(ctx, time.Second*5, b.checkAndUninstallDanglingBiz)
 }
 
@@ -126,7 +191,7 @@ func (b *BaseProvider) checkAndUninstallDanglingBiz(ctx context.Context) {
 		return
 	}
 	for _, bizInfo := range bizInfos {
-		if bizInfo.BizState == "RESOLVED" {
+		if b.modelUtils.NormalizeBizState(bizInfo.BizState) == common.BizStateResolved {
 			continue
 		}
 		bizIdentity := b.modelUtils.GetBizIdentityFromBizInfo(&bizInfo)
@@ -138,10 +203,191 @@ func (b *BaseProvider) checkAndUninstallDanglingBiz(ctx context.Context) {
 	}
 }
 
+// SetDefaultBizResources set the resources hint of biz whose container specifies no resources
+func (b *BaseProvider) SetDefaultBizResources(resources corev1.ResourceList) {
+	b.defaultBizResources = resources
+}
+
+// SetDefaultBizVersion set the version of biz containers providing none by BIZ_VERSION env or image, such
+// containers are rejected if empty
+func (b *BaseProvider) SetDefaultBizVersion(defaultBizVersion string) {
+	b.modelUtils.DefaultBizVersion = defaultBizVersion
+	b.runtimeInfoStore.setDefaultBizVersion(defaultBizVersion)
+}
+
+// SetPublishRetry set the retry policy of publishing biz install and uninstall commands
+func (b *BaseProvider) SetPublishRetry(publishRetry model.PublishRetryConfig) {
+	b.publishRetry = publishRetry
+}
+
+// SetDryRun set whether biz install and uninstall commands are only logged instead of published
+func (b *BaseProvider) SetDryRun(dryRun bool) {
+	b.dryRun = dryRun
+}
+
+// SetRejectBizDowngrade set whether pod updates downgrading any biz are rejected, keeping the installed versions
+func (b *BaseProvider) SetRejectBizDowngrade(rejectBizDowngrade bool) {
+	b.rejectBizDowngrade = rejectBizDowngrade
+}
+
+// SetBaseOffline set whether base is offline, the pods of an offline base are reported Failed so that their controllers
+// replace them, pods failed stay failed once base back
+func (b *BaseProvider) SetBaseOffline(offline bool) {
+	b.baseOffline.Store(offline)
+}
+
+// SetCommandQos set the qos of publishing biz commands, model.DefaultQosCommand by default
+func (b *BaseProvider) SetCommandQos(qos byte) {
+	b.commandQos = qos
+}
+
+// SetCommandTimeout set the timeout of waiting for base to confirm a biz command, model.DefaultCommandTimeout by default
+func (b *BaseProvider) SetCommandTimeout(timeout time.Duration) {
+	if timeout > 0 {
+		b.commandTimeout = timeout
+	}
+}
+
+// SetMaxConcurrentBizOps set the max biz commands of the node waiting for confirmation at the same time, further
+// commands wait for a slot, model.DefaultMaxConcurrentBizOps by default. should be set before Run
+func (b *BaseProvider) SetMaxConcurrentBizOps(maxConcurrentBizOps int) {
+	if maxConcurrentBizOps > 0 {
+		b.maxConcurrentBizOps = maxConcurrentBizOps
+		b.bizOps = common.NewBizOpLimiter(maxConcurrentBizOps)
+	}
+}
+
+// SetMetricsRecorder set the recorder observing biz installs and biz info syncs of the node, nothing observed if nil
+func (b *BaseProvider) SetMetricsRecorder(recorder model.MetricsRecorder) {
+	b.metrics = recorder
+}
+
+// observeBizInstall record the result of an install command, a biz reported broken is a failed install
+func (b *BaseProvider) observeBizInstall(bizIdentity string, bizInfo *ark.ArkBizInfo, err error) {
+	if b.metrics == nil {
+		return
+	}
+	if err == nil && bizInfo != nil && b.modelUtils.NormalizeBizState(bizInfo.BizState) == common.BizStateBroken {
+		err = fmt.Errorf("biz %s broken", bizIdentity)
+	}
+	b.metrics.ObserveBizInstall(err)
+}
+
+// awaitBizCommand wait for base to confirm the published command of biz within the command timeout, returns
+// common.ErrBizCommandTimeout and marks the biz timed out if not confirmed in time
+func (b *BaseProvider) awaitBizCommand(ctx context.Context, bizIdentity string, waiter *common.BizCommandWaiter) (*ark.ArkBizInfo, error) {
+	if b.dryRun {
+		return nil, nil
+	}
+	timer := time.NewTimer(b.commandTimeout)
+	defer timer.Stop()
+	select {
+	case bizInfo := <-waiter.Result():
+		return bizInfo, nil
+	case timedOutAt := <-timer.C:
+		b.runtimeInfoStore.SetBizTimedOutAt(bizIdentity, timedOutAt)
+		return nil, fmt.Errorf("%w: biz %s not confirmed by node %s in %s", common.ErrBizCommandTimeout, bizIdentity, b.nodeID, b.commandTimeout)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// publishBizCommand publish biz command to base with retry, only log it in dry run mode
+func (b *BaseProvider) publishBizCommand(ctx context.Context, command string, payload interface{}) error {
+	topic, err := common.FormatArkletCommandTopic(b.nodeID, command)
+	if err != nil {
+		return err
+	}
+	if b.dryRun {
+		log.G(ctx).WithField("topic", topic).WithField("payload", payload).Info("DryRunSkipPublish")
+		return nil
+	}
+	return common.RetryWithBackoff(ctx, b.publishRetry, func(ctx context.Context) error {
+		// biz command should not be retained, otherwise a reconnected base would re-execute a stale command
+		return b.mqttClient.PubWithRetained(ctx, topic, b.commandQos, false, payload)
+	})
+}
+
+// SetEventRecorder set the recorder of biz lifecycle events, no event is recorded if nil
+func (b *BaseProvider) SetEventRecorder(eventRecorder record.EventRecorder) {
+	b.eventRecorder = eventRecorder
+}
+
+// recordBizEvent record event of biz to its pod, only changed reasons are recorded so that each milestone shows once
+func (b *BaseProvider) recordBizEvent(bizIdentity, eventType, reason, message string) {
+	if b.eventRecorder == nil || reason == "" {
+		return
+	}
+	pod := b.runtimeInfoStore.GetPodByKey(b.runtimeInfoStore.GetRelatedPodKeyByBizIdentity(bizIdentity))
+	if pod == nil {
+		return
+	}
+	if !b.runtimeInfoStore.ObserveBizEventReason(bizIdentity, reason) {
+		return
+	}
+	b.eventRecorder.Event(pod, eventType, reason, message)
+}
+
+// getBizResources returns the resources hint of biz from its container
+func (b *BaseProvider) getBizResources(bizIdentity string) map[corev1.ResourceName]string {
+	pod := b.runtimeInfoStore.GetPodByKey(b.runtimeInfoStore.GetRelatedPodKeyByBizIdentity(bizIdentity))
+	if pod == nil {
+		return nil
+	}
+	resources := b.modelUtils.GetBizResourcesFromCoreV1Pod(pod, b.defaultBizResources)[bizIdentity]
+	if len(resources) == 0 {
+		return nil
+	}
+	ret := make(map[corev1.ResourceName]string, len(resources))
+	for name, quantity := range resources {
+		ret[name] = quantity.String()
+	}
+	return ret
+}
+
 func (b *BaseProvider) SyncBizInfo(bizInfos []ark.ArkBizInfo) {
+	if b.metrics != nil {
+		start := time.Now()
+		defer func() {
+			b.metrics.ObserveReconcile(time.Since(start))
+		}()
+	}
+	// biz states are observed in the order of reports, events and retries are handed out after unlocking
+	type bizEvent struct {
+		bizIdentity, eventType, reason, message string
+	}
+	events := make([]bizEvent, 0, len(bizInfos))
+
 	b.bizInfosCache.Lock()
-	defer b.bizInfosCache.Unlock()
 	b.bizInfosCache.LatestBizInfos = bizInfos
+	activatedBizIdentities := make(map[string]bool)
+	for _, bizInfo := range bizInfos {
+		bizIdentity := b.modelUtils.GetBizIdentityFromBizInfo(&bizInfo)
+		if b.modelUtils.NormalizeBizState(bizInfo.BizState) == common.BizStateActivated {
+			activatedBizIdentities[bizIdentity] = true
+		}
+		if bizModel := b.runtimeInfoStore.GetBizModel(bizIdentity); bizModel != nil {
+			eventType, reason, message := b.modelUtils.GetBizLifecycleEvent(b.modelUtils.TranslateArkBizInfoToV1ContainerStatus(bizModel, &bizInfo))
+			events = append(events, bizEvent{bizIdentity, eventType, reason, message})
+		}
+	}
+	b.runtimeInfoStore.ObserveActivatedBiz(activatedBizIdentities)
+
+	reported := make([]*ark.ArkBizInfo, 0, len(bizInfos))
+	for i := range bizInfos {
+		reported = append(reported, &bizInfos[i])
+	}
+	b.bizCommands.Observe(b.nodeID, reported)
+	b.bizInfosCache.Unlock()
+
+	for _, event := range events {
+		b.recordBizEvent(event.bizIdentity, event.eventType, event.reason, event.message)
+	}
+
+	// base reachable again, retry the deferred uninstall
+	for _, bizIdentity := range b.pendingUnInstalls.popAll() {
+		b.uninstallOperationQueue.Enqueue(context.Background(), bizIdentity)
+	}
 }
 
 func (b *BaseProvider) queryAllBiz(_ context.Context) ([]ark.ArkBizInfo, error) {
@@ -170,16 +416,30 @@ func (b *BaseProvider) queryBiz(ctx context.Context, bizIdentity string) (*ark.A
 	return nil, nil
 }
 
-func (b *BaseProvider) installBizMqtt(_ context.Context, bizModel *ark.BizModel) error {
-	installBizRequestBytes, _ := json.Marshal(bizModel)
-	b.mqttClient.Pub(common.FormatArkletCommandTopic(b.nodeID, model.CommandInstallBiz), 1, installBizRequestBytes)
-	return nil
+func (b *BaseProvider) installBizMqtt(ctx context.Context, bizModel *ark.BizModel) error {
+	return b.publishBizCommand(ctx, model.CommandInstallBiz, model.BizModelWithResources{
+		BizModel:  *bizModel,
+		Resources: b.getBizResources(b.modelUtils.GetBizIdentityFromBizModel(bizModel)),
+	})
 }
 
-func (b *BaseProvider) unInstallBizMqtt(_ context.Context, bizModel *ark.BizModel) error {
-	unInstallBizRequestBytes, _ := json.Marshal(bizModel)
-	b.mqttClient.Pub(common.FormatArkletCommandTopic(b.nodeID, model.CommandUnInstallBiz), 1, unInstallBizRequestBytes)
-	return nil
+// installBizBatchMqtt publish one install batch command of the biz models in order
+func (b *BaseProvider) installBizBatchMqtt(ctx context.Context, bizModels []*ark.BizModel) error {
+	batch := model.InstallBizBatch{
+		Version:   model.CurrentProtocolVersion,
+		BizModels: make([]model.BizModelWithResources, 0, len(bizModels)),
+	}
+	for _, bizModel := range bizModels {
+		batch.BizModels = append(batch.BizModels, model.BizModelWithResources{
+			BizModel:  *bizModel,
+			Resources: b.getBizResources(b.modelUtils.GetBizIdentityFromBizModel(bizModel)),
+		})
+	}
+	return b.publishBizCommand(ctx, model.CommandInstallBizBatch, batch)
+}
+
+func (b *BaseProvider) unInstallBizMqtt(ctx context.Context, bizModel *ark.BizModel) error {
+	return b.publishBizCommand(ctx, model.CommandUnInstallBiz, bizModel)
 }
 
 func (b *BaseProvider) handleInstallOperation(ctx context.Context, bizIdentity string) error {
@@ -198,33 +458,94 @@ func (b *BaseProvider) handleInstallOperation(ctx context.Context, bizIdentity s
 		return err
 	}
 
-	if bizInfo != nil && bizInfo.BizState == "ACTIVATED" {
+	bizState := ""
+	if bizInfo != nil {
+		bizState = b.modelUtils.NormalizeBizState(bizInfo.BizState)
+	}
+
+	if bizState == common.BizStateActivated {
 		logger.Info("BizAlreadyActivated")
 		return nil
 	}
 
-	if bizInfo != nil && bizInfo.BizState == "RESOLVED" {
+	if bizState == common.BizStateResolved {
 		// process concurrent install operation
 		logger.Info("BizInstalling")
 		return nil
 	}
 
-	if bizInfo != nil && bizInfo.BizState != "DEACTIVATED" {
+	if bizInfo != nil && bizState != common.BizStateDeactivated {
 		// todo: support retry accordingly
 		//       we should check the related defaultPod failed strategy and retry accordingly
 		logger.Error("BizInstalledButNotActivated")
 		return errors.New("BizInstalledButNotActivated")
 	}
 
+	if err = b.checkBizDependenciesActivated(ctx, bizIdentity, bizModel); err != nil {
+		// retried until dependencies activated
+		logger.WithError(err).Info("BizDependenciesNotActivated")
+		return err
+	}
+
+	// the command timeout starts once a slot acquired
+	release, err := b.bizOps.Acquire(ctx, b.nodeID)
+	if err != nil {
+		return err
+	}
+	defer release()
+	// waiter registered before publishing, so that a quick confirmation is not missed
+	waiter, cancelWait := b.bizCommands.Wait(b.nodeID, model.CommandInstallBiz, bizIdentity, common.BizInstallConfirmed)
+	defer cancelWait()
+	b.runtimeInfoStore.SetBizTimedOutAt(bizIdentity, time.Time{})
 	if err = b.installBizMqtt(ctx, bizModel); err != nil {
 		logger.WithError(err).Error("InstallBizFailed")
+		b.observeBizInstall(bizIdentity, nil, err)
+		b.recordBizEvent(bizIdentity, corev1.EventTypeWarning, common.EventReasonInstallFailed, fmt.Sprintf("Biz %s failed to publish install command: %v", bizIdentity, err))
 		return err
 	}
+	b.recordBizEvent(bizIdentity, corev1.EventTypeNormal, common.EventReasonInstallRequested, fmt.Sprintf("Biz %s install requested", bizIdentity))
+
+	bizInfo, err = b.awaitBizCommand(ctx, bizIdentity, waiter)
+	if !b.dryRun {
+		b.observeBizInstall(bizIdentity, bizInfo, err)
+	}
+	if err != nil {
+		// not retried, the pod reports the timeout until base reports the biz
+		logger.WithError(err).Error("InstallBizNotConfirmed")
+		return nil
+	}
 
 	logger.Info("HandleBizInstallOperationFinished")
 	return nil
 }
 
+// checkBizDependenciesActivated returns error if any biz the biz depends on in the same pod is not activated on base
+func (b *BaseProvider) checkBizDependenciesActivated(ctx context.Context, bizIdentity string, bizModel *ark.BizModel) error {
+	pod := b.runtimeInfoStore.GetPodByKey(b.runtimeInfoStore.GetRelatedPodKeyByBizIdentity(bizIdentity))
+	if pod == nil {
+		return nil
+	}
+	// init biz are activated one by one before the other biz of pod
+	dependencies := append(b.modelUtils.GetInitBizDependenciesFromCoreV1Pod(pod, bizModel.BizName),
+		b.modelUtils.GetBizDependencyGraphFromCoreV1Pod(pod)[bizModel.BizName]...)
+	if len(dependencies) == 0 {
+		return nil
+	}
+	for _, dependencyModel := range b.runtimeInfoStore.GetRelatedBizModels(b.modelUtils.GetPodKey(pod)) {
+		if !slices.Contains(dependencies, dependencyModel.BizName) {
+			continue
+		}
+		dependencyInfo, err := b.queryBiz(ctx, b.modelUtils.GetBizIdentityFromBizModel(dependencyModel))
+		if err != nil {
+			return err
+		}
+		if dependencyInfo == nil || b.modelUtils.NormalizeBizState(dependencyInfo.BizState) != common.BizStateActivated {
+			return fmt.Errorf("biz %s depends on %s not activated", bizModel.BizName, dependencyModel.BizName)
+		}
+	}
+	return nil
+}
+
 func (b *BaseProvider) handleUnInstallOperation(ctx context.Context, bizIdentity string) error {
 	logger := log.G(ctx).WithField("bizIdentity", bizIdentity)
 	logger.Info("HandleUnInstallOperationStarted")
@@ -236,13 +557,27 @@ func (b *BaseProvider) handleUnInstallOperation(ctx context.Context, bizIdentity
 	}
 
 	if bizInfo != nil {
+		release, err := b.bizOps.Acquire(ctx, b.nodeID)
+		if err != nil {
+			return err
+		}
+		defer release()
+		waiter, cancelWait := b.bizCommands.Wait(b.nodeID, model.CommandUnInstallBiz, bizIdentity, common.BizUnInstallConfirmed)
+		defer cancelWait()
 		// local installed, call uninstall
 		if err = b.unInstallBizMqtt(ctx, &ark.BizModel{
 			BizName:    bizInfo.BizName,
 			BizVersion: bizInfo.BizVersion,
 		}); err != nil {
+			// base may be offline, defer the uninstall until base reports biz again instead of retrying in a hot loop
 			logger.WithError(err).Error("UnInstallBizFailed")
-			return err
+			b.pendingUnInstalls.add(bizIdentity)
+			return nil
+		}
+		if _, err = b.awaitBizCommand(ctx, bizIdentity, waiter); err != nil {
+			// the biz still reported is uninstalled again by the dangling biz check
+			logger.WithError(err).Error("UnInstallBizNotConfirmed")
+			return nil
 		}
 	}
 
@@ -255,9 +590,19 @@ func (b *BaseProvider) CreatePod(ctx context.Context, pod *corev1.Pod) error {
 	logger := log.G(ctx).WithField("podKey", b.modelUtils.GetPodKey(pod))
 	logger.Info("CreatePodStarted")
 
+	// enqueue init biz first and the others in dependency order, held until init biz and dependencies activated
+	bizModels, err := b.modelUtils.GetInstallBizModelsFromCoreV1Pod(pod)
+	if err != nil {
+		logger.WithError(err).Error("InvalidBizModels")
+		return err
+	}
+
 	// update the baseline info so the async handle logic can see them first
 	b.runtimeInfoStore.PutPod(pod.DeepCopy())
-	bizModels := b.modelUtils.GetBizModelsFromCoreV1Pod(pod)
+	if len(bizModels) > 1 && len(pod.Spec.InitContainers) == 0 {
+		// biz of a pod are installed by one batch command, base installs them in order
+		bizModels = b.installBizBatch(ctx, bizModels)
+	}
 	for _, bizModel := range bizModels {
 		b.installOperationQueue.Enqueue(ctx, b.modelUtils.GetBizIdentityFromBizModel(bizModel))
 		logger.WithField("bizName", bizModel.BizName).WithField("bizVersion", bizModel.BizVersion).Info("ItemEnqueued")
@@ -266,19 +611,136 @@ func (b *BaseProvider) CreatePod(ctx context.Context, pod *corev1.Pod) error {
 	return nil
 }
 
+// installBizBatch publish one install batch command of the biz not installed on base, returns the biz left to install
+// one by one, i.e. all biz if the biz list of base is unknown yet or the batch failed to publish, and the biz installed
+// but not activated for retry
+func (b *BaseProvider) installBizBatch(ctx context.Context, bizModels []*ark.BizModel) []*ark.BizModel {
+	logger := log.G(ctx)
+	bizInfos, err := b.queryAllBiz(ctx)
+	if err != nil {
+		return bizModels
+	}
+	identityToState := make(map[string]string, len(bizInfos))
+	for _, bizInfo := range bizInfos {
+		identityToState[b.modelUtils.GetBizIdentityFromBizInfo(&bizInfo)] = b.modelUtils.NormalizeBizState(bizInfo.BizState)
+	}
+
+	batch := make([]*ark.BizModel, 0, len(bizModels))
+	left := make([]*ark.BizModel, 0)
+	for _, bizModel := range bizModels {
+		bizState, installed := identityToState[b.modelUtils.GetBizIdentityFromBizModel(bizModel)]
+		switch {
+		case !installed || bizState == common.BizStateDeactivated:
+			batch = append(batch, bizModel)
+		case bizState != common.BizStateActivated && bizState != common.BizStateResolved:
+			left = append(left, bizModel)
+		}
+	}
+	if len(batch) <= 1 {
+		return append(batch, left...)
+	}
+
+	// the batch is one command to base, holding one slot until all its biz confirmed or timed out
+	release, err := b.bizOps.Acquire(ctx, b.nodeID)
+	if err != nil {
+		return bizModels
+	}
+	// waiters registered before publishing, so that a quick confirmation is not missed
+	waiters := make([]*common.BizCommandWaiter, 0, len(batch))
+	cancelWaits := make([]func(), 0, len(batch))
+	for _, bizModel := range batch {
+		bizIdentity := b.modelUtils.GetBizIdentityFromBizModel(bizModel)
+		waiter, cancelWait := b.bizCommands.Wait(b.nodeID, model.CommandInstallBizBatch, bizIdentity, common.BizInstallConfirmed)
+		waiters = append(waiters, waiter)
+		cancelWaits = append(cancelWaits, cancelWait)
+		b.runtimeInfoStore.SetBizTimedOutAt(bizIdentity, time.Time{})
+	}
+	finish := func() {
+		for _, cancelWait := range cancelWaits {
+			cancelWait()
+		}
+		release()
+	}
+	if err = b.installBizBatchMqtt(ctx, batch); err != nil {
+		finish()
+		logger.WithError(err).Error("InstallBizBatchFailed")
+		return bizModels
+	}
+	for _, bizModel := range batch {
+		bizIdentity := b.modelUtils.GetBizIdentityFromBizModel(bizModel)
+		b.recordBizEvent(bizIdentity, corev1.EventTypeNormal, common.EventReasonInstallRequested, fmt.Sprintf("Biz %s install requested", bizIdentity))
+	}
+	logger.WithField("bizCount", len(batch)).Info("InstallBizBatchPublished")
+
+	go func() {
+		defer finish()
+		b.awaitBizBatch(ctx, batch, waiters)
+	}()
+	return left
+}
+
+// awaitBizBatch wait for base to confirm each biz of a published batch within the command timeout, as a single install
+func (b *BaseProvider) awaitBizBatch(ctx context.Context, batch []*ark.BizModel, waiters []*common.BizCommandWaiter) {
+	wg := sync.WaitGroup{}
+	for i, bizModel := range batch {
+		wg.Add(1)
+		go func(bizModel *ark.BizModel, waiter *common.BizCommandWaiter) {
+			defer wg.Done()
+			bizIdentity := b.modelUtils.GetBizIdentityFromBizModel(bizModel)
+			bizInfo, err := b.awaitBizCommand(ctx, bizIdentity, waiter)
+			if !b.dryRun {
+				b.observeBizInstall(bizIdentity, bizInfo, err)
+			}
+			if err != nil {
+				// not retried, the pod reports the timeout until base reports the biz
+				log.G(ctx).WithField("bizName", bizModel.BizName).WithField("bizVersion", bizModel.BizVersion).
+					WithError(err).Error("InstallBizNotConfirmed")
+			}
+		}(bizModel, waiters[i])
+	}
+	wg.Wait()
+}
+
 // UpdatePod install directly
 func (b *BaseProvider) UpdatePod(ctx context.Context, pod *corev1.Pod) error {
 	podKey := b.modelUtils.GetPodKey(pod)
 	logger := log.G(ctx).WithField("podKey", podKey)
 	logger.Info("UpdatePodStarted")
 
-	newModels := b.modelUtils.GetBizModelsFromCoreV1Pod(pod)
+	newModels, err := b.modelUtils.GetInstallBizModelsFromCoreV1Pod(pod)
+	if err != nil {
+		logger.WithError(err).Error("InvalidBizModels")
+		return err
+	}
 
 	// check pod deletion timestamp
 	if pod.ObjectMeta.DeletionTimestamp == nil {
+		oldModels := b.runtimeInfoStore.GetRelatedBizModels(podKey)
+		// uninstall the removed biz and the replaced versions, install the added biz and the new versions
+		installs, uninstalls := b.modelUtils.DiffBizModels(oldModels, newModels)
+		if b.rejectBizDowngrade {
+			if downgrades := b.modelUtils.GetBizDowngrades(installs, uninstalls); len(downgrades) > 0 {
+				// keep the pod as installed so that its status and deletion follow the installed versions
+				for _, downgrade := range downgrades {
+					for _, oldModel := range oldModels {
+						if !b.modelUtils.CmpBizModelName(oldModel, downgrade) {
+							continue
+						}
+						logger.WithField("bizName", downgrade.BizName).WithField("bizVersion", downgrade.BizVersion).
+							WithField("installedVersion", oldModel.BizVersion).Warn("BizDowngradeRejected")
+						b.recordBizEvent(b.modelUtils.GetBizIdentityFromBizModel(oldModel), corev1.EventTypeWarning, common.EventReasonDowngradeRejected,
+							fmt.Sprintf("Biz %s downgrade from %s to %s rejected", downgrade.BizName, oldModel.BizVersion, downgrade.BizVersion))
+					}
+				}
+				return nil
+			}
+		}
 		b.runtimeInfoStore.PutPod(pod.DeepCopy())
-		// not in deletion, install new models
-		for _, newModel := range newModels {
+		for _, oldModel := range uninstalls {
+			b.uninstallOperationQueue.Enqueue(ctx, b.modelUtils.GetBizIdentityFromBizModel(oldModel))
+			logger.WithField("bizName", oldModel.BizName).WithField("bizVersion", oldModel.BizVersion).Info("ReplacedItemEnqueued")
+		}
+		for _, newModel := range installs {
 			b.installOperationQueue.Enqueue(ctx, b.modelUtils.GetBizIdentityFromBizModel(newModel))
 			logger.WithField("bizName", newModel.BizName).WithField("bizVersion", newModel.BizVersion).Info("ItemEnqueued")
 		}
@@ -287,14 +749,27 @@ func (b *BaseProvider) UpdatePod(ctx context.Context, pod *corev1.Pod) error {
 	return nil
 }
 
-// DeletePod directly uninstall biz  from base
+// DeletePod uninstall biz of pod from base
 func (b *BaseProvider) DeletePod(ctx context.Context, pod *corev1.Pod) error {
 	podKey := b.modelUtils.GetPodKey(pod)
 	logger := log.G(ctx).WithField("podKey", podKey)
 	logger.Info("DeletePodStarted")
 
+	// uninstall the biz installed for the pod, which differ from the spec if an update was rejected
+	bizModels := b.runtimeInfoStore.GetRelatedBizModels(podKey)
+	if bizModels == nil {
+		// biz with unresolved version can't be installed, skip them
+		initBizModels, _ := b.modelUtils.GetInitBizModelsFromCoreV1Pod(pod)
+		bizModels, _ = b.modelUtils.GetBizModelsFromCoreV1Pod(pod)
+		bizModels = append(initBizModels, bizModels...)
+	}
+
 	// check is deleted
 	b.runtimeInfoStore.DeletePod(podKey)
+	for _, bizModel := range bizModels {
+		b.uninstallOperationQueue.Enqueue(ctx, b.modelUtils.GetBizIdentityFromBizModel(bizModel))
+		logger.WithField("bizName", bizModel.BizName).WithField("bizVersion", bizModel.BizVersion).Info("ItemEnqueued")
+	}
 
 	if b.k8sClient != nil {
 		// delete pod with no grace period, mock kubelet
@@ -311,13 +786,13 @@ func (b *BaseProvider) DeletePod(ctx context.Context, pod *corev1.Pod) error {
 //	so the outer control loop can call CreatePod / UpdatePod / DeletePod accordingly
 //	just return the defaultPod from the local store
 func (b *BaseProvider) GetPod(_ context.Context, namespace, name string) (*corev1.Pod, error) {
-	return b.runtimeInfoStore.GetPodByKey(namespace + "/" + name), nil
+	return b.runtimeInfoStore.GetPodByKey(b.modelUtils.GetPodKeyFromNamespacedName(namespace, name)), nil
 }
 
 // GetPodStatus this will be called repeatedly by virtual kubelet framework to get the defaultPod status
 // we should query the actual runtime info and translate them in to V1PodStatus accordingly
 func (b *BaseProvider) GetPodStatus(ctx context.Context, namespace, name string) (*corev1.PodStatus, error) {
-	podKey := namespace + "/" + name
+	podKey := b.modelUtils.GetPodKeyFromNamespacedName(namespace, name)
 	pod := b.runtimeInfoStore.GetPodByKey(podKey)
 	podStatus := &corev1.PodStatus{}
 	logger := log.G(ctx)
@@ -343,11 +818,19 @@ func (b *BaseProvider) GetPodStatus(ctx context.Context, namespace, name string)
 		}
 		return podStatus, nil
 	}
-	// check pod in deletion
-	isAllContainerReady := true
-	isSomeContainerFailed := false
-	// not in deletion
-	bizModels := b.modelUtils.GetBizModelsFromCoreV1Pod(pod)
+	if b.baseOffline.Load() {
+		return &corev1.PodStatus{
+			Phase:   corev1.PodFailed,
+			Reason:  PodReasonNodeLost,
+			Message: fmt.Sprintf("base of node %s is offline", b.nodeID),
+			PodIP:   b.localIP,
+			PodIPs:  []corev1.PodIP{{IP: b.localIP}},
+		}, nil
+	}
+	bizModels, err := b.modelUtils.GetBizModelsFromCoreV1PodChecked(pod)
+	if err != nil {
+		logger.WithError(err).Error("InvalidBizModels")
+	}
 
 	bizInfos, err := b.queryAllBiz(ctx)
 	if err != nil {
@@ -359,82 +842,44 @@ func (b *BaseProvider) GetPodStatus(ctx context.Context, namespace, name string)
 	for _, info := range bizInfos {
 		bizRuntimeInfos[b.modelUtils.GetBizIdentityFromBizInfo(&info)] = &info
 	}
-	// bizName -> container status
-	containerStatuses := make(map[string]*corev1.ContainerStatus)
-	/**
-	if further info is provided, we can set the time accordingly
-	failedTime would be the earliest time of the failed container
-	successTime would be the latest time of the success container
-	startTime would be the earliest time of the all container
-	*/
+	containerStatuses := make([]corev1.ContainerStatus, 0, len(bizModels))
 	for _, bizModel := range bizModels {
-		info := bizRuntimeInfos[b.modelUtils.GetBizIdentityFromBizModel(bizModel)]
-		containerStatus := b.modelUtils.TranslateArkBizInfoToV1ContainerStatus(bizModel, info)
-		containerStatuses[bizModel.BizName] = containerStatus
-
-		if !containerStatus.Ready {
-			isAllContainerReady = false
-		}
-
-		if containerStatus.State.Terminated != nil {
-			isSomeContainerFailed = true
+		bizIdentity := b.modelUtils.GetBizIdentityFromBizModel(bizModel)
+		info := bizRuntimeInfos[bizIdentity]
+		times := b.runtimeInfoStore.GetBizTimes(bizIdentity)
+		if info == nil && !times.TimedOutAt.IsZero() {
+			// install not confirmed in time and base still reports nothing of the biz
+			info = &ark.ArkBizInfo{
+				BizName:    bizModel.BizName,
+				BizVersion: bizModel.BizVersion,
+				BizState:   common.BizStateTimeout,
+			}
 		}
+		containerStatus := b.modelUtils.TranslateArkBizInfoToV1ContainerStatusWithTimes(bizModel, info, times)
+		containerStatus.RestartCount = b.runtimeInfoStore.GetRestartCount(bizIdentity)
+		containerStatuses = append(containerStatuses, *containerStatus)
 	}
 
+	aggregated := b.modelUtils.AggregatePodStatus(containerStatuses)
+	podStatus = &aggregated
 	podStatus.PodIP = b.localIP
 	podStatus.PodIPs = []corev1.PodIP{{IP: b.localIP}}
 
-	podStatus.ContainerStatuses = make([]corev1.ContainerStatus, 0)
-	for _, status := range containerStatuses {
-		podStatus.ContainerStatuses = append(podStatus.ContainerStatuses, *status)
-	}
+	return podStatus, nil
+}
 
-	podStatus.Phase = corev1.PodPending
-	if isAllContainerReady {
-		podStatus.Phase = corev1.PodRunning
-		podStatus.Conditions = []corev1.PodCondition{
-			{
-				Type:   "module.koupleless.io/installed",
-				Status: corev1.ConditionTrue,
-			},
-			{
-				Type:   "module.koupleless.io/ready",
-				Status: corev1.ConditionTrue,
-			},
-			{
-				Type:   "Ready",
-				Status: corev1.ConditionTrue,
-			},
-			{
-				Type:   "ContainersReady",
-				Status: corev1.ConditionTrue,
-			},
-		}
-	}
+// PendingBizCommands returns the biz commands published to base and waiting for confirmation
+func (b *BaseProvider) PendingBizCommands() []common.PendingBizCommand {
+	return b.bizCommands.Pending(b.nodeID)
+}
 
-	if isSomeContainerFailed {
-		podStatus.Phase = corev1.PodFailed
-		podStatus.Conditions = []corev1.PodCondition{
-			{
-				Type:   "basement.koupleless.io/installed",
-				Status: corev1.ConditionFalse,
-			},
-			{
-				Type:   "basement.koupleless.io/ready",
-				Status: corev1.ConditionFalse,
-			},
-			{
-				Type:   "Ready",
-				Status: corev1.ConditionFalse,
-			},
-			{
-				Type:   "ContainersReady",
-				Status: corev1.ConditionFalse,
-			},
-		}
+// DesiredBizModels returns the biz models of all pods on the node
+func (b *BaseProvider) DesiredBizModels() []*ark.BizModel {
+	ret := make([]*ark.BizModel, 0)
+	for _, pod := range b.runtimeInfoStore.GetPods() {
+		ret = append(ret, b.runtimeInfoStore.GetRelatedBizModels(b.modelUtils.GetPodKey(pod))...)
 	}
-
-	return podStatus, nil
+	return ret
 }
 
 // funcs below support call from users, should not support in module management
@@ -442,8 +887,9 @@ func (b *BaseProvider) GetPods(_ context.Context) ([]*corev1.Pod, error) {
 	return b.runtimeInfoStore.GetPods(), nil
 }
 
+// GetContainerLogs fetch the log lines of the biz container from base, returns ErrNodeOffline if base not replied in time
 func (b *BaseProvider) GetContainerLogs(ctx context.Context, namespace, podName, containerName string, opts api.ContainerLogOpts) (io.ReadCloser, error) {
-	return nil, nil
+	return b.fetchBizLogs(ctx, namespace, podName, containerName, opts)
 }
 
 func (b *BaseProvider) RunInContainer(ctx context.Context, namespace, podName, containerName string, cmd []string, attach api.AttachIO) error {
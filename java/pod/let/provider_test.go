@@ -0,0 +1,689 @@
+package let
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/koupleless/arkctl/v1/service/ark"
+	"github.com/koupleless/virtual-kubelet/common/mqtt/mqtttest"
+	"github.com/koupleless/virtual-kubelet/java/common"
+	"github.com/koupleless/virtual-kubelet/java/model"
+	"gotest.tools/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+var deletedPod = &corev1.Pod{
+	ObjectMeta: metav1.ObjectMeta{
+		Namespace: "default",
+		Name:      "test-pod",
+	},
+	Spec: corev1.PodSpec{
+		Containers: []corev1.Container{
+			{
+				Name:  "biz1",
+				Image: "file:///test/biz1-0.0.1.jar",
+			}, {
+				Name:  "biz2",
+				Image: "file:///test/biz2.jar",
+				Env: []corev1.EnvVar{
+					{
+						Name:  "BIZ_VERSION",
+						Value: "0.0.2",
+					},
+				},
+			},
+		},
+	},
+}
+
+// commandTopic returns the topic of command to test-node
+func commandTopic(t *testing.T, command string) string {
+	topic, err := common.FormatArkletCommandTopic("test-node", command)
+	assert.NilError(t, err)
+	return topic
+}
+
+// waitPublished wait until count of messages published to topic reaches n
+func waitPublished(t *testing.T, client *mqtttest.FakeClient, topic string, n int) []mqtttest.PublishedMessage {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if published := client.PublishedTo(topic); len(published) >= n {
+			return published
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("%d messages expected on %s, got %d", n, topic, len(client.PublishedTo(topic)))
+	return nil
+}
+
+func TestBaseProvider_installBizMqtt_Retry(t *testing.T) {
+	client := mqtttest.NewFakeClient()
+	client.FailPubs = 2
+	provider := NewBaseProvider("default", "127.0.0.1", "test-node", client, nil)
+	provider.SetPublishRetry(model.PublishRetryConfig{
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+	})
+
+	err := provider.installBizMqtt(context.Background(), &ark.BizModel{
+		BizName:    "biz1",
+		BizVersion: "0.0.1",
+	})
+	assert.NilError(t, err)
+	published := client.PublishedTo(commandTopic(t, model.CommandInstallBiz))
+	assert.Equal(t, len(published), 1)
+	assert.Equal(t, published[0].Qos, model.DefaultQosCommand)
+	var payload model.BizModelWithResources
+	assert.NilError(t, json.Unmarshal(published[0].Payload, &payload))
+	assert.Equal(t, payload.BizName, "biz1")
+}
+
+func TestBaseProvider_unInstallBizMqtt_RetryExhausted(t *testing.T) {
+	client := mqtttest.NewFakeClient()
+	client.FailPubs = 2
+	provider := NewBaseProvider("default", "127.0.0.1", "test-node", client, nil)
+	provider.SetPublishRetry(model.PublishRetryConfig{
+		MaxAttempts:    2,
+		InitialBackoff: time.Millisecond,
+	})
+
+	err := provider.unInstallBizMqtt(context.Background(), &ark.BizModel{
+		BizName:    "biz1",
+		BizVersion: "0.0.1",
+	})
+	assert.Assert(t, errors.Is(err, mqtttest.ErrFakePubFailed))
+	assert.Equal(t, len(client.PublishedTo(commandTopic(t, model.CommandUnInstallBiz))), 0)
+}
+
+func TestBaseProvider_DeletePod(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := mqtttest.NewFakeClient()
+	provider := NewBaseProvider("default", "127.0.0.1", "test-node", client, nil)
+	// base in test never confirms the uninstall
+	provider.SetCommandTimeout(50 * time.Millisecond)
+	go provider.uninstallOperationQueue.Run(ctx, 1)
+
+	assert.NilError(t, provider.CreatePod(ctx, deletedPod))
+	provider.SyncBizInfo([]ark.ArkBizInfo{
+		{BizName: "biz1", BizVersion: "0.0.1", BizState: "ACTIVATED"},
+		{BizName: "biz2", BizVersion: "0.0.2", BizState: "ACTIVATED"},
+	})
+	assert.NilError(t, provider.DeletePod(ctx, deletedPod))
+	assert.Assert(t, provider.runtimeInfoStore.GetPodByKey("default/test-pod") == nil)
+
+	published := waitPublished(t, client, commandTopic(t, model.CommandUnInstallBiz), 2)
+	uninstalled := make(map[string]bool)
+	for _, msg := range published {
+		var bizModel ark.BizModel
+		assert.NilError(t, json.Unmarshal(msg.Payload, &bizModel))
+		uninstalled[bizModel.BizName+":"+bizModel.BizVersion] = true
+	}
+	assert.DeepEqual(t, uninstalled, map[string]bool{"biz1:0.0.1": true, "biz2:0.0.2": true})
+}
+
+func TestBaseProvider_DeletePod_BaseOffline(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := mqtttest.NewFakeClient()
+	client.FailPubs = 2
+	provider := NewBaseProvider("default", "127.0.0.1", "test-node", client, nil)
+	provider.SetPublishRetry(model.PublishRetryConfig{
+		MaxAttempts:    1,
+		InitialBackoff: time.Millisecond,
+	})
+	provider.SetCommandTimeout(50 * time.Millisecond)
+	go provider.uninstallOperationQueue.Run(ctx, 1)
+
+	provider.SyncBizInfo([]ark.ArkBizInfo{
+		{BizName: "biz1", BizVersion: "0.0.1", BizState: "ACTIVATED"},
+		{BizName: "biz2", BizVersion: "0.0.2", BizState: "ACTIVATED"},
+	})
+	assert.NilError(t, provider.DeletePod(ctx, deletedPod))
+
+	topic := commandTopic(t, model.CommandUnInstallBiz)
+	pendingCount := func() int {
+		provider.pendingUnInstalls.Lock()
+		defer provider.pendingUnInstalls.Unlock()
+		return len(provider.pendingUnInstalls.bizIdentities)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for pendingCount() < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, pendingCount(), 2)
+	assert.Equal(t, len(client.PublishedTo(topic)), 0)
+
+	// base reports biz again after reconnected, the deferred uninstall is retried
+	provider.SyncBizInfo([]ark.ArkBizInfo{
+		{BizName: "biz1", BizVersion: "0.0.1", BizState: "ACTIVATED"},
+		{BizName: "biz2", BizVersion: "0.0.2", BizState: "ACTIVATED"},
+	})
+	waitPublished(t, client, topic, 2)
+}
+
+func TestBaseProvider_UpdatePod(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := mqtttest.NewFakeClient()
+	provider := NewBaseProvider("default", "127.0.0.1", "test-node", client, nil)
+	provider.SetCommandTimeout(50 * time.Millisecond)
+
+	assert.NilError(t, provider.CreatePod(ctx, deletedPod))
+	provider.SyncBizInfo([]ark.ArkBizInfo{
+		{BizName: "biz1", BizVersion: "0.0.1", BizState: "ACTIVATED"},
+		{BizName: "biz2", BizVersion: "0.0.2", BizState: "ACTIVATED"},
+	})
+
+	// biz1 upgraded by image, biz2 removed and biz3 added with only BIZ_VERSION env
+	updatedPod := deletedPod.DeepCopy()
+	updatedPod.Spec.Containers = []corev1.Container{
+		{
+			Name:  "biz1",
+			Image: "file:///test/biz1-0.0.2.jar",
+		}, {
+			Name:  "biz3",
+			Image: "file:///test/biz3.jar",
+			Env: []corev1.EnvVar{
+				{
+					Name:  "BIZ_VERSION",
+					Value: "0.0.3",
+				},
+			},
+		},
+	}
+	assert.NilError(t, provider.UpdatePod(ctx, updatedPod))
+	assert.Equal(t, provider.runtimeInfoStore.GetRelatedPodKeyByBizIdentity("biz2:0.0.2"), "")
+	go provider.installOperationQueue.Run(ctx, 1)
+	go provider.uninstallOperationQueue.Run(ctx, 1)
+
+	commandSet := func(published []mqtttest.PublishedMessage) map[string]bool {
+		ret := make(map[string]bool)
+		for _, msg := range published {
+			var bizModel ark.BizModel
+			assert.NilError(t, json.Unmarshal(msg.Payload, &bizModel))
+			ret[bizModel.BizName+":"+bizModel.BizVersion] = true
+		}
+		return ret
+	}
+	uninstalled := waitPublished(t, client, commandTopic(t, model.CommandUnInstallBiz), 2)
+	assert.DeepEqual(t, commandSet(uninstalled), map[string]bool{"biz1:0.0.1": true, "biz2:0.0.2": true})
+	installed := waitPublished(t, client, commandTopic(t, model.CommandInstallBiz), 2)
+	assert.DeepEqual(t, commandSet(installed), map[string]bool{"biz1:0.0.2": true, "biz3:0.0.3": true})
+
+	// status only update of the same spec enqueues nothing
+	provider.SyncBizInfo([]ark.ArkBizInfo{
+		{BizName: "biz1", BizVersion: "0.0.2", BizState: "ACTIVATED"},
+		{BizName: "biz3", BizVersion: "0.0.3", BizState: "ACTIVATED"},
+	})
+	assert.NilError(t, provider.UpdatePod(ctx, updatedPod.DeepCopy()))
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, len(client.PublishedTo(commandTopic(t, model.CommandInstallBiz))), 2)
+	assert.Equal(t, len(client.PublishedTo(commandTopic(t, model.CommandUnInstallBiz))), 2)
+}
+
+func TestBaseProvider_UpdatePod_RejectBizDowngrade(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := mqtttest.NewFakeClient()
+	recorder := record.NewFakeRecorder(10)
+	provider := NewBaseProvider("default", "127.0.0.1", "test-node", client, nil)
+	provider.SetEventRecorder(recorder)
+	provider.SetRejectBizDowngrade(true)
+
+	assert.NilError(t, provider.CreatePod(ctx, deletedPod))
+	provider.SyncBizInfo([]ark.ArkBizInfo{
+		{BizName: "biz1", BizVersion: "0.0.1", BizState: "ACTIVATED"},
+		{BizName: "biz2", BizVersion: "0.0.2", BizState: "ACTIVATED"},
+	})
+	go provider.installOperationQueue.Run(ctx, 1)
+	go provider.uninstallOperationQueue.Run(ctx, 1)
+	time.Sleep(100 * time.Millisecond)
+	installs := len(client.PublishedTo(commandTopic(t, model.CommandInstallBiz)))
+
+	downgradedPod := deletedPod.DeepCopy()
+	downgradedPod.Spec.Containers[1].Env[0].Value = "0.0.1"
+	assert.NilError(t, provider.UpdatePod(ctx, downgradedPod))
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, len(client.PublishedTo(commandTopic(t, model.CommandInstallBiz))), installs)
+	assert.Equal(t, len(client.PublishedTo(commandTopic(t, model.CommandUnInstallBiz))), 0)
+	assert.Equal(t, provider.runtimeInfoStore.GetRelatedPodKeyByBizIdentity("biz2:0.0.2"), "default/test-pod")
+	rejected := false
+	for len(recorder.Events) > 0 {
+		rejected = rejected || strings.HasPrefix(<-recorder.Events, "Warning "+common.EventReasonDowngradeRejected)
+	}
+	assert.Assert(t, rejected)
+
+	// the installed version is uninstalled with the pod
+	assert.NilError(t, provider.DeletePod(ctx, downgradedPod))
+	published := waitPublished(t, client, commandTopic(t, model.CommandUnInstallBiz), 2)
+	uninstalled := make(map[string]bool)
+	for _, msg := range published {
+		var bizModel ark.BizModel
+		assert.NilError(t, json.Unmarshal(msg.Payload, &bizModel))
+		uninstalled[bizModel.BizName+":"+bizModel.BizVersion] = true
+	}
+	assert.DeepEqual(t, uninstalled, map[string]bool{"biz1:0.0.1": true, "biz2:0.0.2": true})
+}
+
+func TestBaseProvider_CreatePod_InstallBizBatch(t *testing.T) {
+	ctx := context.Background()
+	client := mqtttest.NewFakeClient()
+	provider := NewBaseProvider("default", "127.0.0.1", "test-node", client, nil)
+	pod := deletedPod.DeepCopy()
+	pod.Spec.Containers = append(pod.Spec.Containers, corev1.Container{
+		Name:  "biz3",
+		Image: "file:///test/biz3-0.0.3.jar",
+		Env: []corev1.EnvVar{
+			{
+				Name:  common.BizDependsOnEnv,
+				Value: "biz1",
+			},
+		},
+	})
+
+	provider.SyncBizInfo([]ark.ArkBizInfo{})
+	assert.NilError(t, provider.CreatePod(ctx, pod))
+	published := client.PublishedTo(commandTopic(t, model.CommandInstallBizBatch))
+	assert.Equal(t, len(published), 1)
+	var batch model.InstallBizBatch
+	assert.NilError(t, json.Unmarshal(published[0].Payload, &batch))
+	installed := make([]string, 0)
+	for _, bizModel := range batch.BizModels {
+		installed = append(installed, bizModel.BizName+":"+bizModel.BizVersion)
+	}
+	assert.DeepEqual(t, installed, []string{"biz1:0.0.1", "biz2:0.0.2", "biz3:0.0.3"})
+	assert.Equal(t, len(client.PublishedTo(commandTopic(t, model.CommandInstallBiz))), 0)
+	assert.Equal(t, provider.installOperationQueue.Len(), 0)
+
+	// installed biz are skipped, the only biz left is installed by single command
+	client = mqtttest.NewFakeClient()
+	provider = NewBaseProvider("default", "127.0.0.1", "test-node", client, nil)
+	provider.SyncBizInfo([]ark.ArkBizInfo{
+		{BizName: "biz1", BizVersion: "0.0.1", BizState: "ACTIVATED"},
+		{BizName: "biz2", BizVersion: "0.0.2", BizState: "RESOLVED"},
+	})
+	assert.NilError(t, provider.CreatePod(ctx, pod))
+	assert.Equal(t, len(client.PublishedTo(commandTopic(t, model.CommandInstallBizBatch))), 0)
+	assert.Equal(t, provider.installOperationQueue.Len(), 1)
+
+	// biz list of base unknown yet, installed one by one
+	client = mqtttest.NewFakeClient()
+	provider = NewBaseProvider("default", "127.0.0.1", "test-node", client, nil)
+	assert.NilError(t, provider.CreatePod(ctx, pod))
+	assert.Equal(t, len(client.PublishedTo(commandTopic(t, model.CommandInstallBizBatch))), 0)
+	assert.Equal(t, provider.installOperationQueue.Len(), 3)
+}
+
+func TestBaseProvider_CreatePod_InstallBizBatch_Confirmation(t *testing.T) {
+	ctx := context.Background()
+	client := mqtttest.NewFakeClient()
+	recorder := &fakeMetricsRecorder{}
+	provider := NewBaseProvider("default", "127.0.0.1", "test-node", client, nil)
+	provider.SetCommandTimeout(200 * time.Millisecond)
+	provider.SetMaxConcurrentBizOps(1)
+	provider.SetMetricsRecorder(recorder)
+
+	provider.SyncBizInfo([]ark.ArkBizInfo{})
+	assert.NilError(t, provider.CreatePod(ctx, deletedPod))
+	assert.Equal(t, len(client.PublishedTo(commandTopic(t, model.CommandInstallBizBatch))), 1)
+	assert.DeepEqual(t, provider.PendingBizCommands(), []common.PendingBizCommand{
+		{Command: model.CommandInstallBizBatch, BizIdentity: "biz1:0.0.1"},
+		{Command: model.CommandInstallBizBatch, BizIdentity: "biz2:0.0.2"},
+	})
+	// the batch holds the only slot until its biz confirmed or timed out
+	acquireCtx, cancelAcquire := context.WithTimeout(ctx, 50*time.Millisecond)
+	_, err := provider.bizOps.Acquire(acquireCtx, "test-node")
+	cancelAcquire()
+	assert.Assert(t, errors.Is(err, context.DeadlineExceeded))
+
+	provider.SyncBizInfo([]ark.ArkBizInfo{
+		{BizName: "biz1", BizVersion: "0.0.1", BizState: "ACTIVATED"},
+	})
+	acquireCtx, cancelAcquire = context.WithTimeout(ctx, 5*time.Second)
+	defer cancelAcquire()
+	release, err := provider.bizOps.Acquire(acquireCtx, "test-node")
+	assert.NilError(t, err)
+	release()
+
+	installs, _ := recorder.observed()
+	assert.Equal(t, len(installs), 2)
+	failed := 0
+	for _, err := range installs {
+		if errors.Is(err, common.ErrBizCommandTimeout) {
+			failed++
+		}
+	}
+	assert.Equal(t, failed, 1)
+	assert.Equal(t, len(provider.PendingBizCommands()), 0)
+	assert.Assert(t, !provider.runtimeInfoStore.GetBizTimes("biz2:0.0.2").TimedOutAt.IsZero())
+	assert.Assert(t, provider.runtimeInfoStore.GetBizTimes("biz1:0.0.1").TimedOutAt.IsZero())
+}
+
+func TestBaseProvider_CreatePod_InitBiz(t *testing.T) {
+	ctx := context.Background()
+	client := mqtttest.NewFakeClient()
+	provider := NewBaseProvider("default", "127.0.0.1", "test-node", client, nil)
+	provider.SetCommandTimeout(50 * time.Millisecond)
+	pod := deletedPod.DeepCopy()
+	pod.Spec.InitContainers = []corev1.Container{
+		{
+			Name:  "init",
+			Image: "file:///test/init-1.0.0.jar",
+		},
+	}
+
+	provider.SyncBizInfo([]ark.ArkBizInfo{})
+	assert.NilError(t, provider.CreatePod(ctx, pod))
+	assert.Equal(t, len(client.PublishedTo(commandTopic(t, model.CommandInstallBizBatch))), 0)
+	assert.Equal(t, provider.installOperationQueue.Len(), 3)
+
+	// biz are held until the init biz activated
+	assert.Assert(t, provider.handleInstallOperation(ctx, "biz1:0.0.1") != nil)
+	assert.NilError(t, provider.handleInstallOperation(ctx, "init:1.0.0"))
+	assert.Equal(t, len(client.PublishedTo(commandTopic(t, model.CommandInstallBiz))), 1)
+	provider.SyncBizInfo([]ark.ArkBizInfo{
+		{BizName: "init", BizVersion: "1.0.0", BizState: "ACTIVATED"},
+	})
+	assert.NilError(t, provider.handleInstallOperation(ctx, "biz1:0.0.1"))
+	assert.Equal(t, len(client.PublishedTo(commandTopic(t, model.CommandInstallBiz))), 2)
+
+	// init biz are uninstalled with the pod
+	assert.NilError(t, provider.DeletePod(ctx, pod))
+	assert.Equal(t, provider.uninstallOperationQueue.Len(), 3)
+}
+
+func TestBaseProvider_SyncBizInfo_Events(t *testing.T) {
+	ctx := context.Background()
+	client := mqtttest.NewFakeClient()
+	recorder := record.NewFakeRecorder(10)
+	provider := NewBaseProvider("default", "127.0.0.1", "test-node", client, nil)
+	provider.SetEventRecorder(recorder)
+	provider.SetCommandTimeout(50 * time.Millisecond)
+	assert.NilError(t, provider.CreatePod(ctx, deletedPod))
+
+	provider.SyncBizInfo([]ark.ArkBizInfo{})
+	assert.NilError(t, provider.handleInstallOperation(ctx, "biz1:0.0.1"))
+	provider.SyncBizInfo([]ark.ArkBizInfo{
+		{BizName: "biz1", BizVersion: "0.0.1", BizState: "RESOLVED"},
+	})
+	provider.SyncBizInfo([]ark.ArkBizInfo{
+		{BizName: "biz1", BizVersion: "0.0.1", BizState: "ACTIVATED"},
+	})
+	// unchanged state should not record event again
+	provider.SyncBizInfo([]ark.ArkBizInfo{
+		{BizName: "biz1", BizVersion: "0.0.1", BizState: "ACTIVATED"},
+	})
+	provider.SyncBizInfo([]ark.ArkBizInfo{
+		{BizName: "biz1", BizVersion: "0.0.1", BizState: "ACTIVATED"},
+		{BizName: "biz2", BizVersion: "0.0.2", BizState: "BROKEN"},
+	})
+
+	reasons := make([]string, 0)
+	for len(recorder.Events) > 0 {
+		fields := strings.Fields(<-recorder.Events)
+		reasons = append(reasons, fields[0]+" "+fields[1])
+	}
+	assert.DeepEqual(t, reasons, []string{
+		"Normal " + common.EventReasonInstallRequested,
+		"Normal " + common.EventReasonResolved,
+		"Normal " + common.EventReasonActivated,
+		"Warning " + common.EventReasonInstallFailed,
+	})
+}
+
+func TestBaseProvider_SyncBizInfo_EventOutsideLock(t *testing.T) {
+	ctx := context.Background()
+	// recording blocks until the event read
+	recorder := record.NewFakeRecorder(0)
+	provider := NewBaseProvider("default", "127.0.0.1", "test-node", mqtttest.NewFakeClient(), nil)
+	provider.SetEventRecorder(recorder)
+	assert.NilError(t, provider.CreatePod(ctx, deletedPod))
+
+	synced := make(chan struct{})
+	go func() {
+		defer close(synced)
+		provider.SyncBizInfo([]ark.ArkBizInfo{
+			{BizName: "biz1", BizVersion: "0.0.1", BizState: "ACTIVATED"},
+		})
+	}()
+
+	// the biz info list is readable while the event is being recorded
+	queried := make(chan struct{})
+	go func() {
+		defer close(queried)
+		for {
+			if bizInfo, _ := provider.queryBiz(ctx, "biz1:0.0.1"); bizInfo != nil {
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	select {
+	case <-queried:
+	case <-time.After(5 * time.Second):
+		t.Fatal("biz info list locked while recording event")
+	}
+	assert.Assert(t, strings.Contains(<-recorder.Events, common.EventReasonActivated))
+	<-synced
+}
+
+func TestBaseProvider_installBizMqtt_DryRun(t *testing.T) {
+	client := mqtttest.NewFakeClient()
+	provider := NewBaseProvider("default", "127.0.0.1", "test-node", client, nil)
+	provider.SetDryRun(true)
+
+	bizModel := &ark.BizModel{
+		BizName:    "biz1",
+		BizVersion: "0.0.1",
+	}
+	assert.NilError(t, provider.installBizMqtt(context.Background(), bizModel))
+	assert.NilError(t, provider.unInstallBizMqtt(context.Background(), bizModel))
+	assert.Equal(t, len(client.Published()), 0)
+}
+
+var singleBizPod = &corev1.Pod{
+	ObjectMeta: metav1.ObjectMeta{
+		Namespace: "default",
+		Name:      "single-biz-pod",
+	},
+	Spec: corev1.PodSpec{
+		Containers: []corev1.Container{
+			{
+				Name:  "biz1",
+				Image: "file:///test/biz1-0.0.1.jar",
+			},
+		},
+	},
+}
+
+func TestBaseProvider_CreatePod_CommandConfirmed(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := mqtttest.NewFakeClient()
+	provider := NewBaseProvider("default", "127.0.0.1", "test-node", client, nil)
+	go provider.installOperationQueue.Run(ctx, 1)
+
+	provider.SyncBizInfo([]ark.ArkBizInfo{})
+	assert.NilError(t, provider.CreatePod(ctx, singleBizPod))
+	waitPublished(t, client, commandTopic(t, model.CommandInstallBiz), 1)
+	assert.DeepEqual(t, provider.PendingBizCommands(), []common.PendingBizCommand{
+		{Command: model.CommandInstallBiz, BizIdentity: "biz1:0.0.1"},
+	})
+
+	provider.SyncBizInfo([]ark.ArkBizInfo{
+		{BizName: "biz1", BizVersion: "0.0.1", BizState: "ACTIVATED"},
+	})
+	deadline := time.Now().Add(5 * time.Second)
+	for len(provider.PendingBizCommands()) > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, len(provider.PendingBizCommands()), 0)
+	assert.Assert(t, provider.runtimeInfoStore.GetBizTimes("biz1:0.0.1").TimedOutAt.IsZero())
+}
+
+func TestBaseProvider_CreatePod_CommandTimeout(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := mqtttest.NewFakeClient()
+	provider := NewBaseProvider("default", "127.0.0.1", "test-node", client, nil)
+	provider.SetCommandTimeout(50 * time.Millisecond)
+	go provider.installOperationQueue.Run(ctx, 1)
+
+	provider.SyncBizInfo([]ark.ArkBizInfo{})
+	assert.NilError(t, provider.CreatePod(ctx, singleBizPod))
+	deadline := time.Now().Add(5 * time.Second)
+	for provider.runtimeInfoStore.GetBizTimes("biz1:0.0.1").TimedOutAt.IsZero() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	status, err := provider.GetPodStatus(ctx, "default", "single-biz-pod")
+	assert.NilError(t, err)
+	terminated := status.ContainerStatuses[0].State.Terminated
+	assert.Assert(t, terminated != nil)
+	assert.Equal(t, terminated.Reason, "BizCommandTimeout")
+	// the finish time is when the timeout fired, not when the status is computed
+	time.Sleep(10 * time.Millisecond)
+	status, err = provider.GetPodStatus(ctx, "default", "single-biz-pod")
+	assert.NilError(t, err)
+	assert.Assert(t, status.ContainerStatuses[0].State.Terminated.FinishedAt.Equal(&terminated.FinishedAt))
+	// not retried, the install command is published once
+	assert.Equal(t, len(client.PublishedTo(commandTopic(t, model.CommandInstallBiz))), 1)
+
+	// base reports the biz late, the reported state replaces the timeout
+	provider.SyncBizInfo([]ark.ArkBizInfo{
+		{BizName: "biz1", BizVersion: "0.0.1", BizState: "ACTIVATED"},
+	})
+	status, err = provider.GetPodStatus(ctx, "default", "single-biz-pod")
+	assert.NilError(t, err)
+	assert.Assert(t, status.ContainerStatuses[0].State.Running != nil)
+}
+
+func TestBaseProvider_CreatePod_MaxConcurrentBizOps(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := mqtttest.NewFakeClient()
+	provider := NewBaseProvider("default", "127.0.0.1", "test-node", client, nil)
+	provider.SetMaxConcurrentBizOps(2)
+	provider.Run(ctx)
+
+	provider.SyncBizInfo([]ark.ArkBizInfo{})
+	for i := 1; i <= 5; i++ {
+		pod := singleBizPod.DeepCopy()
+		pod.Name = fmt.Sprintf("pod-%d", i)
+		pod.Spec.Containers[0].Name = fmt.Sprintf("biz%d", i)
+		pod.Spec.Containers[0].Image = fmt.Sprintf("file:///test/biz%d-0.0.1.jar", i)
+		assert.NilError(t, provider.CreatePod(ctx, pod))
+	}
+
+	topic := commandTopic(t, model.CommandInstallBiz)
+	activated := make([]ark.ArkBizInfo, 0)
+	for _, outstanding := range []int{2, 4, 5} {
+		published := waitPublished(t, client, topic, outstanding)
+		// no more than 2 installs of the node outstanding before base confirms any
+		time.Sleep(100 * time.Millisecond)
+		assert.Equal(t, len(client.PublishedTo(topic)), outstanding)
+		assert.Assert(t, len(provider.PendingBizCommands()) <= 2)
+
+		for _, msg := range published[len(activated):] {
+			var bizModel ark.BizModel
+			assert.NilError(t, json.Unmarshal(msg.Payload, &bizModel))
+			activated = append(activated, ark.ArkBizInfo{BizName: bizModel.BizName, BizVersion: bizModel.BizVersion, BizState: "ACTIVATED"})
+		}
+		provider.SyncBizInfo(activated)
+	}
+}
+
+type fakeMetricsRecorder struct {
+	sync.Mutex
+	installs   []error
+	reconciles int
+}
+
+func (r *fakeMetricsRecorder) ObserveBizInstall(err error) {
+	r.Lock()
+	defer r.Unlock()
+	r.installs = append(r.installs, err)
+}
+
+func (r *fakeMetricsRecorder) ObserveReconcile(time.Duration) {
+	r.Lock()
+	defer r.Unlock()
+	r.reconciles++
+}
+
+func (r *fakeMetricsRecorder) observed() ([]error, int) {
+	r.Lock()
+	defer r.Unlock()
+	return append([]error{}, r.installs...), r.reconciles
+}
+
+func TestBaseProvider_MetricsRecorder(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := mqtttest.NewFakeClient()
+	recorder := &fakeMetricsRecorder{}
+	provider := NewBaseProvider("default", "127.0.0.1", "test-node", client, nil)
+	provider.SetCommandTimeout(200 * time.Millisecond)
+	provider.SetMetricsRecorder(recorder)
+	go provider.installOperationQueue.Run(ctx, 1)
+
+	waitInstalls := func(n int) []error {
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			if installs, _ := recorder.observed(); len(installs) >= n {
+				return installs
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatalf("%d installs expected to be observed", n)
+		return nil
+	}
+
+	provider.SyncBizInfo([]ark.ArkBizInfo{})
+	assert.NilError(t, provider.CreatePod(ctx, singleBizPod))
+	waitPublished(t, client, commandTopic(t, model.CommandInstallBiz), 1)
+	provider.SyncBizInfo([]ark.ArkBizInfo{
+		{BizName: "biz1", BizVersion: "0.0.1", BizState: "ACTIVATED"},
+	})
+	installs := waitInstalls(1)
+	assert.NilError(t, installs[0])
+
+	// not confirmed by base
+	pod := singleBizPod.DeepCopy()
+	pod.Name = "other-biz-pod"
+	pod.Spec.Containers[0].Name = "biz2"
+	pod.Spec.Containers[0].Image = "file:///test/biz2-0.0.1.jar"
+	assert.NilError(t, provider.CreatePod(ctx, pod))
+	installs = waitInstalls(2)
+	assert.Assert(t, errors.Is(installs[1], common.ErrBizCommandTimeout))
+
+	_, reconciles := recorder.observed()
+	assert.Equal(t, reconciles, 2)
+}
+
+func TestBaseProvider_GetPodStatus_BaseOffline(t *testing.T) {
+	ctx := context.Background()
+	provider := NewBaseProvider("default", "127.0.0.1", "test-node", mqtttest.NewFakeClient(), nil)
+	assert.NilError(t, provider.CreatePod(ctx, deletedPod))
+
+	provider.SetBaseOffline(true)
+	status, err := provider.GetPodStatus(ctx, "default", "test-pod")
+	assert.NilError(t, err)
+	assert.Equal(t, status.Phase, corev1.PodFailed)
+	assert.Equal(t, status.Reason, PodReasonNodeLost)
+
+	provider.SetBaseOffline(false)
+	status, err = provider.GetPodStatus(ctx, "default", "test-pod")
+	assert.NilError(t, err)
+	assert.Assert(t, status.Phase != corev1.PodFailed)
+	assert.Equal(t, len(status.ContainerStatuses), 2)
+}
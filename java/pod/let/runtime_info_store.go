@@ -16,6 +16,7 @@ package let
 
 import (
 	"sync"
+	"time"
 
 	"github.com/koupleless/arkctl/v1/service/ark"
 	"github.com/koupleless/virtual-kubelet/java/common"
@@ -30,6 +31,18 @@ type RuntimeInfoStore struct {
 	podKeyToPod                map[string]*corev1.Pod
 	podKeyToBizModels          map[string][]*ark.BizModel
 	bizIdentityToRelatedPodKey map[string]string
+	bizIdentityToRestartState  map[string]*bizRestartState
+	bizIdentityToEventReason   map[string]string
+	bizIdentityToTimedOutAt    map[string]time.Time
+}
+
+// bizRestartState track the activation of a biz to count its restarts and time its lifecycle
+type bizRestartState struct {
+	everActivated bool
+	activated     bool
+	restartCount  int32
+	activatedAt   time.Time
+	deactivatedAt time.Time
 }
 
 func NewRuntimeInfoStore() *RuntimeInfoStore {
@@ -39,11 +52,21 @@ func NewRuntimeInfoStore() *RuntimeInfoStore {
 		podKeyToPod:                make(map[string]*corev1.Pod),
 		podKeyToBizModels:          make(map[string][]*ark.BizModel),
 		bizIdentityToRelatedPodKey: make(map[string]string),
+		bizIdentityToRestartState:  make(map[string]*bizRestartState),
+		bizIdentityToEventReason:   make(map[string]string),
+		bizIdentityToTimedOutAt:    make(map[string]time.Time),
 	}
 }
 
+// setDefaultBizVersion set the version of stored biz models whose containers provide none
+func (r *RuntimeInfoStore) setDefaultBizVersion(defaultBizVersion string) {
+	r.Lock()
+	defer r.Unlock()
+	r.modelUtils.DefaultBizVersion = defaultBizVersion
+}
+
 func (r *RuntimeInfoStore) getPodKey(pod *corev1.Pod) string {
-	return pod.Namespace + "/" + pod.Name
+	return r.modelUtils.GetPodKey(pod)
 }
 
 func (r *RuntimeInfoStore) getBizIdentity(biz *ark.BizModel) string {
@@ -56,9 +79,17 @@ func (r *RuntimeInfoStore) PutPod(pod *corev1.Pod) {
 
 	podKey := r.getPodKey(pod)
 
+	// biz removed or replaced by update are no longer related to the pod
+	for _, bizModel := range r.podKeyToBizModels[podKey] {
+		delete(r.bizIdentityToRelatedPodKey, r.getBizIdentity(bizModel))
+	}
+
 	// create or update
 	r.podKeyToPod[podKey] = pod
-	r.podKeyToBizModels[podKey] = r.modelUtils.GetBizModelsFromCoreV1Pod(pod)
+	// biz models with unresolved version are still tracked, the error is surfaced by provider
+	initBizModels, _ := r.modelUtils.GetInitBizModelsFromCoreV1Pod(pod)
+	bizModels, _ := r.modelUtils.GetBizModelsFromCoreV1Pod(pod)
+	r.podKeyToBizModels[podKey] = append(initBizModels, bizModels...)
 	for _, bizModel := range r.podKeyToBizModels[podKey] {
 		// the biz identity naming convention should guarantee there would be no potential conflict
 		// for now we use bizName:version as the identity, the constraint cannot be applied.
@@ -77,6 +108,9 @@ func (r *RuntimeInfoStore) DeletePod(podKey string) {
 		// for now we use bizName:version as the identity, the constraint cannot be applied.
 		// further mechnanism to avoid this is required, for now we just leave the risk here.
 		delete(r.bizIdentityToRelatedPodKey, r.getBizIdentity(bizModel))
+		delete(r.bizIdentityToRestartState, r.getBizIdentity(bizModel))
+		delete(r.bizIdentityToEventReason, r.getBizIdentity(bizModel))
+		delete(r.bizIdentityToTimedOutAt, r.getBizIdentity(bizModel))
 	}
 
 	delete(r.podKeyToBizModels, podKey)
@@ -116,6 +150,84 @@ func (r *RuntimeInfoStore) GetRelatedBizModels(podKey string) []*ark.BizModel {
 	return r.podKeyToBizModels[podKey]
 }
 
+// ObserveActivatedBiz update the activation of all biz related to pods with the activated biz identities,
+// a biz activated again after being deactivated or uninstalled is counted as a restart, and the transition times are tracked
+func (r *RuntimeInfoStore) ObserveActivatedBiz(activatedBizIdentities map[string]bool) {
+	r.Lock()
+	defer r.Unlock()
+	now := time.Now()
+	for bizIdentity := range r.bizIdentityToRelatedPodKey {
+		state, has := r.bizIdentityToRestartState[bizIdentity]
+		if !has {
+			state = &bizRestartState{}
+			r.bizIdentityToRestartState[bizIdentity] = state
+		}
+		activated := activatedBizIdentities[bizIdentity]
+		if activated && !state.activated && state.everActivated {
+			state.restartCount++
+		}
+		if activated && !state.activated {
+			state.activatedAt = now
+			state.deactivatedAt = time.Time{}
+		}
+		if !activated && state.activated {
+			state.deactivatedAt = now
+		}
+		if activated {
+			state.everActivated = true
+		}
+		state.activated = activated
+	}
+}
+
+// SetBizTimedOutAt record the time the latest command of biz was given up unconfirmed, zero clears it
+func (r *RuntimeInfoStore) SetBizTimedOutAt(bizIdentity string, timedOutAt time.Time) {
+	r.Lock()
+	defer r.Unlock()
+	if timedOutAt.IsZero() {
+		delete(r.bizIdentityToTimedOutAt, bizIdentity)
+		return
+	}
+	r.bizIdentityToTimedOutAt[bizIdentity] = timedOutAt
+}
+
+// GetBizTimes returns the times biz was first seen activated and deactivated by ObserveActivatedBiz,
+// and the time its latest command timed out
+func (r *RuntimeInfoStore) GetBizTimes(bizIdentity string) common.BizTimes {
+	r.RLock()
+	defer r.RUnlock()
+	times := common.BizTimes{
+		TimedOutAt: r.bizIdentityToTimedOutAt[bizIdentity],
+	}
+	if state, has := r.bizIdentityToRestartState[bizIdentity]; has {
+		times.ActivatedAt = state.activatedAt
+		times.DeactivatedAt = state.deactivatedAt
+	}
+	return times
+}
+
+// GetRestartCount returns the restart count of biz
+func (r *RuntimeInfoStore) GetRestartCount(bizIdentity string) int32 {
+	r.RLock()
+	defer r.RUnlock()
+	state, has := r.bizIdentityToRestartState[bizIdentity]
+	if !has {
+		return 0
+	}
+	return state.restartCount
+}
+
+// ObserveBizEventReason record the latest lifecycle event reason of biz, returns false if unchanged
+func (r *RuntimeInfoStore) ObserveBizEventReason(bizIdentity, reason string) bool {
+	r.Lock()
+	defer r.Unlock()
+	if r.bizIdentityToEventReason[bizIdentity] == reason {
+		return false
+	}
+	r.bizIdentityToEventReason[bizIdentity] = reason
+	return true
+}
+
 func (r *RuntimeInfoStore) GetPods() []*corev1.Pod {
 	r.RLock()
 	defer r.RUnlock()
@@ -122,3 +122,49 @@ func TestRuntimeInfoStore_GetRelatedPodKeyByBizIdentity(t *testing.T) {
 	}))
 	assert.Assert(t, podKey == "")
 }
+
+func TestRuntimeInfoStore_ObserveActivatedBiz(t *testing.T) {
+	store := NewRuntimeInfoStore()
+	store.PutPod(defaultPod)
+	bizIdentity := store.getBizIdentity(&ark.BizModel{
+		BizName:    "test-container1",
+		BizVersion: "1.1.1",
+	})
+	store.ObserveActivatedBiz(map[string]bool{})
+	assert.Assert(t, store.GetRestartCount(bizIdentity) == 0)
+	store.ObserveActivatedBiz(map[string]bool{bizIdentity: true})
+	assert.Assert(t, store.GetRestartCount(bizIdentity) == 0)
+	store.ObserveActivatedBiz(map[string]bool{bizIdentity: true})
+	assert.Assert(t, store.GetRestartCount(bizIdentity) == 0)
+
+	// deactivated then reactivated
+	store.ObserveActivatedBiz(map[string]bool{})
+	store.ObserveActivatedBiz(map[string]bool{bizIdentity: true})
+	assert.Assert(t, store.GetRestartCount(bizIdentity) == 1)
+
+	store.DeletePod(store.modelUtils.GetPodKey(defaultPod))
+	assert.Assert(t, store.GetRestartCount(bizIdentity) == 0)
+}
+
+func TestRuntimeInfoStore_GetBizTimes(t *testing.T) {
+	store := NewRuntimeInfoStore()
+	store.PutPod(defaultPod)
+	bizIdentity := store.getBizIdentity(&ark.BizModel{
+		BizName:    "test-container1",
+		BizVersion: "1.1.1",
+	})
+	store.ObserveActivatedBiz(map[string]bool{})
+	assert.Assert(t, store.GetBizTimes(bizIdentity).ActivatedAt.IsZero())
+
+	store.ObserveActivatedBiz(map[string]bool{bizIdentity: true})
+	activatedAt := store.GetBizTimes(bizIdentity).ActivatedAt
+	assert.Assert(t, !activatedAt.IsZero())
+	store.ObserveActivatedBiz(map[string]bool{bizIdentity: true})
+	assert.Assert(t, store.GetBizTimes(bizIdentity).ActivatedAt.Equal(activatedAt))
+	assert.Assert(t, store.GetBizTimes(bizIdentity).DeactivatedAt.IsZero())
+
+	store.ObserveActivatedBiz(map[string]bool{})
+	times := store.GetBizTimes(bizIdentity)
+	assert.Assert(t, times.ActivatedAt.Equal(activatedAt))
+	assert.Assert(t, !times.DeactivatedAt.Before(activatedAt))
+}
@@ -0,0 +1,109 @@
+package node
+
+import (
+	"context"
+	"fmt"
+	"github.com/koupleless/virtual-kubelet/java/model"
+	"github.com/virtual-kubelet/virtual-kubelet/log"
+	"github.com/virtual-kubelet/virtual-kubelet/node"
+	"github.com/virtual-kubelet/virtual-kubelet/node/nodeutil"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"time"
+)
+
+// nodeControllers runs the pod controller and node controller of a virtual node as nodeutil.Node does, built from
+// the node package so that the node lease is configurable, nodeutil fixes it to 40s
+type nodeControllers struct {
+	nc *node.NodeController
+	pc *node.PodController
+
+	podInformerFactory informers.SharedInformerFactory
+	scmInformerFactory informers.SharedInformerFactory
+
+	workers int
+
+	ready chan struct{}
+	done  chan struct{}
+	err   error
+}
+
+// nodeLeaseOpt returns the option enabling the v1 lease of node, renewed in a quarter of duration if renewInterval is zero
+func nodeLeaseOpt(clientSet kubernetes.Interface, leaseDuration, renewInterval time.Duration) node.NodeControllerOpt {
+	if leaseDuration <= 0 {
+		leaseDuration = model.DefaultNodeLeaseDuration
+	}
+	leaseDurationSeconds := int32(leaseDuration / time.Second)
+	if renewInterval <= 0 {
+		return node.WithNodeEnableLeaseV1(nodeutil.NodeLeaseV1Client(clientSet), leaseDurationSeconds)
+	}
+	return node.WithNodeEnableLeaseV1WithRenewInterval(nodeutil.NodeLeaseV1Client(clientSet), leaseDurationSeconds, renewInterval)
+}
+
+// Run starts the informers and the pod controller, then the node controller once the pod controller ready
+func (n *nodeControllers) Run(ctx context.Context) (retErr error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer func() {
+		cancel()
+		n.err = retErr
+		close(n.done)
+	}()
+
+	go n.podInformerFactory.Start(ctx.Done())
+	go n.scmInformerFactory.Start(ctx.Done())
+	go n.pc.Run(ctx, n.workers) //nolint:errcheck
+	defer func() {
+		cancel()
+		<-n.pc.Done()
+	}()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-n.pc.Ready():
+	case <-n.pc.Done():
+		return n.pc.Err()
+	}
+	log.G(ctx).Debug("pod controller ready")
+
+	go n.nc.Run(ctx) //nolint:errcheck
+	defer func() {
+		cancel()
+		<-n.nc.Done()
+	}()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-n.nc.Ready():
+	case <-n.nc.Done():
+		return n.nc.Err()
+	}
+	log.G(ctx).Debug("node controller ready")
+	close(n.ready)
+
+	select {
+	case <-n.nc.Done():
+		return n.nc.Err()
+	case <-n.pc.Done():
+		return n.pc.Err()
+	}
+}
+
+// WaitReady waits for the specified timeout for the controllers to be ready
+func (n *nodeControllers) WaitReady(ctx context.Context, timeout time.Duration) error {
+	if timeout > 0 {
+		var cancel func()
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	select {
+	case <-n.ready:
+		return nil
+	case <-n.done:
+		return fmt.Errorf("controller exited before ready: %w", n.err)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
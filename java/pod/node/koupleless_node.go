@@ -9,28 +9,44 @@ import (
 	podlet "github.com/koupleless/virtual-kubelet/java/pod/let"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
+	"github.com/virtual-kubelet/virtual-kubelet/errdefs"
 	"github.com/virtual-kubelet/virtual-kubelet/node"
+	"github.com/virtual-kubelet/virtual-kubelet/node/api"
 	"github.com/virtual-kubelet/virtual-kubelet/node/nodeutil"
+	"io"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/utils/ptr"
-	"runtime"
+	"path"
 	"time"
 )
 
 type KouplelessNode struct {
 	clientSet  *kubernetes.Clientset
-	mqttClient *mqtt.Client
+	mqttClient mqtt.Publisher
 	nodeID     string
 
+	heartbeatInterval      time.Duration
+	heartbeatJitterPercent int
+	qosHeartbeat           byte
+	qosCommand             byte
+
 	vnode       *VirtualKubeletNode
 	podProvider *podlet.BaseProvider
-	node        *nodeutil.Node
+	node        *nodeControllers
+
+	eventBroadcaster record.EventBroadcaster
 
 	done  chan struct{}
 	ready chan struct{}
 
 	BaseHealthInfoChan chan ark.HealthData
+	BaseHeartbeatChan  chan model.NodeHeartbeat
 	BaseBizInfoChan    chan []ark.ArkBizInfo
 	BaseBizExitChan    chan struct{}
 
@@ -43,6 +59,7 @@ func (n *KouplelessNode) Run(ctx context.Context) {
 	ctx, cancel := context.WithCancel(ctx)
 	defer func() {
 		cancel()
+		n.eventBroadcaster.Shutdown()
 		n.err = err
 		close(n.done)
 	}()
@@ -55,12 +72,13 @@ func (n *KouplelessNode) Run(ctx context.Context) {
 
 	go n.listenAndSync(ctx)
 
-	go common.TimedTaskWithInterval(ctx, time.Second*9, func(ctx context.Context) {
-		n.mqttClient.Pub(common.FormatArkletCommandTopic(n.nodeID, model.CommandHealth), 0, "{}")
+	// health commands act as node heartbeat, jittered so that heartbeats of nodes don't spike the broker together
+	go common.TimedTaskWithJitter(ctx, n.heartbeatInterval, n.heartbeatJitterPercent, func(ctx context.Context) {
+		n.publishCommand(ctx, model.CommandHealth, n.qosHeartbeat)
 	})
 
 	go common.TimedTaskWithInterval(ctx, time.Second*5, func(ctx context.Context) {
-		n.mqttClient.Pub(common.FormatArkletCommandTopic(n.nodeID, model.CommandQueryAllBiz), 0, "{}")
+		n.publishCommand(ctx, model.CommandQueryAllBiz, n.qosCommand)
 	})
 
 	select {
@@ -92,6 +110,16 @@ func (n *KouplelessNode) Run(ctx context.Context) {
 	}
 }
 
+// publishCommand publish the command without payload to base, skipped with an error log if the node id is not a valid topic segment
+func (n *KouplelessNode) publishCommand(ctx context.Context, command string, qos byte) {
+	topic, err := common.FormatArkletCommandTopic(n.nodeID, command)
+	if err != nil {
+		logrus.WithField("nodeID", n.nodeID).WithError(err).Errorf("skip publishing %s command", command)
+		return
+	}
+	n.mqttClient.PubWithRetained(ctx, topic, qos, false, "{}")
+}
+
 func (n *KouplelessNode) listenAndSync(ctx context.Context) {
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
@@ -100,13 +128,81 @@ func (n *KouplelessNode) listenAndSync(ctx context.Context) {
 		case <-ctx.Done():
 			return
 		case healthData := <-n.BaseHealthInfoChan:
+			n.podProvider.SetBaseOffline(false)
 			go n.vnode.Notify(healthData)
+		case heartbeat := <-n.BaseHeartbeatChan:
+			go n.vnode.NotifyHeartbeat(heartbeat)
 		case bizInfos := <-n.BaseBizInfoChan:
 			go n.podProvider.SyncBizInfo(bizInfos)
 		}
 	}
 }
 
+// Shutdown releases the resources of a node never run, e.g. the event broadcaster recording to api server,
+// the node run releases them on exit
+func (n *KouplelessNode) Shutdown() {
+	n.eventBroadcaster.Shutdown()
+}
+
+// MarkNotReady set the virtual node NotReady, so that no more pods are scheduled to it
+func (n *KouplelessNode) MarkNotReady() {
+	if n.vnode == nil {
+		return
+	}
+	n.vnode.NotifyNotReady()
+}
+
+// MarkOffline set the virtual node NotReady and fail its pods, so that their controllers replace them on other nodes,
+// the node is Ready again once base health data arrives
+func (n *KouplelessNode) MarkOffline() {
+	n.MarkNotReady()
+	if n.podProvider == nil {
+		return
+	}
+	n.podProvider.SetBaseOffline(true)
+}
+
+// IsReady returns true if the virtual node is Ready
+func (n *KouplelessNode) IsReady() bool {
+	if n.vnode == nil {
+		return false
+	}
+	return n.vnode.IsReady()
+}
+
+// DesiredBizModels returns the biz models of pods scheduled to the node
+func (n *KouplelessNode) DesiredBizModels() []*ark.BizModel {
+	if n.podProvider == nil {
+		return nil
+	}
+	return n.podProvider.DesiredBizModels()
+}
+
+// PendingBizCommands returns the biz commands of the node waiting for base confirmation
+func (n *KouplelessNode) PendingBizCommands() []common.PendingBizCommand {
+	if n.podProvider == nil {
+		return nil
+	}
+	return n.podProvider.PendingBizCommands()
+}
+
+// HasPod returns true if the pod is scheduled to the node
+func (n *KouplelessNode) HasPod(namespace, name string) bool {
+	if n.podProvider == nil {
+		return false
+	}
+	pod, _ := n.podProvider.GetPod(context.Background(), namespace, name)
+	return pod != nil
+}
+
+// GetContainerLogs fetch the log lines of the biz container from base, see podlet.BaseProvider.GetContainerLogs
+func (n *KouplelessNode) GetContainerLogs(ctx context.Context, namespace, podName, containerName string, opts api.ContainerLogOpts) (io.ReadCloser, error) {
+	if n.podProvider == nil {
+		return nil, errdefs.NotFoundf("pod %s/%s not found", namespace, podName)
+	}
+	return n.podProvider.GetContainerLogs(ctx, namespace, podName, containerName, opts)
+}
+
 // WaitReady waits for the specified timeout for the controller to be ready.
 //
 // The timeout is for convenience so the caller doesn't have to juggle an extra context.
@@ -126,7 +222,16 @@ func (n *KouplelessNode) Err() error {
 }
 
 func NewKouplelessNode(config *model.BuildKouplelessNodeConfig) (*KouplelessNode, error) {
-	clientSet, err := nodeutil.ClientsetFromEnv(config.KubeConfigPath)
+	restConfig, err := common.NewKubeRestConfig(config.KubeConfigPath, config.InCluster)
+	if err != nil {
+		logrus.Errorf("Error creating kube rest config: %v", err)
+		return nil, errors.Wrap(err, "error creating client set")
+	}
+	if config.WrapKubeTransport != nil {
+		// node create and status update and pod deletion of the node all go through the wrapped transport
+		restConfig.Wrap(config.WrapKubeTransport)
+	}
+	clientSet, err := kubernetes.NewForConfig(restConfig)
 	if err != nil {
 		logrus.Errorf("Error creating client set: %v", err)
 		return nil, errors.Wrap(err, "error creating client set")
@@ -140,53 +245,131 @@ func NewKouplelessNode(config *model.BuildKouplelessNodeConfig) (*KouplelessNode
 		return nil, errors.New("node name cannot be empty")
 	}
 
-	// Set up the pod podProvider.
-	var provider *podlet.BaseProvider
-	var nodeProvider *VirtualKubeletNode
-	cm, err := nodeutil.NewNode(
-		config.NodeID,
-		func(cfg nodeutil.ProviderConfig) (nodeutil.Provider, node.NodeProvider, error) {
-			nodeProvider = NewVirtualKubeletNode(model.BuildVirtualNodeConfig{
-				NodeIP:    config.NodeIP,
-				TechStack: config.TechStack,
-				Version:   config.BizVersion,
-				BizName:   config.BizName,
-			})
-			// initialize node spec on bootstrap
-			provider = podlet.NewBaseProvider(cfg.Node.Namespace, config.NodeIP, config.NodeID, config.MqttClient, clientSet)
+	heartbeatInterval := config.HeartbeatInterval
+	if heartbeatInterval <= 0 {
+		heartbeatInterval = model.DefaultHeartbeatInterval
+	}
 
-			err := nodeProvider.Register(context.Background(), cfg.Node)
-			if err != nil {
-				return nil, nil, err
-			}
-			return provider, nodeProvider, nil
-		},
-		func(cfg *nodeutil.NodeConfig) error {
-			cfg.InformerResyncPeriod = time.Minute
-			cfg.NodeSpec.Status.NodeInfo.Architecture = runtime.GOARCH
-			cfg.NodeSpec.Status.NodeInfo.OperatingSystem = "linux"
-			cfg.DebugHTTP = true
-
-			cfg.NumWorkers = 4
-			return nil
+	heartbeatTimeout := config.HeartbeatTimeout
+	if heartbeatTimeout <= 0 {
+		heartbeatTimeout = model.DefaultHeartbeatTimeout
+	}
+
+	qosCommand := config.QosCommand
+	if qosCommand == 0 {
+		qosCommand = model.DefaultQosCommand
+	}
+
+	nodeName := config.NodeName
+	if nodeName == "" {
+		nodeName = config.NodeID
+	}
+
+	// biz lifecycle events are recorded to pods, shown by kubectl describe pod
+	eventBroadcaster := record.NewBroadcaster()
+	eventBroadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: clientSet.CoreV1().Events("")})
+	eventRecorder := eventBroadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: "module-controller", Host: config.NodeID})
+
+	// pods of the node are listed by the pod controller, the secrets, config maps and services by pod env resolution
+	podInformerFactory := informers.NewSharedInformerFactoryWithOptions(clientSet, time.Minute, nodeutil.PodInformerFilter(nodeName))
+	scmInformerFactory := informers.NewSharedInformerFactory(clientSet, time.Minute)
+
+	nodeProvider := NewVirtualKubeletNode(model.BuildVirtualNodeConfig{
+		NodeIP:    config.NodeIP,
+		TechStack: config.TechStack,
+		Version:   config.BizVersion,
+		BizName:   config.BizName,
+
+		HeartbeatTimeout: heartbeatTimeout,
+		KubeletPort:      config.KubeletPort,
+	})
+	nodeSpec := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: nodeName,
+			Labels: map[string]string{
+				"type":               "virtual-kubelet",
+				"kubernetes.io/role": "agent",
+			},
 		},
-		nodeutil.WithClient(clientSet),
+	}
+	// initialize node spec on bootstrap
+	if err = nodeProvider.Register(context.Background(), nodeSpec); err != nil {
+		eventBroadcaster.Shutdown()
+		return nil, errors.Wrap(err, "error creating provider")
+	}
+
+	// Set up the pod podProvider.
+	provider := podlet.NewBaseProvider(nodeSpec.Namespace, config.NodeIP, config.NodeID, config.MqttClient, clientSet)
+	provider.SetDefaultBizResources(config.DefaultBizResources)
+	provider.SetDefaultBizVersion(config.DefaultBizVersion)
+	provider.SetPublishRetry(config.PublishRetry)
+	provider.SetEventRecorder(eventRecorder)
+	provider.SetDryRun(config.DryRun)
+	provider.SetRejectBizDowngrade(config.RejectBizDowngrade)
+	provider.SetCommandQos(qosCommand)
+	provider.SetCommandTimeout(config.CommandTimeout)
+	provider.SetMaxConcurrentBizOps(config.MaxConcurrentBizOps)
+	provider.SetMetricsRecorder(config.MetricsRecorder)
+
+	pc, err := node.NewPodController(node.PodControllerConfig{
+		PodClient:         clientSet.CoreV1(),
+		EventRecorder:     eventBroadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: path.Join(nodeName, "pod-controller")}),
+		Provider:          provider,
+		PodInformer:       podInformerFactory.Core().V1().Pods(),
+		SecretInformer:    scmInformerFactory.Core().V1().Secrets(),
+		ConfigMapInformer: scmInformerFactory.Core().V1().ConfigMaps(),
+		ServiceInformer:   scmInformerFactory.Core().V1().Services(),
+	})
+	if err != nil {
+		eventBroadcaster.Shutdown()
+		return nil, errors.Wrap(err, "error creating pod controller")
+	}
+
+	nc, err := node.NewNodeController(
+		nodeProvider,
+		nodeSpec,
+		clientSet.CoreV1().Nodes(),
+		nodeLeaseOpt(clientSet, config.NodeLeaseDuration, config.NodeLeaseRenewInterval),
 	)
 	if err != nil {
-		return nil, err
+		eventBroadcaster.Shutdown()
+		return nil, errors.Wrap(err, "error creating node controller")
 	}
 
-	return &KouplelessNode{
-		clientSet:          clientSet,
-		mqttClient:         config.MqttClient,
-		podProvider:        provider,
-		nodeID:             config.NodeID,
-		vnode:              nodeProvider,
-		node:               cm,
-		done:               make(chan struct{}),
+	cm := &nodeControllers{
+		nc:                 nc,
+		pc:                 pc,
+		podInformerFactory: podInformerFactory,
+		scmInformerFactory: scmInformerFactory,
+		workers:            4,
 		ready:              make(chan struct{}),
-		BaseBizExitChan:    make(chan struct{}),
-		BaseBizInfoChan:    make(chan []ark.ArkBizInfo, 5),
-		BaseHealthInfoChan: make(chan ark.HealthData, 5),
+		done:               make(chan struct{}),
+	}
+
+	// node controller fails to create a node already existing, e.g. left by the last run of controller, so the node is
+	// registered before it runs and the existing one is updated to the desired state
+	if _, err = common.RegisterVirtualNode(context.Background(), clientSet.CoreV1().Nodes(), nodeProvider.nodeInfo); err != nil {
+		eventBroadcaster.Shutdown()
+		return nil, errors.Wrap(err, "error registering node")
+	}
+
+	return &KouplelessNode{
+		clientSet:              clientSet,
+		mqttClient:             config.MqttClient,
+		podProvider:            provider,
+		nodeID:                 config.NodeID,
+		heartbeatInterval:      heartbeatInterval,
+		heartbeatJitterPercent: config.HeartbeatJitterPercent,
+		qosHeartbeat:           config.QosHeartbeat,
+		qosCommand:             qosCommand,
+		vnode:                  nodeProvider,
+		node:                   cm,
+		eventBroadcaster:       eventBroadcaster,
+		done:                   make(chan struct{}),
+		ready:                  make(chan struct{}),
+		BaseBizExitChan:        make(chan struct{}),
+		BaseBizInfoChan:        make(chan []ark.ArkBizInfo, 5),
+		BaseHealthInfoChan:     make(chan ark.HealthData, 5),
+		BaseHeartbeatChan:      make(chan model.NodeHeartbeat, 5),
 	}, nil
 }
@@ -16,13 +16,14 @@ package node
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"github.com/koupleless/arkctl/v1/service/ark"
 	"github.com/koupleless/virtual-kubelet/java/common"
 	"github.com/koupleless/virtual-kubelet/java/model"
 	"github.com/virtual-kubelet/virtual-kubelet/log"
 	"github.com/virtual-kubelet/virtual-kubelet/node"
 	corev1 "k8s.io/api/core/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"sync"
 	"time"
 )
@@ -37,12 +38,19 @@ type NodeProvider interface {
 var _ NodeProvider = &VirtualKubeletNode{}
 var modelUtils = common.ModelUtils{}
 
+// ErrBaseHeartbeatLost is returned by Ping once base reported no health data within the heartbeat timeout,
+// so that the node lease is no longer renewed and the node is soon treated unreachable by kubernetes
+var ErrBaseHeartbeatLost = errors.New("base heartbeat lost")
+
 type VirtualKubeletNode struct {
 	sync.Mutex
 	nodeConfig *model.BuildVirtualNodeConfig
 
 	nodeInfo *corev1.Node
 
+	// lastHeartbeat is the time of registration or the latest health data reported by base
+	lastHeartbeat time.Time
+
 	notify func(*corev1.Node)
 }
 
@@ -52,21 +60,10 @@ func (v *VirtualKubeletNode) Notify(data ark.HealthData) {
 	if v.nodeInfo == nil {
 		return
 	}
+	v.lastHeartbeat = time.Now()
 	// node status
-	nodeReadyStatus := corev1.ConditionTrue
-	nodeReadyMessage := ""
 	v.nodeInfo.Status.Phase = corev1.NodeRunning
-	conditions := []corev1.NodeCondition{
-		{
-			Type:   corev1.NodeReady,
-			Status: nodeReadyStatus,
-			LastHeartbeatTime: metav1.Time{
-				Time: time.Now(),
-			},
-			Message: nodeReadyMessage,
-		},
-	}
-	v.nodeInfo.Status.Conditions = conditions
+	v.nodeInfo.Status.Conditions = modelUtils.BuildNodeConditions(corev1.ConditionTrue, time.Now())
 	if data.Jvm.JavaMaxMetaspace != -1 {
 		v.nodeInfo.Status.Capacity[corev1.ResourceMemory] = common.ConvertByteNumToResourceQuantity(data.Jvm.JavaMaxMetaspace)
 	}
@@ -76,6 +73,48 @@ func (v *VirtualKubeletNode) Notify(data ark.HealthData) {
 	v.notify(v.nodeInfo.DeepCopy())
 }
 
+// IsReady returns true if the node is registered and its Ready condition is true
+func (v *VirtualKubeletNode) IsReady() bool {
+	v.Lock()
+	defer v.Unlock()
+	if v.nodeInfo == nil {
+		return false
+	}
+	for _, condition := range v.nodeInfo.Status.Conditions {
+		if condition.Type == corev1.NodeReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// NotifyHeartbeat reflect the node metadata carried by base heartbeat onto node status and notify
+func (v *VirtualKubeletNode) NotifyHeartbeat(heartbeat model.NodeHeartbeat) {
+	v.Lock()
+	defer v.Unlock()
+	if v.nodeInfo == nil {
+		return
+	}
+	now := time.Now()
+	if err := modelUtils.ApplyNodeHeartbeat(v.nodeInfo, &heartbeat, now); err != nil {
+		log.G(context.Background()).WithError(err).WithField("node", v.nodeInfo.Name).Warn("IgnoreInvalidNodeHeartbeat")
+		return
+	}
+	v.lastHeartbeat = now
+	v.notify(v.nodeInfo.DeepCopy())
+}
+
+// NotifyNotReady set the node NotReady and notify, e.g. once the base is unreachable
+func (v *VirtualKubeletNode) NotifyNotReady() {
+	v.Lock()
+	defer v.Unlock()
+	if v.nodeInfo == nil {
+		return
+	}
+	v.nodeInfo.Status.Conditions = modelUtils.BuildNodeConditions(corev1.ConditionFalse, time.Now())
+	v.notify(v.nodeInfo.DeepCopy())
+}
+
 func NewVirtualKubeletNode(config model.BuildVirtualNodeConfig) *VirtualKubeletNode {
 	return &VirtualKubeletNode{
 		nodeConfig: &config,
@@ -90,11 +129,22 @@ func (v *VirtualKubeletNode) Register(_ context.Context, node *corev1.Node) erro
 	modelUtils.BuildVirtualNode(v.nodeConfig, node)
 	v.Lock()
 	v.nodeInfo = node.DeepCopy()
+	v.lastHeartbeat = time.Now()
 	v.Unlock()
 	return nil
 }
 
-func (v *VirtualKubeletNode) Ping(ctx context.Context) error {
+// Ping fails once base heartbeats stopped for longer than the heartbeat timeout, the node lease is renewed only while
+// ping succeeds, its duration and renew interval are set by the NodeLease fields of the node config
+func (v *VirtualKubeletNode) Ping(_ context.Context) error {
+	v.Lock()
+	defer v.Unlock()
+	if v.nodeConfig.HeartbeatTimeout <= 0 || v.lastHeartbeat.IsZero() {
+		return nil
+	}
+	if elapsed := time.Since(v.lastHeartbeat); elapsed > v.nodeConfig.HeartbeatTimeout {
+		return fmt.Errorf("%w: no health data in %s", ErrBaseHeartbeatLost, elapsed.Round(time.Second))
+	}
 	return nil
 }
 
@@ -2,11 +2,17 @@ package node
 
 import (
 	"context"
+	"errors"
 	"github.com/koupleless/arkctl/v1/service/ark"
 	"github.com/koupleless/virtual-kubelet/java/model"
+	"github.com/virtual-kubelet/virtual-kubelet/node"
+	"github.com/virtual-kubelet/virtual-kubelet/node/nodeutil"
 	"gotest.tools/assert"
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
 	"testing"
+	"time"
 )
 
 func TestNewVirtualKubeletNode(t *testing.T) {
@@ -29,7 +35,13 @@ func TestVirtualKubeletNode_Register(t *testing.T) {
 	node := &corev1.Node{}
 	err := vnode.Register(context.Background(), node)
 	assert.NilError(t, err)
-	assert.Assert(t, len(node.Labels) == 3)
+	assert.DeepEqual(t, node.Labels, map[string]string{
+		model.LabelKeyTechStack:  "java",
+		model.LabelKeyBizName:    "test",
+		model.LabelKeyBizVersion: "1.0.0",
+		model.LabelKeyNodeIP:     "127.0.0.1",
+		corev1.LabelOSStable:     "linux",
+	})
 	assert.Assert(t, len(node.Spec.Taints) == 1)
 	assert.Assert(t, node.Status.Phase == corev1.NodePending)
 }
@@ -45,6 +57,27 @@ func TestVirtualKubeletNode_Ping(t *testing.T) {
 	assert.NilError(t, err)
 }
 
+func TestVirtualKubeletNode_PingHeartbeatLost(t *testing.T) {
+	vnode := NewVirtualKubeletNode(model.BuildVirtualNodeConfig{
+		NodeIP:           "127.0.0.1",
+		TechStack:        "java",
+		BizName:          "test",
+		Version:          "1.0.0",
+		HeartbeatTimeout: time.Minute,
+	})
+	node := &corev1.Node{}
+	assert.NilError(t, vnode.Register(context.Background(), node))
+	vnode.NotifyNodeStatus(context.Background(), func(_ *corev1.Node) {})
+	assert.NilError(t, vnode.Ping(context.Background()))
+
+	vnode.lastHeartbeat = time.Now().Add(-2 * time.Minute)
+	err := vnode.Ping(context.Background())
+	assert.Assert(t, errors.Is(err, ErrBaseHeartbeatLost))
+
+	vnode.Notify(ark.HealthData{})
+	assert.NilError(t, vnode.Ping(context.Background()))
+}
+
 func TestVirtualKubeletNode_NotifyNodeStatus(t *testing.T) {
 	vnode := NewVirtualKubeletNode(model.BuildVirtualNodeConfig{
 		NodeIP:    "127.0.0.1",
@@ -65,3 +98,86 @@ func TestVirtualKubeletNode_NotifyNodeStatus(t *testing.T) {
 	vnode.Notify(ark.HealthData{})
 	assert.Assert(t, len(nodeList) == 1)
 }
+
+func TestVirtualKubeletNode_NotifyReady(t *testing.T) {
+	vnode := NewVirtualKubeletNode(model.BuildVirtualNodeConfig{
+		NodeIP:    "127.0.0.1",
+		TechStack: "java",
+		BizName:   "test",
+		Version:   "1.0.0",
+	})
+	node := &corev1.Node{}
+	assert.NilError(t, vnode.Register(context.Background(), node))
+	var notified *corev1.Node
+	vnode.NotifyNodeStatus(context.Background(), func(node *corev1.Node) {
+		notified = node
+	})
+	vnode.Notify(ark.HealthData{})
+	assert.Assert(t, notified.Status.Phase == corev1.NodeRunning)
+	assert.Assert(t, notified.Status.Conditions[0].Type == corev1.NodeReady)
+	assert.Assert(t, notified.Status.Conditions[0].Status == corev1.ConditionTrue)
+	assert.Assert(t, len(notified.Status.Conditions) == 4)
+}
+
+func TestVirtualKubeletNode_NotifyNotReady(t *testing.T) {
+	vnode := NewVirtualKubeletNode(model.BuildVirtualNodeConfig{
+		NodeIP:    "127.0.0.1",
+		TechStack: "java",
+		BizName:   "test",
+		Version:   "1.0.0",
+	})
+	node := &corev1.Node{}
+	assert.NilError(t, vnode.Register(context.Background(), node))
+	var notified *corev1.Node
+	vnode.NotifyNodeStatus(context.Background(), func(node *corev1.Node) {
+		notified = node
+	})
+	vnode.Notify(ark.HealthData{})
+	vnode.NotifyNotReady()
+	assert.Assert(t, notified.Status.Conditions[0].Type == corev1.NodeReady)
+	assert.Assert(t, notified.Status.Conditions[0].Status == corev1.ConditionFalse)
+}
+
+func TestVirtualKubeletNode_IsReady(t *testing.T) {
+	vnode := NewVirtualKubeletNode(model.BuildVirtualNodeConfig{
+		NodeIP:    "127.0.0.1",
+		TechStack: "java",
+		BizName:   "test",
+		Version:   "1.0.0",
+	})
+	assert.Assert(t, !vnode.IsReady())
+	assert.NilError(t, vnode.Register(context.Background(), &corev1.Node{}))
+	vnode.NotifyNodeStatus(context.Background(), func(_ *corev1.Node) {})
+	vnode.Notify(ark.HealthData{})
+	assert.Assert(t, vnode.IsReady())
+	vnode.NotifyNotReady()
+	assert.Assert(t, !vnode.IsReady())
+}
+
+func TestNodeLeaseOpt(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	clientSet := fake.NewSimpleClientset()
+	vnode := NewVirtualKubeletNode(model.BuildVirtualNodeConfig{
+		NodeIP:    "127.0.0.1",
+		TechStack: "java",
+		BizName:   "test",
+		Version:   "1.0.0",
+	})
+	nodeSpec := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "test-node"}}
+	assert.NilError(t, vnode.Register(ctx, nodeSpec))
+	nc, err := node.NewNodeController(vnode, nodeSpec, clientSet.CoreV1().Nodes(), nodeLeaseOpt(clientSet, 5*time.Second, time.Second))
+	assert.NilError(t, err)
+	go nc.Run(ctx) //nolint:errcheck
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		lease, err := nodeutil.NodeLeaseV1Client(clientSet).Get(ctx, "test-node", metav1.GetOptions{})
+		if err == nil {
+			assert.Equal(t, *lease.Spec.LeaseDurationSeconds, int32(5))
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("node lease not created")
+}
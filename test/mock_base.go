@@ -56,8 +56,13 @@ func (bm *BaseMock) Exit() {
 	}
 }
 
+func (bm *BaseMock) baseTopic(topicType string) string {
+	topic, _ := mqtt.DefaultTopicBuilder.NodeBaseTopic(bm.deviceID, topicType)
+	return topic
+}
+
 func (bm *BaseMock) Run() {
-	commandTopic := fmt.Sprintf("koupleless/%s/+", bm.deviceID)
+	commandTopic := fmt.Sprintf("%s/%s/+", mqtt.DefaultTopicPrefix, bm.deviceID)
 	bm.mqttClient.Sub(commandTopic, 1, bm.commandCallback)
 	defer bm.mqttClient.UnSub(commandTopic)
 	go func() {
@@ -68,7 +73,7 @@ func (bm *BaseMock) Run() {
 				return
 			case <-ticker.C:
 				masterInfoBytes, _ := json.Marshal(bm.healthData.MasterBizInfo)
-				bm.mqttClient.Pub(fmt.Sprintf("koupleless/%s/base/heart", bm.deviceID), 0, masterInfoBytes)
+				bm.mqttClient.Pub(bm.baseTopic(mqtt.TopicTypeHeartBeat), 0, masterInfoBytes)
 			}
 		}
 	}()
@@ -90,7 +95,7 @@ func (bm *BaseMock) commandCallback(client paho.Client, msg paho.Message) {
 				Message: "",
 			},
 		})
-		bm.mqttClient.Pub(fmt.Sprintf("koupleless/%s/base/health", bm.deviceID), 0, healthBytes)
+		bm.mqttClient.Pub(bm.baseTopic(mqtt.TopicTypeHealth), 0, healthBytes)
 	case model.CommandQueryAllBiz:
 		bizBytes, _ := json.Marshal(ark.QueryAllArkBizResponse{
 			GenericArkResponseBase: ark.GenericArkResponseBase[[]ark.ArkBizInfo]{
@@ -99,7 +104,7 @@ func (bm *BaseMock) commandCallback(client paho.Client, msg paho.Message) {
 				Message: "",
 			},
 		})
-		bm.mqttClient.Pub(fmt.Sprintf("koupleless/%s/base/biz", bm.deviceID), 0, bizBytes)
+		bm.mqttClient.Pub(bm.baseTopic(mqtt.TopicTypeBiz), 0, bizBytes)
 	case model.CommandInstallBiz:
 		var data ark.BizModel
 		json.Unmarshal(msg.Payload(), &data)
@@ -135,7 +140,7 @@ func (bm *BaseMock) commandCallback(client paho.Client, msg paho.Message) {
 				Data: bm.bizInfos,
 			},
 		})
-		bm.mqttClient.Pub(fmt.Sprintf("koupleless/%s/base/biz", bm.deviceID), 0, bizBytes)
+		bm.mqttClient.Pub(bm.baseTopic(mqtt.TopicTypeBiz), 0, bizBytes)
 	case model.CommandUnInstallBiz:
 		var data ark.BizModel
 		json.Unmarshal(msg.Payload(), &data)
@@ -158,6 +163,6 @@ func (bm *BaseMock) commandCallback(client paho.Client, msg paho.Message) {
 				Data: bm.bizInfos,
 			},
 		})
-		bm.mqttClient.Pub(fmt.Sprintf("koupleless/%s/base/biz", bm.deviceID), 0, bizBytes)
+		bm.mqttClient.Pub(bm.baseTopic(mqtt.TopicTypeBiz), 0, bizBytes)
 	}
 }
@@ -33,6 +33,7 @@ import (
 	"os"
 	"path"
 	"testing"
+	"time"
 )
 
 const (
@@ -72,7 +73,7 @@ var _ = BeforeSuite(func() {
 	})
 	Expect(err).NotTo(HaveOccurred())
 	// start mc
-	registerController, err := controller.NewBaseRegisterController(model.BuildBaseRegisterControllerConfig{MqttConfig: mqtt.ClientConfig{
+	registerController, err := controller.NewBaseRegisterController(&model.BuildBaseRegisterControllerConfig{MqttConfig: &mqtt.ClientConfig{
 		Broker:    "broker.emqx.io",
 		Port:      1883,
 		ClientID:  "mc-server-mqtt-client",
@@ -84,11 +85,13 @@ var _ = BeforeSuite(func() {
 	Expect(registerController).NotTo(BeNil())
 
 	go registerController.Run(mainContext)
+	Eventually(registerController.Ready(), time.Minute).Should(BeClosed())
 })
 
 var _ = AfterSuite(func() {
 	By("shutting down test environment")
 	mainCancel()
+	baseMqttClient.Disconnect(250)
 })
 
 func getPodFromYamlFile(filePath string) (*corev1.Pod, error) {